@@ -1,19 +1,373 @@
 package main
 
 import (
-	"github.com/gin-gonic/gin"
-	handlers "github.com/weeweeshka/hot-coffee/internal/transport/handler"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/weeweeshka/hot-coffee/internal/auth"
+	"github.com/weeweeshka/hot-coffee/internal/gateway"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"github.com/weeweeshka/hot-coffee/internal/money"
+	"github.com/weeweeshka/hot-coffee/internal/notifier"
+	"github.com/weeweeshka/hot-coffee/internal/repository/jsonfile"
+	"github.com/weeweeshka/hot-coffee/internal/repository/memory"
+	"github.com/weeweeshka/hot-coffee/internal/repository/postgres"
+	"github.com/weeweeshka/hot-coffee/internal/service"
+	"github.com/weeweeshka/hot-coffee/internal/transport/handler"
+	"github.com/weeweeshka/hot-coffee/internal/transport/router"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 )
 
+// repository is everything the services store. The postgres, JSON file and
+// in-memory storages all implement it; postgres is also a
+// handler.StorageMonitor.
+type repository interface {
+	service.OrderRepo
+	service.MenuRepo
+	service.InventoryRepo
+	service.CustomerRepo
+	service.LoyaltyRepo
+	service.PromotionRepo
+	service.PaymentRepo
+	service.RefundRepo
+	service.ReportRepo
+	service.ShiftRepo
+	service.StaffRepo
+	service.AuditRepo
+}
+
 func main() {
-	router := gin.Default()
-	groupOrder := router.Group("/orders")
-	{
-		groupOrder.POST("/", handlers.CreateOrder)
-		groupOrder.GET("/")
-		groupOrder.GET("/{id}")
-		groupOrder.PUT("/{id}")
-		groupOrder.DELETE("/{id}")
-		groupOrder.POST("/{id}/close")
+	logr := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	if err := run(logr); err != nil {
+		logr.Error("hot-coffee stopped", "err", err)
+		os.Exit(1)
+	}
+}
+
+func run(logr *slog.Logger) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	repo, err := openStorage(ctx, logr)
+	if err != nil {
+		return err
+	}
+	if closer, ok := repo.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	tokens, err := auth.NewSigner([]byte(os.Getenv("AUTH_SECRET")), 12*time.Hour)
+	if err != nil {
+		return err
+	}
+
+	rule, err := loyaltyRule()
+	if err != nil {
+		return err
+	}
+	pricing, err := pricingRules()
+	if err != nil {
+		return err
+	}
+
+	cards, err := paymentGateway(logr)
+	if err != nil {
+		return err
+	}
+	alerts, err := stockNotifier(logr)
+	if err != nil {
+		return err
+	}
+	monitor := service.NewStockMonitor(logr, repo, alerts, 64)
+	go monitor.Run(ctx)
+
+	audit := service.NewAuditService(logr, repo)
+	inventory := service.NewInventoryService(logr, repo, audit)
+	menu := service.NewMenuService(logr, repo, repo, audit)
+	staff := service.NewStaffService(logr, repo, tokens)
+	promotions := service.NewPromotionService(logr, repo)
+	loyalty := service.NewLoyaltyService(logr, repo, repo, rule)
+	orders := service.NewOrderService(repo, repo, repo, logr,
+		service.WithConsumptionObserver(monitor),
+		service.WithCustomers(repo),
+		service.WithLoyalty(loyalty),
+		service.WithPromotions(promotions),
+		service.WithPricing(pricing),
+		service.WithPayments(repo),
+		service.WithAudit(audit),
+	)
+	customers := service.NewCustomerService(logr, repo, orders)
+	payments := service.NewPaymentService(logr, repo, orders, cards)
+	refunds := service.NewRefundService(logr, repo, orders, repo, repo, cards)
+	shifts := service.NewShiftService(logr, repo)
+	reports := service.NewReportService(logr, repo, service.WithTipPooling(models.PoolEqual))
+
+	if username := os.Getenv("ADMIN_USERNAME"); username != "" {
+		if err = staff.EnsureAdmin(ctx, username, os.Getenv("ADMIN_PASSWORD")); err != nil {
+			return err
+		}
+	}
+
+	database, _ := repo.(handler.StorageMonitor)
+	engine := router.New(router.Handlers{
+		Health:     handler.NewHealthHandler(database, logr),
+		Auth:       handler.NewAuthHandler(staff, logr),
+		Staff:      handler.NewStaffHandler(staff, logr),
+		Audit:      handler.NewAuditHandler(audit, logr),
+		Orders:     handler.NewOrderHandler(orders, logr),
+		Menus:      handler.NewMenuHandler(menu, logr),
+		Inventory:  handler.NewInventoryHandler(inventory, logr),
+		Reports:    handler.NewReportHandler(reports, logr),
+		Customers:  handler.NewCustomerHandler(customers, logr),
+		Loyalty:    handler.NewLoyaltyHandler(loyalty, logr),
+		Promotions: handler.NewPromotionHandler(promotions, logr),
+		Payments:   handler.NewPaymentHandler(payments, logr),
+		Refunds:    handler.NewRefundHandler(refunds, logr),
+		Shifts:     handler.NewShiftHandler(shifts, logr),
+	})
+
+	server := &http.Server{Addr: addr(), Handler: engine}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	logr.Info("listening", "addr", server.Addr)
+	if err = server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// openStorage picks the storage named by STORAGE: postgres, the default, at
+// DATABASE_URL, file, which keeps JSON files in DATA_DIR, or memory, which
+// keeps nothing across restarts.
+func openStorage(ctx context.Context, logr *slog.Logger) (repository, error) {
+	switch kind := os.Getenv("STORAGE"); kind {
+	case "", "postgres":
+		cfg, err := postgresConfig()
+		if err != nil {
+			return nil, err
+		}
+		return postgres.NewStorage(ctx, logr, cfg)
+	case "file":
+		dir := os.Getenv("DATA_DIR")
+		if dir == "" {
+			dir = "data"
+		}
+		return jsonfile.NewStorage(logr, dir)
+	case "memory":
+		return memory.NewStorage(logr), nil
+	default:
+		return nil, fmt.Errorf("unknown storage %q, want postgres, file or memory", kind)
+	}
+}
+
+// postgresConfig reads the pool settings DB_MAX_CONNS, DB_MIN_CONNS,
+// DB_HEALTH_CHECK_PERIOD, DB_CONNECT_ATTEMPTS and DB_STATEMENT_TIMEOUT, all
+// optional.
+func postgresConfig() (postgres.Config, error) {
+	cfg := postgres.Config{URL: os.Getenv("DATABASE_URL")}
+	var maxConns, minConns, attempts int
+	for _, env := range []struct {
+		name  string
+		value *int
+	}{
+		{"DB_MAX_CONNS", &maxConns},
+		{"DB_MIN_CONNS", &minConns},
+		{"DB_CONNECT_ATTEMPTS", &attempts},
+	} {
+		raw := os.Getenv(env.name)
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 || n > math.MaxInt32 {
+			return cfg, fmt.Errorf("invalid %s %q, want a positive integer", env.name, raw)
+		}
+		*env.value = n
+	}
+	cfg.MaxConns, cfg.MinConns, cfg.ConnectAttempts = int32(maxConns), int32(minConns), attempts
+
+	for _, env := range []struct {
+		name  string
+		value *time.Duration
+	}{
+		{"DB_HEALTH_CHECK_PERIOD", &cfg.HealthCheckPeriod},
+		{"DB_STATEMENT_TIMEOUT", &cfg.StatementTimeout},
+	} {
+		raw := os.Getenv(env.name)
+		if raw == "" {
+			continue
+		}
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			return cfg, fmt.Errorf("invalid %s %q, want a positive duration such as 5s", env.name, raw)
+		}
+		*env.value = d
+	}
+	return cfg, nil
+}
+
+// pricingRules reads the pricing rules from the JSON file PRICING_FILE, if
+// set, and then from DEFAULT_TAX_RATE, TAX_RATES, PRICE_ROUNDING and
+// CASH_INCREMENT, which override the file. TAX_RATES lists category=rate
+// pairs separated by commas, such as "food=5,coffee=8.25". Rules that do not
+// validate stop the server from starting.
+func pricingRules() (models.PricingRules, error) {
+	var rules models.PricingRules
+	if path := os.Getenv("PRICING_FILE"); path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			return rules, fmt.Errorf("cannot read PRICING_FILE: %w", err)
+		}
+		defer file.Close()
+		decoder := json.NewDecoder(file)
+		decoder.DisallowUnknownFields()
+		if err = decoder.Decode(&rules); err != nil {
+			return rules, fmt.Errorf("cannot parse PRICING_FILE %s: %w", path, err)
+		}
+	}
+
+	if raw := os.Getenv("DEFAULT_TAX_RATE"); raw != "" {
+		rate, err := money.ParseRate(raw)
+		if err != nil {
+			return rules, fmt.Errorf("invalid DEFAULT_TAX_RATE: %w", err)
+		}
+		rules.DefaultTaxRate = rate
+	}
+	if raw := os.Getenv("TAX_RATES"); raw != "" {
+		rules.TaxRates = make(map[string]money.Rate)
+		for _, pair := range strings.Split(raw, ",") {
+			category, value, ok := strings.Cut(pair, "=")
+			category = strings.TrimSpace(category)
+			if !ok || category == "" {
+				return rules, fmt.Errorf("invalid TAX_RATES entry %q, want category=rate", pair)
+			}
+			rate, err := money.ParseRate(value)
+			if err != nil {
+				return rules, fmt.Errorf("invalid TAX_RATES rate of %q: %w", category, err)
+			}
+			rules.TaxRates[category] = rate
+		}
+	}
+	if raw := os.Getenv("PRICE_ROUNDING"); raw != "" {
+		rules.Rounding = money.RoundingMode(raw)
+	}
+	if raw := os.Getenv("CASH_INCREMENT"); raw != "" {
+		increment, err := money.Parse(raw)
+		if err != nil {
+			return rules, fmt.Errorf("invalid CASH_INCREMENT: %w", err)
+		}
+		rules.CashIncrement = increment
+	}
+
+	if err := rules.Validate(); err != nil {
+		return rules, fmt.Errorf("invalid pricing rules: %w", err)
+	}
+	return rules, nil
+}
+
+// loyaltyRule reads the loyalty rule from the JSON file LOYALTY_FILE, if set,
+// and then from LOYALTY_MODE, LOYALTY_POINTS_PER_UNIT,
+// LOYALTY_FREE_ITEM_POINTS and LOYALTY_POINT_VALUE, which override the file.
+// Without either, a point is earned per unit of currency and points cannot be
+// redeemed. A rule that does not validate stops the server from starting.
+func loyaltyRule() (models.LoyaltyRule, error) {
+	rule := models.LoyaltyRule{Mode: models.EarnPerCurrency, PointsPerUnit: 1}
+	if path := os.Getenv("LOYALTY_FILE"); path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			return rule, fmt.Errorf("cannot read LOYALTY_FILE: %w", err)
+		}
+		defer file.Close()
+		decoder := json.NewDecoder(file)
+		decoder.DisallowUnknownFields()
+		if err = decoder.Decode(&rule); err != nil {
+			return rule, fmt.Errorf("cannot parse LOYALTY_FILE %s: %w", path, err)
+		}
+	}
+
+	if raw := os.Getenv("LOYALTY_MODE"); raw != "" {
+		rule.Mode = models.LoyaltyEarnMode(raw)
+	}
+	if raw := os.Getenv("LOYALTY_POINTS_PER_UNIT"); raw != "" {
+		points, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return rule, fmt.Errorf("invalid LOYALTY_POINTS_PER_UNIT: %w", err)
+		}
+		rule.PointsPerUnit = points
+	}
+	if raw := os.Getenv("LOYALTY_FREE_ITEM_POINTS"); raw != "" {
+		points, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return rule, fmt.Errorf("invalid LOYALTY_FREE_ITEM_POINTS: %w", err)
+		}
+		rule.FreeItemPoints = points
+	}
+	if raw := os.Getenv("LOYALTY_POINT_VALUE"); raw != "" {
+		value, err := money.Parse(raw)
+		if err != nil {
+			return rule, fmt.Errorf("invalid LOYALTY_POINT_VALUE: %w", err)
+		}
+		rule.PointValue = value
+	}
+
+	if err := rule.Validate(); err != nil {
+		return rule, fmt.Errorf("invalid loyalty rule: %w", err)
+	}
+	return rule, nil
+}
+
+// paymentGateway picks the card gateway named by PAYMENT_GATEWAY. none, the
+// default, takes cash only. fake approves cards without charging them, so it
+// is refused unless ALLOW_FAKE_GATEWAY=1 marks a development or test run.
+func paymentGateway(logr *slog.Logger) (service.PaymentGateway, error) {
+	switch kind := os.Getenv("PAYMENT_GATEWAY"); kind {
+	case "", "none":
+		logr.Info("card payments are disabled")
+		return nil, nil
+	case "fake":
+		if os.Getenv("ALLOW_FAKE_GATEWAY") != "1" {
+			return nil, fmt.Errorf("PAYMENT_GATEWAY=fake charges no cards, set ALLOW_FAKE_GATEWAY=1 to use it in development")
+		}
+		logr.Warn("card payments go to the fake gateway, no card is charged")
+		return gateway.NewFakeGateway(), nil
+	default:
+		return nil, fmt.Errorf("unknown PAYMENT_GATEWAY %q, want none or fake", kind)
+	}
+}
+
+// stockNotifier posts low-stock alerts to STOCK_WEBHOOK_URL when it is set
+// and logs them otherwise.
+func stockNotifier(logr *slog.Logger) (service.Notifier, error) {
+	raw := os.Getenv("STOCK_WEBHOOK_URL")
+	if raw == "" {
+		return notifier.NewLogNotifier(logr), nil
+	}
+	u, err := url.ParseRequestURI(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid STOCK_WEBHOOK_URL %q, want an http or https URL", raw)
+	}
+	logr.Info("stock alerts go to a webhook", "host", u.Host)
+	return notifier.NewWebhookNotifier(raw, nil), nil
+}
+
+func addr() string {
+	if addr := os.Getenv("ADDR"); addr != "" {
+		return addr
 	}
+	return ":8080"
 }
@@ -0,0 +1,103 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"reflect"
+)
+
+type contextKey int
+
+const (
+	actorKey contextKey = iota
+	requestIDKey
+)
+
+// System is the actor of changes made outside any request.
+var System = models.AuditActor{Username: "system"}
+
+func WithActor(ctx context.Context, actor models.AuditActor) context.Context {
+	return context.WithValue(ctx, actorKey, actor)
+}
+
+// Actor is who the context acts for, System when nobody.
+func Actor(ctx context.Context) models.AuditActor {
+	if actor, ok := ctx.Value(actorKey).(models.AuditActor); ok {
+		return actor
+	}
+	return System
+}
+
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// Change is the value of a field before and after a change.
+type Change struct {
+	Before any `json:"before"`
+	After  any `json:"after"`
+}
+
+// Diff compares the JSON forms of before and after field by field and
+// returns the fields that differ. Either may be nil, for an entity that is
+// being created or deleted. Values that are not JSON objects are compared
+// whole, under the "value" field.
+func Diff(before, after any) (json.RawMessage, error) {
+	old, err := decode(before)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := decode(after)
+	if err != nil {
+		return nil, err
+	}
+
+	oldFields, oldOK := old.(map[string]any)
+	newFields, newOK := updated.(map[string]any)
+	if (!oldOK && old != nil) || (!newOK && updated != nil) {
+		if reflect.DeepEqual(old, updated) {
+			return json.Marshal(map[string]Change{})
+		}
+		return json.Marshal(map[string]Change{"value": {Before: old, After: updated}})
+	}
+
+	changes := make(map[string]Change)
+	for field, value := range oldFields {
+		if next, ok := newFields[field]; !ok || !reflect.DeepEqual(value, next) {
+			changes[field] = Change{Before: value, After: newFields[field]}
+		}
+	}
+	for field, value := range newFields {
+		if _, ok := oldFields[field]; !ok {
+			changes[field] = Change{After: value}
+		}
+	}
+	return json.Marshal(changes)
+}
+
+// decode turns v into what encoding/json decodes its JSON form to, keeping
+// numbers exact.
+func decode(v any) (any, error) {
+	if v == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode audit value: %w", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var decoded any
+	if err = decoder.Decode(&decoded); err != nil {
+		return nil, fmt.Errorf("cannot decode audit value: %w", err)
+	}
+	return decoded, nil
+}
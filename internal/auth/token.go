@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"strings"
+	"time"
+)
+
+const minSecretSize = 32
+
+// Signer issues and checks bearer tokens: the claims as base64url JSON and
+// their HMAC-SHA256, joined by a dot.
+type Signer struct {
+	secret []byte
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+func NewSigner(secret []byte, ttl time.Duration) (*Signer, error) {
+	if len(secret) < minSecretSize {
+		return nil, fmt.Errorf("token secret must be at least %d bytes", minSecretSize)
+	}
+	if ttl <= 0 {
+		return nil, errors.New("token lifetime must be positive")
+	}
+	return &Signer{secret: secret, ttl: ttl, now: time.Now}, nil
+}
+
+// Sign issues a token for the staff member that expires after the signer's
+// lifetime.
+func (s *Signer) Sign(staff models.Staff) (string, models.Claims, error) {
+	now := s.now().UTC().Truncate(time.Second)
+	claims := models.Claims{StaffID: staff.ID, Role: staff.Role, IssuedAt: now, ExpiresAt: now.Add(s.ttl)}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", models.Claims{}, fmt.Errorf("cannot encode claims: %w", err)
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + s.sign(encoded), claims, nil
+}
+
+// Verify checks the token's signature and expiry and returns its claims. Any
+// failure is models.ErrUnauthorized.
+func (s *Signer) Verify(token string) (models.Claims, error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(s.sign(encoded))) {
+		return models.Claims{}, fmt.Errorf("%w: bad token signature", models.ErrUnauthorized)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return models.Claims{}, fmt.Errorf("%w: malformed token", models.ErrUnauthorized)
+	}
+	var claims models.Claims
+	if err = json.Unmarshal(payload, &claims); err != nil {
+		return models.Claims{}, fmt.Errorf("%w: malformed token", models.ErrUnauthorized)
+	}
+
+	if !s.now().Before(claims.ExpiresAt) {
+		return models.Claims{}, fmt.Errorf("%w: token expired", models.ErrUnauthorized)
+	}
+	return claims, nil
+}
+
+func (s *Signer) sign(encoded string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
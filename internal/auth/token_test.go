@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"encoding/base64"
+	"errors"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+var secret = []byte("0123456789abcdef0123456789abcdef")
+
+// newTestSigner returns a signer whose clock reads *now.
+func newTestSigner(t *testing.T, secret []byte, now *time.Time) *Signer {
+	t.Helper()
+	s, err := NewSigner(secret, time.Hour)
+	if err != nil {
+		t.Fatalf("NewSigner: %v", err)
+	}
+	s.now = func() time.Time { return *now }
+	return s
+}
+
+func TestNewSigner(t *testing.T) {
+	for _, tc := range []struct {
+		secret []byte
+		ttl    time.Duration
+		ok     bool
+	}{
+		{secret, time.Hour, true},
+		{secret[:31], time.Hour, false},
+		{nil, time.Hour, false},
+		{secret, 0, false},
+		{secret, -time.Minute, false},
+	} {
+		if _, err := NewSigner(tc.secret, tc.ttl); (err == nil) != tc.ok {
+			t.Errorf("NewSigner(%d bytes, %s) err = %v, want ok %t", len(tc.secret), tc.ttl, err, tc.ok)
+		}
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	now := time.Date(2026, 3, 1, 9, 30, 15, 500, time.UTC)
+	s := newTestSigner(t, secret, &now)
+	staff := models.Staff{ID: 7, Username: "ann", Role: models.RoleShiftLead}
+
+	token, claims, err := s.Sign(staff)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	want := models.Claims{
+		StaffID:   7,
+		Role:      models.RoleShiftLead,
+		IssuedAt:  now.Truncate(time.Second),
+		ExpiresAt: now.Truncate(time.Second).Add(time.Hour),
+	}
+	if claims != want {
+		t.Errorf("Sign claims = %+v, want %+v", claims, want)
+	}
+
+	for _, tc := range []struct {
+		name string
+		at   time.Time
+		ok   bool
+	}{
+		{"at issue", now, true},
+		{"just before expiry", want.ExpiresAt.Add(-time.Nanosecond), true},
+		{"at expiry", want.ExpiresAt, false},
+		{"after expiry", want.ExpiresAt.Add(time.Minute), false},
+	} {
+		now = tc.at
+		got, err := s.Verify(token)
+		switch {
+		case tc.ok && (err != nil || !got.ExpiresAt.Equal(want.ExpiresAt) || got.StaffID != want.StaffID || got.Role != want.Role):
+			t.Errorf("Verify %s = %+v, %v; want %+v", tc.name, got, err, want)
+		case !tc.ok && !errors.Is(err, models.ErrUnauthorized):
+			t.Errorf("Verify %s err = %v, want ErrUnauthorized", tc.name, err)
+		}
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	now := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	s := newTestSigner(t, secret, &now)
+	token, _, err := s.Sign(models.Staff{ID: 7, Role: models.RoleBarista})
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	payload, signature, _ := strings.Cut(token, ".")
+
+	other := newTestSigner(t, []byte("fedcba9876543210fedcba9876543210"), &now)
+	forged, _, err := other.Sign(models.Staff{ID: 7, Role: models.RoleAdmin})
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+
+	promoted := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":7,"role":"admin","iat":"2026-03-01T09:00:00Z","exp":"2026-03-01T10:00:00Z"}`))
+	notBase64 := "!!!"
+	notJSON := base64.RawURLEncoding.EncodeToString([]byte("not json"))
+
+	for _, tc := range []struct {
+		name  string
+		token string
+	}{
+		{"empty", ""},
+		{"no signature", payload},
+		{"empty signature", payload + "."},
+		{"other secret", forged},
+		{"changed claims", promoted + "." + signature},
+		{"truncated signature", payload + "." + signature[:len(signature)-1]},
+		{"signed garbage", notBase64 + "." + s.sign(notBase64)},
+		{"signed non-JSON", notJSON + "." + s.sign(notJSON)},
+	} {
+		if claims, err := s.Verify(tc.token); !errors.Is(err, models.ErrUnauthorized) {
+			t.Errorf("Verify %s = %+v, %v; want ErrUnauthorized", tc.name, claims, err)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"github.com/weeweeshka/hot-coffee/internal/money"
+	"sync"
+)
+
+// FakeGateway is a local stand-in for a card processor. It approves every
+// charge except those made with a declined token and keeps charges in
+// memory, so it is only fit for tests and local runs.
+type FakeGateway struct {
+	mu       sync.Mutex
+	next     int64
+	declined map[string]bool
+	// charges holds what is left to refund of each charge.
+	charges map[string]money.Amount
+}
+
+func NewFakeGateway(declinedTokens ...string) *FakeGateway {
+	declined := make(map[string]bool, len(declinedTokens))
+	for _, token := range declinedTokens {
+		declined[token] = true
+	}
+	return &FakeGateway{declined: declined, charges: make(map[string]money.Amount)}
+}
+
+func (g *FakeGateway) Charge(ctx context.Context, charge models.CardCharge) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if charge.Amount <= 0 {
+		return "", fmt.Errorf("%w: charge must be positive", models.ErrInvalidPayment)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.declined[charge.Token] {
+		return "", fmt.Errorf("%w: card %s", models.ErrPaymentDeclined, charge.Token)
+	}
+	g.next++
+	reference := fmt.Sprintf("fake_%d", g.next)
+	g.charges[reference] = charge.Amount
+	return reference, nil
+}
+
+func (g *FakeGateway) Refund(ctx context.Context, reference string, amount money.Amount) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	left, ok := g.charges[reference]
+	if !ok {
+		return fmt.Errorf("unknown charge %q", reference)
+	}
+	if amount <= 0 || amount > left {
+		return fmt.Errorf("cannot refund %s of charge %q, %s left", amount, reference, left)
+	}
+	g.charges[reference] = left - amount
+	return nil
+}
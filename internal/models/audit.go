@@ -0,0 +1,63 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var ErrInvalidAuditFilter = errors.New("invalid audit filter")
+
+type AuditAction string
+
+const (
+	AuditCreate AuditAction = "create"
+	AuditUpdate AuditAction = "update"
+	AuditDelete AuditAction = "delete"
+	AuditClose  AuditAction = "close"
+	AuditCancel AuditAction = "cancel"
+	// AuditMovement is a stock movement recorded against an inventory item.
+	AuditMovement AuditAction = "movement"
+)
+
+type AuditEntity string
+
+const (
+	EntityOrder     AuditEntity = "order"
+	EntityMenu      AuditEntity = "menu"
+	EntityInventory AuditEntity = "inventory"
+)
+
+// AuditActor is who made a change. Changes made outside a request, such as
+// at startup, have no staff ID and are made by "system".
+type AuditActor struct {
+	StaffID  *int64 `json:"staff_id,omitempty"`
+	Username string `json:"username"`
+}
+
+// AuditEntry records one change. Diff maps each field that changed to its
+// value before and after, where a created entity has no before and a
+// deleted one no after.
+type AuditEntry struct {
+	ID         int64           `json:"id"`
+	Actor      AuditActor      `json:"actor"`
+	Action     AuditAction     `json:"action"`
+	EntityType AuditEntity     `json:"entity_type"`
+	EntityID   int64           `json:"entity_id"`
+	Diff       json.RawMessage `json:"diff"`
+	RequestID  string          `json:"request_id,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// AuditFilter narrows the audit log down; zero fields match everything.
+// From and To bound the time as [From, To).
+type AuditFilter struct {
+	StaffID    int64
+	Action     AuditAction
+	EntityType AuditEntity
+	EntityID   int64
+	RequestID  string
+	From       time.Time
+	To         time.Time
+	Limit      int
+}
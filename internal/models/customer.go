@@ -0,0 +1,30 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrInvalidCustomer   = errors.New("invalid customer")
+	ErrDuplicateCustomer = errors.New("customer with this phone or email already exists")
+)
+
+type Customer struct {
+	ID        int64     `json:"customer_id"`
+	Name      string    `json:"name"`
+	Phone     string    `json:"phone,omitempty"`
+	Email     string    `json:"email,omitempty"`
+	Notes     string    `json:"notes,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// FavoriteOrder is an order a customer saved to repeat later, modifiers
+// included.
+type FavoriteOrder struct {
+	ID         int64       `json:"favorite_id"`
+	CustomerID int64       `json:"customer_id"`
+	Name       string      `json:"name"`
+	Items      []OrderItem `json:"items"`
+	CreatedAt  time.Time   `json:"created_at"`
+}
@@ -0,0 +1,16 @@
+package models
+
+// StorageStats describes the database connection pool for monitoring.
+// AcquireCount and the counts after it are totals since startup.
+type StorageStats struct {
+	MaxConns             int32  `json:"max_conns"`
+	TotalConns           int32  `json:"total_conns"`
+	IdleConns            int32  `json:"idle_conns"`
+	AcquiredConns        int32  `json:"acquired_conns"`
+	ConstructingConns    int32  `json:"constructing_conns"`
+	AcquireCount         int64  `json:"acquire_count"`
+	AcquireDuration      string `json:"acquire_duration"`
+	EmptyAcquireCount    int64  `json:"empty_acquire_count"`
+	CanceledAcquireCount int64  `json:"canceled_acquire_count"`
+	NewConnsCount        int64  `json:"new_conns_count"`
+}
@@ -1,8 +1,138 @@
 package models
 
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInsufficientIngredients = errors.New("insufficient ingredients")
+	ErrInvalidMovement         = errors.New("invalid inventory movement")
+	ErrInvalidInventory        = errors.New("invalid inventory item")
+	ErrDuplicateInventory      = errors.New("ingredient already exists")
+)
+
+type InventoryReason string
+
+const (
+	ReasonRestock          InventoryReason = "restock"
+	ReasonOrderConsumption InventoryReason = "order_consumption"
+	ReasonOrderReversal    InventoryReason = "order_reversal"
+	ReasonWaste            InventoryReason = "waste"
+	ReasonAdjustment       InventoryReason = "adjustment"
+	ReasonCountCorrection  InventoryReason = "count_correction"
+)
+
+// InventoryTransaction is one entry of the append-only stock ledger. The
+// quantity of an inventory item always equals the sum of its deltas.
+type InventoryTransaction struct {
+	ID           int64           `json:"id"`
+	IngredientID int64           `json:"ingredient_id"`
+	Delta        float64         `json:"delta"`
+	Reason       InventoryReason `json:"reason"`
+	OrderID      *int64          `json:"order_id,omitempty"`
+	Actor        string          `json:"actor,omitempty"`
+	Note         string          `json:"note,omitempty"`
+	CreatedAt    time.Time       `json:"created_at"`
+}
+
+// InventoryMovementRequest is a movement booked by hand. Actor is the
+// authenticated staff member and is never read from the request body.
+type InventoryMovementRequest struct {
+	Delta  float64         `json:"delta"`
+	Reason InventoryReason `json:"reason"`
+	Actor  string          `json:"-"`
+	Note   string          `json:"note"`
+}
+
 type InventoryItem struct {
 	IngredientID int64   `json:"ingredient_id"`
 	Name         string  `json:"name"`
 	Quantity     float64 `json:"quantity"`
 	Unit         string  `json:"unit"`
+	ReorderLevel float64 `json:"reorder_level"`
+	TargetLevel  float64 `json:"target_level"`
+	// Density in grams per milliliter lets recipes measured by volume draw
+	// down stock kept by mass and the other way round. Zero means unknown.
+	Density float64 `json:"density,omitempty"`
+}
+
+// ReorderAmount is how much has to be bought to bring the item back to its
+// target level, or at least to its reorder level when no target is set.
+func (i InventoryItem) ReorderAmount() float64 {
+	target := max(i.TargetLevel, i.ReorderLevel)
+	if i.Quantity >= target {
+		return 0
+	}
+	return target - i.Quantity
+}
+
+type LowStockItem struct {
+	InventoryItem
+	ReorderAmount float64 `json:"reorder_amount"`
+}
+
+// StockAlert is raised when an order takes an item below its reorder level.
+type StockAlert struct {
+	IngredientID  int64     `json:"ingredient_id"`
+	Name          string    `json:"name"`
+	Unit          string    `json:"unit"`
+	Quantity      float64   `json:"quantity"`
+	ReorderLevel  float64   `json:"reorder_level"`
+	ReorderAmount float64   `json:"reorder_amount"`
+	OrderID       int64     `json:"order_id"`
+	RaisedAt      time.Time `json:"raised_at"`
+}
+
+// StockChange is an ingredient's quantity before and after an order changed
+// it, read under the same lock as the change.
+type StockChange struct {
+	IngredientID int64
+	Before       float64
+	After        float64
+	ReorderLevel float64
+}
+
+// CrossedReorderLevel reports whether the change took the item below its
+// reorder level.
+func (c StockChange) CrossedReorderLevel() bool {
+	return c.Before >= c.ReorderLevel && c.After < c.ReorderLevel
+}
+
+// IngredientAmount is an amount of a single ingredient expressed in the unit
+// the ingredient is stocked in.
+type IngredientAmount struct {
+	IngredientID int64   `json:"ingredient_id"`
+	Quantity     float64 `json:"quantity"`
+}
+
+type IngredientShortage struct {
+	IngredientID int64   `json:"ingredient_id"`
+	Name         string  `json:"name"`
+	Required     float64 `json:"required"`
+	Available    float64 `json:"available"`
+}
+
+// InsufficientIngredientsError is returned when an order needs more of one or
+// more ingredients than the inventory holds. It matches ErrInsufficientIngredients.
+type InsufficientIngredientsError struct {
+	Shortages []IngredientShortage `json:"shortages"`
+}
+
+func (e *InsufficientIngredientsError) Error() string {
+	parts := make([]string, 0, len(e.Shortages))
+	for _, s := range e.Shortages {
+		name := s.Name
+		if name == "" {
+			name = fmt.Sprintf("ingredient %d", s.IngredientID)
+		}
+		parts = append(parts, fmt.Sprintf("%s (required %g, available %g)", name, s.Required, s.Available))
+	}
+	return fmt.Sprintf("%s: %s", ErrInsufficientIngredients, strings.Join(parts, ", "))
+}
+
+func (e *InsufficientIngredientsError) Unwrap() error {
+	return ErrInsufficientIngredients
 }
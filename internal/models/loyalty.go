@@ -0,0 +1,126 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"github.com/weeweeshka/hot-coffee/internal/money"
+	"time"
+)
+
+var (
+	ErrInvalidRedemption  = errors.New("invalid loyalty redemption")
+	ErrInsufficientPoints = errors.New("not enough loyalty points")
+	ErrRedemptionUndone   = errors.New("redemption is already undone")
+)
+
+// LoyaltyEarnMode says what closing an order earns.
+type LoyaltyEarnMode string
+
+const (
+	// EarnPerCurrency earns PointsPerUnit for every unit of currency paid.
+	EarnPerCurrency LoyaltyEarnMode = "per_currency"
+	// EarnPerItem earns PointsPerUnit stamps for every item ordered.
+	EarnPerItem LoyaltyEarnMode = "per_item"
+)
+
+// LoyaltyRule configures how points are earned and what they are worth.
+type LoyaltyRule struct {
+	Mode          LoyaltyEarnMode `json:"mode"`
+	PointsPerUnit float64         `json:"points_per_unit"`
+	// FreeItemPoints is the cost of one free menu item. Zero disables free
+	// items.
+	FreeItemPoints int64 `json:"free_item_points"`
+	// PointValue is the discount one point buys. Zero disables discounts.
+	PointValue money.Amount `json:"point_value"`
+}
+
+func (r LoyaltyRule) Validate() error {
+	switch r.Mode {
+	case EarnPerCurrency, EarnPerItem:
+	default:
+		return fmt.Errorf("unknown loyalty earn mode %q", r.Mode)
+	}
+	if r.PointsPerUnit < 0 || r.FreeItemPoints < 0 || r.PointValue < 0 {
+		return errors.New("loyalty rule values must not be negative")
+	}
+	return nil
+}
+
+type LoyaltyReason string
+
+const (
+	LoyaltyEarn     LoyaltyReason = "earn"
+	LoyaltyRedeem   LoyaltyReason = "redeem"
+	LoyaltyReversal LoyaltyReason = "reversal"
+)
+
+// LoyaltyEntry is one row of a customer's points ledger. The balance is the
+// sum of all entries.
+type LoyaltyEntry struct {
+	ID           int64         `json:"entry_id"`
+	CustomerID   int64         `json:"customer_id"`
+	Points       int64         `json:"points"`
+	Reason       LoyaltyReason `json:"reason"`
+	OrderID      *int64        `json:"order_id,omitempty"`
+	RedemptionID *int64        `json:"redemption_id,omitempty"`
+	CreatedAt    time.Time     `json:"created_at"`
+}
+
+type RewardType string
+
+const (
+	RewardFreeItem RewardType = "free_item"
+	RewardDiscount RewardType = "discount"
+)
+
+// RedemptionRequest asks to spend points on the order being created: one
+// unit of a product on the order for free, or Points towards a discount.
+type RedemptionRequest struct {
+	Reward    RewardType `json:"reward"`
+	ProductID int64      `json:"product_id,omitempty"`
+	VariantID int64      `json:"variant_id,omitempty"`
+	Points    int64      `json:"points,omitempty"`
+}
+
+// LoyaltyRedemption records points spent on an order and the value they
+// bought.
+type LoyaltyRedemption struct {
+	ID         int64        `json:"redemption_id"`
+	CustomerID int64        `json:"customer_id"`
+	OrderID    int64        `json:"order_id"`
+	Reward     RewardType   `json:"reward"`
+	ProductID  int64        `json:"product_id,omitempty"`
+	VariantID  int64        `json:"variant_id,omitempty"`
+	Points     int64        `json:"points"`
+	Value      money.Amount `json:"value"`
+	CreatedAt  time.Time    `json:"created_at"`
+	UndoneAt   *time.Time   `json:"undone_at,omitempty"`
+}
+
+// RefundedPoints is how many of the points earned on an order of total come
+// back off the customer once refunded of it has been refunded, rounded down
+// in the customer's favour. A fully refunded order gives back all of them.
+func RefundedPoints(earned int64, refunded, total money.Amount) int64 {
+	switch {
+	case earned <= 0 || refunded <= 0 || total <= 0:
+		return 0
+	case refunded >= total:
+		return earned
+	}
+	return earned * int64(refunded) / int64(total)
+}
+
+// CanUndoRedemption reports whether points spent on an order in status can
+// be given back: while it is open and can still change, or once it is
+// cancelled and will not be paid.
+func CanUndoRedemption(status OrderStatus) bool {
+	return status == StatusOpen || status == StatusCancelled
+}
+
+type LoyaltyAccount struct {
+	CustomerID  int64               `json:"customer_id"`
+	Balance     int64               `json:"balance"`
+	Rule        LoyaltyRule         `json:"rule"`
+	History     []LoyaltyEntry      `json:"history"`
+	Redemptions []LoyaltyRedemption `json:"redemptions"`
+}
@@ -0,0 +1,31 @@
+package models_test
+
+import (
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"github.com/weeweeshka/hot-coffee/internal/money"
+	"testing"
+)
+
+func TestRefundedPoints(t *testing.T) {
+	for _, tc := range []struct {
+		earned          int64
+		refunded, total money.Amount
+		want            int64
+	}{
+		{40, 1000, 4000, 10},
+		{40, 2000, 4000, 20},
+		{40, 4000, 4000, 40},
+		{40, 4100, 4000, 40},
+		// Partial refunds round down, in the customer's favour.
+		{10, 999, 4000, 2},
+		{10, 1, 4000, 0},
+		{0, 1000, 4000, 0},
+		{40, 0, 4000, 0},
+		{40, -100, 4000, 0},
+		{40, 1000, 0, 0},
+	} {
+		if got := models.RefundedPoints(tc.earned, tc.refunded, tc.total); got != tc.want {
+			t.Errorf("RefundedPoints(%d, %s, %s) = %d, want %d", tc.earned, tc.refunded, tc.total, got, tc.want)
+		}
+	}
+}
@@ -1,21 +1,124 @@
 package models
 
+import (
+	"errors"
+	"fmt"
+	"github.com/weeweeshka/hot-coffee/internal/money"
+	"strings"
+)
+
+var (
+	ErrInvalidMenu     = errors.New("invalid menu item")
+	ErrItemUnavailable = errors.New("menu item unavailable")
+)
+
+// MenuItem is a product on the menu. Items sold in several sizes list them as
+// variants, each with its own price and recipe; the item's own Price and
+// Ingredients are then not used for ordering. Category picks the tax rate.
 type MenuItem struct {
-	ID          int64                `json:"product_id"`
+	ID             int64                `json:"product_id"`
+	Name           string               `json:"name"`
+	Description    string               `json:"description"`
+	Category       string               `json:"category,omitempty"`
+	Price          money.Amount         `json:"price"`
+	Ingredients    []MenuItemIngredient `json:"ingredients"`
+	Variants       []MenuVariant        `json:"variants,omitempty"`
+	ModifierGroups []ModifierGroup      `json:"modifier_groups,omitempty"`
+}
+
+type MenuVariant struct {
+	ID          int64                `json:"variant_id"`
+	Name        string               `json:"name"`
+	Price       money.Amount         `json:"price"`
+	Ingredients []MenuItemIngredient `json:"ingredients"`
+}
+
+// ModifierGroup is a choice offered on a menu item, such as the milk type.
+// Orders pick between MinSelect and MaxSelect of its modifiers; a MaxSelect
+// of zero means no upper limit.
+type ModifierGroup struct {
+	ID        int64      `json:"group_id"`
+	Name      string     `json:"name"`
+	MinSelect int        `json:"min_select"`
+	MaxSelect int        `json:"max_select"`
+	Modifiers []Modifier `json:"modifiers"`
+}
+
+// Modifier changes the price of an order line by PriceDelta and its recipe by
+// Ingredients, whose quantities may be negative to take something out.
+type Modifier struct {
+	ID          int64                `json:"modifier_id"`
 	Name        string               `json:"name"`
-	Description string               `json:"description"`
-	Price       float64              `json:"price"`
+	PriceDelta  money.Amount         `json:"price_delta"`
 	Ingredients []MenuItemIngredient `json:"ingredients"`
 }
 
+// Variant returns the variant with the given id. An item without variants is
+// its own single variant with id 0.
+func (m MenuItem) Variant(id int64) (MenuVariant, bool) {
+	if len(m.Variants) == 0 {
+		return MenuVariant{Price: m.Price, Ingredients: m.Ingredients}, id == 0
+	}
+	for _, v := range m.Variants {
+		if v.ID == id {
+			return v, true
+		}
+	}
+	return MenuVariant{}, false
+}
+
+// MenuItemIngredient is one line of a recipe. An empty Unit means the unit
+// the ingredient is stocked in.
 type MenuItemIngredient struct {
 	IngredientID int64   `json:"ingredient_id"`
 	Quantity     float64 `json:"quantity"`
+	Unit         string  `json:"unit,omitempty"`
 }
 
+// MenuResponse is a menu item together with what current stock allows.
+// MaxServings is null for items that use no stocked ingredients. For items
+// with variants both describe the best-stocked variant.
 type MenuResponse struct {
-	Name        string               `json:"name"`
-	Description string               `json:"description"`
-	Price       float64              `json:"price"`
-	Ingredients []MenuItemIngredient `json:"ingredients"`
+	ID             int64                 `json:"product_id"`
+	Name           string                `json:"name"`
+	Description    string                `json:"description"`
+	Category       string                `json:"category,omitempty"`
+	Price          money.Amount          `json:"price"`
+	Ingredients    []MenuItemIngredient  `json:"ingredients"`
+	Variants       []MenuVariantResponse `json:"variants,omitempty"`
+	ModifierGroups []ModifierGroup       `json:"modifier_groups,omitempty"`
+	Available      bool                  `json:"available"`
+	MaxServings    *int64                `json:"max_servings"`
+}
+
+type MenuVariantResponse struct {
+	MenuVariant
+	Available   bool   `json:"available"`
+	MaxServings *int64 `json:"max_servings"`
+}
+
+type UnavailableItem struct {
+	ProductID   int64  `json:"product_id"`
+	VariantID   int64  `json:"variant_id,omitempty"`
+	Name        string `json:"name"`
+	Requested   int64  `json:"requested"`
+	MaxServings int64  `json:"max_servings"`
+}
+
+// UnavailableItemsError is returned for orders asking for more servings of
+// menu items than current stock can make. It matches ErrItemUnavailable.
+type UnavailableItemsError struct {
+	Items []UnavailableItem `json:"items"`
+}
+
+func (e *UnavailableItemsError) Error() string {
+	parts := make([]string, 0, len(e.Items))
+	for _, item := range e.Items {
+		parts = append(parts, fmt.Sprintf("%s (requested %d, can make %d)", item.Name, item.Requested, item.MaxServings))
+	}
+	return fmt.Sprintf("%s: %s", ErrItemUnavailable, strings.Join(parts, ", "))
+}
+
+func (e *UnavailableItemsError) Unwrap() error {
+	return ErrItemUnavailable
 }
@@ -1,31 +1,120 @@
 package models
 
-import "errors"
+import (
+	"errors"
+	"github.com/weeweeshka/hot-coffee/internal/money"
+	"time"
+)
 
-var ErrNotFound = errors.New("order not found")
+var (
+	ErrNotFound          = errors.New("order not found")
+	ErrInvalidOrder      = errors.New("invalid order")
+	ErrInvalidTransition = errors.New("invalid order status transition")
+	ErrOrderNotEditable  = errors.New("order cannot be edited")
+	ErrOrderClosed       = errors.New("closed orders cannot be deleted without a refund")
+)
+
+type OrderStatus string
+
+const (
+	StatusOpen       OrderStatus = "open"
+	StatusInProgress OrderStatus = "in_progress"
+	StatusReady      OrderStatus = "ready"
+	StatusClosed     OrderStatus = "closed"
+	StatusCancelled  OrderStatus = "cancelled"
+)
 
 type Order struct {
 	ID           int64       `json:"order_id"`
+	CustomerID   *int64      `json:"customer_id,omitempty"`
 	CustomerName string      `json:"customer_name"`
 	Items        []OrderItem `json:"items"`
-	Status       string      `json:"status"`
-	CreatedAt    string      `json:"created_at"`
+	// Lines are the items as priced when they were ordered.
+	Lines []PricedLine `json:"lines,omitempty"`
+	// Tip is left when the order is closed, apart from tips paid with
+	// payments.
+	Tip money.Amount `json:"tip,omitempty"`
+	// Rounding and CashIncrement are the pricing rules the order was created
+	// under, which its totals keep being computed with. Orders from before
+	// they were kept have neither.
+	Rounding      money.RoundingMode `json:"rounding,omitempty"`
+	CashIncrement money.Amount       `json:"cash_increment,omitempty"`
+	Status        OrderStatus        `json:"status"`
+	CreatedAt     string             `json:"created_at"`
+	StartedAt     *time.Time         `json:"started_at,omitempty"`
+	ReadyAt       *time.Time         `json:"ready_at,omitempty"`
+	ClosedAt      *time.Time         `json:"closed_at,omitempty"`
+	CancelledAt   *time.Time         `json:"cancelled_at,omitempty"`
+}
+
+// SetStatus moves the order to status and stamps the timestamp of that stage.
+func (o *Order) SetStatus(status OrderStatus, at time.Time) {
+	o.Status = status
+	switch status {
+	case StatusInProgress:
+		o.StartedAt = &at
+	case StatusReady:
+		o.ReadyAt = &at
+	case StatusClosed:
+		o.ClosedAt = &at
+	case StatusCancelled:
+		o.CancelledAt = &at
+	}
+}
+
+// OrderPage selects a page of the order list, newest first. A zero Limit
+// takes the default page size.
+type OrderPage struct {
+	Limit  int
+	Offset int
+}
+
+// OrderDiscounts are the discounts quoted for a new order, recorded in the
+// same transaction as the order itself.
+type OrderDiscounts struct {
+	// Promotion, if set, is checked against its limits before Usage of it
+	// is recorded.
+	Promotion *Promotion
+	Usage     PromotionUsage
+	// Redemption, if set, spends the customer's points.
+	Redemption *LoyaltyRedemption
 }
 
 type OrderItem struct {
-	ProductID int64 `json:"product_id"`
-	Quantity  int   `json:"quantity"`
+	ProductID int64   `json:"product_id"`
+	VariantID int64   `json:"variant_id,omitempty"`
+	Modifiers []int64 `json:"modifiers,omitempty"`
+	Quantity  int     `json:"quantity"`
 }
 
 type OrderRequest struct {
+	CustomerID   *int64      `json:"customer_id,omitempty"`
 	CustomerName string      `json:"customer_name"`
 	Items        []OrderItem `json:"items"`
+	// Redeem spends the customer's loyalty points on the new order. Updates
+	// cannot redeem.
+	Redeem *RedemptionRequest `json:"redeem,omitempty"`
+	// PromoCode applies a promotion to the new order. Later updates reprice
+	// the promotion and may repeat its code but cannot change it.
+	PromoCode string `json:"promo_code,omitempty"`
+}
+
+// CloseRequest is the optional body of closing an order.
+type CloseRequest struct {
+	Tip money.Amount `json:"tip,omitempty"`
 }
 
 type OrderResponse struct {
-	ID           int64       `json:"order_id"`
-	CustomerName string      `json:"customer_name"`
-	Items        []OrderItem `json:"items"`
-	Status       string      `json:"status"`
-	CreatedAt    string      `json:"created_at"`
+	ID           int64        `json:"order_id"`
+	CustomerID   *int64       `json:"customer_id,omitempty"`
+	CustomerName string       `json:"customer_name"`
+	Items        []OrderItem  `json:"items"`
+	Tip          money.Amount `json:"tip,omitempty"`
+	Status       OrderStatus  `json:"status"`
+	CreatedAt    string       `json:"created_at"`
+	StartedAt    *time.Time   `json:"started_at,omitempty"`
+	ReadyAt      *time.Time   `json:"ready_at,omitempty"`
+	ClosedAt     *time.Time   `json:"closed_at,omitempty"`
+	CancelledAt  *time.Time   `json:"cancelled_at,omitempty"`
+	Pricing      OrderPricing `json:"pricing"`
 }
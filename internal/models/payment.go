@@ -0,0 +1,72 @@
+package models
+
+import (
+	"errors"
+	"github.com/weeweeshka/hot-coffee/internal/money"
+	"time"
+)
+
+var (
+	ErrInvalidPayment  = errors.New("invalid payment")
+	ErrPaymentDeclined = errors.New("payment declined")
+	ErrOverpayment     = errors.New("payment exceeds the amount due")
+	ErrOrderNotPaid    = errors.New("order is not fully paid")
+	ErrOrderPaid       = errors.New("order has payments")
+)
+
+type PaymentMethod string
+
+const (
+	PaymentCash PaymentMethod = "cash"
+	PaymentCard PaymentMethod = "card"
+)
+
+// PaymentRequest pays part or all of an order with one tender. Split tender
+// is several requests against the same order.
+type PaymentRequest struct {
+	Method PaymentMethod `json:"method"`
+	// Amount is what goes towards the order. Zero pays the balance due, or
+	// as much of it as the cash tendered covers.
+	Amount money.Amount `json:"amount,omitempty"`
+	// Tendered is the cash handed over; change is given from it. Zero means
+	// exactly Amount.
+	Tendered money.Amount `json:"tendered,omitempty"`
+	// CardToken identifies the card to the payment gateway.
+	CardToken string `json:"card_token,omitempty"`
+	// Tip is paid on top of Amount with the same tender and does not count
+	// towards the order.
+	Tip money.Amount `json:"tip,omitempty"`
+}
+
+type Payment struct {
+	ID       int64         `json:"payment_id"`
+	OrderID  int64         `json:"order_id"`
+	Method   PaymentMethod `json:"method"`
+	Amount   money.Amount  `json:"amount"`
+	Tendered money.Amount  `json:"tendered,omitempty"`
+	Change   money.Amount  `json:"change,omitempty"`
+	Tip      money.Amount  `json:"tip,omitempty"`
+	// Refunded is how much of Amount has been given back.
+	Refunded money.Amount `json:"refunded,omitempty"`
+	// Reference is the gateway's id for a card charge.
+	Reference string    `json:"reference,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CardCharge is what is sent to the payment gateway.
+type CardCharge struct {
+	OrderID int64        `json:"order_id"`
+	Amount  money.Amount `json:"amount"`
+	Token   string       `json:"card_token"`
+}
+
+// OrderBalance is what an order costs, what has been paid towards it and
+// what is still due.
+type OrderBalance struct {
+	OrderID  int64        `json:"order_id"`
+	Total    money.Amount `json:"total"`
+	Paid     money.Amount `json:"paid"`
+	Due      money.Amount `json:"due"`
+	Refunded money.Amount `json:"refunded"`
+	Payments []Payment    `json:"payments"`
+}
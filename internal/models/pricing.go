@@ -0,0 +1,98 @@
+package models
+
+import (
+	"fmt"
+	"github.com/weeweeshka/hot-coffee/internal/money"
+)
+
+// PricingRules configures how orders are priced. Menu prices exclude tax.
+// Items are taxed at the rate of their category, or DefaultTaxRate when the
+// category has none; Rounding applies to tax and percentage discounts, and a
+// positive CashIncrement rounds the grand total to a multiple of it.
+type PricingRules struct {
+	TaxRates       map[string]money.Rate `json:"tax_rates,omitempty"`
+	DefaultTaxRate money.Rate            `json:"default_tax_rate"`
+	Rounding       money.RoundingMode    `json:"rounding,omitempty"`
+	CashIncrement  money.Amount          `json:"cash_increment,omitempty"`
+}
+
+func (r PricingRules) Validate() error {
+	if r.DefaultTaxRate < 0 || r.DefaultTaxRate > money.Percent100 {
+		return fmt.Errorf("default tax rate must be between 0 and 100%%")
+	}
+	for category, rate := range r.TaxRates {
+		if rate < 0 || rate > money.Percent100 {
+			return fmt.Errorf("tax rate of %q must be between 0 and 100%%", category)
+		}
+	}
+	if r.CashIncrement < 0 {
+		return fmt.Errorf("cash increment must not be negative")
+	}
+	return r.Rounding.Validate()
+}
+
+// TaxRate is the rate items of category are taxed at.
+func (r PricingRules) TaxRate(category string) money.Rate {
+	if rate, ok := r.TaxRates[category]; ok {
+		return rate
+	}
+	return r.DefaultTaxRate
+}
+
+type DiscountSource string
+
+const (
+	DiscountFromPromotion DiscountSource = "promotion"
+	DiscountFromLoyalty   DiscountSource = "loyalty"
+)
+
+// OrderPricing itemises what an order costs. Discounts come off before tax
+// and are spread over the lines they apply to in proportion to their totals.
+// Total is Subtotal - DiscountTotal + TaxTotal + Rounding.
+type OrderPricing struct {
+	Lines         []PricedLine      `json:"lines"`
+	Subtotal      money.Amount      `json:"subtotal"`
+	Discounts     []AppliedDiscount `json:"discounts,omitempty"`
+	DiscountTotal money.Amount      `json:"discount_total"`
+	Taxes         []TaxLine         `json:"taxes,omitempty"`
+	TaxTotal      money.Amount      `json:"tax_total"`
+	Rounding      money.Amount      `json:"rounding,omitempty"`
+	Total         money.Amount      `json:"total"`
+}
+
+// PricedLine is an order line with the prices it was sold at, which are
+// stored with the order. Net is what the line comes to after its share of the
+// order's discounts and with its share of the tax; it is filled in when the
+// order is priced.
+type PricedLine struct {
+	ID        int64        `json:"line_id,omitempty"`
+	ProductID int64        `json:"product_id"`
+	VariantID int64        `json:"variant_id,omitempty"`
+	Modifiers []int64      `json:"modifiers,omitempty"`
+	Name      string       `json:"name"`
+	Category  string       `json:"category,omitempty"`
+	Quantity  int          `json:"quantity"`
+	UnitPrice money.Amount `json:"unit_price"`
+	LineTotal money.Amount `json:"line_total"`
+	TaxRate   money.Rate   `json:"tax_rate"`
+	Net       money.Amount `json:"net"`
+}
+
+// AppliedDiscount is a discount on the order. A ProductID limits it to the
+// lines of that product.
+type AppliedDiscount struct {
+	Source      DiscountSource `json:"source"`
+	Code        string         `json:"code,omitempty"`
+	Description string         `json:"description"`
+	ProductID   int64          `json:"product_id,omitempty"`
+	Amount      money.Amount   `json:"amount"`
+}
+
+// TaxLine is the tax charged at one rate on the discounted lines of one
+// category.
+type TaxLine struct {
+	Category string       `json:"category"`
+	Rate     money.Rate   `json:"rate"`
+	Taxable  money.Amount `json:"taxable"`
+	Amount   money.Amount `json:"amount"`
+}
@@ -0,0 +1,45 @@
+package models_test
+
+import (
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"github.com/weeweeshka/hot-coffee/internal/money"
+	"testing"
+)
+
+func TestPricingRulesValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		rules models.PricingRules
+		ok    bool
+	}{
+		{"zero", models.PricingRules{}, true},
+		{"full", models.PricingRules{TaxRates: map[string]money.Rate{"food": 0, "alcohol": money.Percent100}, DefaultTaxRate: 825, Rounding: money.HalfEven, CashIncrement: 5}, true},
+		{"negative default rate", models.PricingRules{DefaultTaxRate: -1}, false},
+		{"default rate over 100%", models.PricingRules{DefaultTaxRate: money.Percent100 + 1}, false},
+		{"negative category rate", models.PricingRules{TaxRates: map[string]money.Rate{"food": -1}}, false},
+		{"category rate over 100%", models.PricingRules{TaxRates: map[string]money.Rate{"food": money.Percent100 + 1}}, false},
+		{"negative cash increment", models.PricingRules{CashIncrement: -5}, false},
+		{"unknown rounding", models.PricingRules{Rounding: "sideways"}, false},
+	} {
+		if err := tc.rules.Validate(); (err == nil) != tc.ok {
+			t.Errorf("Validate %s err = %v, want ok %t", tc.name, err, tc.ok)
+		}
+	}
+}
+
+func TestPricingRulesTaxRate(t *testing.T) {
+	rules := models.PricingRules{TaxRates: map[string]money.Rate{"food": 500, "retail": 0}, DefaultTaxRate: 1000}
+	for _, tc := range []struct {
+		category string
+		want     money.Rate
+	}{
+		{"food", 500},
+		{"retail", 0},
+		{"coffee", 1000},
+		{"", 1000},
+	} {
+		if got := rules.TaxRate(tc.category); got != tc.want {
+			t.Errorf("TaxRate(%q) = %d, want %d", tc.category, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package models
+
+import (
+	"errors"
+	"github.com/weeweeshka/hot-coffee/internal/money"
+	"time"
+)
+
+var (
+	ErrInvalidPromotion   = errors.New("invalid promotion")
+	ErrPromoNotApplicable = errors.New("promo code does not apply")
+	ErrPromoLimitReached  = errors.New("promo code usage limit reached")
+	ErrDuplicatePromotion = errors.New("promo code already exists")
+)
+
+type DiscountType string
+
+const (
+	DiscountPercentage DiscountType = "percentage"
+	DiscountFixed      DiscountType = "fixed"
+	// DiscountBuyXGetY gives GetQuantity of every BuyQuantity+GetQuantity
+	// units of the promoted product for free, cheapest first.
+	DiscountBuyXGetY DiscountType = "buy_x_get_y"
+)
+
+// TimeWindow limits a promotion to a time of day, such as a happy hour.
+// Start and End are "15:04" clock times; a window that ends before it starts
+// runs past midnight. Days are time.Weekday values; empty means every day.
+type TimeWindow struct {
+	Start string         `json:"start"`
+	End   string         `json:"end"`
+	Days  []time.Weekday `json:"days,omitempty"`
+}
+
+// Promotion is a discount rule customers unlock with its code.
+type Promotion struct {
+	ID   int64        `json:"promotion_id"`
+	Code string       `json:"code"`
+	Name string       `json:"name"`
+	Type DiscountType `json:"type"`
+	// Value is the fixed amount off, or for percentage promotions the
+	// percentage off with the same two decimals (see Percent).
+	Value money.Amount `json:"value,omitempty"`
+	// ProductID limits the discount to one product; zero means the whole
+	// order. Buy-X-get-Y promotions need one.
+	ProductID   int64       `json:"product_id,omitempty"`
+	BuyQuantity int         `json:"buy_quantity,omitempty"`
+	GetQuantity int         `json:"get_quantity,omitempty"`
+	Window      *TimeWindow `json:"window,omitempty"`
+	StartsAt    *time.Time  `json:"starts_at,omitempty"`
+	EndsAt      *time.Time  `json:"ends_at,omitempty"`
+	// MaxUses caps the orders the code can be used on, MaxUsesPerCustomer
+	// the orders of one customer and MaxDiscountTotal the discount it can
+	// give away in total. Zero means no limit.
+	MaxUses            int64        `json:"max_uses,omitempty"`
+	MaxUsesPerCustomer int64        `json:"max_uses_per_customer,omitempty"`
+	MaxDiscountTotal   money.Amount `json:"max_discount_total,omitempty"`
+	Active             bool         `json:"active"`
+	CreatedAt          time.Time    `json:"created_at"`
+}
+
+// PromotionUsage records a promotion applied to an order. Usages of
+// cancelled or deleted orders are voided and stop counting towards limits.
+type PromotionUsage struct {
+	ID          int64        `json:"usage_id"`
+	PromotionID int64        `json:"promotion_id"`
+	Code        string       `json:"code"`
+	ProductID   int64        `json:"product_id,omitempty"`
+	OrderID     int64        `json:"order_id"`
+	CustomerID  *int64       `json:"customer_id,omitempty"`
+	Amount      money.Amount `json:"amount"`
+	CreatedAt   time.Time    `json:"created_at"`
+	VoidedAt    *time.Time   `json:"voided_at,omitempty"`
+}
+
+type PromotionReport struct {
+	From       *time.Time            `json:"from,omitempty"`
+	To         *time.Time            `json:"to,omitempty"`
+	Promotions []PromotionUsageStats `json:"promotions"`
+}
+
+// PromotionUsageStats measures one campaign over the report period. Revenue
+// is what the discounted orders brought in after all their discounts.
+type PromotionUsageStats struct {
+	PromotionID   int64        `json:"promotion_id"`
+	Code          string       `json:"code"`
+	Name          string       `json:"name"`
+	Uses          int64        `json:"uses"`
+	Customers     int64        `json:"customers"`
+	DiscountTotal money.Amount `json:"discount_total"`
+	Revenue       money.Amount `json:"revenue"`
+	ClosedOrders  int64        `json:"closed_orders"`
+}
+
+// Percent is the percentage off of a percentage promotion.
+func (p Promotion) Percent() money.Rate {
+	return money.Rate(p.Value)
+}
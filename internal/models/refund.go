@@ -0,0 +1,55 @@
+package models
+
+import (
+	"errors"
+	"github.com/weeweeshka/hot-coffee/internal/money"
+	"time"
+)
+
+var (
+	ErrInvalidRefund = errors.New("invalid refund")
+	ErrRefundFailed  = errors.New("card refund failed")
+)
+
+// RefundRequest gives money back for a closed order, or for a cancelled one
+// that was paid.
+type RefundRequest struct {
+	// Lines lists what to refund. None refunds whatever is left of the
+	// order.
+	Lines  []RefundLine `json:"lines,omitempty"`
+	Reason string       `json:"reason"`
+	// Restock returns the ingredients of the refunded items to the
+	// inventory, for items that were never made. Leave it off when they were
+	// made and thrown away.
+	Restock bool `json:"restock"`
+}
+
+type RefundLine struct {
+	LineID   int64 `json:"line_id"`
+	Quantity int   `json:"quantity"`
+	// Amount is the line's net price for Quantity, worked out by the
+	// service.
+	Amount money.Amount `json:"amount,omitempty"`
+}
+
+// Refund is money given back for an order. Amount is what the customer gets
+// and is taken off the order's payments, newest first; when the whole order
+// ends up refunded it includes the order's cash rounding.
+type Refund struct {
+	ID        int64           `json:"refund_id"`
+	OrderID   int64           `json:"order_id"`
+	Reason    string          `json:"reason"`
+	Restock   bool            `json:"restock"`
+	Amount    money.Amount    `json:"amount"`
+	Lines     []RefundLine    `json:"lines"`
+	Payments  []PaymentRefund `json:"payments,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// PaymentRefund is the part of a refund given back through one payment.
+type PaymentRefund struct {
+	PaymentID int64         `json:"payment_id"`
+	Method    PaymentMethod `json:"method"`
+	Amount    money.Amount  `json:"amount"`
+	Reference string        `json:"reference,omitempty"`
+}
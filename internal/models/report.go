@@ -0,0 +1,104 @@
+package models
+
+import (
+	"errors"
+	"github.com/weeweeshka/hot-coffee/internal/money"
+	"time"
+)
+
+var ErrInvalidReport = errors.New("invalid report request")
+
+type SalesGrouping string
+
+const (
+	GroupByDay   SalesGrouping = "day"
+	GroupByWeek  SalesGrouping = "week"
+	GroupByMonth SalesGrouping = "month"
+)
+
+type SalesReport struct {
+	From *time.Time `json:"from,omitempty"`
+	To   *time.Time `json:"to,omitempty"`
+	// TotalRevenue is what the orders sold for before tax, less their
+	// discounts and the items refunded since.
+	TotalRevenue money.Amount `json:"total_revenue"`
+	// RefundTotal is what was given back on the orders in the report.
+	RefundTotal   money.Amount  `json:"refund_total"`
+	OrderCount    int64         `json:"order_count"`
+	AverageTicket money.Amount  `json:"average_ticket"`
+	GroupBy       SalesGrouping `json:"group_by,omitempty"`
+	Series        []SalesPeriod `json:"series,omitempty"`
+}
+
+type SalesPeriod struct {
+	PeriodStart   time.Time    `json:"period_start"`
+	Revenue       money.Amount `json:"revenue"`
+	OrderCount    int64        `json:"order_count"`
+	AverageTicket money.Amount `json:"average_ticket"`
+}
+
+type PopularItemsSort string
+
+const (
+	SortByQuantity PopularItemsSort = "quantity"
+	SortByRevenue  PopularItemsSort = "revenue"
+)
+
+type PopularItemsReport struct {
+	From   *time.Time       `json:"from,omitempty"`
+	To     *time.Time       `json:"to,omitempty"`
+	SortBy PopularItemsSort `json:"sort_by"`
+	Items  []PopularItem    `json:"items"`
+}
+
+// PopularItem is the sales of a menu item variant over a period. Ranks are
+// dense over everything sold in the period, shares are fractions of the
+// period's totals.
+type PopularItem struct {
+	ProductID     int64        `json:"product_id"`
+	VariantID     int64        `json:"variant_id,omitempty"`
+	Name          string       `json:"name"`
+	VariantName   string       `json:"variant_name,omitempty"`
+	QuantitySold  int64        `json:"quantity_sold"`
+	Revenue       money.Amount `json:"revenue"`
+	QuantityRank  int64        `json:"quantity_rank"`
+	RevenueRank   int64        `json:"revenue_rank"`
+	QuantityShare float64      `json:"quantity_share"`
+	RevenueShare  float64      `json:"revenue_share"`
+}
+
+// TipPooling says how a day's tips are shared by the staff on shift that day.
+type TipPooling string
+
+const (
+	// PoolEqual splits tips evenly between everyone who worked that day.
+	PoolEqual TipPooling = "equal"
+	// PoolByHours splits tips in proportion to the time each worked.
+	PoolByHours TipPooling = "hours"
+)
+
+// TipReport totals tips on closed orders per day and shares every day's tips
+// between the staff on shift that day. Tips of days nobody was on shift are
+// left Unassigned.
+type TipReport struct {
+	From       *time.Time   `json:"from,omitempty"`
+	To         *time.Time   `json:"to,omitempty"`
+	Pooling    TipPooling   `json:"pooling"`
+	Total      money.Amount `json:"total"`
+	Unassigned money.Amount `json:"unassigned"`
+	Staff      []StaffTips  `json:"staff"`
+	Days       []TipDay     `json:"days"`
+}
+
+type TipDay struct {
+	Date       time.Time    `json:"date"`
+	Total      money.Amount `json:"total"`
+	Unassigned money.Amount `json:"unassigned,omitempty"`
+	Staff      []StaffTips  `json:"staff,omitempty"`
+}
+
+type StaffTips struct {
+	Staff string       `json:"staff"`
+	Hours float64      `json:"hours"`
+	Tips  money.Amount `json:"tips"`
+}
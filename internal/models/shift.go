@@ -0,0 +1,47 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrInvalidShift = errors.New("invalid shift")
+	ErrShiftOpen    = errors.New("staff member is already on shift")
+	ErrShiftEnded   = errors.New("shift has already ended")
+)
+
+// Shift is a stretch of time a staff member worked. EndedAt is nil while
+// they are still on shift.
+type Shift struct {
+	ID        int64      `json:"shift_id"`
+	Staff     string     `json:"staff"`
+	StartedAt time.Time  `json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+}
+
+// ShiftRequest starts a shift for the authenticated staff member; Staff is
+// never read from the request body.
+type ShiftRequest struct {
+	Staff string `json:"-"`
+}
+
+// Worked is how long the shift overlapped [from, to). A shift still open
+// counts up to now.
+func (s Shift) Worked(from, to, now time.Time) time.Duration {
+	end := now
+	if s.EndedAt != nil {
+		end = *s.EndedAt
+	}
+	start := s.StartedAt
+	if start.Before(from) {
+		start = from
+	}
+	if end.After(to) {
+		end = to
+	}
+	if !end.After(start) {
+		return 0
+	}
+	return end.Sub(start)
+}
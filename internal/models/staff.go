@@ -0,0 +1,133 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrInvalidStaff       = errors.New("invalid staff member")
+	ErrDuplicateStaff     = errors.New("username is already taken")
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrUnauthorized       = errors.New("authentication required")
+	ErrForbidden          = errors.New("permission denied")
+)
+
+type Role string
+
+const (
+	RoleBarista   Role = "barista"
+	RoleShiftLead Role = "shift_lead"
+	RoleManager   Role = "manager"
+	RoleAdmin     Role = "admin"
+)
+
+// roleRanks orders the roles; every role holds the permissions of the roles
+// ranked below it.
+var roleRanks = map[Role]int{
+	RoleBarista:   1,
+	RoleShiftLead: 2,
+	RoleManager:   3,
+	RoleAdmin:     4,
+}
+
+func (r Role) Valid() bool {
+	return roleRanks[r] > 0
+}
+
+type Permission string
+
+const (
+	PermOrders          Permission = "orders"
+	PermOrdersCancel    Permission = "orders:cancel"
+	PermPayments        Permission = "payments"
+	PermRefunds         Permission = "refunds"
+	PermMenuRead        Permission = "menu:read"
+	PermMenuWrite       Permission = "menu:write"
+	PermInventoryRead   Permission = "inventory:read"
+	PermInventoryMove   Permission = "inventory:move"
+	PermInventoryWrite  Permission = "inventory:write"
+	PermReports         Permission = "reports"
+	PermCustomers       Permission = "customers"
+	PermCustomersDelete Permission = "customers:delete"
+	PermLoyaltyAdjust   Permission = "loyalty:adjust"
+	PermPromotionsRead  Permission = "promotions:read"
+	PermPromotionsWrite Permission = "promotions:write"
+	PermShifts          Permission = "shifts"
+	PermStaffRead       Permission = "staff:read"
+	PermStaffWrite      Permission = "staff:write"
+	PermAudit           Permission = "audit"
+	PermHealth          Permission = "health"
+)
+
+// Permissions is the permission matrix: the least role that holds each
+// permission.
+var Permissions = map[Permission]Role{
+	PermOrders:          RoleBarista,
+	PermPayments:        RoleBarista,
+	PermMenuRead:        RoleBarista,
+	PermInventoryRead:   RoleBarista,
+	PermCustomers:       RoleBarista,
+	PermPromotionsRead:  RoleBarista,
+	PermShifts:          RoleBarista,
+	PermOrdersCancel:    RoleShiftLead,
+	PermRefunds:         RoleShiftLead,
+	PermInventoryMove:   RoleShiftLead,
+	PermLoyaltyAdjust:   RoleShiftLead,
+	PermMenuWrite:       RoleManager,
+	PermInventoryWrite:  RoleManager,
+	PermReports:         RoleManager,
+	PermCustomersDelete: RoleManager,
+	PermPromotionsWrite: RoleManager,
+	PermStaffRead:       RoleManager,
+	PermAudit:           RoleManager,
+	PermHealth:          RoleManager,
+	PermStaffWrite:      RoleAdmin,
+}
+
+// Can reports whether the role holds the permission. Unknown permissions are
+// held by nobody.
+func (r Role) Can(p Permission) bool {
+	least, ok := Permissions[p]
+	return ok && roleRanks[r] >= roleRanks[least]
+}
+
+// Staff is a staff user. The password hash never leaves the service.
+type Staff struct {
+	ID           int64     `json:"staff_id"`
+	Username     string    `json:"username"`
+	Name         string    `json:"name"`
+	Role         Role      `json:"role"`
+	Active       bool      `json:"active"`
+	PasswordHash string    `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// StaffRequest creates or updates a staff user. On update an empty Password
+// keeps the current one.
+type StaffRequest struct {
+	Username string `json:"username"`
+	Name     string `json:"name"`
+	Password string `json:"password,omitempty"`
+	Role     Role   `json:"role"`
+	Active   *bool  `json:"active,omitempty"`
+}
+
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// Claims are what a signed token says about its bearer.
+type Claims struct {
+	StaffID   int64     `json:"sub"`
+	Role      Role      `json:"role"`
+	IssuedAt  time.Time `json:"iat"`
+	ExpiresAt time.Time `json:"exp"`
+}
+
+type Session struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Staff     Staff     `json:"staff"`
+}
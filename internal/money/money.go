@@ -0,0 +1,319 @@
+// Package money keeps prices exact. Amounts are whole minor units (cents) and
+// rates are hundredths of a percent, so sums never drift and every rounding
+// is an explicit step with an explicit rule.
+package money
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+var ErrInvalidAmount = errors.New("invalid amount")
+
+// scale is the number of decimal places of amounts and rates.
+const scale = 2
+
+// Amount is a sum of money in minor units.
+type Amount int64
+
+// Rate is a percentage in hundredths of a percent: 8.25% is Rate(825).
+type Rate int64
+
+// Percent100 is 100%.
+const Percent100 Rate = 100 * 100
+
+// RoundingMode says how a result that falls between two minor units is
+// rounded. The zero value is HalfUp.
+type RoundingMode string
+
+const (
+	// HalfUp rounds halves away from zero.
+	HalfUp RoundingMode = "half_up"
+	// HalfEven rounds halves to the even neighbour.
+	HalfEven RoundingMode = "half_even"
+	// Down truncates towards zero.
+	Down RoundingMode = "down"
+	// Up rounds away from zero.
+	Up RoundingMode = "up"
+)
+
+func (m RoundingMode) Validate() error {
+	switch m {
+	case "", HalfUp, HalfEven, Down, Up:
+		return nil
+	}
+	return fmt.Errorf("unknown rounding mode %q", m)
+}
+
+// Parse reads a decimal such as "3.5" or "-12.05". More than two decimal
+// places is an error rather than a silent rounding.
+func Parse(s string) (Amount, error) {
+	v, err := parseDecimal(s)
+	return Amount(v), err
+}
+
+// ParseRate reads a percentage such as "8.25".
+func ParseRate(s string) (Rate, error) {
+	v, err := parseDecimal(s)
+	return Rate(v), err
+}
+
+func (a Amount) String() string {
+	return formatDecimal(int64(a))
+}
+
+// Float64 is a in whole units. It is meant for ratios such as points per
+// unit spent, not for further arithmetic on money.
+func (a Amount) Float64() float64 {
+	return float64(a) / 100
+}
+
+func (a Amount) Mul(n int) Amount {
+	return a * Amount(n)
+}
+
+// Percent is rate percent of a, rounded by mode.
+func (a Amount) Percent(rate Rate, mode RoundingMode) Amount {
+	return Amount(divRound(int64(a)*int64(rate), int64(Percent100), mode))
+}
+
+// Div splits a into n parts, rounded by mode.
+func (a Amount) Div(n int64, mode RoundingMode) Amount {
+	if n == 0 {
+		return 0
+	}
+	return Amount(divRound(int64(a), n, mode))
+}
+
+// RoundTo rounds a to a multiple of increment, as cash rounding to the
+// smallest coin does. A non-positive increment leaves a unchanged.
+func (a Amount) RoundTo(increment Amount, mode RoundingMode) Amount {
+	if increment <= 0 {
+		return a
+	}
+	return Amount(divRound(int64(a), int64(increment), mode)) * increment
+}
+
+// Allocate splits a over weights in proportion, handing the minor units left
+// over by rounding down to the largest remainders so the parts add up to a
+// exactly. Weights must not be negative.
+func (a Amount) Allocate(weights []Amount) []Amount {
+	parts := make([]Amount, len(weights))
+	var total int64
+	for _, w := range weights {
+		total += int64(w)
+	}
+	if total == 0 {
+		return parts
+	}
+
+	remainders := make([]int64, len(weights))
+	var given Amount
+	for i, w := range weights {
+		product := new(big.Int).Mul(big.NewInt(int64(a)), big.NewInt(int64(w)))
+		quotient, remainder := new(big.Int).QuoRem(product, big.NewInt(total), new(big.Int))
+		parts[i] = Amount(quotient.Int64())
+		remainders[i] = remainder.Int64()
+		given += parts[i]
+	}
+
+	step := Amount(1)
+	if a < 0 {
+		step = -1
+	}
+	for left := a - given; left != 0; left -= step {
+		best := -1
+		for i := range remainders {
+			if weights[i] > 0 && (best < 0 || abs(remainders[i]) > abs(remainders[best])) {
+				best = i
+			}
+		}
+		parts[best] += step
+		remainders[best] = 0
+	}
+	return parts
+}
+
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalJSON accepts a JSON number or a string holding one.
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	v, err := unmarshalDecimal(data)
+	if err != nil {
+		return err
+	}
+	if v != nil {
+		*a = Amount(*v)
+	}
+	return nil
+}
+
+func (a *Amount) ScanNumeric(n pgtype.Numeric) error {
+	v, err := scanDecimal(n)
+	*a = Amount(v)
+	return err
+}
+
+func (a Amount) NumericValue() (pgtype.Numeric, error) {
+	return pgtype.Numeric{Int: big.NewInt(int64(a)), Exp: -scale, Valid: true}, nil
+}
+
+func (r Rate) String() string {
+	return formatDecimal(int64(r))
+}
+
+func (r Rate) MarshalJSON() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+func (r *Rate) UnmarshalJSON(data []byte) error {
+	v, err := unmarshalDecimal(data)
+	if err != nil {
+		return err
+	}
+	if v != nil {
+		*r = Rate(*v)
+	}
+	return nil
+}
+
+func (r *Rate) ScanNumeric(n pgtype.Numeric) error {
+	v, err := scanDecimal(n)
+	*r = Rate(v)
+	return err
+}
+
+func (r Rate) NumericValue() (pgtype.Numeric, error) {
+	return pgtype.Numeric{Int: big.NewInt(int64(r)), Exp: -scale, Valid: true}, nil
+}
+
+func parseDecimal(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	digits, negative := strings.CutPrefix(s, "-")
+	if !negative {
+		digits = strings.TrimPrefix(s, "+")
+	}
+
+	whole, fraction, _ := strings.Cut(digits, ".")
+	if whole == "" && fraction == "" || len(fraction) > scale || !isDigits(whole) || !isDigits(fraction) {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	fraction += strings.Repeat("0", scale-len(fraction))
+
+	v, err := strconv.ParseInt(whole+fraction, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	if negative {
+		v = -v
+	}
+	return v, nil
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func formatDecimal(v int64) string {
+	sign := ""
+	if v < 0 {
+		sign = "-"
+	}
+	u := abs(v)
+	return fmt.Sprintf("%s%d.%02d", sign, u/100, u%100)
+}
+
+func unmarshalDecimal(data []byte) (*int64, error) {
+	if bytes.Equal(data, []byte("null")) {
+		return nil, nil
+	}
+	s := string(data)
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	}
+	v, err := parseDecimal(s)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// scanDecimal converts a NUMERIC to minor units. Columns are NUMERIC(_, 2),
+// but unconstrained ones are rounded half up rather than refused.
+func scanDecimal(n pgtype.Numeric) (int64, error) {
+	if !n.Valid {
+		return 0, errors.New("cannot scan NULL into a money value")
+	}
+	if n.NaN || n.InfinityModifier != pgtype.Finite {
+		return 0, fmt.Errorf("%w: not a finite number", ErrInvalidAmount)
+	}
+
+	v := new(big.Int).Set(n.Int)
+	exp := int64(n.Exp) + scale
+	if exp >= 0 {
+		v.Mul(v, new(big.Int).Exp(big.NewInt(10), big.NewInt(exp), nil))
+	} else {
+		divisor := new(big.Int).Exp(big.NewInt(10), big.NewInt(-exp), nil)
+		quotient, remainder := new(big.Int).QuoRem(v, divisor, new(big.Int))
+		if new(big.Int).Abs(remainder).Mul(new(big.Int).Abs(remainder), big.NewInt(2)).Cmp(divisor) >= 0 {
+			quotient.Add(quotient, big.NewInt(int64(v.Sign())))
+		}
+		v = quotient
+	}
+	if !v.IsInt64() {
+		return 0, fmt.Errorf("%w: out of range", ErrInvalidAmount)
+	}
+	return v.Int64(), nil
+}
+
+// divRound divides num by a non-zero den and rounds the quotient by mode.
+func divRound(num, den int64, mode RoundingMode) int64 {
+	if den < 0 {
+		num, den = -num, -den
+	}
+	q, r := num/den, num%den
+	if r == 0 {
+		return q
+	}
+	sign := int64(1)
+	if num < 0 {
+		sign = -1
+	}
+
+	switch mode {
+	case Down:
+		return q
+	case Up:
+		return q + sign
+	case HalfEven:
+		if twice := 2 * abs(r); twice > den || twice == den && q%2 != 0 {
+			return q + sign
+		}
+		return q
+	default:
+		if 2*abs(r) >= den {
+			return q + sign
+		}
+		return q
+	}
+}
+
+func abs(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,188 @@
+package money_test
+
+import (
+	"errors"
+	"github.com/weeweeshka/hot-coffee/internal/money"
+	"slices"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want money.Amount
+	}{
+		{"0", 0},
+		{"3.5", 350},
+		{"-12.05", -1205},
+		{"+5", 500},
+		{" 7 ", 700},
+		{".5", 50},
+		{"5.", 500},
+		{"-0.01", -1},
+		{"92233720368547758.07", 9223372036854775807},
+	} {
+		got, err := money.Parse(tc.in)
+		if err != nil || got != tc.want {
+			t.Errorf("Parse(%q) = %d, %v; want %d", tc.in, got, err, tc.want)
+		}
+	}
+
+	for _, in := range []string{
+		"", ".", "-", "+", "-+5", "+-5", "--5", "++5", "- 5",
+		"1.234", "1.2.3", "abc", "1e3", "0x10", "1,5", "92233720368547758.08",
+	} {
+		if got, err := money.Parse(in); !errors.Is(err, money.ErrInvalidAmount) {
+			t.Errorf("Parse(%q) = %d, %v; want ErrInvalidAmount", in, got, err)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	for _, tc := range []struct {
+		in   money.Amount
+		want string
+	}{
+		{0, "0.00"},
+		{5, "0.05"},
+		{-5, "-0.05"},
+		{100, "1.00"},
+		{-100, "-1.00"},
+		{123456, "1234.56"},
+	} {
+		if got := tc.in.String(); got != tc.want {
+			t.Errorf("Amount(%d).String() = %q, want %q", tc.in, got, tc.want)
+		}
+		if back, err := money.Parse(tc.want); err != nil || back != tc.in {
+			t.Errorf("Parse(%q) = %d, %v; want %d back", tc.want, back, err, tc.in)
+		}
+	}
+}
+
+func TestMul(t *testing.T) {
+	for _, tc := range []struct {
+		a    money.Amount
+		n    int
+		want money.Amount
+	}{
+		{350, 3, 1050},
+		{-125, 2, -250},
+		{125, -2, -250},
+		{999, 0, 0},
+	} {
+		if got := tc.a.Mul(tc.n); got != tc.want {
+			t.Errorf("%d.Mul(%d) = %d, want %d", tc.a, tc.n, got, tc.want)
+		}
+	}
+}
+
+func TestDiv(t *testing.T) {
+	for _, tc := range []struct {
+		a    money.Amount
+		n    int64
+		mode money.RoundingMode
+		want money.Amount
+	}{
+		{250, 2, money.HalfUp, 125},
+		{250, -2, money.HalfUp, -125},
+		{100, 3, money.HalfUp, 33},
+		{200, 3, money.HalfUp, 67},
+		{-200, 3, money.HalfUp, -67},
+		{200, -3, money.HalfUp, -67},
+		{-200, -3, money.HalfUp, 67},
+		{5, 2, money.HalfUp, 3},
+		{5, -2, money.HalfUp, -3},
+		{100, 3, money.Down, 33},
+		{100, -3, money.Down, -33},
+		{100, 3, money.Up, 34},
+		{100, -3, money.Up, -34},
+		{-100, -3, money.Up, 34},
+		{5, 2, money.HalfEven, 2},
+		{15, 2, money.HalfEven, 8},
+		{5, -2, money.HalfEven, -2},
+		{-15, 2, money.HalfEven, -8},
+		{-15, -2, money.HalfEven, 8},
+		{7, 0, money.HalfUp, 0},
+	} {
+		if got := tc.a.Div(tc.n, tc.mode); got != tc.want {
+			t.Errorf("%d.Div(%d, %s) = %d, want %d", tc.a, tc.n, tc.mode, got, tc.want)
+		}
+	}
+}
+
+func TestRounding(t *testing.T) {
+	t.Run("RoundTo", func(t *testing.T) {
+		for _, tc := range []struct {
+			a         money.Amount
+			increment money.Amount
+			mode      money.RoundingMode
+			want      money.Amount
+		}{
+			{1234, 5, money.HalfUp, 1235},
+			{1232, 5, money.HalfUp, 1230},
+			{1232, 5, money.Up, 1235},
+			{1237, 5, money.Down, 1235},
+			{-1233, 5, money.HalfUp, -1235},
+			{1225, 10, money.HalfEven, 1220},
+			{1235, 10, money.HalfEven, 1240},
+			{1234, 0, money.HalfUp, 1234},
+			{1234, -5, money.HalfUp, 1234},
+		} {
+			if got := tc.a.RoundTo(tc.increment, tc.mode); got != tc.want {
+				t.Errorf("%d.RoundTo(%d, %s) = %d, want %d", tc.a, tc.increment, tc.mode, got, tc.want)
+			}
+		}
+	})
+
+	t.Run("Percent", func(t *testing.T) {
+		for _, tc := range []struct {
+			a    money.Amount
+			rate money.Rate
+			mode money.RoundingMode
+			want money.Amount
+		}{
+			{1000, 825, money.HalfUp, 83},
+			{1000, 825, "", 83},
+			{1000, 825, money.HalfEven, 82},
+			{1000, 835, money.HalfEven, 84},
+			{1000, 825, money.Down, 82},
+			{1001, 1000, money.Up, 101},
+			{-1000, 825, money.HalfUp, -83},
+			{1000, money.Percent100, money.HalfUp, 1000},
+		} {
+			if got := tc.a.Percent(tc.rate, tc.mode); got != tc.want {
+				t.Errorf("%d.Percent(%s, %q) = %d, want %d", tc.a, tc.rate, tc.mode, got, tc.want)
+			}
+		}
+	})
+
+	t.Run("Allocate", func(t *testing.T) {
+		for _, tc := range []struct {
+			a       money.Amount
+			weights []money.Amount
+			want    []money.Amount
+		}{
+			{100, []money.Amount{1, 1, 1}, []money.Amount{34, 33, 33}},
+			{-100, []money.Amount{1, 1, 1}, []money.Amount{-34, -33, -33}},
+			{100, []money.Amount{300, 100}, []money.Amount{75, 25}},
+			{10, []money.Amount{1, 0, 2}, []money.Amount{3, 0, 7}},
+			{10, []money.Amount{0, 0}, []money.Amount{0, 0}},
+			{0, []money.Amount{5, 5}, []money.Amount{0, 0}},
+		} {
+			if got := tc.a.Allocate(tc.weights); !slices.Equal(got, tc.want) {
+				t.Errorf("%d.Allocate(%v) = %v, want %v", tc.a, tc.weights, got, tc.want)
+			}
+		}
+	})
+
+	t.Run("Validate", func(t *testing.T) {
+		for _, mode := range []money.RoundingMode{"", money.HalfUp, money.HalfEven, money.Down, money.Up} {
+			if err := mode.Validate(); err != nil {
+				t.Errorf("RoundingMode(%q).Validate() = %v", mode, err)
+			}
+		}
+		if err := money.RoundingMode("nearest").Validate(); err == nil {
+			t.Error(`RoundingMode("nearest").Validate() = nil, want an error`)
+		}
+	})
+}
@@ -0,0 +1,28 @@
+package notifier
+
+import (
+	"context"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"log/slog"
+)
+
+type LogNotifier struct {
+	logr *slog.Logger
+}
+
+func NewLogNotifier(logr *slog.Logger) *LogNotifier {
+	return &LogNotifier{logr: logr}
+}
+
+func (n *LogNotifier) Notify(ctx context.Context, alert models.StockAlert) error {
+	n.logr.WarnContext(ctx, "Low stock",
+		"ingredient_id", alert.IngredientID,
+		"name", alert.Name,
+		"quantity", alert.Quantity,
+		"unit", alert.Unit,
+		"reorder_level", alert.ReorderLevel,
+		"reorder_amount", alert.ReorderAmount,
+		"order_id", alert.OrderID,
+	)
+	return nil
+}
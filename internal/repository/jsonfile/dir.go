@@ -0,0 +1,197 @@
+package jsonfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+const (
+	snapshotName = "snapshot.json"
+	// journalName holds one JSON record per line, each the rows one write
+	// changed after the snapshot.
+	journalName = "journal.jsonl"
+	tempExt     = ".tmp"
+	lockName    = "LOCK"
+)
+
+// dataDir keeps a snapshot of the data and a journal of the writes made
+// since. A write appends its record to the journal and syncs it, so it costs
+// what it changed rather than the size of the data. A snapshot is written to
+// a temporary file, synced and renamed over the old one before the journal
+// is emptied; the records a crash leaves behind are older than the snapshot
+// and skipped on load.
+type dataDir struct {
+	path    string
+	lock    *os.File
+	logr    *slog.Logger
+	journal *os.File
+	// size is where the next record of the journal goes.
+	size int64
+}
+
+func openDataDir(logr *slog.Logger, path string) (*dataDir, error) {
+	if err := os.MkdirAll(path, 0o755); err != nil {
+		return nil, fmt.Errorf("cannot create data directory: %w", err)
+	}
+
+	lock, err := lockFile(filepath.Join(path, lockName))
+	if err != nil {
+		return nil, err
+	}
+
+	d := &dataDir{path: path, lock: lock, logr: logr}
+	if err = d.open(); err != nil {
+		d.close()
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *dataDir) close() error {
+	if d.journal != nil {
+		d.journal.Close()
+	}
+	return d.lock.Close()
+}
+
+// open removes the temporary files of snapshots a crash interrupted and
+// opens the journal.
+func (d *dataDir) open() error {
+	temps, err := filepath.Glob(filepath.Join(d.path, "*"+tempExt))
+	if err != nil {
+		return fmt.Errorf("cannot list data directory: %w", err)
+	}
+	for _, temp := range temps {
+		if err = os.Remove(temp); err != nil {
+			return fmt.Errorf("cannot remove %s: %w", temp, err)
+		}
+	}
+
+	d.journal, err = os.OpenFile(filepath.Join(d.path, journalName), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("cannot open journal: %w", err)
+	}
+	return d.sync()
+}
+
+// Load reads the snapshot and the journal. A last record that is cut short
+// or garbled was being appended when the process stopped, so its write never
+// returned; it is dropped.
+func (d *dataDir) Load() (json.RawMessage, []json.RawMessage, error) {
+	snapshot, err := os.ReadFile(filepath.Join(d.path, snapshotName))
+	if errors.Is(err, fs.ErrNotExist) {
+		snapshot = nil
+	} else if err != nil {
+		return nil, nil, fmt.Errorf("cannot read snapshot: %w", err)
+	} else if !json.Valid(snapshot) {
+		return nil, nil, fmt.Errorf("%s is not valid JSON", snapshotName)
+	}
+
+	b, err := os.ReadFile(filepath.Join(d.path, journalName))
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot read journal: %w", err)
+	}
+
+	var records []json.RawMessage
+	size := 0
+	for size < len(b) {
+		line, rest, complete := bytes.Cut(b[size:], []byte("\n"))
+		if !json.Valid(line) || !complete {
+			if complete && len(rest) > 0 {
+				return nil, nil, fmt.Errorf("journal record at byte %d is not valid JSON", size)
+			}
+			break
+		}
+		records = append(records, line)
+		size += len(line) + 1
+	}
+
+	if size < len(b) {
+		d.logr.Warn("Dropping a journal record cut short", "bytes", len(b)-size)
+		if err = d.journal.Truncate(int64(size)); err != nil {
+			return nil, nil, fmt.Errorf("cannot truncate journal: %w", err)
+		}
+	}
+	d.size = int64(size)
+	return snapshot, records, nil
+}
+
+func (d *dataDir) Append(record json.RawMessage) error {
+	line := make([]byte, 0, len(record)+1)
+	line = append(append(line, record...), '\n')
+
+	_, err := d.journal.WriteAt(line, d.size)
+	if err == nil {
+		err = d.journal.Sync()
+	}
+	if err != nil {
+		if truncErr := d.journal.Truncate(d.size); truncErr != nil {
+			d.logr.Error("Cannot take back a failed journal record", "err", truncErr)
+		}
+		return fmt.Errorf("cannot append to journal: %w", err)
+	}
+	d.size += int64(len(line))
+	return nil
+}
+
+func (d *dataDir) Snapshot(snapshot json.RawMessage) error {
+	if err := d.writeFile(filepath.Join(d.path, snapshotName), snapshot); err != nil {
+		return err
+	}
+
+	if err := d.journal.Truncate(0); err != nil {
+		return fmt.Errorf("cannot empty journal: %w", err)
+	}
+	d.size = 0
+	if err := d.journal.Sync(); err != nil {
+		return fmt.Errorf("cannot sync journal: %w", err)
+	}
+	return nil
+}
+
+// writeFile replaces the file at path with data in one rename.
+func (d *dataDir) writeFile(path string, data []byte) error {
+	temp := path + tempExt
+	f, err := os.OpenFile(temp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("cannot create %s: %w", temp, err)
+	}
+
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(temp)
+		return fmt.Errorf("cannot write %s: %w", temp, err)
+	}
+
+	if err = os.Rename(temp, path); err != nil {
+		os.Remove(temp)
+		return fmt.Errorf("cannot rename %s: %w", temp, err)
+	}
+	return d.sync()
+}
+
+// sync makes the renames in the directory durable.
+func (d *dataDir) sync() error {
+	dir, err := os.Open(d.path)
+	if err != nil {
+		return fmt.Errorf("cannot open data directory: %w", err)
+	}
+	defer dir.Close()
+
+	if err = dir.Sync(); err != nil {
+		return fmt.Errorf("cannot sync data directory: %w", err)
+	}
+	return nil
+}
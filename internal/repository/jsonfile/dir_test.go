@@ -0,0 +1,87 @@
+package jsonfile
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func openTestDir(t *testing.T, path string) *dataDir {
+	t.Helper()
+	d, err := openDataDir(slog.New(slog.NewTextHandler(io.Discard, nil)), path)
+	if err != nil {
+		t.Fatalf("openDataDir: %v", err)
+	}
+	t.Cleanup(func() { d.close() })
+	return d
+}
+
+func expectLoad(t *testing.T, d *dataDir, snapshot string, records ...string) {
+	t.Helper()
+	gotSnapshot, journal, err := d.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	var got []string
+	for _, r := range journal {
+		got = append(got, string(r))
+	}
+	if string(gotSnapshot) != snapshot || !slices.Equal(got, records) {
+		t.Errorf("Load = %s, %q; want %s, %q", gotSnapshot, got, snapshot, records)
+	}
+}
+
+func TestDataDir(t *testing.T) {
+	path := t.TempDir()
+	d := openTestDir(t, path)
+	expectLoad(t, d, "")
+
+	for _, r := range []string{`{"seq":1}`, `{"seq":2}`} {
+		if err := d.Append(json.RawMessage(r)); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+	expectLoad(t, d, "", `{"seq":1}`, `{"seq":2}`)
+
+	// A record cut short by a crash is dropped, and the next one takes its
+	// place.
+	d.close()
+	journal := filepath.Join(path, journalName)
+	f, err := os.OpenFile(journal, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"seq":3,"ro`)
+	f.Close()
+	d = openTestDir(t, path)
+	expectLoad(t, d, "", `{"seq":1}`, `{"seq":2}`)
+	if err = d.Append(json.RawMessage(`{"seq":3}`)); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	expectLoad(t, d, "", `{"seq":1}`, `{"seq":2}`, `{"seq":3}`)
+
+	if err = d.Snapshot(json.RawMessage(`{"seq":3,"tables":{}}`)); err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	if err = d.Append(json.RawMessage(`{"seq":4}`)); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	d.close()
+	d = openTestDir(t, path)
+	expectLoad(t, d, `{"seq":3,"tables":{}}`, `{"seq":4}`)
+}
+
+func TestDataDirRefusesGarbledJournal(t *testing.T) {
+	path := t.TempDir()
+	if err := os.WriteFile(filepath.Join(path, journalName), []byte("{\"seq\":1}\nnot json\n{\"seq\":3}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	d := openTestDir(t, path)
+	if _, _, err := d.Load(); err == nil {
+		t.Error("Load of a journal garbled in the middle: err = nil")
+	}
+}
@@ -0,0 +1,37 @@
+package jsonfile_test
+
+import (
+	"github.com/weeweeshka/hot-coffee/internal/repository/jsonfile"
+	"github.com/weeweeshka/hot-coffee/internal/repository/repotest"
+	"github.com/weeweeshka/hot-coffee/internal/service"
+	"io"
+	"log/slog"
+	"testing"
+)
+
+// newStorage opens a fresh data directory that is released when the test
+// ends.
+func newStorage(t *testing.T) *jsonfile.Storage {
+	storage, err := jsonfile.NewStorage(slog.New(slog.NewTextHandler(io.Discard, nil)), t.TempDir())
+	if err != nil {
+		t.Fatalf("NewStorage: %v", err)
+	}
+	t.Cleanup(func() { storage.Close() })
+	return storage
+}
+
+func TestInventoryRepo(t *testing.T) {
+	repotest.RunInventoryRepoSuite(t, func(t *testing.T) service.InventoryRepo { return newStorage(t) })
+}
+
+func TestMenuRepo(t *testing.T) {
+	repotest.RunMenuRepoSuite(t, func(t *testing.T) repotest.MenuStore { return newStorage(t) })
+}
+
+func TestOrderRepo(t *testing.T) {
+	repotest.RunOrderRepoSuite(t, func(t *testing.T) repotest.OrderStore { return newStorage(t) })
+}
+
+func TestDiscountRepo(t *testing.T) {
+	repotest.RunDiscountRepoSuite(t, func(t *testing.T) repotest.DiscountStore { return newStorage(t) })
+}
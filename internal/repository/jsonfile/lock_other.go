@@ -0,0 +1,13 @@
+//go:build !unix
+
+package jsonfile
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+)
+
+func lockFile(path string) (*os.File, error) {
+	return nil, fmt.Errorf("json file storage is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,38 @@
+package jsonfile
+
+import (
+	"github.com/weeweeshka/hot-coffee/internal/repository/memory"
+	"log/slog"
+)
+
+// Storage is the in-memory storage saved to a data directory as a JSON
+// snapshot and a journal of the rows every write changed, for shops that run
+// without a database. Every write reaches the disk before it returns. Only
+// one process can use a directory at a time.
+type Storage struct {
+	*memory.Storage
+	dir *dataDir
+}
+
+// NewStorage opens the data directory at path, creating it when missing,
+// and discards any write a crash interrupted.
+func NewStorage(logr *slog.Logger, path string) (*Storage, error) {
+	dir, err := openDataDir(logr, path)
+	if err != nil {
+		return nil, err
+	}
+
+	storage, err := memory.Open(logr, dir)
+	if err != nil {
+		dir.close()
+		return nil, err
+	}
+	logr.Info("using json file storage", "dir", path)
+
+	return &Storage{Storage: storage, dir: dir}, nil
+}
+
+// Close releases the data directory.
+func (s *Storage) Close() error {
+	return s.dir.close()
+}
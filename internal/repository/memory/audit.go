@@ -0,0 +1,52 @@
+package memory
+
+import (
+	"context"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"slices"
+)
+
+func (s *Storage) SaveAuditEntry(ctx context.Context, entry models.AuditEntry) (int64, error) {
+	var id int64
+	err := s.write(ctx, func(d *tables) error {
+		id = d.next("audit_log")
+		entry.ID = id
+		entry.Actor.StaffID = cloneID(entry.Actor.StaffID)
+		entry.Diff = slices.Clone(entry.Diff)
+		entry.CreatedAt = s.now()
+		d.Audit = append(d.Audit, entry)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (s *Storage) GetAuditLog(ctx context.Context, filter models.AuditFilter) ([]models.AuditEntry, error) {
+	var entries []models.AuditEntry
+	err := s.read(ctx, func(d *tables) error {
+		entries = []models.AuditEntry{}
+		for i := len(d.Audit) - 1; i >= 0 && len(entries) < filter.Limit; i-- {
+			entry := d.Audit[i]
+			switch {
+			case filter.StaffID != 0 && (entry.Actor.StaffID == nil || *entry.Actor.StaffID != filter.StaffID),
+				filter.Action != "" && entry.Action != filter.Action,
+				filter.EntityType != "" && entry.EntityType != filter.EntityType,
+				filter.EntityID != 0 && entry.EntityID != filter.EntityID,
+				filter.RequestID != "" && entry.RequestID != filter.RequestID,
+				!inRange(entry.CreatedAt, filter.From, filter.To):
+				continue
+			}
+
+			entry.Actor.StaffID = cloneID(entry.Actor.StaffID)
+			entry.Diff = slices.Clone(entry.Diff)
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,214 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"slices"
+)
+
+func (s *Storage) SaveCustomer(ctx context.Context, data models.Customer) (int64, error) {
+	var id int64
+	err := s.write(ctx, func(d *tables) error {
+		if err := d.checkCustomerContacts(0, data); err != nil {
+			return err
+		}
+
+		id = d.next("customers")
+		data.ID = id
+		data.CreatedAt = s.now()
+		d.Customers[id] = data
+		d.touch("customers", id)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (s *Storage) GetAllCustomers(ctx context.Context) ([]models.Customer, error) {
+	var customers []models.Customer
+	err := s.read(ctx, func(d *tables) error {
+		customers = make([]models.Customer, 0, len(d.Customers))
+		for _, c := range d.Customers {
+			customers = append(customers, c)
+		}
+		slices.SortFunc(customers, func(a, b models.Customer) int {
+			return cmp.Or(cmp.Compare(a.Name, b.Name), cmp.Compare(a.ID, b.ID))
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return customers, nil
+}
+
+func (s *Storage) GetCustomer(ctx context.Context, id int64) (models.Customer, error) {
+	var customer models.Customer
+	err := s.read(ctx, func(d *tables) error {
+		var ok bool
+		if customer, ok = d.Customers[id]; !ok {
+			return models.ErrNotFound
+		}
+		return nil
+	})
+	return customer, err
+}
+
+func (s *Storage) UpdateCustomer(ctx context.Context, id int64, customer models.Customer) (models.Customer, error) {
+	err := s.write(ctx, func(d *tables) error {
+		current, ok := d.Customers[id]
+		if !ok {
+			return models.ErrNotFound
+		}
+		if err := d.checkCustomerContacts(id, customer); err != nil {
+			return err
+		}
+
+		customer.ID, customer.CreatedAt = id, current.CreatedAt
+		d.Customers[id] = customer
+		d.touch("customers", id)
+		return nil
+	})
+	if err != nil {
+		return models.Customer{}, err
+	}
+	return customer, nil
+}
+
+// DeleteCustomer removes the customer with their favorites and loyalty
+// account. Their orders and promotion usages are kept without them.
+func (s *Storage) DeleteCustomer(ctx context.Context, id int64) error {
+	return s.write(ctx, func(d *tables) error {
+		if _, ok := d.Customers[id]; !ok {
+			return models.ErrNotFound
+		}
+
+		delete(d.Customers, id)
+		d.touch("customers", id)
+		for orderID, order := range d.Orders {
+			if order.CustomerID != nil && *order.CustomerID == id {
+				order.CustomerID = nil
+				d.Orders[orderID] = order
+				d.touch("orders", orderID)
+			}
+		}
+		for favoriteID, f := range d.Favorites {
+			if f.CustomerID == id {
+				delete(d.Favorites, favoriteID)
+				d.touch("favorites", favoriteID)
+			}
+		}
+		d.Loyalty = slices.DeleteFunc(d.Loyalty, func(e models.LoyaltyEntry) bool { return e.CustomerID == id })
+		d.rewrite("loyalty")
+		for redemptionID, r := range d.Redemptions {
+			if r.CustomerID == id {
+				delete(d.Redemptions, redemptionID)
+				d.touch("redemptions", redemptionID)
+			}
+		}
+		for i, u := range d.Usages {
+			if u.CustomerID != nil && *u.CustomerID == id {
+				d.Usages[i].CustomerID = nil
+				d.touch("usages", int64(i))
+			}
+		}
+		return nil
+	})
+}
+
+func (s *Storage) GetCustomerOrders(ctx context.Context, id int64) ([]models.Order, error) {
+	if _, err := s.GetCustomer(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.queryOrders(ctx, func(o models.Order) bool {
+		return o.CustomerID != nil && *o.CustomerID == id
+	})
+}
+
+func (s *Storage) SaveFavorite(ctx context.Context, data models.FavoriteOrder) (int64, error) {
+	var id int64
+	err := s.write(ctx, func(d *tables) error {
+		if _, ok := d.Customers[data.CustomerID]; !ok {
+			return models.ErrNotFound
+		}
+
+		id = d.next("customer_favorites")
+		data.ID = id
+		data.CreatedAt = s.now()
+		d.Favorites[id] = cloneFavorite(data)
+		d.touch("favorites", id)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (s *Storage) GetFavorites(ctx context.Context, customerID int64) ([]models.FavoriteOrder, error) {
+	var favorites []models.FavoriteOrder
+	err := s.read(ctx, func(d *tables) error {
+		favorites = []models.FavoriteOrder{}
+		ids := sortedKeys(d.Favorites)
+		for i := len(ids) - 1; i >= 0; i-- {
+			if f := d.Favorites[ids[i]]; f.CustomerID == customerID {
+				favorites = append(favorites, cloneFavorite(f))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return favorites, nil
+}
+
+func (s *Storage) GetFavorite(ctx context.Context, customerID, favoriteID int64) (models.FavoriteOrder, error) {
+	var favorite models.FavoriteOrder
+	err := s.read(ctx, func(d *tables) error {
+		f, ok := d.Favorites[favoriteID]
+		if !ok || f.CustomerID != customerID {
+			return models.ErrNotFound
+		}
+		favorite = cloneFavorite(f)
+		return nil
+	})
+	return favorite, err
+}
+
+func (s *Storage) DeleteFavorite(ctx context.Context, customerID, favoriteID int64) error {
+	return s.write(ctx, func(d *tables) error {
+		f, ok := d.Favorites[favoriteID]
+		if !ok || f.CustomerID != customerID {
+			return models.ErrNotFound
+		}
+		delete(d.Favorites, favoriteID)
+		d.touch("favorites", favoriteID)
+		return nil
+	})
+}
+
+// checkCustomerContacts fails with models.ErrDuplicateCustomer when another
+// customer has the phone or email of c.
+func (d *tables) checkCustomerContacts(id int64, c models.Customer) error {
+	for _, other := range d.Customers {
+		if other.ID == id {
+			continue
+		}
+		if (c.Phone != "" && other.Phone == c.Phone) || (c.Email != "" && other.Email == c.Email) {
+			return models.ErrDuplicateCustomer
+		}
+	}
+	return nil
+}
+
+func cloneFavorite(f models.FavoriteOrder) models.FavoriteOrder {
+	f.Items = slices.Clone(f.Items)
+	for i := range f.Items {
+		f.Items[i].Modifiers = slices.Clone(f.Items[i].Modifiers)
+	}
+	return f
+}
@@ -0,0 +1,155 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"slices"
+	"time"
+)
+
+func (s *Storage) GetLoyaltyBalance(ctx context.Context, customerID int64) (int64, error) {
+	var balance int64
+	err := s.read(ctx, func(d *tables) error {
+		balance = d.loyaltyBalance(customerID)
+		return nil
+	})
+	return balance, err
+}
+
+func (s *Storage) GetLoyaltyHistory(ctx context.Context, customerID int64) ([]models.LoyaltyEntry, error) {
+	var history []models.LoyaltyEntry
+	err := s.read(ctx, func(d *tables) error {
+		history = []models.LoyaltyEntry{}
+		for _, e := range d.Loyalty {
+			if e.CustomerID == customerID {
+				e.OrderID, e.RedemptionID = cloneID(e.OrderID), cloneID(e.RedemptionID)
+				history = append(history, e)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// checkRedemption fails with models.ErrInsufficientPoints when the customer
+// cannot afford r.
+func (d *tables) checkRedemption(r models.LoyaltyRedemption) error {
+	if _, ok := d.Customers[r.CustomerID]; !ok {
+		return models.ErrNotFound
+	}
+	if balance := d.loyaltyBalance(r.CustomerID); balance < r.Points {
+		return fmt.Errorf("%w: %d needed, %d available", models.ErrInsufficientPoints, r.Points, balance)
+	}
+	return nil
+}
+
+// insertRedemption records a redemption checked by checkRedemption and
+// spends its points.
+func (d *tables) insertRedemption(r models.LoyaltyRedemption, now time.Time) {
+	r.ID = d.next("loyalty_redemptions")
+	r.CreatedAt = now
+	r.UndoneAt = nil
+	d.Redemptions[r.ID] = r
+	d.touch("redemptions", r.ID)
+
+	d.insertLoyalty(models.LoyaltyEntry{
+		CustomerID:   r.CustomerID,
+		Points:       -r.Points,
+		Reason:       models.LoyaltyRedeem,
+		OrderID:      &r.OrderID,
+		RedemptionID: &r.ID,
+	}, now)
+}
+
+func (s *Storage) GetRedemptions(ctx context.Context, customerID int64) ([]models.LoyaltyRedemption, error) {
+	return s.queryRedemptions(ctx, func(r models.LoyaltyRedemption) bool { return r.CustomerID == customerID })
+}
+
+// GetOrderRedemptions lists the redemptions made on the orders.
+func (s *Storage) GetOrderRedemptions(ctx context.Context, orderIDs ...int64) ([]models.LoyaltyRedemption, error) {
+	return s.queryRedemptions(ctx, func(r models.LoyaltyRedemption) bool { return slices.Contains(orderIDs, r.OrderID) })
+}
+
+// UndoRedemption gives the redemption's points back with a reversal entry,
+// unless the order is on its way to being paid.
+func (s *Storage) UndoRedemption(ctx context.Context, id int64) (models.LoyaltyRedemption, error) {
+	var r models.LoyaltyRedemption
+	err := s.write(ctx, func(d *tables) error {
+		var ok bool
+		if r, ok = d.Redemptions[id]; !ok {
+			return models.ErrNotFound
+		}
+		if r.UndoneAt != nil {
+			return models.ErrRedemptionUndone
+		}
+		// A deleted order will not be paid either.
+		if order, ok := d.Orders[r.OrderID]; ok && !models.CanUndoRedemption(order.Status) {
+			return fmt.Errorf("%w: order %d is %s", models.ErrOrderClosed, r.OrderID, order.Status)
+		}
+
+		r = d.undoRedemption(r, s.now())
+		r.UndoneAt = cloneTime(r.UndoneAt)
+		return nil
+	})
+	if err != nil {
+		return models.LoyaltyRedemption{}, err
+	}
+	return r, nil
+}
+
+// undoRedemption gives the points of r back with a reversal entry and
+// returns it undone.
+func (d *tables) undoRedemption(r models.LoyaltyRedemption, now time.Time) models.LoyaltyRedemption {
+	r.UndoneAt = &now
+	d.Redemptions[r.ID] = r
+	d.touch("redemptions", r.ID)
+
+	d.insertLoyalty(models.LoyaltyEntry{
+		CustomerID:   r.CustomerID,
+		Points:       r.Points,
+		Reason:       models.LoyaltyReversal,
+		OrderID:      &r.OrderID,
+		RedemptionID: &r.ID,
+	}, now)
+	return r
+}
+
+func (s *Storage) queryRedemptions(ctx context.Context, match func(models.LoyaltyRedemption) bool) ([]models.LoyaltyRedemption, error) {
+	var redemptions []models.LoyaltyRedemption
+	err := s.read(ctx, func(d *tables) error {
+		redemptions = []models.LoyaltyRedemption{}
+		for _, id := range sortedKeys(d.Redemptions) {
+			if r := d.Redemptions[id]; match(r) {
+				r.UndoneAt = cloneTime(r.UndoneAt)
+				redemptions = append(redemptions, r)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return redemptions, nil
+}
+
+func (d *tables) loyaltyBalance(customerID int64) int64 {
+	var balance int64
+	for _, e := range d.Loyalty {
+		if e.CustomerID == customerID {
+			balance += e.Points
+		}
+	}
+	return balance
+}
+
+func (d *tables) insertLoyalty(e models.LoyaltyEntry, at time.Time) models.LoyaltyEntry {
+	e.ID = d.next("loyalty_ledger")
+	e.CreatedAt = at
+	e.OrderID, e.RedemptionID = cloneID(e.OrderID), cloneID(e.RedemptionID)
+	d.Loyalty = append(d.Loyalty, e)
+	return e
+}
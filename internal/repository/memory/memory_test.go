@@ -0,0 +1,170 @@
+package memory_test
+
+import (
+	"context"
+	"errors"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"github.com/weeweeshka/hot-coffee/internal/repository/memory"
+	"github.com/weeweeshka/hot-coffee/internal/repository/repotest"
+	"github.com/weeweeshka/hot-coffee/internal/service"
+	"io"
+	"log/slog"
+	"testing"
+)
+
+func newStorage() *memory.Storage {
+	return memory.NewStorage(slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+func TestInventoryRepo(t *testing.T) {
+	repotest.RunInventoryRepoSuite(t, func(t *testing.T) service.InventoryRepo { return newStorage() })
+}
+
+func TestMenuRepo(t *testing.T) {
+	repotest.RunMenuRepoSuite(t, func(t *testing.T) repotest.MenuStore { return newStorage() })
+}
+
+func TestOrderRepo(t *testing.T) {
+	repotest.RunOrderRepoSuite(t, func(t *testing.T) repotest.OrderStore { return newStorage() })
+}
+
+func TestDiscountRepo(t *testing.T) {
+	repotest.RunDiscountRepoSuite(t, func(t *testing.T) repotest.DiscountStore { return newStorage() })
+}
+
+func saveIngredient(t *testing.T, s *memory.Storage, name string, quantity float64) int64 {
+	t.Helper()
+	id, err := s.SaveInventory(context.Background(), models.InventoryItem{Name: name, Quantity: quantity, Unit: "g"})
+	if err != nil {
+		t.Fatalf("SaveInventory: %v", err)
+	}
+	return id
+}
+
+func expectQuantity(t *testing.T, s *memory.Storage, id int64, want float64) {
+	t.Helper()
+	item, err := s.GetInventory(context.Background(), id)
+	if err != nil {
+		t.Fatalf("GetInventory: %v", err)
+	}
+	if item.Quantity != want {
+		t.Errorf("%s quantity = %g, want %g", item.Name, item.Quantity, want)
+	}
+}
+
+var latte = models.Order{
+	CustomerName: "ann",
+	Lines:        []models.PricedLine{{ProductID: 1, Name: "latte", Category: "coffee", Quantity: 1, UnitPrice: 400}},
+}
+
+func TestOrderDeductsStock(t *testing.T) {
+	ctx := context.Background()
+	s := newStorage()
+	beans := saveIngredient(t, s, "beans", 100)
+
+	id, _, err := s.SaveOrder(ctx, latte, []models.IngredientAmount{{IngredientID: beans, Quantity: 18}}, models.OrderDiscounts{})
+	if err != nil {
+		t.Fatalf("SaveOrder: %v", err)
+	}
+	expectQuantity(t, s, beans, 82)
+
+	order, err := s.GetOrder(ctx, id)
+	if err != nil {
+		t.Fatalf("GetOrder: %v", err)
+	}
+	if order.Status != models.StatusOpen || len(order.Lines) != 1 || order.Lines[0].ID == 0 {
+		t.Errorf("GetOrder = %+v, want an open order with one numbered line", order)
+	}
+}
+
+func TestRefusedOrderWritesNothing(t *testing.T) {
+	ctx := context.Background()
+	s := newStorage()
+	beans := saveIngredient(t, s, "beans", 100)
+	sugar := saveIngredient(t, s, "sugar", 5)
+
+	_, _, err := s.SaveOrder(ctx, latte, []models.IngredientAmount{
+		{IngredientID: beans, Quantity: 18},
+		{IngredientID: sugar, Quantity: 10},
+	}, models.OrderDiscounts{})
+	var shortage *models.InsufficientIngredientsError
+	if !errors.As(err, &shortage) || len(shortage.Shortages) != 1 || shortage.Shortages[0].IngredientID != sugar {
+		t.Fatalf("SaveOrder short of sugar: err = %v, want a shortage of sugar only", err)
+	}
+	expectQuantity(t, s, beans, 100)
+	expectQuantity(t, s, sugar, 5)
+	if orders, _ := s.GetOrders(ctx, models.OrderPage{Limit: 10}); len(orders) != 0 {
+		t.Errorf("a refused order was stored: %v", orders)
+	}
+
+	// The refused order did not use up an ID either.
+	id, _, err := s.SaveOrder(ctx, latte, []models.IngredientAmount{{IngredientID: beans, Quantity: 18}}, models.OrderDiscounts{})
+	if err != nil || id != 1 {
+		t.Errorf("SaveOrder = %d, %v; want 1", id, err)
+	}
+}
+
+func TestCancelAndDeleteRestock(t *testing.T) {
+	ctx := context.Background()
+	s := newStorage()
+	beans := saveIngredient(t, s, "beans", 100)
+	consumption := []models.IngredientAmount{{IngredientID: beans, Quantity: 18}}
+
+	cancelled, _, err := s.SaveOrder(ctx, latte, consumption, models.OrderDiscounts{})
+	if err != nil {
+		t.Fatalf("SaveOrder: %v", err)
+	}
+	deleted, _, err := s.SaveOrder(ctx, latte, consumption, models.OrderDiscounts{})
+	if err != nil {
+		t.Fatalf("SaveOrder: %v", err)
+	}
+	expectQuantity(t, s, beans, 64)
+
+	if _, err = s.CancelOrder(ctx, cancelled, models.StatusOpen); err != nil {
+		t.Fatalf("CancelOrder: %v", err)
+	}
+	expectQuantity(t, s, beans, 82)
+	if _, err = s.CancelOrder(ctx, cancelled, models.StatusOpen); !errors.Is(err, models.ErrInvalidTransition) {
+		t.Errorf("CancelOrder of a cancelled order: err = %v, want ErrInvalidTransition", err)
+	}
+	expectQuantity(t, s, beans, 82)
+
+	if err = s.DeleteOrder(ctx, deleted); err != nil {
+		t.Fatalf("DeleteOrder: %v", err)
+	}
+	expectQuantity(t, s, beans, 100)
+	if err = s.DeleteOrder(ctx, deleted); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("DeleteOrder of a deleted order: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestValuesAreCopied(t *testing.T) {
+	ctx := context.Background()
+	s := newStorage()
+	customer := int64(7)
+	order := latte
+	order.CustomerID = &customer
+	order.Lines = append([]models.PricedLine(nil), latte.Lines...)
+
+	id, _, err := s.SaveOrder(ctx, order, nil, models.OrderDiscounts{})
+	if err != nil {
+		t.Fatalf("SaveOrder: %v", err)
+	}
+	customer = 8
+	order.Lines[0].Name = "changed"
+
+	got, err := s.GetOrder(ctx, id)
+	if err != nil {
+		t.Fatalf("GetOrder: %v", err)
+	}
+	*got.CustomerID = 9
+	got.Lines[0].Name = "changed"
+
+	got, err = s.GetOrder(ctx, id)
+	if err != nil {
+		t.Fatalf("GetOrder: %v", err)
+	}
+	if *got.CustomerID != 7 || got.Lines[0].Name != "latte" {
+		t.Errorf("stored order changed with the caller's copy: customer %d, line %q", *got.CustomerID, got.Lines[0].Name)
+	}
+}
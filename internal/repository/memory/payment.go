@@ -0,0 +1,80 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"github.com/weeweeshka/hot-coffee/internal/money"
+)
+
+// SavePayment records the payment unless it would take what has been paid
+// towards the order over total.
+func (s *Storage) SavePayment(ctx context.Context, p models.Payment, total money.Amount) (models.Payment, error) {
+	err := s.write(ctx, func(d *tables) error {
+		if _, ok := d.Orders[p.OrderID]; !ok {
+			return models.ErrNotFound
+		}
+		if paid := d.orderPaid(p.OrderID); paid+p.Amount > total {
+			return fmt.Errorf("%w: %s due", models.ErrOverpayment, total-paid)
+		}
+
+		p.ID = d.next("payments")
+		p.Refunded = 0
+		p.CreatedAt = s.now()
+		d.Payments = append(d.Payments, p)
+		return nil
+	})
+	if err != nil {
+		return models.Payment{}, err
+	}
+	return p, nil
+}
+
+func (s *Storage) GetOrderPayments(ctx context.Context, orderID int64) ([]models.Payment, error) {
+	var payments []models.Payment
+	err := s.read(ctx, func(d *tables) error {
+		payments = []models.Payment{}
+		for _, p := range d.Payments {
+			if p.OrderID == orderID {
+				p.Refunded = d.paymentRefunded(p.ID)
+				payments = append(payments, p)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return payments, nil
+}
+
+func (s *Storage) OrderPaid(ctx context.Context, orderID int64) (money.Amount, error) {
+	var paid money.Amount
+	err := s.read(ctx, func(d *tables) error {
+		paid = d.orderPaid(orderID)
+		return nil
+	})
+	return paid, err
+}
+
+func (d *tables) orderPaid(orderID int64) money.Amount {
+	var paid money.Amount
+	for _, p := range d.Payments {
+		if p.OrderID == orderID {
+			paid += p.Amount
+		}
+	}
+	return paid
+}
+
+func (d *tables) paymentRefunded(paymentID int64) money.Amount {
+	var refunded money.Amount
+	for _, r := range d.Refunds {
+		for _, p := range r.Payments {
+			if p.PaymentID == paymentID {
+				refunded += p.Amount
+			}
+		}
+	}
+	return refunded
+}
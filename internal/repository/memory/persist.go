@@ -0,0 +1,405 @@
+package memory
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"log/slog"
+	"maps"
+	"slices"
+	"time"
+)
+
+// Persister keeps the data of a Storage as a snapshot of every table and a
+// journal of the records of the writes made since.
+type Persister interface {
+	// Load returns the last snapshot, nil when there is none, and the
+	// journal records written after it, oldest first.
+	Load() (snapshot json.RawMessage, journal []json.RawMessage, err error)
+	// Append adds the record of one write to the journal. It returns once
+	// the record is durable, or fails and leaves the journal as it was.
+	Append(record json.RawMessage) error
+	// Snapshot replaces the snapshot and empties the journal.
+	Snapshot(snapshot json.RawMessage) error
+}
+
+// ErrFailed is returned by every call on a Storage that could neither
+// journal a write nor put back the data it last persisted. Its data then
+// holds a write that was reported as failed, so it refuses to serve it
+// until a restart loads the persisted data again.
+var ErrFailed = errors.New("storage failed and needs a restart")
+
+// minCompaction is the size the journal grows to before the first snapshot.
+// After that a snapshot is taken once the journal outgrows the last one, so
+// the tables are encoded whole a bounded number of times per byte written.
+var minCompaction = 1 << 20
+
+// snapshot is every table as of the journal record Seq.
+type snapshot struct {
+	Seq    int64   `json:"seq"`
+	Tables *tables `json:"tables"`
+}
+
+// record is what one write changed. Sequences holds the ID sequences when
+// the write took an ID, Lists the lists it rewrote and Rows the rows it
+// changed in the other tables.
+type record struct {
+	Seq       int64                      `json:"seq"`
+	Sequences map[string]int64           `json:"sequences,omitempty"`
+	Lists     map[string]json.RawMessage `json:"lists,omitempty"`
+	Rows      []rowChange                `json:"rows,omitempty"`
+}
+
+// rowChange is a row as the write left it, nil when it was deleted. The ID
+// of a row of a list is its index.
+type rowChange struct {
+	Table string          `json:"table"`
+	ID    int64           `json:"id"`
+	Row   json.RawMessage `json:"row,omitempty"`
+}
+
+// journalState is what the storage knows of what it persisted.
+type journalState struct {
+	// seq is the number of the last record.
+	seq int64
+	// sequences and lengths are the ID sequences and the lengths of the
+	// lists as last persisted.
+	sequences map[string]int64
+	lengths   map[string]int
+	// size is the size of the journal and snapshotSize the size of the
+	// snapshot it follows.
+	size         int
+	snapshotSize int
+	compactAt    int
+}
+
+// Open returns a Storage that starts from the data of persister and
+// journals the rows every write changes before the write returns. A write
+// that cannot be journaled fails and leaves the data as it was.
+func Open(logr *slog.Logger, persister Persister) (*Storage, error) {
+	s := &Storage{
+		logr:      logr,
+		now:       func() time.Time { return time.Now().UTC().Truncate(time.Microsecond) },
+		persister: persister,
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load replaces the data with the snapshot and the journal records after it.
+func (s *Storage) load() error {
+	snap, journal, err := s.persister.Load()
+	if err != nil {
+		return fmt.Errorf("cannot load data: %w", err)
+	}
+
+	data := newTables()
+	state := snapshot{Tables: data}
+	if snap != nil {
+		if err = json.Unmarshal(snap, &state); err != nil {
+			return fmt.Errorf("cannot decode snapshot: %w", err)
+		}
+		if state.Tables != data {
+			return fmt.Errorf("cannot decode snapshot: no tables")
+		}
+	}
+
+	seq, size := state.Seq, 0
+	for _, b := range journal {
+		size += len(b)
+		var rec record
+		if err = json.Unmarshal(b, &rec); err != nil {
+			return fmt.Errorf("cannot decode journal record after %d: %w", seq, err)
+		}
+		if rec.Seq <= state.Seq {
+			// The snapshot was taken before the journal was emptied.
+			continue
+		}
+		if rec.Seq != seq+1 {
+			return fmt.Errorf("journal record %d follows record %d", rec.Seq, seq)
+		}
+		if err = data.apply(rec); err != nil {
+			return fmt.Errorf("cannot apply journal record %d: %w", rec.Seq, err)
+		}
+		seq = rec.Seq
+	}
+
+	data.changed = make(map[string]map[int64]bool)
+	data.rewritten = make(map[string]bool)
+	s.data = data
+	s.journal = journalState{
+		seq:          seq,
+		sequences:    maps.Clone(data.Sequences),
+		lengths:      data.listLengths(),
+		size:         size,
+		snapshotSize: len(snap),
+		compactAt:    max(minCompaction, len(snap)),
+	}
+	return nil
+}
+
+// persist journals the rows the last write changed. When that fails the
+// data goes back to what was last persisted.
+func (s *Storage) persist() error {
+	if s.persister == nil {
+		return nil
+	}
+	defer clear(s.data.changed)
+	defer clear(s.data.rewritten)
+
+	rec, err := s.record()
+	if err != nil {
+		return s.restore(fmt.Errorf("cannot encode data: %w", err))
+	}
+	if rec == nil {
+		return nil
+	}
+	b, err := json.Marshal(rec)
+	if err == nil {
+		err = s.persister.Append(b)
+	}
+	if err != nil {
+		return s.restore(fmt.Errorf("cannot save data: %w", err))
+	}
+
+	s.journal.seq = rec.Seq
+	s.journal.sequences = maps.Clone(s.data.Sequences)
+	s.journal.lengths = s.data.listLengths()
+	s.journal.size += len(b)
+	if s.journal.size >= s.journal.compactAt {
+		s.compact()
+	}
+	return nil
+}
+
+// record collects what the last write changed, nil when it changed nothing.
+func (s *Storage) record() (*record, error) {
+	d := s.data
+	tables := d.rowTables()
+	rec := record{Seq: s.journal.seq + 1}
+	if !maps.Equal(d.Sequences, s.journal.sequences) {
+		rec.Sequences = d.Sequences
+	}
+
+	for name, t := range tables {
+		l, ok := t.(listTable)
+		if !ok {
+			continue
+		}
+		if d.rewritten[name] {
+			b, err := l.encodeAll()
+			if err != nil {
+				return nil, err
+			}
+			if rec.Lists == nil {
+				rec.Lists = make(map[string]json.RawMessage)
+			}
+			rec.Lists[name] = b
+			continue
+		}
+		for i := s.journal.lengths[name]; i < l.length(); i++ {
+			d.touch(name, int64(i))
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(d.changed)) {
+		if rec.Lists[name] != nil {
+			continue
+		}
+		t, ok := tables[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown table %q", name)
+		}
+		for _, id := range sortedKeys(d.changed[name]) {
+			row, err := t.encode(id)
+			if err != nil {
+				return nil, err
+			}
+			rec.Rows = append(rec.Rows, rowChange{Table: name, ID: id, Row: row})
+		}
+	}
+
+	if rec.Sequences == nil && rec.Lists == nil && rec.Rows == nil {
+		return nil, nil
+	}
+	return &rec, nil
+}
+
+// apply makes the changes of a journal record.
+func (d *tables) apply(rec record) error {
+	if rec.Sequences != nil {
+		d.Sequences = rec.Sequences
+	}
+	tables := d.rowTables()
+	for name, b := range rec.Lists {
+		l, ok := tables[name].(listTable)
+		if !ok {
+			return fmt.Errorf("unknown list %q", name)
+		}
+		if err := l.decodeAll(b); err != nil {
+			return fmt.Errorf("cannot decode %s: %w", name, err)
+		}
+	}
+	for _, change := range rec.Rows {
+		t, ok := tables[change.Table]
+		if !ok {
+			return fmt.Errorf("unknown table %q", change.Table)
+		}
+		if err := t.decode(change.ID, change.Row); err != nil {
+			return fmt.Errorf("cannot decode %s row %d: %w", change.Table, change.ID, err)
+		}
+	}
+	return nil
+}
+
+// restore puts back the data as last persisted after a write could not be
+// saved for cause, and returns cause. When the data cannot be put back the
+// storage fails: it refuses every call from then on.
+func (s *Storage) restore(cause error) error {
+	if err := s.load(); err != nil {
+		s.failed = fmt.Errorf("%w: %w", ErrFailed, err)
+		s.logr.Error("cannot restore saved data, refusing every call until restart", "err", err)
+		return fmt.Errorf("%w, then %w", cause, s.failed)
+	}
+	return cause
+}
+
+// compact replaces the snapshot with the data as it is and empties the
+// journal. A failure only postpones that: the journal still holds every
+// write.
+func (s *Storage) compact() {
+	b, err := json.Marshal(snapshot{Seq: s.journal.seq, Tables: s.data})
+	if err == nil {
+		err = s.persister.Snapshot(b)
+	}
+	if err != nil {
+		s.logr.Warn("cannot snapshot data", "err", err)
+		s.journal.compactAt = s.journal.size + max(minCompaction, s.journal.snapshotSize)
+		return
+	}
+	s.journal.size = 0
+	s.journal.snapshotSize = len(b)
+	s.journal.compactAt = max(minCompaction, len(b))
+}
+
+// rowTables returns the tables the journal records row by row, by their
+// names in the snapshot.
+func (d *tables) rowTables() map[string]rowTable {
+	return map[string]rowTable{
+		"inventory":    keyed[models.InventoryItem](d.Inventory),
+		"transactions": list[models.InventoryTransaction]{&d.Transactions},
+		"menus":        keyed[models.MenuItem](d.Menus),
+		"orders":       keyed[models.Order](d.Orders),
+		"customers":    keyed[models.Customer](d.Customers),
+		"favorites":    keyed[models.FavoriteOrder](d.Favorites),
+		"loyalty":      list[models.LoyaltyEntry]{&d.Loyalty},
+		"redemptions":  keyed[models.LoyaltyRedemption](d.Redemptions),
+		"promotions":   keyed[models.Promotion](d.Promotions),
+		"usages":       list[models.PromotionUsage]{&d.Usages},
+		"payments":     list[models.Payment]{&d.Payments},
+		"refunds":      list[models.Refund]{&d.Refunds},
+		"shifts":       keyed[models.Shift](d.Shifts),
+		"staff":        keyed[models.Staff](d.Staff),
+		"passwords":    keyed[string](d.Passwords),
+		"audit":        list[models.AuditEntry]{&d.Audit},
+	}
+}
+
+// listLengths returns the number of rows of every list.
+func (d *tables) listLengths() map[string]int {
+	lengths := make(map[string]int)
+	for name, t := range d.rowTables() {
+		if l, ok := t.(listTable); ok {
+			lengths[name] = l.length()
+		}
+	}
+	return lengths
+}
+
+// rowTable encodes and decodes single rows of a table. A nil row is one
+// that is not there.
+type rowTable interface {
+	encode(id int64) (json.RawMessage, error)
+	decode(id int64, row json.RawMessage) error
+}
+
+// listTable is a rowTable kept in order of insertion.
+type listTable interface {
+	rowTable
+	length() int
+	encodeAll() (json.RawMessage, error)
+	decodeAll(rows json.RawMessage) error
+}
+
+// keyed is a table keyed by ID.
+type keyed[V any] map[int64]V
+
+func (t keyed[V]) encode(id int64) (json.RawMessage, error) {
+	v, ok := t[id]
+	if !ok {
+		return nil, nil
+	}
+	return json.Marshal(v)
+}
+
+func (t keyed[V]) decode(id int64, row json.RawMessage) error {
+	if row == nil {
+		delete(t, id)
+		return nil
+	}
+	var v V
+	if err := json.Unmarshal(row, &v); err != nil {
+		return err
+	}
+	t[id] = v
+	return nil
+}
+
+// list is a table whose rows are identified by their index.
+type list[V any] struct {
+	rows *[]V
+}
+
+func (l list[V]) length() int {
+	return len(*l.rows)
+}
+
+func (l list[V]) encode(i int64) (json.RawMessage, error) {
+	if i < 0 || i >= int64(len(*l.rows)) {
+		return nil, fmt.Errorf("row %d is out of %d", i, len(*l.rows))
+	}
+	return json.Marshal((*l.rows)[i])
+}
+
+// decode replaces the row at i, or appends it when i is just past the end.
+func (l list[V]) decode(i int64, row json.RawMessage) error {
+	if row == nil || i < 0 || i > int64(len(*l.rows)) {
+		return fmt.Errorf("row %d is out of %d", i, len(*l.rows))
+	}
+	var v V
+	if err := json.Unmarshal(row, &v); err != nil {
+		return err
+	}
+	if i == int64(len(*l.rows)) {
+		*l.rows = append(*l.rows, v)
+	} else {
+		(*l.rows)[i] = v
+	}
+	return nil
+}
+
+func (l list[V]) encodeAll() (json.RawMessage, error) {
+	return json.Marshal(*l.rows)
+}
+
+func (l list[V]) decodeAll(rows json.RawMessage) error {
+	var v []V
+	if err := json.Unmarshal(rows, &v); err != nil {
+		return err
+	}
+	*l.rows = v
+	return nil
+}
@@ -0,0 +1,361 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"github.com/weeweeshka/hot-coffee/internal/money"
+	"github.com/weeweeshka/hot-coffee/internal/repository/repotest"
+	"github.com/weeweeshka/hot-coffee/internal/service"
+	"io"
+	"log/slog"
+	"slices"
+	"testing"
+)
+
+// fakePersister keeps the snapshot and the journal in memory and fails the
+// next append when fail is set and every load while failLoad is.
+type fakePersister struct {
+	snapshot  json.RawMessage
+	journal   []json.RawMessage
+	snapshots int
+	fail      bool
+	failLoad  bool
+}
+
+func (p *fakePersister) Load() (json.RawMessage, []json.RawMessage, error) {
+	if p.failLoad {
+		return nil, nil, errors.New("disk gone")
+	}
+	return p.snapshot, slices.Clone(p.journal), nil
+}
+
+func (p *fakePersister) Append(record json.RawMessage) error {
+	if p.fail {
+		p.fail = false
+		return errors.New("disk full")
+	}
+	p.journal = append(p.journal, slices.Clone(record))
+	return nil
+}
+
+func (p *fakePersister) Snapshot(snapshot json.RawMessage) error {
+	p.snapshot = slices.Clone(snapshot)
+	p.journal = nil
+	p.snapshots++
+	return nil
+}
+
+var discard = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// openPersisted opens a storage on a fresh persister and checks that the
+// data replays after every write.
+func openPersisted(t *testing.T) (*Storage, *fakePersister) {
+	t.Helper()
+	p := &fakePersister{}
+	s, err := Open(discard, p)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	s.written = func() { expectReplays(t, s, p) }
+	return s, p
+}
+
+// expectReplays opens a second storage on what p holds and compares its data
+// to that of s, which the write just made holds locked.
+func expectReplays(t *testing.T, s *Storage, p *fakePersister) {
+	t.Helper()
+	replayed, err := Open(discard, p)
+	if err != nil {
+		t.Errorf("replay: %v", err)
+		return
+	}
+	want, _ := json.Marshal(s.data)
+	got, _ := json.Marshal(replayed.data)
+	if string(got) != string(want) {
+		t.Errorf("replayed data differs:\n got %s\nwant %s", got, want)
+	}
+}
+
+func TestJournalRewritesLists(t *testing.T) {
+	ctx := context.Background()
+	s, p := openPersisted(t)
+
+	var customers []int64
+	for _, name := range []string{"ann", "bob"} {
+		id, err := s.SaveCustomer(ctx, models.Customer{Name: name})
+		if err != nil {
+			t.Fatalf("SaveCustomer: %v", err)
+		}
+		order, _, err := s.SaveOrder(ctx, models.Order{CustomerID: &id, CustomerName: name}, nil, models.OrderDiscounts{})
+		if err != nil {
+			t.Fatalf("SaveOrder: %v", err)
+		}
+		if _, err = s.CloseOrder(ctx, order, models.StatusOpen, 0, 10); err != nil {
+			t.Fatalf("CloseOrder: %v", err)
+		}
+		customers = append(customers, id)
+	}
+	if err := s.DeleteCustomer(ctx, customers[0]); err != nil {
+		t.Fatalf("DeleteCustomer: %v", err)
+	}
+
+	menu, err := s.SaveMenu(ctx, models.MenuItem{Name: "latte", Category: "coffee", Price: money.Amount(400)})
+	if err != nil {
+		t.Fatalf("SaveMenu: %v", err)
+	}
+	_, err = s.SavePromotion(ctx, models.Promotion{Code: "LATTE", Name: "latte", Type: models.DiscountFixed, Value: 50, ProductID: menu})
+	if err != nil {
+		t.Fatalf("SavePromotion: %v", err)
+	}
+	if err = s.DeleteMenu(ctx, menu); err != nil {
+		t.Fatalf("DeleteMenu: %v", err)
+	}
+
+	if p.snapshots != 0 {
+		t.Errorf("%d snapshots taken, want the journal only", p.snapshots)
+	}
+	if n := len(p.journal); n != 10 {
+		t.Errorf("journal holds %d records, want one per write, 10", n)
+	}
+}
+
+func TestFailedAppendLeavesData(t *testing.T) {
+	ctx := context.Background()
+	s, p := openPersisted(t)
+
+	id, err := s.SaveStaff(ctx, models.Staff{Username: "ann", Role: models.RoleBarista, Active: true, PasswordHash: "hash"})
+	if err != nil {
+		t.Fatalf("SaveStaff: %v", err)
+	}
+
+	p.fail = true
+	if _, err = s.SaveStaff(ctx, models.Staff{Username: "bob", Role: models.RoleBarista, Active: true}); err == nil {
+		t.Fatal("SaveStaff with a failing journal: err = nil")
+	}
+	staff, err := s.GetAllStaff(ctx)
+	if err != nil {
+		t.Fatalf("GetAllStaff: %v", err)
+	}
+	if len(staff) != 1 || staff[0].ID != id {
+		t.Errorf("staff after a failed save = %v, want only %d", staff, id)
+	}
+
+	// The sequence went back too, so the next staff member gets the ID the
+	// failed one would have had.
+	next, err := s.SaveStaff(ctx, models.Staff{Username: "bob", Role: models.RoleBarista, Active: true})
+	if err != nil {
+		t.Fatalf("SaveStaff: %v", err)
+	}
+	if next != id+1 {
+		t.Errorf("SaveStaff after a failed save = %d, want %d", next, id+1)
+	}
+}
+
+func TestFailedRestoreRefusesCalls(t *testing.T) {
+	ctx := context.Background()
+	s, p := openPersisted(t)
+	s.written = nil
+
+	if _, err := s.SaveStaff(ctx, models.Staff{Username: "ann", Role: models.RoleBarista, Active: true}); err != nil {
+		t.Fatalf("SaveStaff: %v", err)
+	}
+
+	p.fail, p.failLoad = true, true
+	if _, err := s.SaveStaff(ctx, models.Staff{Username: "bob", Role: models.RoleBarista, Active: true}); !errors.Is(err, ErrFailed) {
+		t.Fatalf("SaveStaff that cannot be saved nor undone: err = %v, want ErrFailed", err)
+	}
+
+	// The journal works again, but the data still holds bob, whose save
+	// failed, so nothing is served until a restart.
+	p.failLoad = false
+	if _, err := s.SaveStaff(ctx, models.Staff{Username: "cat", Role: models.RoleBarista, Active: true}); !errors.Is(err, ErrFailed) {
+		t.Errorf("SaveStaff after the failure: err = %v, want ErrFailed", err)
+	}
+	if _, err := s.GetAllStaff(ctx); !errors.Is(err, ErrFailed) {
+		t.Errorf("GetAllStaff after the failure: err = %v, want ErrFailed", err)
+	}
+	if n := len(p.journal); n != 1 {
+		t.Errorf("journal holds %d records, want ann's only", n)
+	}
+
+	restarted, err := Open(discard, p)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	staff, err := restarted.GetAllStaff(ctx)
+	if err != nil || len(staff) != 1 || staff[0].Username != "ann" {
+		t.Errorf("GetAllStaff after a restart = %v, %v; want ann only", staff, err)
+	}
+}
+
+// runSuites runs the repository suites and everyWrite on storages that
+// check their data replays after every write.
+func runSuites(t *testing.T) {
+	t.Run("Inventory", func(t *testing.T) {
+		repotest.RunInventoryRepoSuite(t, func(t *testing.T) service.InventoryRepo { s, _ := openPersisted(t); return s })
+	})
+	t.Run("Menu", func(t *testing.T) {
+		repotest.RunMenuRepoSuite(t, func(t *testing.T) repotest.MenuStore { s, _ := openPersisted(t); return s })
+	})
+	t.Run("Order", func(t *testing.T) {
+		repotest.RunOrderRepoSuite(t, func(t *testing.T) repotest.OrderStore { s, _ := openPersisted(t); return s })
+	})
+	t.Run("Discount", func(t *testing.T) {
+		repotest.RunDiscountRepoSuite(t, func(t *testing.T) repotest.DiscountStore { s, _ := openPersisted(t); return s })
+	})
+	t.Run("EveryWrite", func(t *testing.T) {
+		s, _ := openPersisted(t)
+		everyWrite(t, s)
+	})
+}
+
+func TestJournalReplays(t *testing.T) {
+	runSuites(t)
+}
+
+func TestSnapshotReplays(t *testing.T) {
+	defer func(n int) { minCompaction = n }(minCompaction)
+	minCompaction = 0
+	runSuites(t)
+}
+
+// everyWrite makes every kind of write the storage has, so that the replay
+// check of openPersisted sees each of them.
+func everyWrite(t *testing.T, s *Storage) {
+	t.Helper()
+	ctx := context.Background()
+	must := func(op string, err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("%s: %v", op, err)
+		}
+	}
+
+	milk, err := s.SaveInventory(ctx, models.InventoryItem{Name: "milk", Quantity: 1000, Unit: "ml"})
+	must("SaveInventory", err)
+	_, err = s.UpdateInventory(ctx, milk, models.InventoryItem{Name: "whole milk", Quantity: 1000, Unit: "ml"})
+	must("UpdateInventory", err)
+	_, err = s.AddInventoryTransaction(ctx, models.InventoryTransaction{IngredientID: milk, Delta: 500, Reason: models.ReasonRestock})
+	must("AddInventoryTransaction", err)
+	sugar, err := s.SaveInventory(ctx, models.InventoryItem{Name: "sugar", Quantity: 10, Unit: "g"})
+	must("SaveInventory", err)
+	must("DeleteInventory", s.DeleteInventory(ctx, sugar))
+
+	latte := models.MenuItem{
+		Name:        "latte",
+		Category:    "coffee",
+		Price:       money.Amount(400),
+		Ingredients: []models.MenuItemIngredient{{IngredientID: milk, Quantity: 200}},
+	}
+	latte.ID, err = s.SaveMenu(ctx, latte)
+	must("SaveMenu", err)
+	latte.Price = 450
+	_, err = s.UpdateMenu(ctx, latte.ID, latte)
+	must("UpdateMenu", err)
+	tea, err := s.SaveMenu(ctx, models.MenuItem{Name: "tea", Category: "tea", Price: money.Amount(300)})
+	must("SaveMenu", err)
+	must("DeleteMenu", s.DeleteMenu(ctx, tea))
+
+	customer, err := s.SaveCustomer(ctx, models.Customer{Name: "ann"})
+	must("SaveCustomer", err)
+	_, err = s.UpdateCustomer(ctx, customer, models.Customer{Name: "ann lee"})
+	must("UpdateCustomer", err)
+	favorite, err := s.SaveFavorite(ctx, models.FavoriteOrder{
+		CustomerID: customer,
+		Name:       "usual",
+		Items:      []models.OrderItem{{ProductID: latte.ID, Quantity: 1}},
+	})
+	must("SaveFavorite", err)
+	must("DeleteFavorite", s.DeleteFavorite(ctx, customer, favorite))
+	other, err := s.SaveCustomer(ctx, models.Customer{Name: "bob"})
+	must("SaveCustomer", err)
+	must("DeleteCustomer", s.DeleteCustomer(ctx, other))
+
+	line := models.PricedLine{ProductID: latte.ID, Name: latte.Name, Category: latte.Category, Quantity: 1, UnitPrice: latte.Price}
+	consumption := []models.IngredientAmount{{IngredientID: milk, Quantity: 200}}
+	orderOf := func() models.Order {
+		return models.Order{CustomerID: &customer, CustomerName: "ann lee", Lines: []models.PricedLine{line}}
+	}
+	order, _, err := s.SaveOrder(ctx, orderOf(), consumption, models.OrderDiscounts{})
+	must("SaveOrder", err)
+	updated := orderOf()
+	updated.Lines[0].Quantity = 2
+	_, _, err = s.UpdateOrder(ctx, order, updated, []models.IngredientAmount{{IngredientID: milk, Quantity: 400}}, nil)
+	must("UpdateOrder", err)
+
+	promotion := models.Promotion{Code: "TENOFF", Name: "ten off", Type: models.DiscountFixed, Value: 100}
+	promotion.ID, err = s.SavePromotion(ctx, promotion)
+	must("SavePromotion", err)
+	promotion.Name = "ten off anything"
+	_, err = s.UpdatePromotion(ctx, promotion.ID, promotion)
+	must("UpdatePromotion", err)
+	_, err = s.SavePayment(ctx, models.Payment{OrderID: order, Method: models.PaymentCash, Amount: 900}, 900)
+	must("SavePayment", err)
+	_, err = s.SetOrderStatus(ctx, order, models.StatusOpen, models.StatusInProgress)
+	must("SetOrderStatus", err)
+	_, err = s.CloseOrder(ctx, order, models.StatusInProgress, 100, 100)
+	must("CloseOrder", err)
+	discounted, _, err := s.SaveOrder(ctx, orderOf(), consumption, models.OrderDiscounts{
+		Promotion:  &promotion,
+		Usage:      models.PromotionUsage{CustomerID: &customer, Amount: 100},
+		Redemption: &models.LoyaltyRedemption{CustomerID: customer, Reward: models.RewardDiscount, Points: 50, Value: 50},
+	})
+	must("SaveOrder", err)
+	usages, err := s.GetOrderPromotionUsages(ctx, discounted)
+	if err != nil || len(usages) != 1 {
+		t.Fatalf("GetOrderPromotionUsages = %v, %v; want one usage", usages, err)
+	}
+	usages[0].Amount = 50
+	_, _, err = s.UpdateOrder(ctx, discounted, orderOf(), consumption, usages)
+	must("UpdateOrder", err)
+	redemptions, err := s.GetOrderRedemptions(ctx, discounted)
+	if err != nil || len(redemptions) != 1 {
+		t.Fatalf("GetOrderRedemptions = %v, %v; want one redemption", redemptions, err)
+	}
+	_, err = s.UndoRedemption(ctx, redemptions[0].ID)
+	must("UndoRedemption", err)
+
+	paid, err := s.GetOrder(ctx, order)
+	must("GetOrder", err)
+	_, err = s.SaveRefund(ctx, models.Refund{
+		OrderID: order,
+		Reason:  "spilled",
+		Restock: true,
+		Amount:  450,
+		Lines:   []models.RefundLine{{LineID: paid.Lines[0].ID, Quantity: 1}},
+	}, []models.IngredientAmount{{IngredientID: milk, Quantity: 200}}, 900)
+	must("SaveRefund", err)
+
+	released := func() models.OrderDiscounts {
+		return models.OrderDiscounts{
+			Promotion:  &promotion,
+			Usage:      models.PromotionUsage{CustomerID: &customer, Amount: 100},
+			Redemption: &models.LoyaltyRedemption{CustomerID: customer, Reward: models.RewardDiscount, Points: 20, Value: 20},
+		}
+	}
+	cancelled, _, err := s.SaveOrder(ctx, orderOf(), consumption, released())
+	must("SaveOrder", err)
+	_, err = s.CancelOrder(ctx, cancelled, models.StatusOpen)
+	must("CancelOrder", err)
+	deleted, _, err := s.SaveOrder(ctx, orderOf(), consumption, released())
+	must("SaveOrder", err)
+	must("DeleteOrder", s.DeleteOrder(ctx, deleted))
+	must("DeactivatePromotion", s.DeactivatePromotion(ctx, promotion.ID))
+
+	_, err = s.SaveAuditEntry(ctx, models.AuditEntry{Action: models.AuditCreate, EntityType: models.EntityOrder, EntityID: order})
+	must("SaveAuditEntry", err)
+
+	shift, err := s.StartShift(ctx, "ann")
+	must("StartShift", err)
+	_, err = s.EndShift(ctx, shift.ID)
+	must("EndShift", err)
+
+	staff := models.Staff{Username: "ann", Name: "Ann", Role: models.RoleBarista, Active: true, PasswordHash: "old"}
+	staff.ID, err = s.SaveStaff(ctx, staff)
+	must("SaveStaff", err)
+	staff.Role, staff.PasswordHash = models.RoleShiftLead, "new"
+	_, err = s.UpdateStaff(ctx, staff.ID, staff)
+	must("UpdateStaff", err)
+}
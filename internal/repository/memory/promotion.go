@@ -0,0 +1,194 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"github.com/weeweeshka/hot-coffee/internal/money"
+	"slices"
+	"time"
+)
+
+func (s *Storage) SavePromotion(ctx context.Context, p models.Promotion) (int64, error) {
+	var id int64
+	err := s.write(ctx, func(d *tables) error {
+		if err := d.checkPromotionCode(0, p.Code); err != nil {
+			return err
+		}
+
+		id = d.next("promotions")
+		p.ID = id
+		p.CreatedAt = s.now()
+		d.Promotions[id] = clonePromotion(p)
+		d.touch("promotions", id)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (s *Storage) GetAllPromotions(ctx context.Context) ([]models.Promotion, error) {
+	var promotions []models.Promotion
+	err := s.read(ctx, func(d *tables) error {
+		promotions = []models.Promotion{}
+		ids := sortedKeys(d.Promotions)
+		for i := len(ids) - 1; i >= 0; i-- {
+			promotions = append(promotions, clonePromotion(d.Promotions[ids[i]]))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return promotions, nil
+}
+
+func (s *Storage) GetPromotion(ctx context.Context, id int64) (models.Promotion, error) {
+	return s.queryPromotion(ctx, func(p models.Promotion) bool { return p.ID == id })
+}
+
+func (s *Storage) GetPromotionByCode(ctx context.Context, code string) (models.Promotion, error) {
+	return s.queryPromotion(ctx, func(p models.Promotion) bool { return p.Code == code })
+}
+
+func (s *Storage) UpdatePromotion(ctx context.Context, id int64, p models.Promotion) (models.Promotion, error) {
+	err := s.write(ctx, func(d *tables) error {
+		current, ok := d.Promotions[id]
+		if !ok {
+			return models.ErrNotFound
+		}
+		if err := d.checkPromotionCode(id, p.Code); err != nil {
+			return err
+		}
+
+		p.ID, p.CreatedAt = id, current.CreatedAt
+		d.Promotions[id] = clonePromotion(p)
+		d.touch("promotions", id)
+		return nil
+	})
+	if err != nil {
+		return models.Promotion{}, err
+	}
+	return p, nil
+}
+
+// DeactivatePromotion retires a code but keeps it for its usage history.
+func (s *Storage) DeactivatePromotion(ctx context.Context, id int64) error {
+	return s.write(ctx, func(d *tables) error {
+		p, ok := d.Promotions[id]
+		if !ok {
+			return models.ErrNotFound
+		}
+		p.Active = false
+		d.Promotions[id] = p
+		d.touch("promotions", id)
+		return nil
+	})
+}
+
+// checkPromotionUsage checks u against p's limits and the usages that are
+// not voided.
+func (d *tables) checkPromotionUsage(p models.Promotion, u models.PromotionUsage) error {
+	if _, ok := d.Promotions[p.ID]; !ok {
+		return models.ErrNotFound
+	}
+
+	var uses, customerUses int64
+	var given money.Amount
+	for _, used := range d.Usages {
+		if used.PromotionID != p.ID || used.VoidedAt != nil {
+			continue
+		}
+		uses++
+		given += used.Amount
+		if u.CustomerID != nil && used.CustomerID != nil && *used.CustomerID == *u.CustomerID {
+			customerUses++
+		}
+	}
+
+	switch {
+	case p.MaxUses > 0 && uses >= p.MaxUses:
+		return fmt.Errorf("%w: %s was used %d times", models.ErrPromoLimitReached, p.Code, uses)
+	case p.MaxUsesPerCustomer > 0 && u.CustomerID != nil && customerUses >= p.MaxUsesPerCustomer:
+		return fmt.Errorf("%w: customer used %s %d times", models.ErrPromoLimitReached, p.Code, customerUses)
+	case p.MaxDiscountTotal > 0 && given+u.Amount > p.MaxDiscountTotal:
+		return fmt.Errorf("%w: %s has %s of its budget left", models.ErrPromoLimitReached, p.Code, p.MaxDiscountTotal-given)
+	}
+	return nil
+}
+
+// insertPromotionUsage records a usage of p checked by checkPromotionUsage.
+func (d *tables) insertPromotionUsage(p models.Promotion, u models.PromotionUsage, now time.Time) {
+	u.ID = d.next("promotion_usages")
+	u.PromotionID = p.ID
+	u.CustomerID = cloneID(u.CustomerID)
+	u.CreatedAt = now
+	u.VoidedAt = nil
+	d.Usages = append(d.Usages, u)
+}
+
+// GetOrderPromotionUsages lists the usages of the orders that are not voided.
+func (s *Storage) GetOrderPromotionUsages(ctx context.Context, orderIDs ...int64) ([]models.PromotionUsage, error) {
+	var usages []models.PromotionUsage
+	err := s.read(ctx, func(d *tables) error {
+		usages = []models.PromotionUsage{}
+		for _, u := range d.Usages {
+			if !slices.Contains(orderIDs, u.OrderID) || u.VoidedAt != nil {
+				continue
+			}
+			p := d.Promotions[u.PromotionID]
+			u.Code, u.ProductID = p.Code, p.ProductID
+			u.CustomerID = cloneID(u.CustomerID)
+			usages = append(usages, u)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return usages, nil
+}
+
+func (s *Storage) queryPromotion(ctx context.Context, match func(models.Promotion) bool) (models.Promotion, error) {
+	var promotion models.Promotion
+	err := s.read(ctx, func(d *tables) error {
+		for _, p := range d.Promotions {
+			if match(p) {
+				promotion = clonePromotion(p)
+				return nil
+			}
+		}
+		return models.ErrNotFound
+	})
+	return promotion, err
+}
+
+func (d *tables) checkPromotionCode(id int64, code string) error {
+	for _, p := range d.Promotions {
+		if p.ID != id && p.Code == code {
+			return models.ErrDuplicatePromotion
+		}
+	}
+	return nil
+}
+
+// deletePromotion removes the promotion with its usages.
+func (d *tables) deletePromotion(id int64) {
+	delete(d.Promotions, id)
+	d.touch("promotions", id)
+	d.Usages = slices.DeleteFunc(d.Usages, func(u models.PromotionUsage) bool { return u.PromotionID == id })
+	d.rewrite("usages")
+}
+
+func clonePromotion(p models.Promotion) models.Promotion {
+	if p.Window != nil {
+		window := *p.Window
+		window.Days = slices.Clone(window.Days)
+		p.Window = &window
+	}
+	p.StartsAt = cloneTime(p.StartsAt)
+	p.EndsAt = cloneTime(p.EndsAt)
+	return p
+}
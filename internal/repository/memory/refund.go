@@ -0,0 +1,166 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"github.com/weeweeshka/hot-coffee/internal/money"
+	"slices"
+	"time"
+)
+
+// SaveRefund records the refund against its order lines and payments and
+// puts restock back into the inventory, failing with models.ErrInvalidRefund
+// when it gives back more than was sold or paid. Restocking never returns
+// more of an ingredient than the order still holds out of the inventory. The
+// points the order earned are taken back in the share of orderTotal refunded.
+func (s *Storage) SaveRefund(ctx context.Context, r models.Refund, restock []models.IngredientAmount, orderTotal money.Amount) (models.Refund, error) {
+	err := s.write(ctx, func(d *tables) error {
+		order, ok := d.Orders[r.OrderID]
+		if !ok {
+			return models.ErrNotFound
+		}
+
+		for _, line := range r.Lines {
+			i := slices.IndexFunc(order.Lines, func(l models.PricedLine) bool { return l.ID == line.LineID })
+			if i < 0 {
+				return fmt.Errorf("%w: line %d is not on order %d", models.ErrInvalidRefund, line.LineID, r.OrderID)
+			}
+			if left := order.Lines[i].Quantity - d.lineRefunded(line.LineID); line.Quantity > left {
+				return fmt.Errorf("%w: line %d has %d left to refund", models.ErrInvalidRefund, line.LineID, left)
+			}
+		}
+
+		for _, p := range r.Payments {
+			i := slices.IndexFunc(d.Payments, func(paid models.Payment) bool {
+				return paid.ID == p.PaymentID && paid.OrderID == r.OrderID
+			})
+			if i < 0 {
+				return fmt.Errorf("%w: payment %d is not on order %d", models.ErrInvalidRefund, p.PaymentID, r.OrderID)
+			}
+			if left := d.Payments[i].Amount - d.paymentRefunded(p.PaymentID); p.Amount > left {
+				return fmt.Errorf("%w: payment %d has %s left to refund", models.ErrInvalidRefund, p.PaymentID, left)
+			}
+		}
+
+		r.ID = d.next("refunds")
+		r.CreatedAt = s.now()
+		r = cloneRefund(r)
+		slices.SortFunc(r.Lines, func(a, b models.RefundLine) int { return cmp.Compare(a.LineID, b.LineID) })
+		slices.SortFunc(r.Payments, func(a, b models.PaymentRefund) int { return cmp.Compare(a.PaymentID, b.PaymentID) })
+		for i, p := range r.Payments {
+			paid := d.Payments[slices.IndexFunc(d.Payments, func(paid models.Payment) bool { return paid.ID == p.PaymentID })]
+			r.Payments[i].Method, r.Payments[i].Reference = paid.Method, paid.Reference
+		}
+		d.Refunds = append(d.Refunds, r)
+
+		d.restockRefund(r, restock, r.CreatedAt)
+		d.reverseEarnedPoints(r.OrderID, orderTotal, r.CreatedAt)
+		r = cloneRefund(r)
+		return nil
+	})
+	if err != nil {
+		return models.Refund{}, err
+	}
+	return r, nil
+}
+
+// reverseEarnedPoints takes back the points the order earned in proportion
+// to how much of orderTotal has been refunded so far, less what earlier
+// refunds took back. Reversals of redemptions name the redemption; those of
+// refunds do not.
+func (d *tables) reverseEarnedPoints(orderID int64, orderTotal money.Amount, at time.Time) {
+	var earn models.LoyaltyEntry
+	var reversed int64
+	for _, e := range d.Loyalty {
+		if e.OrderID == nil || *e.OrderID != orderID {
+			continue
+		}
+		switch {
+		case e.Reason == models.LoyaltyEarn:
+			earn = e
+		case e.Reason == models.LoyaltyReversal && e.RedemptionID == nil:
+			reversed -= e.Points
+		}
+	}
+	if earn.ID == 0 {
+		return
+	}
+
+	points := models.RefundedPoints(earn.Points, d.orderRefunded(orderID), orderTotal) - reversed
+	if points <= 0 {
+		return
+	}
+	d.insertLoyalty(models.LoyaltyEntry{
+		CustomerID: earn.CustomerID,
+		Points:     -points,
+		Reason:     models.LoyaltyReversal,
+		OrderID:    &orderID,
+	}, at)
+}
+
+func (d *tables) restockRefund(r models.Refund, restock []models.IngredientAmount, at time.Time) {
+	held := d.orderHeld(r.OrderID)
+	for _, c := range restock {
+		quantity := min(c.Quantity, held[c.IngredientID])
+		item, ok := d.Inventory[c.IngredientID]
+		if quantity <= 0 || !ok {
+			continue
+		}
+		held[c.IngredientID] -= quantity
+
+		item.Quantity += quantity
+		d.Inventory[c.IngredientID] = item
+		d.touch("inventory", c.IngredientID)
+		d.insertTransaction(models.InventoryTransaction{
+			IngredientID: c.IngredientID,
+			OrderID:      &r.OrderID,
+			Delta:        quantity,
+			Reason:       models.ReasonOrderReversal,
+			Note:         fmt.Sprintf("refund %d", r.ID),
+		}, at)
+	}
+}
+
+func (s *Storage) GetOrderRefunds(ctx context.Context, orderID int64) ([]models.Refund, error) {
+	var refunds []models.Refund
+	err := s.read(ctx, func(d *tables) error {
+		refunds = []models.Refund{}
+		for _, r := range d.Refunds {
+			if r.OrderID == orderID {
+				refunds = append(refunds, cloneRefund(r))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return refunds, nil
+}
+
+// lineRefunded is how many units of the order line have been refunded.
+func (d *tables) lineRefunded(lineID int64) int {
+	var refunded int
+	for _, r := range d.Refunds {
+		for _, line := range r.Lines {
+			if line.LineID == lineID {
+				refunded += line.Quantity
+			}
+		}
+	}
+	return refunded
+}
+
+func cloneRefund(r models.Refund) models.Refund {
+	r.Lines = slices.Clone(r.Lines)
+	if r.Lines == nil {
+		r.Lines = []models.RefundLine{}
+	}
+	r.Payments = slices.Clone(r.Payments)
+	if r.Payments == nil {
+		r.Payments = []models.PaymentRefund{}
+	}
+	return r
+}
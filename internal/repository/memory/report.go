@@ -0,0 +1,283 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"github.com/weeweeshka/hot-coffee/internal/money"
+	"slices"
+	"time"
+)
+
+// TotalSales sums closed orders by the time they were closed. Refunded items
+// are taken out of the revenue of the order they were sold on, and so is the
+// share of the order's discounts on what is left.
+func (s *Storage) TotalSales(ctx context.Context, from, to time.Time, groupBy models.SalesGrouping) (models.SalesReport, error) {
+	report := models.SalesReport{GroupBy: groupBy}
+	err := s.read(ctx, func(d *tables) error {
+		periods := make(map[time.Time]*models.SalesPeriod)
+		for _, order := range d.closedOrders(from, to) {
+			revenue := d.orderRevenue(order)
+			report.TotalRevenue += revenue
+			report.RefundTotal += d.orderRefunded(order.ID)
+			report.OrderCount++
+
+			if groupBy == "" {
+				continue
+			}
+			start := truncate(*order.ClosedAt, groupBy)
+			period, ok := periods[start]
+			if !ok {
+				period = &models.SalesPeriod{PeriodStart: start}
+				periods[start] = period
+			}
+			period.Revenue += revenue
+			period.OrderCount++
+		}
+
+		for _, period := range periods {
+			report.Series = append(report.Series, *period)
+		}
+		slices.SortFunc(report.Series, func(a, b models.SalesPeriod) int { return a.PeriodStart.Compare(b.PeriodStart) })
+		return nil
+	})
+	if err != nil {
+		return models.SalesReport{}, err
+	}
+	return report, nil
+}
+
+func (s *Storage) PopularItems(ctx context.Context, from, to time.Time, sortBy models.PopularItemsSort, limit int) ([]models.PopularItem, error) {
+	items := []models.PopularItem{}
+	err := s.read(ctx, func(d *tables) error {
+		type key struct{ product, variant int64 }
+		sold := make(map[key]*models.PopularItem)
+		for _, order := range d.closedOrders(from, to) {
+			for _, line := range order.Lines {
+				menu, ok := d.Menus[line.ProductID]
+				if !ok {
+					continue
+				}
+				k := key{line.ProductID, line.VariantID}
+				item, ok := sold[k]
+				if !ok {
+					item = &models.PopularItem{ProductID: menu.ID, Name: menu.Name, VariantID: line.VariantID}
+					for _, v := range menu.Variants {
+						if v.ID == line.VariantID {
+							item.VariantName = v.Name
+						}
+					}
+					sold[k] = item
+				}
+				quantity := line.Quantity - d.lineRefunded(line.ID)
+				item.QuantitySold += int64(quantity)
+				item.Revenue += line.UnitPrice.Mul(quantity)
+			}
+		}
+
+		var quantity int64
+		var revenue money.Amount
+		for _, item := range sold {
+			if item.QuantitySold > 0 {
+				items = append(items, *item)
+				quantity += item.QuantitySold
+				revenue += item.Revenue
+			}
+		}
+
+		quantityRanks := denseRanks(items, func(item models.PopularItem) int64 { return item.QuantitySold })
+		revenueRanks := denseRanks(items, func(item models.PopularItem) int64 { return int64(item.Revenue) })
+		for i := range items {
+			items[i].QuantityRank = quantityRanks[items[i].QuantitySold]
+			items[i].RevenueRank = revenueRanks[int64(items[i].Revenue)]
+			if quantity != 0 {
+				items[i].QuantityShare = float64(items[i].QuantitySold) / float64(quantity)
+			}
+			if revenue != 0 {
+				items[i].RevenueShare = float64(items[i].Revenue) / float64(revenue)
+			}
+		}
+
+		slices.SortFunc(items, func(a, b models.PopularItem) int {
+			rank := cmp.Compare(a.QuantityRank, b.QuantityRank)
+			if sortBy == models.SortByRevenue {
+				rank = cmp.Compare(a.RevenueRank, b.RevenueRank)
+			}
+			return cmp.Or(rank, cmp.Compare(a.Name, b.Name), cmp.Compare(a.VariantName, b.VariantName))
+		})
+		if limit >= 0 && len(items) > limit {
+			items = items[:limit]
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// PromotionUsage measures every promotion by the orders it was used on in
+// the period. Revenue counts closed orders only, net of all their discounts.
+func (s *Storage) PromotionUsage(ctx context.Context, from, to time.Time) ([]models.PromotionUsageStats, error) {
+	stats := []models.PromotionUsageStats{}
+	err := s.read(ctx, func(d *tables) error {
+		for _, id := range sortedKeys(d.Promotions) {
+			p := d.Promotions[id]
+			stat := models.PromotionUsageStats{PromotionID: p.ID, Code: p.Code, Name: p.Name}
+			customers := make(map[int64]bool)
+			for _, u := range d.Usages {
+				order, ok := d.Orders[u.OrderID]
+				if u.PromotionID != id || u.VoidedAt != nil || !ok || !inRange(u.CreatedAt, from, to) {
+					continue
+				}
+				stat.Uses++
+				stat.DiscountTotal += u.Amount
+				if u.CustomerID != nil {
+					customers[*u.CustomerID] = true
+				}
+				if order.Status == models.StatusClosed {
+					stat.Revenue += max(d.orderSubtotal(order)-d.orderDiscounts(order.ID), 0)
+					stat.ClosedOrders++
+				}
+			}
+			stat.Customers = int64(len(customers))
+			stats = append(stats, stat)
+		}
+
+		slices.SortStableFunc(stats, func(a, b models.PromotionUsageStats) int { return cmp.Compare(b.Uses, a.Uses) })
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// Tips totals the tips of closed orders per day in [from, to): tips paid with
+// payments count on the day they were paid, tips left at close on the day
+// the order closed.
+func (s *Storage) Tips(ctx context.Context, from, to time.Time) ([]models.TipDay, error) {
+	days := []models.TipDay{}
+	err := s.read(ctx, func(d *tables) error {
+		totals := make(map[time.Time]money.Amount)
+		add := func(at time.Time, tip money.Amount) {
+			if tip > 0 && inRange(at, from, to) {
+				totals[truncate(at, models.GroupByDay)] += tip
+			}
+		}
+		for _, p := range d.Payments {
+			if d.Orders[p.OrderID].Status == models.StatusClosed {
+				add(p.CreatedAt, p.Tip)
+			}
+		}
+		for _, order := range d.Orders {
+			if order.Status == models.StatusClosed && order.ClosedAt != nil {
+				add(*order.ClosedAt, order.Tip)
+			}
+		}
+
+		for day, total := range totals {
+			days = append(days, models.TipDay{Date: day, Total: total})
+		}
+		slices.SortFunc(days, func(a, b models.TipDay) int { return a.Date.Compare(b.Date) })
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return days, nil
+}
+
+// closedOrders lists the orders with lines that closed in [from, to).
+func (d *tables) closedOrders(from, to time.Time) []models.Order {
+	var orders []models.Order
+	for _, id := range sortedKeys(d.Orders) {
+		order := d.Orders[id]
+		if order.Status == models.StatusClosed && order.ClosedAt != nil && len(order.Lines) > 0 && inRange(*order.ClosedAt, from, to) {
+			orders = append(orders, order)
+		}
+	}
+	return orders
+}
+
+// orderRevenue is what the order's lines sold for, less the refunded units
+// and the discounts. The discounts are split between the units kept and
+// those refunded in proportion to their price, since refunds give back each
+// line's price after its share of them.
+func (d *tables) orderRevenue(order models.Order) money.Amount {
+	var kept, refunded money.Amount
+	for _, line := range order.Lines {
+		returned := d.lineRefunded(line.ID)
+		kept += line.UnitPrice.Mul(line.Quantity - returned)
+		refunded += line.UnitPrice.Mul(returned)
+	}
+	discounts := d.orderDiscounts(order.ID).Allocate([]money.Amount{kept, refunded})
+	return max(kept-discounts[0], 0)
+}
+
+func (d *tables) orderSubtotal(order models.Order) money.Amount {
+	var subtotal money.Amount
+	for _, line := range order.Lines {
+		subtotal += line.UnitPrice.Mul(line.Quantity)
+	}
+	return subtotal
+}
+
+// orderDiscounts sums the promotions and loyalty rewards still applied to
+// the order.
+func (d *tables) orderDiscounts(orderID int64) money.Amount {
+	var discounts money.Amount
+	for _, u := range d.Usages {
+		if u.OrderID == orderID && u.VoidedAt == nil {
+			discounts += u.Amount
+		}
+	}
+	for _, r := range d.Redemptions {
+		if r.OrderID == orderID && r.UndoneAt == nil {
+			discounts += r.Value
+		}
+	}
+	return discounts
+}
+
+func (d *tables) orderRefunded(orderID int64) money.Amount {
+	var refunded money.Amount
+	for _, r := range d.Refunds {
+		if r.OrderID == orderID {
+			refunded += r.Amount
+		}
+	}
+	return refunded
+}
+
+// truncate starts the day, the ISO week or the month of t in UTC, as
+// date_trunc does.
+func truncate(t time.Time, groupBy models.SalesGrouping) time.Time {
+	y, m, day := t.UTC().Date()
+	switch groupBy {
+	case models.GroupByWeek:
+		weekday := (int(t.UTC().Weekday()) + 6) % 7
+		return time.Date(y, m, day-weekday, 0, 0, 0, 0, time.UTC)
+	case models.GroupByMonth:
+		return time.Date(y, m, 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return time.Date(y, m, day, 0, 0, 0, 0, time.UTC)
+	}
+}
+
+// denseRanks ranks the distinct values of items from the highest, without
+// gaps between ranks.
+func denseRanks(items []models.PopularItem, value func(models.PopularItem) int64) map[int64]int64 {
+	values := make([]int64, 0, len(items))
+	for _, item := range items {
+		values = append(values, value(item))
+	}
+	slices.Sort(values)
+	values = slices.Compact(values)
+
+	ranks := make(map[int64]int64, len(values))
+	for i, v := range values {
+		ranks[v] = int64(len(values) - i)
+	}
+	return ranks
+}
@@ -0,0 +1,75 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"slices"
+	"time"
+)
+
+func (s *Storage) StartShift(ctx context.Context, staff string) (models.Shift, error) {
+	var shift models.Shift
+	err := s.write(ctx, func(d *tables) error {
+		for _, open := range d.Shifts {
+			if open.Staff == staff && open.EndedAt == nil {
+				return models.ErrShiftOpen
+			}
+		}
+
+		shift = models.Shift{ID: d.next("shifts"), Staff: staff, StartedAt: s.now()}
+		d.Shifts[shift.ID] = shift
+		d.touch("shifts", shift.ID)
+		return nil
+	})
+	if err != nil {
+		return models.Shift{}, err
+	}
+	return shift, nil
+}
+
+func (s *Storage) EndShift(ctx context.Context, id int64) (models.Shift, error) {
+	var shift models.Shift
+	err := s.write(ctx, func(d *tables) error {
+		var ok bool
+		if shift, ok = d.Shifts[id]; !ok {
+			return models.ErrNotFound
+		}
+		if shift.EndedAt != nil {
+			return models.ErrShiftEnded
+		}
+
+		now := s.now()
+		shift.EndedAt = &now
+		d.Shifts[id] = shift
+		d.touch("shifts", id)
+		shift.EndedAt = cloneTime(shift.EndedAt)
+		return nil
+	})
+	if err != nil {
+		return models.Shift{}, err
+	}
+	return shift, nil
+}
+
+// GetShifts lists the shifts that overlap [from, to); zero bounds are open.
+func (s *Storage) GetShifts(ctx context.Context, from, to time.Time) ([]models.Shift, error) {
+	var shifts []models.Shift
+	err := s.read(ctx, func(d *tables) error {
+		shifts = []models.Shift{}
+		for _, shift := range d.Shifts {
+			if (from.IsZero() || shift.EndedAt == nil || shift.EndedAt.After(from)) && (to.IsZero() || shift.StartedAt.Before(to)) {
+				shift.EndedAt = cloneTime(shift.EndedAt)
+				shifts = append(shifts, shift)
+			}
+		}
+		slices.SortFunc(shifts, func(a, b models.Shift) int {
+			return cmp.Or(a.StartedAt.Compare(b.StartedAt), cmp.Compare(a.ID, b.ID))
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return shifts, nil
+}
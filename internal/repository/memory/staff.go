@@ -0,0 +1,122 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"slices"
+)
+
+func (s *Storage) SaveStaff(ctx context.Context, staff models.Staff) (int64, error) {
+	var id int64
+	err := s.write(ctx, func(d *tables) error {
+		if err := d.checkUsername(0, staff.Username); err != nil {
+			return err
+		}
+
+		id = d.next("staff")
+		staff.ID = id
+		staff.CreatedAt = s.now()
+		d.Passwords[id] = staff.PasswordHash
+		d.touch("passwords", id)
+		staff.PasswordHash = ""
+		d.Staff[id] = staff
+		d.touch("staff", id)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (s *Storage) GetAllStaff(ctx context.Context) ([]models.Staff, error) {
+	var staff []models.Staff
+	err := s.read(ctx, func(d *tables) error {
+		staff = make([]models.Staff, 0, len(d.Staff))
+		for id := range d.Staff {
+			staff = append(staff, d.getStaff(id))
+		}
+		slices.SortFunc(staff, func(a, b models.Staff) int { return cmp.Compare(a.Username, b.Username) })
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return staff, nil
+}
+
+func (s *Storage) GetStaff(ctx context.Context, id int64) (models.Staff, error) {
+	return s.queryStaff(ctx, func(staff models.Staff) bool { return staff.ID == id })
+}
+
+func (s *Storage) GetStaffByUsername(ctx context.Context, username string) (models.Staff, error) {
+	return s.queryStaff(ctx, func(staff models.Staff) bool { return staff.Username == username })
+}
+
+// UpdateStaff replaces the staff member's details, and their password when
+// staff carries a new hash.
+func (s *Storage) UpdateStaff(ctx context.Context, id int64, staff models.Staff) (models.Staff, error) {
+	err := s.write(ctx, func(d *tables) error {
+		current, ok := d.Staff[id]
+		if !ok {
+			return models.ErrNotFound
+		}
+		if err := d.checkUsername(id, staff.Username); err != nil {
+			return err
+		}
+
+		if staff.PasswordHash != "" {
+			d.Passwords[id] = staff.PasswordHash
+			d.touch("passwords", id)
+		}
+		staff.ID, staff.CreatedAt, staff.PasswordHash = id, current.CreatedAt, ""
+		d.Staff[id] = staff
+		d.touch("staff", id)
+		staff = d.getStaff(id)
+		return nil
+	})
+	if err != nil {
+		return models.Staff{}, err
+	}
+	return staff, nil
+}
+
+func (s *Storage) CountStaff(ctx context.Context) (int64, error) {
+	var count int64
+	err := s.read(ctx, func(d *tables) error {
+		count = int64(len(d.Staff))
+		return nil
+	})
+	return count, err
+}
+
+func (s *Storage) queryStaff(ctx context.Context, match func(models.Staff) bool) (models.Staff, error) {
+	var staff models.Staff
+	err := s.read(ctx, func(d *tables) error {
+		for id, member := range d.Staff {
+			if match(member) {
+				staff = d.getStaff(id)
+				return nil
+			}
+		}
+		return models.ErrNotFound
+	})
+	return staff, err
+}
+
+// getStaff returns the staff member with their password hash.
+func (d *tables) getStaff(id int64) models.Staff {
+	staff := d.Staff[id]
+	staff.PasswordHash = d.Passwords[id]
+	return staff
+}
+
+func (d *tables) checkUsername(id int64, username string) error {
+	for _, staff := range d.Staff {
+		if staff.ID != id && staff.Username == username {
+			return models.ErrDuplicateStaff
+		}
+	}
+	return nil
+}
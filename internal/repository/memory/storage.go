@@ -0,0 +1,1021 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"github.com/weeweeshka/hot-coffee/internal/money"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Storage keeps everything in memory behind one lock and implements every
+// repository the services need, with the semantics of the postgres storage.
+// Writes make all their checks before their first change, so a write that
+// fails leaves the data as it was. Values are copied in and out, so callers
+// never share memory with the store.
+type Storage struct {
+	mu   sync.RWMutex
+	data *tables
+	logr *slog.Logger
+	now  func() time.Time
+	// persister, when set, is given the rows every write changes; see Open.
+	persister Persister
+	journal   journalState
+	// failed, when set, is why the data no longer matches what was
+	// persisted; see ErrFailed.
+	failed error
+	// written, when set, runs after every write that succeeded, under the
+	// write lock. Tests replay the journal with it.
+	written func()
+}
+
+// tables is everything the store holds. Each map is keyed by ID.
+type tables struct {
+	Sequences    map[string]int64                   `json:"sequences"`
+	Inventory    map[int64]models.InventoryItem     `json:"inventory"`
+	Transactions []models.InventoryTransaction      `json:"transactions"`
+	Menus        map[int64]models.MenuItem          `json:"menus"`
+	Orders       map[int64]models.Order             `json:"orders"`
+	Customers    map[int64]models.Customer          `json:"customers"`
+	Favorites    map[int64]models.FavoriteOrder     `json:"favorites"`
+	Loyalty      []models.LoyaltyEntry              `json:"loyalty"`
+	Redemptions  map[int64]models.LoyaltyRedemption `json:"redemptions"`
+	Promotions   map[int64]models.Promotion         `json:"promotions"`
+	Usages       []models.PromotionUsage            `json:"usages"`
+	Payments     []models.Payment                   `json:"payments"`
+	Refunds      []models.Refund                    `json:"refunds"`
+	Shifts       map[int64]models.Shift             `json:"shifts"`
+	Staff        map[int64]models.Staff             `json:"staff"`
+	// Passwords holds the staff password hashes, which models.Staff keeps
+	// out of JSON.
+	Passwords map[int64]string    `json:"passwords"`
+	Audit     []models.AuditEntry `json:"audit"`
+
+	// changed holds the rows the running write changed, by table, and
+	// rewritten the lists it changed other than by appending. Both are nil
+	// when nothing is persisted.
+	changed   map[string]map[int64]bool
+	rewritten map[string]bool
+}
+
+func newTables() *tables {
+	return &tables{
+		Sequences:   make(map[string]int64),
+		Inventory:   make(map[int64]models.InventoryItem),
+		Menus:       make(map[int64]models.MenuItem),
+		Orders:      make(map[int64]models.Order),
+		Customers:   make(map[int64]models.Customer),
+		Favorites:   make(map[int64]models.FavoriteOrder),
+		Redemptions: make(map[int64]models.LoyaltyRedemption),
+		Promotions:  make(map[int64]models.Promotion),
+		Shifts:      make(map[int64]models.Shift),
+		Staff:       make(map[int64]models.Staff),
+		Passwords:   make(map[int64]string),
+	}
+}
+
+func NewStorage(logr *slog.Logger) *Storage {
+	logr.Info("using in-memory storage")
+	return &Storage{
+		data: newTables(),
+		logr: logr,
+		now:  func() time.Time { return time.Now().UTC().Truncate(time.Microsecond) },
+	}
+}
+
+// read runs fn under the read lock.
+func (s *Storage) read(ctx context.Context, fn func(d *tables) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.failed != nil {
+		return s.failed
+	}
+	return fn(s.data)
+}
+
+// write runs fn under the write lock. fn must make every check before its
+// first change.
+func (s *Storage) write(ctx context.Context, fn func(d *tables) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failed != nil {
+		return s.failed
+	}
+	if err := fn(s.data); err != nil {
+		return err
+	}
+	if err := s.persist(); err != nil {
+		return err
+	}
+	if s.written != nil {
+		s.written()
+	}
+	return nil
+}
+
+// touch marks the row id of a table as changed by the running write, so that
+// it is persisted. Rows appended to a list need no touch.
+func (d *tables) touch(table string, id int64) {
+	if d.changed == nil {
+		return
+	}
+	if d.changed[table] == nil {
+		d.changed[table] = make(map[int64]bool)
+	}
+	d.changed[table][id] = true
+}
+
+// rewrite marks a list the running write removed rows from, so that it is
+// persisted whole.
+func (d *tables) rewrite(table string) {
+	if d.rewritten != nil {
+		d.rewritten[table] = true
+	}
+}
+
+// next returns the next ID of the sequence, starting at 1.
+func (d *tables) next(sequence string) int64 {
+	d.Sequences[sequence]++
+	return d.Sequences[sequence]
+}
+
+// sortedKeys returns the keys of m in ascending order.
+func sortedKeys[V any](m map[int64]V) []int64 {
+	keys := make([]int64, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func inRange(t, from, to time.Time) bool {
+	return (from.IsZero() || !t.Before(from)) && (to.IsZero() || t.Before(to))
+}
+
+func (s *Storage) SaveInventory(ctx context.Context, data models.InventoryItem) (int64, error) {
+	var id int64
+	err := s.write(ctx, func(d *tables) error {
+		if err := d.checkIngredientName(0, data.Name); err != nil {
+			return err
+		}
+
+		id = d.next("ingredients")
+		data.IngredientID = id
+		d.Inventory[id] = data
+		d.touch("inventory", id)
+
+		if data.Quantity != 0 {
+			d.insertTransaction(models.InventoryTransaction{
+				IngredientID: id,
+				Delta:        data.Quantity,
+				Reason:       models.ReasonRestock,
+				Note:         "opening stock",
+			}, s.now())
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (s *Storage) GetAllInventories(ctx context.Context) ([]models.InventoryItem, error) {
+	var items []models.InventoryItem
+	err := s.read(ctx, func(d *tables) error {
+		items = make([]models.InventoryItem, 0, len(d.Inventory))
+		for _, id := range sortedKeys(d.Inventory) {
+			items = append(items, d.Inventory[id])
+		}
+		return nil
+	})
+	return items, err
+}
+
+func (s *Storage) GetInventory(ctx context.Context, id int64) (models.InventoryItem, error) {
+	var item models.InventoryItem
+	err := s.read(ctx, func(d *tables) error {
+		var ok bool
+		if item, ok = d.Inventory[id]; !ok {
+			return models.ErrNotFound
+		}
+		return nil
+	})
+	return item, err
+}
+
+// UpdateInventory renames the item and books any difference between the
+// requested and the stocked quantity as a count correction.
+func (s *Storage) UpdateInventory(ctx context.Context, id int64, inventory models.InventoryItem) (models.InventoryItem, error) {
+	err := s.write(ctx, func(d *tables) error {
+		current, ok := d.Inventory[id]
+		if !ok {
+			return models.ErrNotFound
+		}
+		if err := d.checkIngredientName(id, inventory.Name); err != nil {
+			return err
+		}
+		if err := d.checkUnitChange(current, inventory.Unit); err != nil {
+			return err
+		}
+
+		inventory.IngredientID = id
+		d.Inventory[id] = inventory
+		d.touch("inventory", id)
+
+		if delta := inventory.Quantity - current.Quantity; delta != 0 {
+			d.insertTransaction(models.InventoryTransaction{
+				IngredientID: id,
+				Delta:        delta,
+				Reason:       models.ReasonCountCorrection,
+			}, s.now())
+		}
+		return nil
+	})
+	if err != nil {
+		return models.InventoryItem{}, err
+	}
+	return inventory, nil
+}
+
+// DeleteInventory removes an item that no recipe uses. Its ledger is kept.
+func (s *Storage) DeleteInventory(ctx context.Context, id int64) error {
+	return s.write(ctx, func(d *tables) error {
+		if _, ok := d.Inventory[id]; !ok {
+			return models.ErrNotFound
+		}
+		for _, menuID := range sortedKeys(d.Menus) {
+			if usesIngredient(d.Menus[menuID], id) {
+				return fmt.Errorf("%w: ingredient %d is used by menu item %d", models.ErrInvalidInventory, id, menuID)
+			}
+		}
+
+		delete(d.Inventory, id)
+		d.touch("inventory", id)
+		return nil
+	})
+}
+
+func (s *Storage) AddInventoryTransaction(ctx context.Context, t models.InventoryTransaction) (models.InventoryTransaction, error) {
+	err := s.write(ctx, func(d *tables) error {
+		item, ok := d.Inventory[t.IngredientID]
+		if !ok {
+			return models.ErrNotFound
+		}
+
+		if item.Quantity+t.Delta < 0 {
+			return &models.InsufficientIngredientsError{Shortages: []models.IngredientShortage{{
+				IngredientID: t.IngredientID,
+				Name:         item.Name,
+				Required:     -t.Delta,
+				Available:    item.Quantity,
+			}}}
+		}
+
+		item.Quantity += t.Delta
+		d.Inventory[t.IngredientID] = item
+		d.touch("inventory", t.IngredientID)
+		t = d.insertTransaction(t, s.now())
+		return nil
+	})
+	if err != nil {
+		return models.InventoryTransaction{}, err
+	}
+	return t, nil
+}
+
+func (s *Storage) GetInventoryHistory(ctx context.Context, id int64, from, to time.Time) ([]models.InventoryTransaction, error) {
+	var history []models.InventoryTransaction
+	err := s.read(ctx, func(d *tables) error {
+		if _, ok := d.Inventory[id]; !ok {
+			return models.ErrNotFound
+		}
+
+		history = []models.InventoryTransaction{}
+		for _, t := range d.Transactions {
+			if t.IngredientID == id && inRange(t.CreatedAt, from, to) {
+				history = append(history, t)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+func (s *Storage) GetLowStock(ctx context.Context) ([]models.InventoryItem, error) {
+	var items []models.InventoryItem
+	err := s.read(ctx, func(d *tables) error {
+		items = []models.InventoryItem{}
+		for _, item := range d.Inventory {
+			if item.Quantity < item.ReorderLevel {
+				items = append(items, item)
+			}
+		}
+		slices.SortFunc(items, func(a, b models.InventoryItem) int {
+			return cmp.Or(cmp.Compare(a.Quantity/a.ReorderLevel, b.Quantity/b.ReorderLevel), cmp.Compare(a.Name, b.Name))
+		})
+		return nil
+	})
+	return items, err
+}
+
+func (d *tables) checkIngredientName(id int64, name string) error {
+	for _, item := range d.Inventory {
+		if item.IngredientID != id && item.Name == name {
+			return fmt.Errorf("%w: %q", models.ErrDuplicateInventory, name)
+		}
+	}
+	return nil
+}
+
+// insertTransaction appends t to the ledger without touching the stock.
+func (d *tables) insertTransaction(t models.InventoryTransaction, at time.Time) models.InventoryTransaction {
+	t.ID = d.next("inventory_transactions")
+	t.CreatedAt = at
+	if t.OrderID != nil {
+		orderID := *t.OrderID
+		t.OrderID = &orderID
+	}
+	d.Transactions = append(d.Transactions, t)
+	return t
+}
+
+// checkUnitChange refuses to change the unit of an item that is in stock or
+// used by a recipe, since neither its quantity nor the recipe amounts would
+// follow.
+func (d *tables) checkUnitChange(current models.InventoryItem, unit string) error {
+	if current.Unit == unit {
+		return nil
+	}
+	if current.Quantity > 0 {
+		return fmt.Errorf("%w: cannot change the unit of ingredient %d from %s to %s while it is in stock",
+			models.ErrInvalidInventory, current.IngredientID, current.Unit, unit)
+	}
+	for _, menuID := range sortedKeys(d.Menus) {
+		if usesIngredient(d.Menus[menuID], current.IngredientID) {
+			return fmt.Errorf("%w: cannot change the unit of ingredient %d from %s to %s while menu item %d uses it",
+				models.ErrInvalidInventory, current.IngredientID, current.Unit, unit, menuID)
+		}
+	}
+	return nil
+}
+
+func usesIngredient(menu models.MenuItem, id int64) bool {
+	uses := func(recipe []models.MenuItemIngredient) bool {
+		return slices.ContainsFunc(recipe, func(i models.MenuItemIngredient) bool { return i.IngredientID == id })
+	}
+	if uses(menu.Ingredients) {
+		return true
+	}
+	for _, variant := range menu.Variants {
+		if uses(variant.Ingredients) {
+			return true
+		}
+	}
+	for _, group := range menu.ModifierGroups {
+		for _, modifier := range group.Modifiers {
+			if uses(modifier.Ingredients) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *Storage) SaveMenu(ctx context.Context, data models.MenuItem) (int64, error) {
+	var id int64
+	err := s.write(ctx, func(d *tables) error {
+		if err := d.checkMenuName(0, data.Name); err != nil {
+			return err
+		}
+
+		id = d.next("menus")
+		data = d.numberMenu(cloneMenu(data), models.MenuItem{})
+		data.ID = id
+		d.Menus[id] = data
+		d.touch("menus", id)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (s *Storage) GetAllMenus(ctx context.Context) ([]models.MenuItem, error) {
+	var menus []models.MenuItem
+	err := s.read(ctx, func(d *tables) error {
+		menus = make([]models.MenuItem, 0, len(d.Menus))
+		for _, id := range sortedKeys(d.Menus) {
+			menus = append(menus, cloneMenu(d.Menus[id]))
+		}
+		return nil
+	})
+	return menus, err
+}
+
+func (s *Storage) GetMenu(ctx context.Context, id int64) (models.MenuItem, error) {
+	var menu models.MenuItem
+	err := s.read(ctx, func(d *tables) error {
+		stored, ok := d.Menus[id]
+		if !ok {
+			return models.ErrNotFound
+		}
+		menu = cloneMenu(stored)
+		return nil
+	})
+	return menu, err
+}
+
+// UpdateMenu replaces the item. Variants, modifier groups and modifiers that
+// carry the ID of one the item already has keep it; the others get new IDs.
+func (s *Storage) UpdateMenu(ctx context.Context, id int64, menu models.MenuItem) (models.MenuItem, error) {
+	err := s.write(ctx, func(d *tables) error {
+		current, ok := d.Menus[id]
+		if !ok {
+			return models.ErrNotFound
+		}
+		if err := d.checkMenuName(id, menu.Name); err != nil {
+			return err
+		}
+
+		menu = d.numberMenu(cloneMenu(menu), current)
+		menu.ID = id
+		d.Menus[id] = menu
+		d.touch("menus", id)
+		menu = cloneMenu(menu)
+		return nil
+	})
+	if err != nil {
+		return models.MenuItem{}, err
+	}
+	return menu, nil
+}
+
+// DeleteMenu removes an item that was never ordered, together with the
+// promotions limited to it.
+func (s *Storage) DeleteMenu(ctx context.Context, id int64) error {
+	return s.write(ctx, func(d *tables) error {
+		if _, ok := d.Menus[id]; !ok {
+			return models.ErrNotFound
+		}
+		for _, orderID := range sortedKeys(d.Orders) {
+			for _, line := range d.Orders[orderID].Lines {
+				if line.ProductID == id {
+					return fmt.Errorf("%w: menu item %d is on order %d", models.ErrInvalidMenu, id, orderID)
+				}
+			}
+		}
+
+		delete(d.Menus, id)
+		d.touch("menus", id)
+		for promotionID, p := range d.Promotions {
+			if p.ProductID == id {
+				d.deletePromotion(promotionID)
+			}
+		}
+		return nil
+	})
+}
+
+func (d *tables) checkMenuName(id int64, name string) error {
+	for _, menu := range d.Menus {
+		if menu.ID != id && menu.Name == name {
+			return fmt.Errorf("%w: menu item %q already exists", models.ErrInvalidMenu, name)
+		}
+	}
+	return nil
+}
+
+// numberMenu gives IDs to the variants, modifier groups and modifiers of menu,
+// keeping those that current already has.
+func (d *tables) numberMenu(menu, current models.MenuItem) models.MenuItem {
+	variants := make(map[int64]bool)
+	for _, v := range current.Variants {
+		variants[v.ID] = true
+	}
+	groups := make(map[int64]bool)
+	modifiers := make(map[int64]bool)
+	for _, g := range current.ModifierGroups {
+		groups[g.ID] = true
+		for _, m := range g.Modifiers {
+			modifiers[m.ID] = true
+		}
+	}
+
+	for i := range menu.Variants {
+		if !variants[menu.Variants[i].ID] {
+			menu.Variants[i].ID = d.next("menu_variants")
+		}
+	}
+	for i := range menu.ModifierGroups {
+		group := &menu.ModifierGroups[i]
+		if !groups[group.ID] {
+			group.ID = d.next("modifier_groups")
+		}
+		for j := range group.Modifiers {
+			if !modifiers[group.Modifiers[j].ID] {
+				group.Modifiers[j].ID = d.next("modifiers")
+			}
+		}
+	}
+	return menu
+}
+
+func cloneMenu(menu models.MenuItem) models.MenuItem {
+	menu.Ingredients = slices.Clone(menu.Ingredients)
+	menu.Variants = slices.Clone(menu.Variants)
+	for i := range menu.Variants {
+		menu.Variants[i].Ingredients = slices.Clone(menu.Variants[i].Ingredients)
+	}
+	menu.ModifierGroups = slices.Clone(menu.ModifierGroups)
+	for i := range menu.ModifierGroups {
+		group := &menu.ModifierGroups[i]
+		group.Modifiers = slices.Clone(group.Modifiers)
+		for j := range group.Modifiers {
+			group.Modifiers[j].Ingredients = slices.Clone(group.Modifiers[j].Ingredients)
+		}
+	}
+	return menu
+}
+
+func (s *Storage) SaveOrder(ctx context.Context, order models.Order, consumption []models.IngredientAmount, discounts models.OrderDiscounts) (int64, []models.StockChange, error) {
+	var id int64
+	var changes []models.StockChange
+	err := s.write(ctx, func(d *tables) error {
+		if err := d.checkStock(consumption, nil); err != nil {
+			return err
+		}
+		if err := d.checkDiscounts(discounts); err != nil {
+			return err
+		}
+
+		now := s.now()
+		id = d.next("orders")
+		d.insertDiscounts(id, discounts, now)
+		before := d.stockLevels(consumedIDs(consumption))
+		d.deductInventory(id, consumption, now)
+		changes = d.stockChanges(before)
+		d.Orders[id] = models.Order{
+			ID:            id,
+			CustomerID:    cloneID(order.CustomerID),
+			CustomerName:  order.CustomerName,
+			Lines:         d.saveOrderItems(order.Lines),
+			Rounding:      order.Rounding,
+			CashIncrement: order.CashIncrement,
+			Status:        models.StatusOpen,
+			CreatedAt:     now.Format(time.RFC3339),
+		}
+		d.touch("orders", id)
+		return nil
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	return id, changes, nil
+}
+
+// checkDiscounts checks the discounts of a new order before anything of the
+// order is written.
+func (d *tables) checkDiscounts(discounts models.OrderDiscounts) error {
+	if discounts.Promotion != nil {
+		if err := d.checkPromotionUsage(*discounts.Promotion, discounts.Usage); err != nil {
+			return err
+		}
+	}
+	if discounts.Redemption != nil {
+		if err := d.checkRedemption(*discounts.Redemption); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insertDiscounts records the checked discounts of the new order orderID.
+func (d *tables) insertDiscounts(orderID int64, discounts models.OrderDiscounts, now time.Time) {
+	if discounts.Promotion != nil {
+		usage := discounts.Usage
+		usage.OrderID = orderID
+		d.insertPromotionUsage(*discounts.Promotion, usage, now)
+	}
+	if discounts.Redemption != nil {
+		redemption := *discounts.Redemption
+		redemption.OrderID = orderID
+		d.insertRedemption(redemption, now)
+	}
+}
+
+// GetOrders lists a page of orders, newest first.
+func (s *Storage) GetOrders(ctx context.Context, page models.OrderPage) ([]models.Order, error) {
+	var orders []models.Order
+	err := s.read(ctx, func(d *tables) error {
+		ids := sortedKeys(d.Orders)
+		slices.Reverse(ids)
+		ids = ids[min(page.Offset, len(ids)):]
+		ids = ids[:min(page.Limit, len(ids))]
+
+		orders = make([]models.Order, 0, len(ids))
+		for _, id := range ids {
+			orders = append(orders, cloneOrder(d.Orders[id]))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+func (s *Storage) GetOrder(ctx context.Context, id int64) (models.Order, error) {
+	var order models.Order
+	err := s.read(ctx, func(d *tables) error {
+		stored, ok := d.Orders[id]
+		if !ok {
+			return models.ErrNotFound
+		}
+		order = cloneOrder(stored)
+		return nil
+	})
+	return order, err
+}
+
+// UpdateOrder replaces the order's customer and lines, and swaps what the
+// order holds out of the inventory for consumption. The new lines get new
+// IDs.
+func (s *Storage) UpdateOrder(ctx context.Context, id int64, order models.Order, consumption []models.IngredientAmount, usages []models.PromotionUsage) (models.Order, []models.StockChange, error) {
+	var updated models.Order
+	var changes []models.StockChange
+	err := s.write(ctx, func(d *tables) error {
+		current, ok := d.Orders[id]
+		if !ok {
+			return models.ErrNotFound
+		}
+		if current.Status != models.StatusOpen {
+			return fmt.Errorf("%w: order %d is %s", models.ErrOrderNotEditable, id, current.Status)
+		}
+		held := d.orderHeld(id)
+		if err := d.checkStock(consumption, held); err != nil {
+			return err
+		}
+		repriced := make([]int, len(usages))
+		for i, u := range usages {
+			repriced[i] = slices.IndexFunc(d.Usages, func(used models.PromotionUsage) bool {
+				return used.ID == u.ID && used.OrderID == id && used.VoidedAt == nil
+			})
+			if repriced[i] < 0 {
+				return fmt.Errorf("%w: promotion usage %d of order %d", models.ErrNotFound, u.ID, id)
+			}
+		}
+
+		now := s.now()
+		before := d.stockLevels(append(sortedKeys(held), consumedIDs(consumption)...))
+		d.restockOrder(id, now)
+		d.deductInventory(id, consumption, now)
+		changes = d.stockChanges(before)
+		for i, u := range usages {
+			d.Usages[repriced[i]].Amount = u.Amount
+			d.touch("usages", int64(repriced[i]))
+		}
+
+		current.CustomerID = cloneID(order.CustomerID)
+		current.CustomerName = order.CustomerName
+		current.Lines = d.saveOrderItems(order.Lines)
+		d.Orders[id] = current
+		d.touch("orders", id)
+		updated = cloneOrder(current)
+		return nil
+	})
+	if err != nil {
+		return models.Order{}, nil, err
+	}
+	return updated, changes, nil
+}
+
+func (s *Storage) DeleteOrder(ctx context.Context, id int64) error {
+	return s.write(ctx, func(d *tables) error {
+		order, ok := d.Orders[id]
+		if !ok {
+			return models.ErrNotFound
+		}
+		if order.Status == models.StatusClosed {
+			return models.ErrOrderClosed
+		}
+		if d.orderPaid(id) > 0 {
+			return fmt.Errorf("%w: order %d", models.ErrOrderPaid, id)
+		}
+
+		now := s.now()
+		d.restockOrder(id, now)
+		d.releaseDiscounts(id, now)
+		delete(d.Orders, id)
+		d.touch("orders", id)
+		return nil
+	})
+}
+
+func (s *Storage) SetOrderStatus(ctx context.Context, id int64, from, to models.OrderStatus) (time.Time, error) {
+	if to == models.StatusOpen || to == "" {
+		return time.Time{}, fmt.Errorf("%w: %s -> %s", models.ErrInvalidTransition, from, to)
+	}
+
+	var changedAt time.Time
+	err := s.write(ctx, func(d *tables) error {
+		order, err := d.orderInStatus(id, from, to)
+		if err != nil {
+			return err
+		}
+
+		changedAt = s.now()
+		order.SetStatus(to, changedAt)
+		d.Orders[id] = order
+		d.touch("orders", id)
+		return nil
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	return changedAt, nil
+}
+
+func (s *Storage) CancelOrder(ctx context.Context, id int64, from models.OrderStatus) (time.Time, error) {
+	var cancelledAt time.Time
+	err := s.write(ctx, func(d *tables) error {
+		order, err := d.orderInStatus(id, from, models.StatusCancelled)
+		if err != nil {
+			return err
+		}
+
+		cancelledAt = s.now()
+		order.SetStatus(models.StatusCancelled, cancelledAt)
+		d.Orders[id] = order
+		d.touch("orders", id)
+		d.restockOrder(id, cancelledAt)
+		d.releaseDiscounts(id, cancelledAt)
+		return nil
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	return cancelledAt, nil
+}
+
+// CloseOrder closes the order and records the tip left on it and the points
+// its customer earns in the same write.
+func (s *Storage) CloseOrder(ctx context.Context, id int64, from models.OrderStatus, tip money.Amount, points int64) (time.Time, error) {
+	var closedAt time.Time
+	err := s.write(ctx, func(d *tables) error {
+		order, err := d.orderInStatus(id, from, models.StatusClosed)
+		if err != nil {
+			return err
+		}
+
+		closedAt = s.now()
+		order.SetStatus(models.StatusClosed, closedAt)
+		order.Tip = tip
+		d.Orders[id] = order
+		d.touch("orders", id)
+		if points > 0 && order.CustomerID != nil {
+			d.insertLoyalty(models.LoyaltyEntry{
+				CustomerID: *order.CustomerID,
+				Points:     points,
+				Reason:     models.LoyaltyEarn,
+				OrderID:    &id,
+			}, closedAt)
+		}
+		return nil
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	return closedAt, nil
+}
+
+// orderInStatus returns the order if it is in the from status, and otherwise
+// explains why it cannot move to the to status.
+func (d *tables) orderInStatus(id int64, from, to models.OrderStatus) (models.Order, error) {
+	order, ok := d.Orders[id]
+	if !ok {
+		return models.Order{}, models.ErrNotFound
+	}
+	if order.Status != from {
+		return models.Order{}, fmt.Errorf("%w: %s -> %s", models.ErrInvalidTransition, order.Status, to)
+	}
+	return order, nil
+}
+
+// queryOrders lists the orders match accepts, newest first.
+func (s *Storage) queryOrders(ctx context.Context, match func(models.Order) bool) ([]models.Order, error) {
+	var orders []models.Order
+	err := s.read(ctx, func(d *tables) error {
+		orders = []models.Order{}
+		ids := sortedKeys(d.Orders)
+		for i := len(ids) - 1; i >= 0; i-- {
+			if order := d.Orders[ids[i]]; match(order) {
+				orders = append(orders, cloneOrder(order))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+// saveOrderItems numbers the order lines and works out their totals as sold.
+func (d *tables) saveOrderItems(lines []models.PricedLine) []models.PricedLine {
+	saved := make([]models.PricedLine, 0, len(lines))
+	for _, line := range lines {
+		line.ID = d.next("order_items")
+		line.LineTotal = line.UnitPrice.Mul(line.Quantity)
+		line.Net = 0
+		line.Modifiers = slices.Clone(line.Modifiers)
+		slices.Sort(line.Modifiers)
+		if len(line.Modifiers) == 0 {
+			line.Modifiers = nil
+		}
+		saved = append(saved, line)
+	}
+	return saved
+}
+
+// checkStock fails with a *models.InsufficientIngredientsError unless the
+// inventory, with held given back to it, covers consumption.
+func (d *tables) checkStock(consumption []models.IngredientAmount, held map[int64]float64) error {
+	var shortages []models.IngredientShortage
+	for _, c := range consumption {
+		item := d.Inventory[c.IngredientID]
+		available := item.Quantity
+		if _, ok := d.Inventory[c.IngredientID]; ok {
+			available += held[c.IngredientID]
+		}
+		if available < c.Quantity {
+			shortages = append(shortages, models.IngredientShortage{
+				IngredientID: c.IngredientID,
+				Name:         item.Name,
+				Required:     c.Quantity,
+				Available:    available,
+			})
+		}
+	}
+	if len(shortages) > 0 {
+		return &models.InsufficientIngredientsError{Shortages: shortages}
+	}
+	return nil
+}
+
+// deductInventory takes consumption out of the inventory, recording one
+// consumption movement per ingredient against the order. It must follow a
+// successful checkStock.
+func (d *tables) deductInventory(orderID int64, consumption []models.IngredientAmount, at time.Time) {
+	for _, c := range consumption {
+		item := d.Inventory[c.IngredientID]
+		item.Quantity -= c.Quantity
+		d.Inventory[c.IngredientID] = item
+		d.touch("inventory", c.IngredientID)
+
+		d.insertTransaction(models.InventoryTransaction{
+			IngredientID: c.IngredientID,
+			OrderID:      &orderID,
+			Delta:        -c.Quantity,
+			Reason:       models.ReasonOrderConsumption,
+		}, at)
+	}
+}
+
+func consumedIDs(consumption []models.IngredientAmount) []int64 {
+	ids := make([]int64, 0, len(consumption))
+	for _, c := range consumption {
+		ids = append(ids, c.IngredientID)
+	}
+	return ids
+}
+
+// stockLevels is the quantity of each of ids that is stocked.
+func (d *tables) stockLevels(ids []int64) map[int64]float64 {
+	levels := make(map[int64]float64, len(ids))
+	for _, id := range ids {
+		if item, ok := d.Inventory[id]; ok {
+			levels[id] = item.Quantity
+		}
+	}
+	return levels
+}
+
+// stockChanges compares the quantities taken by stockLevels with what they
+// are now.
+func (d *tables) stockChanges(before map[int64]float64) []models.StockChange {
+	changes := make([]models.StockChange, 0, len(before))
+	for _, id := range sortedKeys(before) {
+		item := d.Inventory[id]
+		changes = append(changes, models.StockChange{
+			IngredientID: id,
+			Before:       before[id],
+			After:        item.Quantity,
+			ReorderLevel: item.ReorderLevel,
+		})
+	}
+	return changes
+}
+
+// orderHeld is how much of each ingredient the order's movements still hold
+// out of the inventory.
+func (d *tables) orderHeld(orderID int64) map[int64]float64 {
+	held := make(map[int64]float64)
+	for _, t := range d.Transactions {
+		if t.OrderID != nil && *t.OrderID == orderID {
+			held[t.IngredientID] -= t.Delta
+		}
+	}
+	return held
+}
+
+// restockOrder gives back whatever the order's movements still hold out of
+// the inventory as a single reversal movement per ingredient.
+func (d *tables) restockOrder(orderID int64, at time.Time) {
+	held := d.orderHeld(orderID)
+	for _, id := range sortedKeys(held) {
+		if held[id] == 0 {
+			continue
+		}
+		if item, ok := d.Inventory[id]; ok {
+			item.Quantity += held[id]
+			d.Inventory[id] = item
+			d.touch("inventory", id)
+		}
+		d.insertTransaction(models.InventoryTransaction{
+			IngredientID: id,
+			OrderID:      &orderID,
+			Delta:        held[id],
+			Reason:       models.ReasonOrderReversal,
+		}, at)
+	}
+}
+
+// releaseDiscounts gives back the points spent on an order that will not be
+// paid and voids its promotion usages, so they stop counting towards limits.
+func (d *tables) releaseDiscounts(orderID int64, at time.Time) {
+	for _, id := range sortedKeys(d.Redemptions) {
+		if r := d.Redemptions[id]; r.OrderID == orderID && r.UndoneAt == nil {
+			d.undoRedemption(r, at)
+		}
+	}
+	for i, u := range d.Usages {
+		if u.OrderID == orderID && u.VoidedAt == nil {
+			d.Usages[i].VoidedAt = &at
+			d.touch("usages", int64(i))
+		}
+	}
+}
+
+// cloneOrder copies the order and lists its items as they would be posted,
+// from its lines.
+func cloneOrder(order models.Order) models.Order {
+	order.CustomerID = cloneID(order.CustomerID)
+	order.Lines = slices.Clone(order.Lines)
+	order.Items = make([]models.OrderItem, 0, len(order.Lines))
+	for i, line := range order.Lines {
+		order.Lines[i].Modifiers = slices.Clone(line.Modifiers)
+		order.Items = append(order.Items, models.OrderItem{
+			ProductID: line.ProductID,
+			VariantID: line.VariantID,
+			Modifiers: slices.Clone(line.Modifiers),
+			Quantity:  line.Quantity,
+		})
+	}
+	order.StartedAt = cloneTime(order.StartedAt)
+	order.ReadyAt = cloneTime(order.ReadyAt)
+	order.ClosedAt = cloneTime(order.ClosedAt)
+	order.CancelledAt = cloneTime(order.CancelledAt)
+	return order
+}
+
+func cloneID(id *int64) *int64 {
+	if id == nil {
+		return nil
+	}
+	v := *id
+	return &v
+}
+
+func cloneTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	v := *t
+	return &v
+}
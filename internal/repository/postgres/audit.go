@@ -0,0 +1,69 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+)
+
+func (s *Storage) SaveAuditEntry(ctx context.Context, entry models.AuditEntry) (int64, error) {
+	var id int64
+	err := s.db.QueryRow(ctx, `
+        INSERT INTO audit_log(staff_id, actor, action, entity_type, entity_id, diff, request_id)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)
+        RETURNING id
+    `, entry.Actor.StaffID, entry.Actor.Username, entry.Action, entry.EntityType, entry.EntityID,
+		string(entry.Diff), entry.RequestID).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("cannot insert into audit_log: %w", err)
+	}
+	return id, nil
+}
+
+func (s *Storage) GetAuditLog(ctx context.Context, filter models.AuditFilter) ([]models.AuditEntry, error) {
+	rows, err := s.db.Query(ctx, `
+        SELECT id, staff_id, actor, action, entity_type, entity_id, diff, request_id, created_at
+        FROM audit_log
+        WHERE ($1::int IS NULL OR staff_id = $1)
+          AND ($2::text IS NULL OR action = $2)
+          AND ($3::text IS NULL OR entity_type = $3)
+          AND ($4::bigint IS NULL OR entity_id = $4)
+          AND ($5::text IS NULL OR request_id = $5)
+          AND ($6::timestamp IS NULL OR created_at >= $6)
+          AND ($7::timestamp IS NULL OR created_at < $7)
+        ORDER BY created_at DESC, id DESC
+        LIMIT $8
+    `, nullID(filter.StaffID), nullString(string(filter.Action)), nullString(string(filter.EntityType)),
+		nullID(filter.EntityID), nullString(filter.RequestID), nullTime(filter.From), nullTime(filter.To), filter.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("cannot select audit_log: %w", err)
+	}
+
+	entries, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.AuditEntry, error) {
+		var entry models.AuditEntry
+		var diff []byte
+		err := row.Scan(&entry.ID, &entry.Actor.StaffID, &entry.Actor.Username, &entry.Action, &entry.EntityType,
+			&entry.EntityID, &diff, &entry.RequestID, &entry.CreatedAt)
+		entry.Diff = diff
+		return entry, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot scan audit_log: %w", err)
+	}
+	return entries, nil
+}
+
+func nullID(id int64) *int64 {
+	if id == 0 {
+		return nil
+	}
+	return &id
+}
+
+func nullString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
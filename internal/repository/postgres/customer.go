@@ -0,0 +1,195 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+)
+
+const (
+	uniqueViolation     = "23505"
+	foreignKeyViolation = "23503"
+)
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolation
+}
+
+func isForeignKeyViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == foreignKeyViolation
+}
+
+func (s *Storage) SaveCustomer(ctx context.Context, data models.Customer) (int64, error) {
+	var customerID int64
+	err := s.db.QueryRow(ctx, `
+        INSERT INTO customers(name, phone, email, notes)
+        VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), $4)
+        RETURNING id
+    `, data.Name, data.Phone, data.Email, data.Notes).Scan(&customerID)
+	if isUniqueViolation(err) {
+		return 0, models.ErrDuplicateCustomer
+	}
+	if err != nil {
+		return 0, fmt.Errorf("cannot insert into customers: %w", err)
+	}
+	return customerID, nil
+}
+
+func (s *Storage) GetAllCustomers(ctx context.Context) ([]models.Customer, error) {
+	rows, err := s.db.Query(ctx, `
+        SELECT id, name, COALESCE(phone, ''), COALESCE(email, ''), notes, created_at
+        FROM customers
+        ORDER BY name, id
+    `)
+	if err != nil {
+		return nil, fmt.Errorf("cannot select customers: %w", err)
+	}
+
+	customers, err := pgx.CollectRows(rows, scanCustomer)
+	if err != nil {
+		return nil, fmt.Errorf("cannot scan customers: %w", err)
+	}
+	return customers, nil
+}
+
+func (s *Storage) GetCustomer(ctx context.Context, id int64) (models.Customer, error) {
+	rows, err := s.db.Query(ctx, `
+        SELECT id, name, COALESCE(phone, ''), COALESCE(email, ''), notes, created_at
+        FROM customers
+        WHERE id = $1
+    `, id)
+	if err != nil {
+		return models.Customer{}, fmt.Errorf("cannot select customer: %w", err)
+	}
+
+	customer, err := pgx.CollectExactlyOneRow(rows, scanCustomer)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Customer{}, models.ErrNotFound
+	}
+	if err != nil {
+		return models.Customer{}, fmt.Errorf("cannot scan customer: %w", err)
+	}
+	return customer, nil
+}
+
+func (s *Storage) UpdateCustomer(ctx context.Context, id int64, customer models.Customer) (models.Customer, error) {
+	err := s.db.QueryRow(ctx, `
+        UPDATE customers SET name = $1, phone = NULLIF($2, ''), email = NULLIF($3, ''), notes = $4
+        WHERE id = $5
+        RETURNING id, created_at
+    `, customer.Name, customer.Phone, customer.Email, customer.Notes, id).Scan(&customer.ID, &customer.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Customer{}, models.ErrNotFound
+	}
+	if isUniqueViolation(err) {
+		return models.Customer{}, models.ErrDuplicateCustomer
+	}
+	if err != nil {
+		return models.Customer{}, fmt.Errorf("cannot update customer: %w", err)
+	}
+	return customer, nil
+}
+
+func (s *Storage) DeleteCustomer(ctx context.Context, id int64) error {
+	tag, err := s.db.Exec(ctx, `DELETE FROM customers WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("cannot delete customer: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return models.ErrNotFound
+	}
+	return nil
+}
+
+func (s *Storage) GetCustomerOrders(ctx context.Context, id int64) ([]models.Order, error) {
+	if _, err := s.GetCustomer(ctx, id); err != nil {
+		return nil, err
+	}
+	return queryOrders(ctx, s.db, `WHERE o.customer_id = $1`, id)
+}
+
+func (s *Storage) SaveFavorite(ctx context.Context, data models.FavoriteOrder) (int64, error) {
+	items, err := json.Marshal(data.Items)
+	if err != nil {
+		return 0, fmt.Errorf("cannot encode favorite items: %w", err)
+	}
+
+	var favoriteID int64
+	err = s.db.QueryRow(ctx, `
+        INSERT INTO customer_favorites(customer_id, name, items) VALUES ($1, $2, $3) RETURNING id
+    `, data.CustomerID, data.Name, items).Scan(&favoriteID)
+	if err != nil {
+		return 0, fmt.Errorf("cannot insert into customer_favorites: %w", err)
+	}
+	return favoriteID, nil
+}
+
+func (s *Storage) GetFavorites(ctx context.Context, customerID int64) ([]models.FavoriteOrder, error) {
+	rows, err := s.db.Query(ctx, `
+        SELECT id, customer_id, name, items, created_at
+        FROM customer_favorites
+        WHERE customer_id = $1
+        ORDER BY created_at DESC, id DESC
+    `, customerID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot select customer_favorites: %w", err)
+	}
+
+	favorites, err := pgx.CollectRows(rows, scanFavorite)
+	if err != nil {
+		return nil, fmt.Errorf("cannot scan customer_favorites: %w", err)
+	}
+	return favorites, nil
+}
+
+func (s *Storage) GetFavorite(ctx context.Context, customerID, favoriteID int64) (models.FavoriteOrder, error) {
+	rows, err := s.db.Query(ctx, `
+        SELECT id, customer_id, name, items, created_at
+        FROM customer_favorites
+        WHERE customer_id = $1 AND id = $2
+    `, customerID, favoriteID)
+	if err != nil {
+		return models.FavoriteOrder{}, fmt.Errorf("cannot select customer_favorites: %w", err)
+	}
+
+	favorite, err := pgx.CollectExactlyOneRow(rows, scanFavorite)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.FavoriteOrder{}, models.ErrNotFound
+	}
+	if err != nil {
+		return models.FavoriteOrder{}, fmt.Errorf("cannot scan customer_favorites: %w", err)
+	}
+	return favorite, nil
+}
+
+func (s *Storage) DeleteFavorite(ctx context.Context, customerID, favoriteID int64) error {
+	tag, err := s.db.Exec(ctx, `DELETE FROM customer_favorites WHERE customer_id = $1 AND id = $2`, customerID, favoriteID)
+	if err != nil {
+		return fmt.Errorf("cannot delete customer_favorites: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return models.ErrNotFound
+	}
+	return nil
+}
+
+func scanCustomer(row pgx.CollectableRow) (models.Customer, error) {
+	var c models.Customer
+	err := row.Scan(&c.ID, &c.Name, &c.Phone, &c.Email, &c.Notes, &c.CreatedAt)
+	return c, err
+}
+
+func scanFavorite(row pgx.CollectableRow) (models.FavoriteOrder, error) {
+	var f models.FavoriteOrder
+	var items []byte
+	if err := row.Scan(&f.ID, &f.CustomerID, &f.Name, &items, &f.CreatedAt); err != nil {
+		return f, err
+	}
+	return f, json.Unmarshal(items, &f.Items)
+}
@@ -0,0 +1,178 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+)
+
+const redemptionColumns = `
+        id, customer_id, order_id, reward, COALESCE(product_id, 0), COALESCE(variant_id, 0),
+        points, value, created_at, undone_at`
+
+func (s *Storage) GetLoyaltyBalance(ctx context.Context, customerID int64) (int64, error) {
+	var balance int64
+	err := s.db.QueryRow(ctx, `
+        SELECT COALESCE(SUM(points), 0) FROM loyalty_ledger WHERE customer_id = $1
+    `, customerID).Scan(&balance)
+	if err != nil {
+		return 0, fmt.Errorf("cannot select loyalty_ledger: %w", err)
+	}
+	return balance, nil
+}
+
+func (s *Storage) GetLoyaltyHistory(ctx context.Context, customerID int64) ([]models.LoyaltyEntry, error) {
+	rows, err := s.db.Query(ctx, `
+        SELECT id, customer_id, points, reason, order_id, redemption_id, created_at
+        FROM loyalty_ledger
+        WHERE customer_id = $1
+        ORDER BY created_at, id
+    `, customerID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot select loyalty_ledger: %w", err)
+	}
+
+	history, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.LoyaltyEntry, error) {
+		var e models.LoyaltyEntry
+		err := row.Scan(&e.ID, &e.CustomerID, &e.Points, &e.Reason, &e.OrderID, &e.RedemptionID, &e.CreatedAt)
+		return e, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot scan loyalty_ledger: %w", err)
+	}
+	return history, nil
+}
+
+// saveRedemption records the redemption and spends its points. The customer
+// row is locked so that concurrent redemptions cannot overdraw the balance.
+func saveRedemption(ctx context.Context, tx pgx.Tx, r models.LoyaltyRedemption) error {
+	var balance int64
+	err := tx.QueryRow(ctx, `
+        SELECT COALESCE((SELECT SUM(points) FROM loyalty_ledger WHERE customer_id = c.id), 0)
+        FROM customers c
+        WHERE c.id = $1
+        FOR UPDATE
+    `, r.CustomerID).Scan(&balance)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("cannot lock customer: %w", err)
+	}
+	if balance < r.Points {
+		return fmt.Errorf("%w: %d needed, %d available", models.ErrInsufficientPoints, r.Points, balance)
+	}
+
+	err = tx.QueryRow(ctx, `
+        INSERT INTO loyalty_redemptions(customer_id, order_id, reward, product_id, variant_id, points, value)
+        VALUES ($1, $2, $3, NULLIF($4, 0), NULLIF($5, 0), $6, $7)
+        RETURNING id
+    `, r.CustomerID, r.OrderID, r.Reward, r.ProductID, r.VariantID, r.Points, r.Value).Scan(&r.ID)
+	if err != nil {
+		return fmt.Errorf("cannot insert into loyalty_redemptions: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+        INSERT INTO loyalty_ledger(customer_id, points, reason, order_id, redemption_id)
+        VALUES ($1, $2, 'redeem', $3, $4)
+    `, r.CustomerID, -r.Points, r.OrderID, r.ID)
+	if err != nil {
+		return fmt.Errorf("cannot insert into loyalty_ledger: %w", err)
+	}
+	return nil
+}
+
+func (s *Storage) GetRedemptions(ctx context.Context, customerID int64) ([]models.LoyaltyRedemption, error) {
+	return s.queryRedemptions(ctx, `WHERE customer_id = $1`, customerID)
+}
+
+// GetOrderRedemptions lists the redemptions made on the orders.
+func (s *Storage) GetOrderRedemptions(ctx context.Context, orderIDs ...int64) ([]models.LoyaltyRedemption, error) {
+	return s.queryRedemptions(ctx, `WHERE order_id = ANY($1)`, orderIDs)
+}
+
+// UndoRedemption gives the redemption's points back with a reversal entry.
+// The order is locked first, like every other change to an order and its
+// discounts, and must be open, cancelled or deleted.
+func (s *Storage) UndoRedemption(ctx context.Context, id int64) (models.LoyaltyRedemption, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return models.LoyaltyRedemption{}, fmt.Errorf("cannot begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var orderID int64
+	err = tx.QueryRow(ctx, `SELECT order_id FROM loyalty_redemptions WHERE id = $1`, id).Scan(&orderID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.LoyaltyRedemption{}, models.ErrNotFound
+	}
+	if err != nil {
+		return models.LoyaltyRedemption{}, fmt.Errorf("cannot select loyalty_redemptions: %w", err)
+	}
+
+	var status models.OrderStatus
+	err = tx.QueryRow(ctx, `SELECT status FROM orders WHERE id = $1 FOR UPDATE`, orderID).Scan(&status)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		// The order was deleted, so it will not be paid either.
+	case err != nil:
+		return models.LoyaltyRedemption{}, fmt.Errorf("cannot select order: %w", err)
+	case !models.CanUndoRedemption(status):
+		return models.LoyaltyRedemption{}, fmt.Errorf("%w: order %d is %s", models.ErrOrderClosed, orderID, status)
+	}
+
+	rows, err := tx.Query(ctx, `SELECT `+redemptionColumns+` FROM loyalty_redemptions WHERE id = $1 FOR UPDATE`, id)
+	if err != nil {
+		return models.LoyaltyRedemption{}, fmt.Errorf("cannot select loyalty_redemptions: %w", err)
+	}
+	r, err := pgx.CollectExactlyOneRow(rows, scanRedemption)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.LoyaltyRedemption{}, models.ErrNotFound
+	}
+	if err != nil {
+		return models.LoyaltyRedemption{}, fmt.Errorf("cannot scan loyalty_redemptions: %w", err)
+	}
+	if r.UndoneAt != nil {
+		return models.LoyaltyRedemption{}, models.ErrRedemptionUndone
+	}
+
+	err = tx.QueryRow(ctx, `UPDATE loyalty_redemptions SET undone_at = NOW() WHERE id = $1 RETURNING undone_at`, id).Scan(&r.UndoneAt)
+	if err != nil {
+		return models.LoyaltyRedemption{}, fmt.Errorf("cannot update loyalty_redemptions: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+        INSERT INTO loyalty_ledger(customer_id, points, reason, order_id, redemption_id)
+        VALUES ($1, $2, 'reversal', $3, $4)
+    `, r.CustomerID, r.Points, r.OrderID, r.ID)
+	if err != nil {
+		return models.LoyaltyRedemption{}, fmt.Errorf("cannot insert into loyalty_ledger: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return models.LoyaltyRedemption{}, fmt.Errorf("cannot commit transaction: %w", err)
+	}
+	return r, nil
+}
+
+func (s *Storage) queryRedemptions(ctx context.Context, where string, args ...any) ([]models.LoyaltyRedemption, error) {
+	rows, err := s.db.Query(ctx, `SELECT `+redemptionColumns+` FROM loyalty_redemptions `+where+` ORDER BY created_at, id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot select loyalty_redemptions: %w", err)
+	}
+
+	redemptions, err := pgx.CollectRows(rows, scanRedemption)
+	if err != nil {
+		return nil, fmt.Errorf("cannot scan loyalty_redemptions: %w", err)
+	}
+	return redemptions, nil
+}
+
+func scanRedemption(row pgx.CollectableRow) (models.LoyaltyRedemption, error) {
+	var r models.LoyaltyRedemption
+	err := row.Scan(&r.ID, &r.CustomerID, &r.OrderID, &r.Reward, &r.ProductID, &r.VariantID,
+		&r.Points, &r.Value, &r.CreatedAt, &r.UndoneAt)
+	return r, err
+}
@@ -0,0 +1,87 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"github.com/weeweeshka/hot-coffee/internal/money"
+)
+
+// SavePayment records the payment unless it would take what has been paid
+// towards the order over total. The order row is locked so that concurrent
+// payments cannot overpay it.
+func (s *Storage) SavePayment(ctx context.Context, p models.Payment, total money.Amount) (models.Payment, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return models.Payment{}, fmt.Errorf("cannot begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var paid money.Amount
+	err = tx.QueryRow(ctx, `
+        SELECT COALESCE((SELECT SUM(amount) FROM payments WHERE order_id = o.id), 0)
+        FROM orders o
+        WHERE o.id = $1
+        FOR UPDATE
+    `, p.OrderID).Scan(&paid)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Payment{}, models.ErrNotFound
+	}
+	if err != nil {
+		return models.Payment{}, fmt.Errorf("cannot lock order: %w", err)
+	}
+	if paid+p.Amount > total {
+		return models.Payment{}, fmt.Errorf("%w: %s due", models.ErrOverpayment, total-paid)
+	}
+
+	err = tx.QueryRow(ctx, `
+        INSERT INTO payments(order_id, method, amount, tendered, change, tip, reference)
+        VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''))
+        RETURNING id, created_at
+    `, p.OrderID, p.Method, p.Amount, p.Tendered, p.Change, p.Tip, p.Reference).Scan(&p.ID, &p.CreatedAt)
+	if err != nil {
+		return models.Payment{}, fmt.Errorf("cannot insert into payments: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return models.Payment{}, fmt.Errorf("cannot commit transaction: %w", err)
+	}
+	return p, nil
+}
+
+func (s *Storage) GetOrderPayments(ctx context.Context, orderID int64) ([]models.Payment, error) {
+	rows, err := s.db.Query(ctx, `
+        SELECT p.id, p.order_id, p.method, p.amount, p.tendered, p.change, p.tip,
+               COALESCE((SELECT SUM(r.amount) FROM payment_refunds r WHERE r.payment_id = p.id), 0),
+               COALESCE(p.reference, ''), p.created_at
+        FROM payments p
+        WHERE p.order_id = $1
+        ORDER BY p.created_at, p.id
+    `, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot select payments: %w", err)
+	}
+
+	payments, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.Payment, error) {
+		var p models.Payment
+		err := row.Scan(&p.ID, &p.OrderID, &p.Method, &p.Amount, &p.Tendered, &p.Change, &p.Tip, &p.Refunded, &p.Reference, &p.CreatedAt)
+		return p, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot scan payments: %w", err)
+	}
+	return payments, nil
+}
+
+func (s *Storage) OrderPaid(ctx context.Context, orderID int64) (money.Amount, error) {
+	var paid money.Amount
+	err := s.db.QueryRow(ctx, `
+        SELECT COALESCE(SUM(amount), 0) FROM payments WHERE order_id = $1
+    `, orderID).Scan(&paid)
+	if err != nil {
+		return 0, fmt.Errorf("cannot select payments: %w", err)
+	}
+	return paid, nil
+}
@@ -0,0 +1,195 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"log/slog"
+	"time"
+)
+
+// Config tunes the connection pool. Zero fields take the defaults below, or
+// pgxpool's own for the pool sizes.
+type Config struct {
+	URL string
+	// MaxConns and MinConns bound the number of open connections.
+	MaxConns int32
+	MinConns int32
+	// HealthCheckPeriod is how often idle connections are checked and the
+	// pool is topped up to MinConns.
+	HealthCheckPeriod time.Duration
+	// ConnectAttempts is how many times startup tries to reach the database,
+	// waiting twice as long after each failure.
+	ConnectAttempts int
+	// StatementTimeout limits every statement, including those run inside a
+	// transaction.
+	StatementTimeout time.Duration
+}
+
+const (
+	defaultConnectAttempts  = 5
+	defaultStatementTimeout = 5 * time.Second
+	firstConnectBackoff     = 500 * time.Millisecond
+	maxConnectBackoff       = 10 * time.Second
+)
+
+// pool is the connection pool with StatementTimeout applied to each query.
+type pool struct {
+	*pgxpool.Pool
+	timeout time.Duration
+}
+
+// connect opens the pool and waits for the database to answer, retrying with
+// backoff while it is not yet up.
+func connect(ctx context.Context, logr *slog.Logger, cfg Config) (*pool, error) {
+	poolConfig, err := pgxpool.ParseConfig(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse database url: %w", err)
+	}
+	if cfg.MaxConns > 0 {
+		poolConfig.MaxConns = cfg.MaxConns
+	}
+	if cfg.MinConns > 0 {
+		poolConfig.MinConns = cfg.MinConns
+	}
+	if poolConfig.MinConns > poolConfig.MaxConns {
+		return nil, fmt.Errorf("min conns %d exceed max conns %d", poolConfig.MinConns, poolConfig.MaxConns)
+	}
+	if cfg.HealthCheckPeriod > 0 {
+		poolConfig.HealthCheckPeriod = cfg.HealthCheckPeriod
+	}
+
+	attempts := cfg.ConnectAttempts
+	if attempts <= 0 {
+		attempts = defaultConnectAttempts
+	}
+	timeout := cfg.StatementTimeout
+	if timeout <= 0 {
+		timeout = defaultStatementTimeout
+	}
+
+	db, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create pool: %w", err)
+	}
+
+	backoff := firstConnectBackoff
+	for attempt := 1; ; attempt++ {
+		pingCtx, cancel := context.WithTimeout(ctx, timeout)
+		err = db.Ping(pingCtx)
+		cancel()
+		if err == nil {
+			break
+		}
+		if attempt == attempts {
+			db.Close()
+			return nil, fmt.Errorf("cannot connect to postgresql after %d attempts: %w", attempts, err)
+		}
+
+		logr.Warn("cannot connect to postgresql, retrying", "attempt", attempt, "backoff", backoff.String(), "err", err)
+		select {
+		case <-ctx.Done():
+			db.Close()
+			return nil, fmt.Errorf("cannot connect to postgresql: %w", ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, maxConnectBackoff)
+	}
+
+	logr.Info("connected to postgresql", "max_conns", poolConfig.MaxConns, "min_conns", poolConfig.MinConns)
+	return &pool{Pool: db, timeout: timeout}, nil
+}
+
+func (p *pool) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	return p.Pool.Exec(ctx, sql, args...)
+}
+
+func (p *pool) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	return timedQuery(ctx, p.Pool, p.timeout, sql, args...)
+}
+
+func (p *pool) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	rows, err := p.Query(ctx, sql, args...)
+	return &timedRow{rows: rows, err: err}
+}
+
+// Begin starts a transaction whose statements are each limited like those
+// run on the pool.
+func (p *pool) Begin(ctx context.Context) (pgx.Tx, error) {
+	tx, err := p.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &timedTx{Tx: tx, timeout: p.timeout}, nil
+}
+
+type timedTx struct {
+	pgx.Tx
+	timeout time.Duration
+}
+
+func (tx *timedTx) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	ctx, cancel := context.WithTimeout(ctx, tx.timeout)
+	defer cancel()
+	return tx.Tx.Exec(ctx, sql, args...)
+}
+
+func (tx *timedTx) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	return timedQuery(ctx, tx.Tx, tx.timeout, sql, args...)
+}
+
+func (tx *timedTx) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	rows, err := tx.Query(ctx, sql, args...)
+	return &timedRow{rows: rows, err: err}
+}
+
+// timedQuery runs the query under the timeout, which lasts until the rows are
+// closed.
+func timedQuery(ctx context.Context, q querier, timeout time.Duration, sql string, args ...any) (pgx.Rows, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	rows, err := q.Query(ctx, sql, args...)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &timedRows{Rows: rows, cancel: cancel}, nil
+}
+
+type timedRows struct {
+	pgx.Rows
+	cancel context.CancelFunc
+}
+
+func (r *timedRows) Close() {
+	r.Rows.Close()
+	r.cancel()
+}
+
+// timedRow scans the first of the rows like pgx.Conn.QueryRow does.
+type timedRow struct {
+	rows pgx.Rows
+	err  error
+}
+
+func (r *timedRow) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	defer r.rows.Close()
+
+	if !r.rows.Next() {
+		if err := r.rows.Err(); err != nil {
+			return err
+		}
+		return pgx.ErrNoRows
+	}
+	if err := r.rows.Scan(dest...); err != nil {
+		return err
+	}
+	r.rows.Close()
+	return r.rows.Err()
+}
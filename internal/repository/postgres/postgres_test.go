@@ -0,0 +1,66 @@
+package postgres_test
+
+import (
+	"context"
+	"github.com/weeweeshka/hot-coffee/internal/repository/postgres"
+	"github.com/weeweeshka/hot-coffee/internal/repository/repotest"
+	"github.com/weeweeshka/hot-coffee/internal/service"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"testing"
+)
+
+var (
+	shared     *postgres.Storage
+	sharedErr  error
+	sharedOnce sync.Once
+)
+
+// TestMain closes the storage the tests shared.
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if shared != nil {
+		shared.Close()
+	}
+	os.Exit(code)
+}
+
+// newStorage connects to the migrated database at TEST_DATABASE_URL and skips
+// the test when it is not set. The suites only look at the rows they create,
+// so every test shares one pool.
+func newStorage(t *testing.T) *postgres.Storage {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	sharedOnce.Do(func() {
+		logr := slog.New(slog.NewTextHandler(io.Discard, nil))
+		shared, sharedErr = postgres.NewStorage(context.Background(), logr, postgres.Config{URL: url})
+	})
+	if sharedErr != nil {
+		t.Fatalf("NewStorage: %v", sharedErr)
+	}
+	return shared
+}
+
+func TestInventoryRepo(t *testing.T) {
+	newStorage(t)
+	repotest.RunInventoryRepoSuite(t, func(t *testing.T) service.InventoryRepo { return newStorage(t) })
+}
+
+func TestMenuRepo(t *testing.T) {
+	newStorage(t)
+	repotest.RunMenuRepoSuite(t, func(t *testing.T) repotest.MenuStore { return newStorage(t) })
+}
+
+func TestOrderRepo(t *testing.T) {
+	newStorage(t)
+	repotest.RunOrderRepoSuite(t, func(t *testing.T) repotest.OrderStore { return newStorage(t) })
+}
+
+func TestDiscountRepo(t *testing.T) {
+	newStorage(t)
+	repotest.RunDiscountRepoSuite(t, func(t *testing.T) repotest.DiscountStore { return newStorage(t) })
+}
@@ -0,0 +1,209 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"github.com/weeweeshka/hot-coffee/internal/money"
+	"time"
+)
+
+const promotionColumns = `
+        id, code, name, type, value, COALESCE(product_id, 0), buy_quantity, get_quantity,
+        window_start, window_end, window_days, starts_at, ends_at,
+        max_uses, max_uses_per_customer, max_discount_total, active, created_at`
+
+func (s *Storage) SavePromotion(ctx context.Context, p models.Promotion) (int64, error) {
+	start, end, days := promotionWindow(p.Window)
+
+	var id int64
+	err := s.db.QueryRow(ctx, `
+        INSERT INTO promotions(code, name, type, value, product_id, buy_quantity, get_quantity,
+                               window_start, window_end, window_days, starts_at, ends_at,
+                               max_uses, max_uses_per_customer, max_discount_total, active)
+        VALUES ($1, $2, $3, $4, NULLIF($5, 0), $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+        RETURNING id
+    `, p.Code, p.Name, p.Type, p.Value, p.ProductID, p.BuyQuantity, p.GetQuantity,
+		start, end, days, p.StartsAt, p.EndsAt,
+		p.MaxUses, p.MaxUsesPerCustomer, p.MaxDiscountTotal, p.Active).Scan(&id)
+	if isUniqueViolation(err) {
+		return 0, models.ErrDuplicatePromotion
+	}
+	if err != nil {
+		return 0, fmt.Errorf("cannot insert into promotions: %w", err)
+	}
+	return id, nil
+}
+
+func (s *Storage) GetAllPromotions(ctx context.Context) ([]models.Promotion, error) {
+	rows, err := s.db.Query(ctx, `SELECT `+promotionColumns+` FROM promotions ORDER BY created_at DESC, id DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("cannot select promotions: %w", err)
+	}
+
+	promotions, err := pgx.CollectRows(rows, scanPromotion)
+	if err != nil {
+		return nil, fmt.Errorf("cannot scan promotions: %w", err)
+	}
+	return promotions, nil
+}
+
+func (s *Storage) GetPromotion(ctx context.Context, id int64) (models.Promotion, error) {
+	return s.queryPromotion(ctx, `WHERE id = $1`, id)
+}
+
+func (s *Storage) GetPromotionByCode(ctx context.Context, code string) (models.Promotion, error) {
+	return s.queryPromotion(ctx, `WHERE code = $1`, code)
+}
+
+func (s *Storage) UpdatePromotion(ctx context.Context, id int64, p models.Promotion) (models.Promotion, error) {
+	start, end, days := promotionWindow(p.Window)
+
+	err := s.db.QueryRow(ctx, `
+        UPDATE promotions
+        SET code = $1, name = $2, type = $3, value = $4, product_id = NULLIF($5, 0),
+            buy_quantity = $6, get_quantity = $7, window_start = $8, window_end = $9, window_days = $10,
+            starts_at = $11, ends_at = $12, max_uses = $13, max_uses_per_customer = $14,
+            max_discount_total = $15, active = $16
+        WHERE id = $17
+        RETURNING created_at
+    `, p.Code, p.Name, p.Type, p.Value, p.ProductID, p.BuyQuantity, p.GetQuantity,
+		start, end, days, p.StartsAt, p.EndsAt,
+		p.MaxUses, p.MaxUsesPerCustomer, p.MaxDiscountTotal, p.Active, id).Scan(&p.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Promotion{}, models.ErrNotFound
+	}
+	if isUniqueViolation(err) {
+		return models.Promotion{}, models.ErrDuplicatePromotion
+	}
+	if err != nil {
+		return models.Promotion{}, fmt.Errorf("cannot update promotions: %w", err)
+	}
+
+	p.ID = id
+	return p, nil
+}
+
+// DeactivatePromotion retires a code but keeps it for its usage history.
+func (s *Storage) DeactivatePromotion(ctx context.Context, id int64) error {
+	tag, err := s.db.Exec(ctx, `UPDATE promotions SET active = FALSE WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("cannot update promotions: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return models.ErrNotFound
+	}
+	return nil
+}
+
+// savePromotionUsage records u after checking p's limits. The promotion row
+// is locked so that concurrent orders cannot use the code past its limits.
+func savePromotionUsage(ctx context.Context, tx pgx.Tx, p models.Promotion, u models.PromotionUsage) error {
+	var uses, customerUses int64
+	var given money.Amount
+	err := tx.QueryRow(ctx, `
+        SELECT (SELECT COUNT(*) FROM promotion_usages WHERE promotion_id = p.id AND voided_at IS NULL),
+               (SELECT COUNT(*) FROM promotion_usages WHERE promotion_id = p.id AND voided_at IS NULL AND customer_id = $2),
+               (SELECT COALESCE(SUM(amount), 0) FROM promotion_usages WHERE promotion_id = p.id AND voided_at IS NULL)
+        FROM promotions p
+        WHERE p.id = $1
+        FOR UPDATE
+    `, p.ID, u.CustomerID).Scan(&uses, &customerUses, &given)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("cannot lock promotion: %w", err)
+	}
+
+	switch {
+	case p.MaxUses > 0 && uses >= p.MaxUses:
+		return fmt.Errorf("%w: %s was used %d times", models.ErrPromoLimitReached, p.Code, uses)
+	case p.MaxUsesPerCustomer > 0 && u.CustomerID != nil && customerUses >= p.MaxUsesPerCustomer:
+		return fmt.Errorf("%w: customer used %s %d times", models.ErrPromoLimitReached, p.Code, customerUses)
+	case p.MaxDiscountTotal > 0 && given+u.Amount > p.MaxDiscountTotal:
+		return fmt.Errorf("%w: %s has %s of its budget left", models.ErrPromoLimitReached, p.Code, p.MaxDiscountTotal-given)
+	}
+
+	_, err = tx.Exec(ctx, `
+        INSERT INTO promotion_usages(promotion_id, order_id, customer_id, amount)
+        VALUES ($1, $2, $3, $4)
+    `, p.ID, u.OrderID, u.CustomerID, u.Amount)
+	if err != nil {
+		return fmt.Errorf("cannot insert into promotion_usages: %w", err)
+	}
+	return nil
+}
+
+// GetOrderPromotionUsages lists the usages of the orders that are not voided.
+func (s *Storage) GetOrderPromotionUsages(ctx context.Context, orderIDs ...int64) ([]models.PromotionUsage, error) {
+	rows, err := s.db.Query(ctx, `
+        SELECT u.id, u.promotion_id, p.code, COALESCE(p.product_id, 0), u.order_id, u.customer_id, u.amount, u.created_at, u.voided_at
+        FROM promotion_usages u
+        JOIN promotions p ON p.id = u.promotion_id
+        WHERE u.order_id = ANY($1) AND u.voided_at IS NULL
+        ORDER BY u.id
+    `, orderIDs)
+	if err != nil {
+		return nil, fmt.Errorf("cannot select promotion_usages: %w", err)
+	}
+
+	usages, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.PromotionUsage, error) {
+		var u models.PromotionUsage
+		err := row.Scan(&u.ID, &u.PromotionID, &u.Code, &u.ProductID, &u.OrderID, &u.CustomerID, &u.Amount, &u.CreatedAt, &u.VoidedAt)
+		return u, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot scan promotion_usages: %w", err)
+	}
+	return usages, nil
+}
+
+func (s *Storage) queryPromotion(ctx context.Context, where string, args ...any) (models.Promotion, error) {
+	rows, err := s.db.Query(ctx, `SELECT `+promotionColumns+` FROM promotions `+where, args...)
+	if err != nil {
+		return models.Promotion{}, fmt.Errorf("cannot select promotions: %w", err)
+	}
+
+	p, err := pgx.CollectExactlyOneRow(rows, scanPromotion)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Promotion{}, models.ErrNotFound
+	}
+	if err != nil {
+		return models.Promotion{}, fmt.Errorf("cannot scan promotions: %w", err)
+	}
+	return p, nil
+}
+
+func promotionWindow(w *models.TimeWindow) (*string, *string, []int32) {
+	if w == nil {
+		return nil, nil, nil
+	}
+	days := make([]int32, 0, len(w.Days))
+	for _, day := range w.Days {
+		days = append(days, int32(day))
+	}
+	return &w.Start, &w.End, days
+}
+
+func scanPromotion(row pgx.CollectableRow) (models.Promotion, error) {
+	var p models.Promotion
+	var start, end *string
+	var days []int32
+	err := row.Scan(&p.ID, &p.Code, &p.Name, &p.Type, &p.Value, &p.ProductID, &p.BuyQuantity, &p.GetQuantity,
+		&start, &end, &days, &p.StartsAt, &p.EndsAt,
+		&p.MaxUses, &p.MaxUsesPerCustomer, &p.MaxDiscountTotal, &p.Active, &p.CreatedAt)
+	if err != nil {
+		return p, err
+	}
+
+	if start != nil && end != nil {
+		p.Window = &models.TimeWindow{Start: *start, End: *end}
+		for _, day := range days {
+			p.Window.Days = append(p.Window.Days, time.Weekday(day))
+		}
+	}
+	return p, nil
+}
@@ -0,0 +1,245 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"github.com/weeweeshka/hot-coffee/internal/money"
+)
+
+// SaveRefund records the refund against its order lines and payments and
+// puts restock back into the inventory in one transaction. The order row is
+// locked so that concurrent refunds cannot give back more than was sold or
+// paid; either fails with models.ErrInvalidRefund. Restocking never returns
+// more of an ingredient than the order still holds out of the inventory. The
+// points the order earned are taken back in the share of orderTotal refunded.
+func (s *Storage) SaveRefund(ctx context.Context, r models.Refund, restock []models.IngredientAmount, orderTotal money.Amount) (models.Refund, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return models.Refund{}, fmt.Errorf("cannot begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var status models.OrderStatus
+	err = tx.QueryRow(ctx, `SELECT status FROM orders WHERE id = $1 FOR UPDATE`, r.OrderID).Scan(&status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Refund{}, models.ErrNotFound
+	}
+	if err != nil {
+		return models.Refund{}, fmt.Errorf("cannot lock order: %w", err)
+	}
+
+	for _, line := range r.Lines {
+		var left int
+		err = tx.QueryRow(ctx, `
+            SELECT oi.quantity - COALESCE((SELECT SUM(rl.quantity) FROM refund_lines rl WHERE rl.order_item_id = oi.id), 0)
+            FROM order_items oi
+            WHERE oi.id = $1 AND oi.order_id = $2
+        `, line.LineID, r.OrderID).Scan(&left)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.Refund{}, fmt.Errorf("%w: line %d is not on order %d", models.ErrInvalidRefund, line.LineID, r.OrderID)
+		}
+		if err != nil {
+			return models.Refund{}, fmt.Errorf("cannot select order_items: %w", err)
+		}
+		if line.Quantity > left {
+			return models.Refund{}, fmt.Errorf("%w: line %d has %d left to refund", models.ErrInvalidRefund, line.LineID, left)
+		}
+	}
+
+	for _, p := range r.Payments {
+		var left money.Amount
+		err = tx.QueryRow(ctx, `
+            SELECT p.amount - COALESCE((SELECT SUM(pr.amount) FROM payment_refunds pr WHERE pr.payment_id = p.id), 0)
+            FROM payments p
+            WHERE p.id = $1 AND p.order_id = $2
+        `, p.PaymentID, r.OrderID).Scan(&left)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.Refund{}, fmt.Errorf("%w: payment %d is not on order %d", models.ErrInvalidRefund, p.PaymentID, r.OrderID)
+		}
+		if err != nil {
+			return models.Refund{}, fmt.Errorf("cannot select payments: %w", err)
+		}
+		if p.Amount > left {
+			return models.Refund{}, fmt.Errorf("%w: payment %d has %s left to refund", models.ErrInvalidRefund, p.PaymentID, left)
+		}
+	}
+
+	err = tx.QueryRow(ctx, `
+        INSERT INTO refunds(order_id, reason, restock, amount)
+        VALUES ($1, $2, $3, $4)
+        RETURNING id, created_at
+    `, r.OrderID, r.Reason, r.Restock, r.Amount).Scan(&r.ID, &r.CreatedAt)
+	if err != nil {
+		return models.Refund{}, fmt.Errorf("cannot insert into refunds: %w", err)
+	}
+
+	for _, line := range r.Lines {
+		_, err = tx.Exec(ctx, `
+            INSERT INTO refund_lines(refund_id, order_item_id, quantity, amount)
+            VALUES ($1, $2, $3, $4)
+        `, r.ID, line.LineID, line.Quantity, line.Amount)
+		if err != nil {
+			return models.Refund{}, fmt.Errorf("cannot insert into refund_lines: %w", err)
+		}
+	}
+
+	for _, p := range r.Payments {
+		_, err = tx.Exec(ctx, `
+            INSERT INTO payment_refunds(refund_id, payment_id, amount)
+            VALUES ($1, $2, $3)
+        `, r.ID, p.PaymentID, p.Amount)
+		if err != nil {
+			return models.Refund{}, fmt.Errorf("cannot insert into payment_refunds: %w", err)
+		}
+	}
+
+	if err = restockRefund(ctx, tx, r, restock); err != nil {
+		return models.Refund{}, err
+	}
+	if err = reverseEarnedPoints(ctx, tx, r.OrderID, orderTotal); err != nil {
+		return models.Refund{}, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return models.Refund{}, fmt.Errorf("cannot commit transaction: %w", err)
+	}
+	return r, nil
+}
+
+// reverseEarnedPoints takes back the points the order earned in proportion
+// to how much of orderTotal has been refunded so far, less what earlier
+// refunds took back. Reversals of redemptions name the redemption; those of
+// refunds do not.
+func reverseEarnedPoints(ctx context.Context, tx pgx.Tx, orderID int64, orderTotal money.Amount) error {
+	var customerID, earned, reversed int64
+	var refunded money.Amount
+	err := tx.QueryRow(ctx, `
+        SELECT customer_id, points,
+               (SELECT COALESCE(-SUM(points), 0) FROM loyalty_ledger
+                WHERE order_id = $1 AND reason = 'reversal' AND redemption_id IS NULL),
+               (SELECT COALESCE(SUM(amount), 0) FROM refunds WHERE order_id = $1)
+        FROM loyalty_ledger
+        WHERE order_id = $1 AND reason = 'earn'
+    `, orderID).Scan(&customerID, &earned, &reversed, &refunded)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("cannot select loyalty_ledger: %w", err)
+	}
+
+	points := models.RefundedPoints(earned, refunded, orderTotal) - reversed
+	if points <= 0 {
+		return nil
+	}
+	_, err = tx.Exec(ctx, `
+        INSERT INTO loyalty_ledger(customer_id, points, reason, order_id)
+        VALUES ($1, $2, 'reversal', $3)
+    `, customerID, -points, orderID)
+	if err != nil {
+		return fmt.Errorf("cannot insert into loyalty_ledger: %w", err)
+	}
+	return nil
+}
+
+func restockRefund(ctx context.Context, tx pgx.Tx, r models.Refund, restock []models.IngredientAmount) error {
+	ids := make([]int64, 0, len(restock))
+	for _, c := range restock {
+		ids = append(ids, c.IngredientID)
+	}
+	stock, err := lockStock(ctx, tx, ids)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range restock {
+		var held float64
+		err = tx.QueryRow(ctx, `
+            SELECT -COALESCE(SUM(delta), 0)
+            FROM inventory_transactions
+            WHERE order_id = $1 AND ingredient_id = $2
+        `, r.OrderID, c.IngredientID).Scan(&held)
+		if err != nil {
+			return fmt.Errorf("cannot select inventory_transactions: %w", err)
+		}
+
+		quantity := min(c.Quantity, held)
+		if quantity <= 0 {
+			continue
+		}
+		if _, ok := stock[c.IngredientID]; !ok {
+			return models.ErrNotFound
+		}
+
+		_, err = tx.Exec(ctx, `UPDATE inventory SET quantity = quantity + $1 WHERE ingredient_id = $2`, quantity, c.IngredientID)
+		if err != nil {
+			return fmt.Errorf("cannot update inventory: %w", err)
+		}
+
+		_, err = insertTransaction(ctx, tx, models.InventoryTransaction{
+			IngredientID: c.IngredientID,
+			OrderID:      &r.OrderID,
+			Delta:        quantity,
+			Reason:       models.ReasonOrderReversal,
+			Note:         fmt.Sprintf("refund %d", r.ID),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Storage) GetOrderRefunds(ctx context.Context, orderID int64) ([]models.Refund, error) {
+	rows, err := s.db.Query(ctx, `
+        SELECT r.id, r.order_id, r.reason, r.restock, r.amount, r.created_at,
+               COALESCE((
+                   SELECT json_agg(json_build_object(
+                       'line_id', rl.order_item_id,
+                       'quantity', rl.quantity,
+                       'amount', rl.amount
+                   ) ORDER BY rl.order_item_id)
+                   FROM refund_lines rl
+                   WHERE rl.refund_id = r.id
+               ), '[]'),
+               COALESCE((
+                   SELECT json_agg(json_build_object(
+                       'payment_id', pr.payment_id,
+                       'method', p.method,
+                       'amount', pr.amount,
+                       'reference', COALESCE(p.reference, '')
+                   ) ORDER BY pr.payment_id)
+                   FROM payment_refunds pr
+                   JOIN payments p ON p.id = pr.payment_id
+                   WHERE pr.refund_id = r.id
+               ), '[]')
+        FROM refunds r
+        WHERE r.order_id = $1
+        ORDER BY r.created_at, r.id
+    `, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot select refunds: %w", err)
+	}
+
+	refunds, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.Refund, error) {
+		var r models.Refund
+		var lines, payments []byte
+		err := row.Scan(&r.ID, &r.OrderID, &r.Reason, &r.Restock, &r.Amount, &r.CreatedAt, &lines, &payments)
+		if err != nil {
+			return r, err
+		}
+		if err = json.Unmarshal(lines, &r.Lines); err != nil {
+			return r, err
+		}
+		err = json.Unmarshal(payments, &r.Payments)
+		return r, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot scan refunds: %w", err)
+	}
+	return refunds, nil
+}
@@ -0,0 +1,223 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"github.com/weeweeshka/hot-coffee/internal/money"
+	"time"
+)
+
+// TotalSales sums closed orders by the time they were closed. The grand total
+// and the per-period series come out of a single grouping-sets aggregation;
+// the series is left empty when groupBy is. Refunded items are taken out of
+// the revenue of the order they were sold on, and so is the share of the
+// order's discounts on what is left, rounded as money.Amount.Allocate does.
+func (s *Storage) TotalSales(ctx context.Context, from, to time.Time, groupBy models.SalesGrouping) (models.SalesReport, error) {
+	truncate := groupBy
+	if truncate == "" {
+		truncate = models.GroupByDay
+	}
+
+	rows, err := s.db.Query(ctx, `
+        WITH sold AS (
+            SELECT o.id, date_trunc($3, o.closed_at) AS period,
+                   SUM(oi.quantity * oi.unit_price) AS subtotal,
+                   SUM((oi.quantity - COALESCE(rl.quantity, 0)) * oi.unit_price) AS kept,
+                   (SELECT COALESCE(SUM(u.amount), 0) FROM promotion_usages u
+                    WHERE u.order_id = o.id AND u.voided_at IS NULL) +
+                   (SELECT COALESCE(SUM(lr.value), 0) FROM loyalty_redemptions lr
+                    WHERE lr.order_id = o.id AND lr.undone_at IS NULL) AS discounts,
+                   (SELECT COALESCE(SUM(r.amount), 0) FROM refunds r WHERE r.order_id = o.id) AS refunded
+            FROM orders o
+            JOIN order_items oi ON oi.order_id = o.id
+            LEFT JOIN (
+                SELECT order_item_id, SUM(quantity) AS quantity FROM refund_lines GROUP BY order_item_id
+            ) rl ON rl.order_item_id = oi.id
+            WHERE o.status = 'closed'
+              AND ($1::timestamp IS NULL OR o.closed_at >= $1)
+              AND ($2::timestamp IS NULL OR o.closed_at < $2)
+            GROUP BY o.id, o.closed_at
+        ),
+        closed AS (
+            SELECT period, refunded,
+                   GREATEST(kept - ROUND(discounts * kept / NULLIF(subtotal, 0), 2), 0) AS revenue
+            FROM sold
+        )
+        SELECT GROUPING(period) = 1, period, COALESCE(SUM(revenue), 0), COALESCE(SUM(refunded), 0), COUNT(*)
+        FROM closed
+        GROUP BY GROUPING SETS ((), (period))
+        ORDER BY GROUPING(period) DESC, period
+    `, nullTime(from), nullTime(to), string(truncate))
+	if err != nil {
+		return models.SalesReport{}, fmt.Errorf("cannot aggregate sales: %w", err)
+	}
+	defer rows.Close()
+
+	report := models.SalesReport{GroupBy: groupBy}
+	for rows.Next() {
+		var total bool
+		var period *time.Time
+		var revenue, refunded money.Amount
+		var count int64
+		if err = rows.Scan(&total, &period, &revenue, &refunded, &count); err != nil {
+			return models.SalesReport{}, fmt.Errorf("cannot scan sales: %w", err)
+		}
+
+		if total {
+			report.TotalRevenue, report.RefundTotal, report.OrderCount = revenue, refunded, count
+			continue
+		}
+		if groupBy != "" && period != nil {
+			report.Series = append(report.Series, models.SalesPeriod{PeriodStart: *period, Revenue: revenue, OrderCount: count})
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return models.SalesReport{}, fmt.Errorf("cannot read sales: %w", err)
+	}
+	return report, nil
+}
+
+func (s *Storage) PopularItems(ctx context.Context, from, to time.Time, sortBy models.PopularItemsSort, limit int) ([]models.PopularItem, error) {
+	rows, err := s.db.Query(ctx, `
+        WITH sold AS (
+            SELECT m.id, m.name, v.id AS variant_id, v.name AS variant_name,
+                   SUM(oi.quantity - COALESCE(rl.quantity, 0)) AS quantity,
+                   SUM((oi.quantity - COALESCE(rl.quantity, 0)) * oi.unit_price) AS revenue
+            FROM orders o
+            JOIN order_items oi ON oi.order_id = o.id
+            JOIN menus m ON m.id = oi.menu_id
+            LEFT JOIN menu_variants v ON v.id = oi.variant_id
+            LEFT JOIN (
+                SELECT order_item_id, SUM(quantity) AS quantity FROM refund_lines GROUP BY order_item_id
+            ) rl ON rl.order_item_id = oi.id
+            WHERE o.status = 'closed'
+              AND ($1::timestamp IS NULL OR o.closed_at >= $1)
+              AND ($2::timestamp IS NULL OR o.closed_at < $2)
+            GROUP BY m.id, m.name, v.id, v.name
+            HAVING SUM(oi.quantity - COALESCE(rl.quantity, 0)) > 0
+        ), ranked AS (
+            SELECT id, name, variant_id, variant_name, quantity, revenue,
+                   DENSE_RANK() OVER (ORDER BY quantity DESC) AS quantity_rank,
+                   DENSE_RANK() OVER (ORDER BY revenue DESC) AS revenue_rank,
+                   COALESCE(quantity / NULLIF(SUM(quantity) OVER (), 0), 0) AS quantity_share,
+                   COALESCE(revenue / NULLIF(SUM(revenue) OVER (), 0), 0) AS revenue_share
+            FROM sold
+        )
+        SELECT id, name, COALESCE(variant_id, 0), COALESCE(variant_name, ''),
+               quantity, revenue, quantity_rank, revenue_rank, quantity_share, revenue_share
+        FROM ranked
+        ORDER BY CASE WHEN $3 = 'revenue' THEN revenue_rank ELSE quantity_rank END, name, variant_name
+        LIMIT $4
+    `, nullTime(from), nullTime(to), string(sortBy), limit)
+	if err != nil {
+		return nil, fmt.Errorf("cannot rank menu items: %w", err)
+	}
+	defer rows.Close()
+
+	items := []models.PopularItem{}
+	for rows.Next() {
+		var item models.PopularItem
+		err = rows.Scan(&item.ProductID, &item.Name, &item.VariantID, &item.VariantName, &item.QuantitySold, &item.Revenue,
+			&item.QuantityRank, &item.RevenueRank, &item.QuantityShare, &item.RevenueShare)
+		if err != nil {
+			return nil, fmt.Errorf("cannot scan menu item sales: %w", err)
+		}
+		items = append(items, item)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read menu item sales: %w", err)
+	}
+	return items, nil
+}
+
+// PromotionUsage measures every promotion by the orders it was used on in
+// the period. Revenue counts closed orders only, net of all their discounts.
+func (s *Storage) PromotionUsage(ctx context.Context, from, to time.Time) ([]models.PromotionUsageStats, error) {
+	rows, err := s.db.Query(ctx, `
+        WITH used AS (
+            SELECT u.promotion_id, u.order_id, u.customer_id, u.amount
+            FROM promotion_usages u
+            JOIN orders o ON o.id = u.order_id
+            WHERE u.voided_at IS NULL
+              AND ($1::timestamp IS NULL OR u.created_at >= $1)
+              AND ($2::timestamp IS NULL OR u.created_at < $2)
+        ), gross AS (
+            SELECT oi.order_id, SUM(oi.quantity * oi.unit_price) AS subtotal
+            FROM order_items oi
+            WHERE oi.order_id IN (SELECT order_id FROM used)
+            GROUP BY oi.order_id
+        ), discounts AS (
+            SELECT order_id, SUM(amount) AS amount
+            FROM (
+                SELECT order_id, amount FROM promotion_usages WHERE voided_at IS NULL
+                UNION ALL
+                SELECT order_id, value FROM loyalty_redemptions WHERE undone_at IS NULL
+            ) d
+            WHERE order_id IN (SELECT order_id FROM used)
+            GROUP BY order_id
+        )
+        SELECT p.id, p.code, p.name,
+               COUNT(u.order_id), COUNT(DISTINCT u.customer_id), COALESCE(SUM(u.amount), 0),
+               COALESCE(SUM(GREATEST(g.subtotal - COALESCE(d.amount, 0), 0)) FILTER (WHERE o.status = 'closed'), 0),
+               COUNT(*) FILTER (WHERE o.status = 'closed')
+        FROM promotions p
+        LEFT JOIN used u ON u.promotion_id = p.id
+        LEFT JOIN orders o ON o.id = u.order_id
+        LEFT JOIN gross g ON g.order_id = u.order_id
+        LEFT JOIN discounts d ON d.order_id = u.order_id
+        GROUP BY p.id, p.code, p.name
+        ORDER BY COUNT(u.order_id) DESC, p.id
+    `, nullTime(from), nullTime(to))
+	if err != nil {
+		return nil, fmt.Errorf("cannot aggregate promotion usage: %w", err)
+	}
+
+	stats, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.PromotionUsageStats, error) {
+		var p models.PromotionUsageStats
+		err := row.Scan(&p.PromotionID, &p.Code, &p.Name, &p.Uses, &p.Customers, &p.DiscountTotal, &p.Revenue, &p.ClosedOrders)
+		return p, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot scan promotion usage: %w", err)
+	}
+	return stats, nil
+}
+
+// Tips totals the tips of closed orders per day in [from, to): tips paid with
+// payments count on the day they were paid, tips left at close on the day
+// the order closed.
+func (s *Storage) Tips(ctx context.Context, from, to time.Time) ([]models.TipDay, error) {
+	rows, err := s.db.Query(ctx, `
+        WITH tips AS (
+            SELECT p.created_at AS at, p.tip
+            FROM payments p
+            JOIN orders o ON o.id = p.order_id
+            WHERE o.status = 'closed' AND p.tip > 0
+            UNION ALL
+            SELECT o.closed_at, o.tip
+            FROM orders o
+            WHERE o.status = 'closed' AND o.tip > 0
+        )
+        SELECT date_trunc('day', at) AS day, SUM(tip)
+        FROM tips
+        WHERE ($1::timestamp IS NULL OR at >= $1)
+          AND ($2::timestamp IS NULL OR at < $2)
+        GROUP BY day
+        ORDER BY day
+    `, nullTime(from), nullTime(to))
+	if err != nil {
+		return nil, fmt.Errorf("cannot aggregate tips: %w", err)
+	}
+
+	days, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.TipDay, error) {
+		var day models.TipDay
+		err := row.Scan(&day.Date, &day.Total)
+		return day, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot scan tips: %w", err)
+	}
+	return days, nil
+}
@@ -0,0 +1,73 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"time"
+)
+
+func (s *Storage) StartShift(ctx context.Context, staff string) (models.Shift, error) {
+	shift := models.Shift{Staff: staff}
+	err := s.db.QueryRow(ctx, `
+        INSERT INTO shifts(staff) VALUES ($1)
+        RETURNING id, started_at
+    `, staff).Scan(&shift.ID, &shift.StartedAt)
+	if isUniqueViolation(err) {
+		return models.Shift{}, models.ErrShiftOpen
+	}
+	if err != nil {
+		return models.Shift{}, fmt.Errorf("cannot insert into shifts: %w", err)
+	}
+	return shift, nil
+}
+
+func (s *Storage) EndShift(ctx context.Context, id int64) (models.Shift, error) {
+	var shift models.Shift
+	err := s.db.QueryRow(ctx, `
+        UPDATE shifts SET ended_at = NOW()
+        WHERE id = $1 AND ended_at IS NULL
+        RETURNING id, staff, started_at, ended_at
+    `, id).Scan(&shift.ID, &shift.Staff, &shift.StartedAt, &shift.EndedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		var exists bool
+		err = s.db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM shifts WHERE id = $1)`, id).Scan(&exists)
+		if err != nil {
+			return models.Shift{}, fmt.Errorf("cannot select shifts: %w", err)
+		}
+		if exists {
+			return models.Shift{}, models.ErrShiftEnded
+		}
+		return models.Shift{}, models.ErrNotFound
+	}
+	if err != nil {
+		return models.Shift{}, fmt.Errorf("cannot update shift: %w", err)
+	}
+	return shift, nil
+}
+
+// GetShifts lists the shifts that overlap [from, to); zero bounds are open.
+func (s *Storage) GetShifts(ctx context.Context, from, to time.Time) ([]models.Shift, error) {
+	rows, err := s.db.Query(ctx, `
+        SELECT id, staff, started_at, ended_at
+        FROM shifts
+        WHERE ($1::timestamp IS NULL OR ended_at IS NULL OR ended_at > $1)
+          AND ($2::timestamp IS NULL OR started_at < $2)
+        ORDER BY started_at, id
+    `, nullTime(from), nullTime(to))
+	if err != nil {
+		return nil, fmt.Errorf("cannot select shifts: %w", err)
+	}
+
+	shifts, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.Shift, error) {
+		var shift models.Shift
+		err := row.Scan(&shift.ID, &shift.Staff, &shift.StartedAt, &shift.EndedAt)
+		return shift, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot scan shifts: %w", err)
+	}
+	return shifts, nil
+}
@@ -0,0 +1,105 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+)
+
+const staffColumns = `id, username, name, role, active, password_hash, created_at`
+
+func (s *Storage) SaveStaff(ctx context.Context, staff models.Staff) (int64, error) {
+	var id int64
+	err := s.db.QueryRow(ctx, `
+        INSERT INTO staff(username, name, password_hash, role, active)
+        VALUES ($1, $2, $3, $4, $5)
+        RETURNING id
+    `, staff.Username, staff.Name, staff.PasswordHash, staff.Role, staff.Active).Scan(&id)
+	if isUniqueViolation(err) {
+		return 0, models.ErrDuplicateStaff
+	}
+	if err != nil {
+		return 0, fmt.Errorf("cannot insert into staff: %w", err)
+	}
+	return id, nil
+}
+
+func (s *Storage) GetAllStaff(ctx context.Context) ([]models.Staff, error) {
+	rows, err := s.db.Query(ctx, `SELECT `+staffColumns+` FROM staff ORDER BY username`)
+	if err != nil {
+		return nil, fmt.Errorf("cannot select staff: %w", err)
+	}
+
+	staff, err := pgx.CollectRows(rows, scanStaff)
+	if err != nil {
+		return nil, fmt.Errorf("cannot scan staff: %w", err)
+	}
+	return staff, nil
+}
+
+func (s *Storage) GetStaff(ctx context.Context, id int64) (models.Staff, error) {
+	return s.getStaff(ctx, `WHERE id = $1`, id)
+}
+
+func (s *Storage) GetStaffByUsername(ctx context.Context, username string) (models.Staff, error) {
+	return s.getStaff(ctx, `WHERE username = $1`, username)
+}
+
+func (s *Storage) getStaff(ctx context.Context, where string, arg any) (models.Staff, error) {
+	rows, err := s.db.Query(ctx, `SELECT `+staffColumns+` FROM staff `+where, arg)
+	if err != nil {
+		return models.Staff{}, fmt.Errorf("cannot select staff: %w", err)
+	}
+
+	staff, err := pgx.CollectExactlyOneRow(rows, scanStaff)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Staff{}, models.ErrNotFound
+	}
+	if err != nil {
+		return models.Staff{}, fmt.Errorf("cannot scan staff: %w", err)
+	}
+	return staff, nil
+}
+
+// UpdateStaff replaces the staff member's details, and their password when
+// staff carries a new hash.
+func (s *Storage) UpdateStaff(ctx context.Context, id int64, staff models.Staff) (models.Staff, error) {
+	rows, err := s.db.Query(ctx, `
+        UPDATE staff
+        SET username = $1, name = $2, role = $3, active = $4,
+            password_hash = COALESCE(NULLIF($5, ''), password_hash)
+        WHERE id = $6
+        RETURNING `+staffColumns,
+		staff.Username, staff.Name, staff.Role, staff.Active, staff.PasswordHash, id)
+	if err != nil {
+		return models.Staff{}, fmt.Errorf("cannot update staff: %w", err)
+	}
+
+	staff, err = pgx.CollectExactlyOneRow(rows, scanStaff)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Staff{}, models.ErrNotFound
+	}
+	if isUniqueViolation(err) {
+		return models.Staff{}, models.ErrDuplicateStaff
+	}
+	if err != nil {
+		return models.Staff{}, fmt.Errorf("cannot update staff: %w", err)
+	}
+	return staff, nil
+}
+
+func (s *Storage) CountStaff(ctx context.Context) (int64, error) {
+	var count int64
+	if err := s.db.QueryRow(ctx, `SELECT COUNT(*) FROM staff`).Scan(&count); err != nil {
+		return 0, fmt.Errorf("cannot count staff: %w", err)
+	}
+	return count, nil
+}
+
+func scanStaff(row pgx.CollectableRow) (models.Staff, error) {
+	var staff models.Staff
+	err := row.Scan(&staff.ID, &staff.Username, &staff.Name, &staff.Role, &staff.Active, &staff.PasswordHash, &staff.CreatedAt)
+	return staff, err
+}
@@ -2,55 +2,387 @@ package postgres
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/weeweeshka/hot-coffee/internal/models"
+	"github.com/weeweeshka/hot-coffee/internal/money"
 	"log/slog"
+	"strings"
 	"time"
 )
 
 type Storage struct {
-	db   *pgx.Conn
+	db   *pool
 	logr *slog.Logger
 }
 
-func NewStorage(logr *slog.Logger, connString string) (*Storage, error) {
-	ctx := context.Background()
-	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
-	defer cancel()
+// querier runs queries on the pool or inside a transaction, so that helpers
+// read what the transaction they are called in has written.
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
 
-	conn, err := pgx.Connect(ctx, connString)
+// NewStorage connects to the database described by cfg, giving up when ctx
+// is done or cfg.ConnectAttempts have failed.
+func NewStorage(ctx context.Context, logr *slog.Logger, cfg Config) (*Storage, error) {
+	db, err := connect(ctx, logr, cfg)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	logr.Info("connected to postgresql")
 
 	return &Storage{
 		logr: logr,
-		db:   conn}, nil
+		db:   db}, nil
+}
+
+func (s *Storage) Close() error {
+	s.db.Close()
+	return nil
+}
+
+// Ping checks that the database answers.
+func (s *Storage) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, s.db.timeout)
+	defer cancel()
+	return s.db.Ping(ctx)
+}
+
+// Stats reports how the pool's connections are used.
+func (s *Storage) Stats() models.StorageStats {
+	stat := s.db.Stat()
+	return models.StorageStats{
+		MaxConns:             stat.MaxConns(),
+		TotalConns:           stat.TotalConns(),
+		IdleConns:            stat.IdleConns(),
+		AcquiredConns:        stat.AcquiredConns(),
+		ConstructingConns:    stat.ConstructingConns(),
+		AcquireCount:         stat.AcquireCount(),
+		AcquireDuration:      stat.AcquireDuration().String(),
+		EmptyAcquireCount:    stat.EmptyAcquireCount(),
+		CanceledAcquireCount: stat.CanceledAcquireCount(),
+		NewConnsCount:        stat.NewConnsCount(),
+	}
 }
 
 func (s *Storage) SaveInventory(ctx context.Context, data models.InventoryItem) (int64, error) {
 	tx, err := s.db.Begin(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("cannot begin transaction: %v", err)
+		return 0, fmt.Errorf("cannot begin transaction: %w", err)
 	}
 	defer tx.Rollback(ctx)
 
 	var inventoryId int64
-	err = tx.QueryRow(ctx, `INSERT INTO inventory(name, quantity, unit) VALUES ($1, $2, $3) RETURNING id`, data.Name, data.Quantity, data.Unit).Scan(&inventoryId)
+	err = tx.QueryRow(ctx, `
+        INSERT INTO ingredients(name, unit, density) VALUES ($1, $2, NULLIF($3, 0)) RETURNING id
+    `, data.Name, data.Unit, data.Density).Scan(&inventoryId)
+	if isUniqueViolation(err) {
+		return 0, fmt.Errorf("%w: %q", models.ErrDuplicateInventory, data.Name)
+	}
 	if err != nil {
-		return 0, fmt.Errorf("cannot insert into inventory: %v", err)
+		return 0, fmt.Errorf("cannot insert into ingredients: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+        INSERT INTO inventory(ingredient_id, quantity, unit, reorder_level, target_level)
+        VALUES ($1, $2, $3, $4, $5)
+    `, inventoryId, data.Quantity, data.Unit, data.ReorderLevel, data.TargetLevel)
+	if isUniqueViolation(err) {
+		return 0, fmt.Errorf("%w: ingredient %d already has an inventory row", models.ErrDuplicateInventory, inventoryId)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("cannot insert into inventory: %w", err)
+	}
+
+	if data.Quantity != 0 {
+		_, err = insertTransaction(ctx, tx, models.InventoryTransaction{
+			IngredientID: inventoryId,
+			Delta:        data.Quantity,
+			Reason:       models.ReasonRestock,
+			Note:         "opening stock",
+		})
+		if err != nil {
+			return 0, err
+		}
 	}
 
 	err = tx.Commit(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("cannot commit transaction: %v", err)
+		return 0, fmt.Errorf("cannot commit transaction: %w", err)
 	}
 	s.logr.Info("commit transaction")
 	return inventoryId, nil
 }
 
+func (s *Storage) GetAllInventories(ctx context.Context) ([]models.InventoryItem, error) {
+	return s.queryInventory(ctx, `ORDER BY inv.ingredient_id`)
+}
+
+func (s *Storage) GetInventory(ctx context.Context, id int64) (models.InventoryItem, error) {
+	items, err := s.queryInventory(ctx, `WHERE inv.ingredient_id = $1`, id)
+	if err != nil {
+		return models.InventoryItem{}, err
+	}
+	if len(items) == 0 {
+		return models.InventoryItem{}, models.ErrNotFound
+	}
+	return items[0], nil
+}
+
+// UpdateInventory renames the item and books any difference between the
+// requested and the stocked quantity as a count correction.
+func (s *Storage) UpdateInventory(ctx context.Context, id int64, inventory models.InventoryItem) (models.InventoryItem, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return models.InventoryItem{}, fmt.Errorf("cannot begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	current, err := lockInventory(ctx, tx, id)
+	if err != nil {
+		return models.InventoryItem{}, err
+	}
+	if err = checkUnitChange(ctx, tx, id, current, inventory.Unit); err != nil {
+		return models.InventoryItem{}, err
+	}
+
+	_, err = tx.Exec(ctx, `
+        UPDATE ingredients SET name = $1, unit = $2, density = NULLIF($3, 0) WHERE id = $4
+    `, inventory.Name, inventory.Unit, inventory.Density, id)
+	if isUniqueViolation(err) {
+		return models.InventoryItem{}, fmt.Errorf("%w: %q", models.ErrDuplicateInventory, inventory.Name)
+	}
+	if err != nil {
+		return models.InventoryItem{}, fmt.Errorf("cannot update ingredients: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+        UPDATE inventory SET quantity = $1, unit = $2, reorder_level = $3, target_level = $4
+        WHERE ingredient_id = $5
+    `, inventory.Quantity, inventory.Unit, inventory.ReorderLevel, inventory.TargetLevel, id)
+	if err != nil {
+		return models.InventoryItem{}, fmt.Errorf("cannot update inventory: %w", err)
+	}
+
+	if delta := inventory.Quantity - current; delta != 0 {
+		_, err = insertTransaction(ctx, tx, models.InventoryTransaction{
+			IngredientID: id,
+			Delta:        delta,
+			Reason:       models.ReasonCountCorrection,
+		})
+		if err != nil {
+			return models.InventoryItem{}, err
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return models.InventoryItem{}, fmt.Errorf("cannot commit transaction: %w", err)
+	}
+
+	inventory.IngredientID = id
+	return inventory, nil
+}
+
+// checkUnitChange refuses to change the unit of an ingredient that is in
+// stock or used by a recipe, since neither its quantity nor the recipe
+// amounts would follow.
+func checkUnitChange(ctx context.Context, tx pgx.Tx, id int64, quantity float64, unit string) error {
+	var current string
+	var used bool
+	err := tx.QueryRow(ctx, `
+        SELECT unit, EXISTS(
+            SELECT 1 FROM menu_ingredients WHERE ingredient_id = $1
+            UNION ALL SELECT 1 FROM menu_variant_ingredients WHERE ingredient_id = $1
+            UNION ALL SELECT 1 FROM modifier_ingredients WHERE ingredient_id = $1
+        )
+        FROM inventory
+        WHERE ingredient_id = $1
+    `, id).Scan(&current, &used)
+	if err != nil {
+		return fmt.Errorf("cannot select inventory unit: %w", err)
+	}
+
+	switch {
+	case current == unit:
+		return nil
+	case quantity > 0:
+		return fmt.Errorf("%w: cannot change the unit of ingredient %d from %s to %s while it is in stock", models.ErrInvalidInventory, id, current, unit)
+	case used:
+		return fmt.Errorf("%w: cannot change the unit of ingredient %d from %s to %s while a recipe uses it", models.ErrInvalidInventory, id, current, unit)
+	}
+	return nil
+}
+
+// DeleteInventory removes an ingredient that no recipe uses. Its movements
+// stay in the ledger.
+func (s *Storage) DeleteInventory(ctx context.Context, id int64) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err = lockInventory(ctx, tx, id); err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec(ctx, `DELETE FROM inventory WHERE ingredient_id = $1`, id); err != nil {
+		return fmt.Errorf("cannot delete inventory: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM ingredients WHERE id = $1`, id)
+	if isForeignKeyViolation(err) {
+		return fmt.Errorf("%w: ingredient %d is used by a recipe", models.ErrInvalidInventory, id)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot delete ingredient: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("cannot commit transaction: %w", err)
+	}
+	return nil
+}
+
+func (s *Storage) AddInventoryTransaction(ctx context.Context, t models.InventoryTransaction) (models.InventoryTransaction, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return models.InventoryTransaction{}, fmt.Errorf("cannot begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	current, err := lockInventory(ctx, tx, t.IngredientID)
+	if err != nil {
+		return models.InventoryTransaction{}, err
+	}
+
+	if current+t.Delta < 0 {
+		shortages := []models.IngredientShortage{{IngredientID: t.IngredientID, Required: -t.Delta, Available: current}}
+		if err = nameShortages(ctx, tx, shortages); err != nil {
+			return models.InventoryTransaction{}, err
+		}
+		return models.InventoryTransaction{}, &models.InsufficientIngredientsError{Shortages: shortages}
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE inventory SET quantity = quantity + $1 WHERE ingredient_id = $2`, t.Delta, t.IngredientID)
+	if err != nil {
+		return models.InventoryTransaction{}, fmt.Errorf("cannot update inventory: %w", err)
+	}
+
+	t, err = insertTransaction(ctx, tx, t)
+	if err != nil {
+		return models.InventoryTransaction{}, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return models.InventoryTransaction{}, fmt.Errorf("cannot commit transaction: %w", err)
+	}
+	return t, nil
+}
+
+func (s *Storage) GetInventoryHistory(ctx context.Context, id int64, from, to time.Time) ([]models.InventoryTransaction, error) {
+	var exists bool
+	err := s.db.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM inventory WHERE ingredient_id = $1)`, id).Scan(&exists)
+	if err != nil {
+		return nil, fmt.Errorf("cannot select inventory: %w", err)
+	}
+	if !exists {
+		return nil, models.ErrNotFound
+	}
+
+	rows, err := s.db.Query(ctx, `
+        SELECT id, ingredient_id, delta, reason, order_id, COALESCE(actor, ''), note, created_at
+        FROM inventory_transactions
+        WHERE ingredient_id = $1
+          AND ($2::timestamp IS NULL OR created_at >= $2)
+          AND ($3::timestamp IS NULL OR created_at < $3)
+        ORDER BY created_at, id
+    `, id, nullTime(from), nullTime(to))
+	if err != nil {
+		return nil, fmt.Errorf("cannot select inventory_transactions: %w", err)
+	}
+	defer rows.Close()
+
+	history := []models.InventoryTransaction{}
+	for rows.Next() {
+		var t models.InventoryTransaction
+		err = rows.Scan(&t.ID, &t.IngredientID, &t.Delta, &t.Reason, &t.OrderID, &t.Actor, &t.Note, &t.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("cannot scan inventory_transactions: %w", err)
+		}
+		history = append(history, t)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read inventory_transactions: %w", err)
+	}
+	return history, nil
+}
+
+func (s *Storage) GetLowStock(ctx context.Context) ([]models.InventoryItem, error) {
+	return s.queryInventory(ctx, `
+        WHERE inv.quantity < inv.reorder_level
+        ORDER BY inv.quantity / inv.reorder_level, ing.name
+    `)
+}
+
+// queryInventory loads the inventory items matching the clause with their
+// ingredient details.
+func (s *Storage) queryInventory(ctx context.Context, clause string, args ...any) ([]models.InventoryItem, error) {
+	rows, err := s.db.Query(ctx, `
+        SELECT inv.ingredient_id, ing.name, inv.quantity, inv.unit, inv.reorder_level, inv.target_level,
+               COALESCE(ing.density, 0)
+        FROM inventory inv
+        JOIN ingredients ing ON ing.id = inv.ingredient_id
+        `+clause, args...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot select inventory: %w", err)
+	}
+
+	items, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.InventoryItem, error) {
+		var item models.InventoryItem
+		err := row.Scan(&item.IngredientID, &item.Name, &item.Quantity, &item.Unit, &item.ReorderLevel, &item.TargetLevel, &item.Density)
+		return item, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot scan inventory: %w", err)
+	}
+	return items, nil
+}
+
+func lockInventory(ctx context.Context, tx pgx.Tx, id int64) (float64, error) {
+	var quantity float64
+	err := tx.QueryRow(ctx, `SELECT quantity FROM inventory WHERE ingredient_id = $1 FOR UPDATE`, id).Scan(&quantity)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, models.ErrNotFound
+	}
+	if err != nil {
+		return 0, fmt.Errorf("cannot lock inventory: %w", err)
+	}
+	return quantity, nil
+}
+
+func insertTransaction(ctx context.Context, tx pgx.Tx, t models.InventoryTransaction) (models.InventoryTransaction, error) {
+	err := tx.QueryRow(ctx, `
+        INSERT INTO inventory_transactions(ingredient_id, order_id, delta, reason, actor, note)
+        VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6)
+        RETURNING id, created_at
+    `, t.IngredientID, t.OrderID, t.Delta, t.Reason, t.Actor, t.Note).Scan(&t.ID, &t.CreatedAt)
+	if err != nil {
+		return models.InventoryTransaction{}, fmt.Errorf("cannot insert into inventory_transactions: %w", err)
+	}
+	return t, nil
+}
+
+func nullTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
 func (s *Storage) SaveMenu(ctx context.Context, data models.MenuItem) (int64, error) {
 	tx, err := s.db.Begin(ctx)
 	if err != nil {
@@ -60,20 +392,25 @@ func (s *Storage) SaveMenu(ctx context.Context, data models.MenuItem) (int64, er
 
 	var menuID int64
 	err = tx.QueryRow(ctx, `
-        INSERT INTO menus(name, description, price) 
-        VALUES ($1, $2, $3) 
+        INSERT INTO menus(name, description, category, price) 
+        VALUES ($1, $2, $3, $4) 
         RETURNING id
-    `, data.Name, data.Description, data.Price).Scan(&menuID)
+    `, data.Name, data.Description, data.Category, data.Price).Scan(&menuID)
 
 	if err != nil {
-		return 0, fmt.Errorf("cannot save menu: %w", err)
+		return 0, menuError(fmt.Errorf("cannot save menu: %w", err), data.Name)
 	}
 
-	for _, ingredient := range data.Ingredients {
-		_, err = tx.Exec(ctx, `INSERT INTO menu_ingredients(ingredient_id, quantity) VALUES ($1, $2, $3)`, ingredient.IngredientID, ingredient.Quantity)
-		if err != nil {
-			return 0, fmt.Errorf("cannot save menu_ingredients: %w", err)
-		}
+	if err = saveRecipe(ctx, tx, "menu_ingredients", "menu_id", menuID, data.Ingredients); err != nil {
+		return 0, menuError(err, data.Name)
+	}
+
+	if err = saveVariants(ctx, tx, menuID, data.Variants); err != nil {
+		return 0, menuError(err, data.Name)
+	}
+
+	if err = saveModifierGroups(ctx, tx, menuID, data.ModifierGroups); err != nil {
+		return 0, menuError(err, data.Name)
 	}
 
 	if err = tx.Commit(ctx); err != nil {
@@ -82,33 +419,929 @@ func (s *Storage) SaveMenu(ctx context.Context, data models.MenuItem) (int64, er
 	return menuID, nil
 }
 
-func (s *Storage) SaveOrder(ctx context.Context, data models.OrderRequest) (int64, error) {
+func (s *Storage) GetAllMenus(ctx context.Context) ([]models.MenuItem, error) {
+	return queryMenus(ctx, s.db, "")
+}
 
+func (s *Storage) GetMenu(ctx context.Context, id int64) (models.MenuItem, error) {
+	menus, err := queryMenus(ctx, s.db, `WHERE m.id = $1`, id)
+	if err != nil {
+		return models.MenuItem{}, err
+	}
+	if len(menus) == 0 {
+		return models.MenuItem{}, models.ErrNotFound
+	}
+	return menus[0], nil
+}
+
+// UpdateMenu replaces the menu item. Variants, modifier groups and modifiers
+// keep their IDs when the input carries them, so past order lines still point
+// at them; those left out are removed unless an order uses them.
+func (s *Storage) UpdateMenu(ctx context.Context, id int64, menu models.MenuItem) (models.MenuItem, error) {
 	tx, err := s.db.Begin(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("cannot begin transaction: %w", err)
+		return models.MenuItem{}, fmt.Errorf("cannot begin transaction: %w", err)
 	}
 	defer tx.Rollback(ctx)
 
-	var orderId int64
-	err = s.db.QueryRow(ctx, `INSERT INTO orders(
-                   customer_name) VALUES ($1) RETURNING id`, data.CustomerName).Scan(&orderId)
+	tag, err := tx.Exec(ctx, `
+        UPDATE menus SET name = $2, description = $3, category = $4, price = $5 WHERE id = $1
+    `, id, menu.Name, menu.Description, menu.Category, menu.Price)
+	if err != nil {
+		return models.MenuItem{}, menuError(fmt.Errorf("cannot update menu: %w", err), menu.Name)
+	}
+	if tag.RowsAffected() == 0 {
+		return models.MenuItem{}, models.ErrNotFound
+	}
+
+	if err = saveRecipe(ctx, tx, "menu_ingredients", "menu_id", id, menu.Ingredients); err != nil {
+		return models.MenuItem{}, menuError(err, menu.Name)
+	}
+	if err = saveVariants(ctx, tx, id, menu.Variants); err != nil {
+		return models.MenuItem{}, menuError(err, menu.Name)
+	}
+	if err = saveModifierGroups(ctx, tx, id, menu.ModifierGroups); err != nil {
+		return models.MenuItem{}, menuError(err, menu.Name)
+	}
+
+	menus, err := queryMenus(ctx, tx, `WHERE m.id = $1`, id)
+	if err != nil {
+		return models.MenuItem{}, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return models.MenuItem{}, fmt.Errorf("cannot commit transaction: %w", err)
+	}
+	return menus[0], nil
+}
+
+// DeleteMenu removes an item that was never ordered, together with its
+// recipe, options and the promotions limited to it.
+func (s *Storage) DeleteMenu(ctx context.Context, id int64) error {
+	tag, err := s.db.Exec(ctx, `DELETE FROM menus WHERE id = $1`, id)
+	if isForeignKeyViolation(err) {
+		return fmt.Errorf("%w: menu item %d is on an order", models.ErrInvalidMenu, id)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot delete menu: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return models.ErrNotFound
+	}
+	return nil
+}
+
+// menuError turns constraint violations raised while writing the menu item
+// into models.ErrInvalidMenu.
+func menuError(err error, name string) error {
+	var pgErr *pgconn.PgError
+	switch {
+	case isUniqueViolation(err) && errors.As(err, &pgErr) && pgErr.TableName == "menus":
+		return fmt.Errorf("%w: menu item %q already exists", models.ErrInvalidMenu, name)
+	case isUniqueViolation(err):
+		return fmt.Errorf("%w: menu item %q repeats an option name", models.ErrInvalidMenu, name)
+	case isForeignKeyViolation(err) && errors.As(err, &pgErr) && strings.HasSuffix(pgErr.TableName, "ingredients"):
+		return fmt.Errorf("%w: menu item %q uses an unknown ingredient", models.ErrInvalidMenu, name)
+	case isForeignKeyViolation(err):
+		return fmt.Errorf("%w: menu item %q drops an option that is on an order", models.ErrInvalidMenu, name)
+	}
+	return err
+}
+
+// saveRecipe replaces the ingredients that the row of table keyed by
+// owner = id is made of.
+func saveRecipe(ctx context.Context, tx pgx.Tx, table, owner string, id int64, ingredients []models.MenuItemIngredient) error {
+	_, err := tx.Exec(ctx, fmt.Sprintf(`DELETE FROM %s WHERE %s = $1`, table, owner), id)
+	if err != nil {
+		return fmt.Errorf("cannot delete %s: %w", table, err)
+	}
+
+	for _, ingredient := range ingredients {
+		_, err = tx.Exec(ctx, fmt.Sprintf(`
+            INSERT INTO %s(%s, ingredient_id, quantity, unit)
+            VALUES ($1, $2, $3, NULLIF($4, ''))
+        `, table, owner), id, ingredient.IngredientID, ingredient.Quantity, ingredient.Unit)
+		if err != nil {
+			return fmt.Errorf("cannot save %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+// saveModifierGroups makes the modifier groups of the menu item match groups,
+// updating those whose ID it already has and inserting the rest.
+func saveModifierGroups(ctx context.Context, tx pgx.Tx, menuID int64, groups []models.ModifierGroup) error {
+	ids := make([]int64, 0, len(groups))
+	for _, group := range groups {
+		ids = append(ids, group.ID)
+	}
+	_, err := tx.Exec(ctx, `
+        DELETE FROM modifier_groups WHERE menu_id = $1 AND NOT (id = ANY($2))
+    `, menuID, ids)
 	if err != nil {
-		return 0, fmt.Errorf("cannot insert into orders: %v", err)
+		return fmt.Errorf("cannot delete modifier_groups: %w", err)
 	}
 
-	for _, items := range data.Items {
-		_, err = s.db.Exec(ctx, `INSERT INTO items(
-                  order_id, menu_id ,quantity) VALUES ($1, $2, $3)`, orderId, items.ProductID, items.Quantity)
+	for _, group := range groups {
+		groupID := group.ID
+		tag, err := tx.Exec(ctx, `
+            UPDATE modifier_groups SET name = $3, min_select = $4, max_select = $5
+            WHERE id = $1 AND menu_id = $2
+        `, groupID, menuID, group.Name, group.MinSelect, group.MaxSelect)
 		if err != nil {
-			return 0, fmt.Errorf("cannot insert into items: %v", err)
+			return fmt.Errorf("cannot update modifier_groups: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			err = tx.QueryRow(ctx, `
+                INSERT INTO modifier_groups(menu_id, name, min_select, max_select) VALUES ($1, $2, $3, $4) RETURNING id
+            `, menuID, group.Name, group.MinSelect, group.MaxSelect).Scan(&groupID)
+			if err != nil {
+				return fmt.Errorf("cannot save modifier_groups: %w", err)
+			}
+		}
+
+		if err = saveModifiers(ctx, tx, groupID, group.Modifiers); err != nil {
+			return err
 		}
 	}
+	return nil
+}
+
+func saveModifiers(ctx context.Context, tx pgx.Tx, groupID int64, modifiers []models.Modifier) error {
+	ids := make([]int64, 0, len(modifiers))
+	for _, modifier := range modifiers {
+		ids = append(ids, modifier.ID)
+	}
+	_, err := tx.Exec(ctx, `
+        DELETE FROM modifiers WHERE group_id = $1 AND NOT (id = ANY($2))
+    `, groupID, ids)
+	if err != nil {
+		return fmt.Errorf("cannot delete modifiers: %w", err)
+	}
+
+	for _, modifier := range modifiers {
+		modifierID := modifier.ID
+		tag, err := tx.Exec(ctx, `
+            UPDATE modifiers SET name = $3, price_delta = $4 WHERE id = $1 AND group_id = $2
+        `, modifierID, groupID, modifier.Name, modifier.PriceDelta)
+		if err != nil {
+			return fmt.Errorf("cannot update modifiers: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			err = tx.QueryRow(ctx, `
+                INSERT INTO modifiers(group_id, name, price_delta) VALUES ($1, $2, $3) RETURNING id
+            `, groupID, modifier.Name, modifier.PriceDelta).Scan(&modifierID)
+			if err != nil {
+				return fmt.Errorf("cannot save modifiers: %w", err)
+			}
+		}
+
+		if err = saveRecipe(ctx, tx, "modifier_ingredients", "modifier_id", modifierID, modifier.Ingredients); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveVariants makes the variants of the menu item match variants, updating
+// those whose ID it already has and inserting the rest.
+func saveVariants(ctx context.Context, tx pgx.Tx, menuID int64, variants []models.MenuVariant) error {
+	ids := make([]int64, 0, len(variants))
+	for _, variant := range variants {
+		ids = append(ids, variant.ID)
+	}
+	_, err := tx.Exec(ctx, `
+        DELETE FROM menu_variants WHERE menu_id = $1 AND NOT (id = ANY($2))
+    `, menuID, ids)
+	if err != nil {
+		return fmt.Errorf("cannot delete menu_variants: %w", err)
+	}
+
+	for _, variant := range variants {
+		variantID := variant.ID
+		tag, err := tx.Exec(ctx, `
+            UPDATE menu_variants SET name = $3, price = $4 WHERE id = $1 AND menu_id = $2
+        `, variantID, menuID, variant.Name, variant.Price)
+		if err != nil {
+			return fmt.Errorf("cannot update menu_variants: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			err = tx.QueryRow(ctx, `
+                INSERT INTO menu_variants(menu_id, name, price) VALUES ($1, $2, $3) RETURNING id
+            `, menuID, variant.Name, variant.Price).Scan(&variantID)
+			if err != nil {
+				return fmt.Errorf("cannot save menu_variants: %w", err)
+			}
+		}
+
+		if err = saveRecipe(ctx, tx, "menu_variant_ingredients", "variant_id", variantID, variant.Ingredients); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recipeJSON aggregates the ingredients of the table row whose owner column
+// equals key.
+func recipeJSON(table, owner, key string) string {
+	return fmt.Sprintf(`COALESCE((
+            SELECT json_agg(json_build_object(
+                'ingredient_id', r.ingredient_id,
+                'quantity', r.quantity,
+                'unit', COALESCE(r.unit, '')
+            ) ORDER BY r.ingredient_id)
+            FROM %s r
+            WHERE r.%s = %s
+        ), '[]')`, table, owner, key)
+}
+
+// menuColumns selects a menu item with its recipe, variants and modifier
+// groups, so a single query loads whole items.
+var menuColumns = `
+        SELECT m.id, m.name, m.description, m.category, m.price,
+        ` + recipeJSON("menu_ingredients", "menu_id", "m.id") + `,
+        COALESCE((
+            SELECT json_agg(json_build_object(
+                'variant_id', v.id,
+                'name', v.name,
+                'price', v.price,
+                'ingredients', ` + recipeJSON("menu_variant_ingredients", "variant_id", "v.id") + `
+            ) ORDER BY v.id)
+            FROM menu_variants v
+            WHERE v.menu_id = m.id
+        ), '[]'),
+        COALESCE((
+            SELECT json_agg(json_build_object(
+                'group_id', g.id,
+                'name', g.name,
+                'min_select', g.min_select,
+                'max_select', g.max_select,
+                'modifiers', COALESCE((
+                    SELECT json_agg(json_build_object(
+                        'modifier_id', md.id,
+                        'name', md.name,
+                        'price_delta', md.price_delta,
+                        'ingredients', ` + recipeJSON("modifier_ingredients", "modifier_id", "md.id") + `
+                    ) ORDER BY md.id)
+                    FROM modifiers md
+                    WHERE md.group_id = g.id
+                ), '[]')
+            ) ORDER BY g.id)
+            FROM modifier_groups g
+            WHERE g.menu_id = m.id
+        ), '[]')
+        FROM menus m
+`
+
+// queryMenus loads the menu items matching the where clause in one round trip.
+func queryMenus(ctx context.Context, q querier, where string, args ...any) ([]models.MenuItem, error) {
+	rows, err := q.Query(ctx, menuColumns+where+`
+        ORDER BY m.id
+    `, args...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot select menus: %w", err)
+	}
+
+	menus, err := pgx.CollectRows(rows, scanMenu)
+	if err != nil {
+		return nil, fmt.Errorf("cannot scan menus: %w", err)
+	}
+	return menus, nil
+}
+
+func scanMenu(row pgx.CollectableRow) (models.MenuItem, error) {
+	var m models.MenuItem
+	var ingredients, variants, groups []byte
+	err := row.Scan(&m.ID, &m.Name, &m.Description, &m.Category, &m.Price, &ingredients, &variants, &groups)
+	if err != nil {
+		return m, err
+	}
+	if err = json.Unmarshal(ingredients, &m.Ingredients); err != nil {
+		return m, err
+	}
+	if err = json.Unmarshal(variants, &m.Variants); err != nil {
+		return m, err
+	}
+	if err = json.Unmarshal(groups, &m.ModifierGroups); err != nil {
+		return m, err
+	}
+	return m, nil
+}
+
+func (s *Storage) SaveOrder(ctx context.Context, order models.Order, consumption []models.IngredientAmount, discounts models.OrderDiscounts) (int64, []models.StockChange, error) {
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return 0, nil, fmt.Errorf("cannot begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var orderId int64
+	err = tx.QueryRow(ctx, `INSERT INTO orders(
+                   customer_id, customer_name, rounding, cash_increment) VALUES ($1, $2, NULLIF($3, ''), $4) RETURNING id`,
+		order.CustomerID, order.CustomerName, order.Rounding, order.CashIncrement).Scan(&orderId)
+	if err != nil {
+		return 0, nil, fmt.Errorf("cannot insert into orders: %w", err)
+	}
+
+	before, err := lockStock(ctx, tx, consumedIDs(consumption))
+	if err != nil {
+		return 0, nil, err
+	}
+	if err = deductInventory(ctx, tx, orderId, consumption); err != nil {
+		return 0, nil, err
+	}
+	changes, err := stockChanges(ctx, tx, before)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if err = saveOrderItems(ctx, tx, orderId, order.Lines); err != nil {
+		return 0, nil, err
+	}
+	if err = saveDiscounts(ctx, tx, orderId, discounts); err != nil {
+		return 0, nil, err
+	}
 
 	if err = tx.Commit(ctx); err != nil {
-		return 0, fmt.Errorf("cannot commit transaction: %w", err)
+		return 0, nil, fmt.Errorf("cannot commit transaction: %w", err)
 	}
 	s.logr.Info("order saved")
 
-	return orderId, nil
+	return orderId, changes, nil
+}
+
+// saveDiscounts records the discounts of the new order orderID.
+func saveDiscounts(ctx context.Context, tx pgx.Tx, orderID int64, discounts models.OrderDiscounts) error {
+	if discounts.Promotion != nil {
+		usage := discounts.Usage
+		usage.OrderID = orderID
+		if err := savePromotionUsage(ctx, tx, *discounts.Promotion, usage); err != nil {
+			return err
+		}
+	}
+	if discounts.Redemption != nil {
+		redemption := *discounts.Redemption
+		redemption.OrderID = orderID
+		if err := saveRedemption(ctx, tx, redemption); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetOrders lists a page of orders, newest first.
+func (s *Storage) GetOrders(ctx context.Context, page models.OrderPage) ([]models.Order, error) {
+	return queryOrders(ctx, s.db, `WHERE o.id IN (
+            SELECT id FROM orders ORDER BY created_at DESC, id DESC LIMIT $1 OFFSET $2
+        )`, page.Limit, page.Offset)
+}
+
+func (s *Storage) GetOrder(ctx context.Context, id int64) (models.Order, error) {
+	orders, err := queryOrders(ctx, s.db, `WHERE o.id = $1`, id)
+	if err != nil {
+		return models.Order{}, err
+	}
+	if len(orders) == 0 {
+		return models.Order{}, models.ErrNotFound
+	}
+	return orders[0], nil
+}
+
+// UpdateOrder replaces the lines of an open order, returning the inventory it
+// held before deducting consumption.
+func (s *Storage) UpdateOrder(ctx context.Context, id int64, order models.Order, consumption []models.IngredientAmount, usages []models.PromotionUsage) (models.Order, []models.StockChange, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return models.Order{}, nil, fmt.Errorf("cannot begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var status models.OrderStatus
+	err = tx.QueryRow(ctx, `SELECT status FROM orders WHERE id = $1 FOR UPDATE`, id).Scan(&status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Order{}, nil, models.ErrNotFound
+	}
+	if err != nil {
+		return models.Order{}, nil, fmt.Errorf("cannot select order: %w", err)
+	}
+	if status != models.StatusOpen {
+		return models.Order{}, nil, fmt.Errorf("%w: order %d is %s", models.ErrOrderNotEditable, id, status)
+	}
+
+	held, err := orderIngredients(ctx, tx, id)
+	if err != nil {
+		return models.Order{}, nil, err
+	}
+	before, err := lockStock(ctx, tx, append(held, consumedIDs(consumption)...))
+	if err != nil {
+		return models.Order{}, nil, err
+	}
+	if err = restockOrder(ctx, tx, id); err != nil {
+		return models.Order{}, nil, err
+	}
+	if err = deductInventory(ctx, tx, id, consumption); err != nil {
+		return models.Order{}, nil, err
+	}
+	changes, err := stockChanges(ctx, tx, before)
+	if err != nil {
+		return models.Order{}, nil, err
+	}
+
+	_, err = tx.Exec(ctx, `
+        UPDATE orders SET customer_id = $2, customer_name = $3 WHERE id = $1
+    `, id, order.CustomerID, order.CustomerName)
+	if err != nil {
+		return models.Order{}, nil, fmt.Errorf("cannot update order: %w", err)
+	}
+
+	if _, err = tx.Exec(ctx, `DELETE FROM order_items WHERE order_id = $1`, id); err != nil {
+		return models.Order{}, nil, fmt.Errorf("cannot delete order_items: %w", err)
+	}
+	if err = saveOrderItems(ctx, tx, id, order.Lines); err != nil {
+		return models.Order{}, nil, err
+	}
+
+	for _, u := range usages {
+		tag, err := tx.Exec(ctx, `
+            UPDATE promotion_usages SET amount = $1
+            WHERE id = $2 AND order_id = $3 AND voided_at IS NULL
+        `, u.Amount, u.ID, id)
+		if err != nil {
+			return models.Order{}, nil, fmt.Errorf("cannot update promotion_usages: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return models.Order{}, nil, fmt.Errorf("%w: promotion usage %d of order %d", models.ErrNotFound, u.ID, id)
+		}
+	}
+
+	orders, err := queryOrders(ctx, tx, `WHERE o.id = $1`, id)
+	if err != nil {
+		return models.Order{}, nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return models.Order{}, nil, fmt.Errorf("cannot commit transaction: %w", err)
+	}
+	s.logr.Info("order updated", "id", id)
+	return orders[0], changes, nil
+}
+
+// saveOrderItems stores the order lines with the prices they are sold at.
+func saveOrderItems(ctx context.Context, tx pgx.Tx, orderID int64, lines []models.PricedLine) error {
+	for _, item := range lines {
+		var itemID int64
+		err := tx.QueryRow(ctx, `INSERT INTO order_items(
+                  order_id, menu_id, variant_id, quantity, name, category, unit_price, tax_rate)
+                  VALUES ($1, $2, NULLIF($3, 0), $4, $5, $6, $7, $8) RETURNING id`,
+			orderID, item.ProductID, item.VariantID, item.Quantity, item.Name, item.Category, item.UnitPrice, item.TaxRate).Scan(&itemID)
+		if err != nil {
+			return fmt.Errorf("cannot insert into order_items: %w", err)
+		}
+
+		for _, modifierID := range item.Modifiers {
+			_, err = tx.Exec(ctx, `INSERT INTO order_item_modifiers(order_item_id, modifier_id) VALUES ($1, $2)`, itemID, modifierID)
+			if err != nil {
+				return fmt.Errorf("cannot insert into order_item_modifiers: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// deductInventory locks the inventory rows of the consumed ingredients, checks
+// that every one of them covers the required amount and decrements them,
+// recording one consumption movement per ingredient against the order.
+func deductInventory(ctx context.Context, tx pgx.Tx, orderID int64, consumption []models.IngredientAmount) error {
+	if len(consumption) == 0 {
+		return nil
+	}
+
+	available, err := lockStock(ctx, tx, consumedIDs(consumption))
+	if err != nil {
+		return err
+	}
+
+	var shortages []models.IngredientShortage
+	for _, c := range consumption {
+		if available[c.IngredientID] < c.Quantity {
+			shortages = append(shortages, models.IngredientShortage{
+				IngredientID: c.IngredientID,
+				Required:     c.Quantity,
+				Available:    available[c.IngredientID],
+			})
+		}
+	}
+	if len(shortages) > 0 {
+		if err = nameShortages(ctx, tx, shortages); err != nil {
+			return err
+		}
+		return &models.InsufficientIngredientsError{Shortages: shortages}
+	}
+
+	for _, c := range consumption {
+		_, err = tx.Exec(ctx, `UPDATE inventory SET quantity = quantity - $1 WHERE ingredient_id = $2`, c.Quantity, c.IngredientID)
+		if err != nil {
+			return fmt.Errorf("cannot update inventory: %w", err)
+		}
+
+		_, err = insertTransaction(ctx, tx, models.InventoryTransaction{
+			IngredientID: c.IngredientID,
+			OrderID:      &orderID,
+			Delta:        -c.Quantity,
+			Reason:       models.ReasonOrderConsumption,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restockOrder gives back whatever the order's movements still hold out of
+// the inventory as a single reversal movement per ingredient. Orders that were
+// already restocked have a zero balance and are left untouched.
+func restockOrder(ctx context.Context, tx pgx.Tx, orderID int64) error {
+	ids, err := orderIngredients(ctx, tx, orderID)
+	if err != nil {
+		return err
+	}
+	if _, err = lockStock(ctx, tx, ids); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+        WITH reversal AS (
+            INSERT INTO inventory_transactions(ingredient_id, order_id, delta, reason)
+            SELECT ingredient_id, order_id, -SUM(delta), $2
+            FROM inventory_transactions
+            WHERE order_id = $1
+            GROUP BY ingredient_id, order_id
+            HAVING SUM(delta) <> 0
+            RETURNING ingredient_id, delta
+        )
+        UPDATE inventory inv
+        SET quantity = inv.quantity + reversal.delta
+        FROM reversal
+        WHERE inv.ingredient_id = reversal.ingredient_id
+    `, orderID, models.ReasonOrderReversal)
+	if err != nil {
+		return fmt.Errorf("cannot restock order: %w", err)
+	}
+	return nil
+}
+
+// releaseDiscounts gives back the points spent on an order that will not be
+// paid and voids its promotion usages, so they stop counting towards limits.
+func releaseDiscounts(ctx context.Context, tx pgx.Tx, orderID int64) error {
+	_, err := tx.Exec(ctx, `
+        WITH undone AS (
+            UPDATE loyalty_redemptions SET undone_at = NOW()
+            WHERE order_id = $1 AND undone_at IS NULL
+            RETURNING id, customer_id, points
+        )
+        INSERT INTO loyalty_ledger(customer_id, points, reason, order_id, redemption_id)
+        SELECT customer_id, points, 'reversal', $1, id FROM undone
+    `, orderID)
+	if err != nil {
+		return fmt.Errorf("cannot undo loyalty_redemptions: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE promotion_usages SET voided_at = NOW() WHERE order_id = $1 AND voided_at IS NULL`, orderID)
+	if err != nil {
+		return fmt.Errorf("cannot update promotion_usages: %w", err)
+	}
+	return nil
+}
+
+// orderIngredients lists the ingredients the order's movements touched.
+func orderIngredients(ctx context.Context, tx pgx.Tx, orderID int64) ([]int64, error) {
+	rows, err := tx.Query(ctx, `
+        SELECT DISTINCT ingredient_id FROM inventory_transactions WHERE order_id = $1
+    `, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot select order consumption: %w", err)
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+	if err != nil {
+		return nil, fmt.Errorf("cannot scan order consumption: %w", err)
+	}
+	return ids, nil
+}
+
+func consumedIDs(consumption []models.IngredientAmount) []int64 {
+	ids := make([]int64, 0, len(consumption))
+	for _, c := range consumption {
+		ids = append(ids, c.IngredientID)
+	}
+	return ids
+}
+
+// stockChanges compares the quantities locked by lockStock with what they
+// are now.
+func stockChanges(ctx context.Context, tx pgx.Tx, before map[int64]float64) ([]models.StockChange, error) {
+	ids := make([]int64, 0, len(before))
+	for id := range before {
+		ids = append(ids, id)
+	}
+
+	rows, err := tx.Query(ctx, `
+        SELECT ingredient_id, quantity, reorder_level
+        FROM inventory
+        WHERE ingredient_id = ANY($1)
+        ORDER BY ingredient_id
+    `, ids)
+	if err != nil {
+		return nil, fmt.Errorf("cannot select inventory: %w", err)
+	}
+
+	changes, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.StockChange, error) {
+		var c models.StockChange
+		err := row.Scan(&c.IngredientID, &c.After, &c.ReorderLevel)
+		c.Before = before[c.IngredientID]
+		return c, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot scan inventory: %w", err)
+	}
+	return changes, nil
+}
+
+// lockStock locks the inventory rows of ids in ingredient_id order, the order
+// every writer takes them in so that concurrent orders cannot deadlock, and
+// returns their quantities.
+func lockStock(ctx context.Context, tx pgx.Tx, ids []int64) (map[int64]float64, error) {
+	rows, err := tx.Query(ctx, `
+        SELECT ingredient_id, quantity
+        FROM inventory
+        WHERE ingredient_id = ANY($1)
+        ORDER BY ingredient_id
+        FOR UPDATE
+    `, ids)
+	if err != nil {
+		return nil, fmt.Errorf("cannot lock inventory: %w", err)
+	}
+	defer rows.Close()
+
+	quantities := make(map[int64]float64, len(ids))
+	for rows.Next() {
+		var id int64
+		var quantity float64
+		if err = rows.Scan(&id, &quantity); err != nil {
+			return nil, fmt.Errorf("cannot scan inventory: %w", err)
+		}
+		quantities[id] = quantity
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read inventory: %w", err)
+	}
+	return quantities, nil
+}
+
+func (s *Storage) DeleteOrder(ctx context.Context, id int64) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var status models.OrderStatus
+	err = tx.QueryRow(ctx, `SELECT status FROM orders WHERE id = $1 FOR UPDATE`, id).Scan(&status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("cannot select order: %w", err)
+	}
+	if status == models.StatusClosed {
+		return models.ErrOrderClosed
+	}
+
+	if err = restockOrder(ctx, tx, id); err != nil {
+		return err
+	}
+	if err = releaseDiscounts(ctx, tx, id); err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec(ctx, `DELETE FROM orders WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("cannot delete order: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("cannot commit transaction: %w", err)
+	}
+	s.logr.Info("order deleted", "id", id)
+	return nil
+}
+
+func nameShortages(ctx context.Context, tx pgx.Tx, shortages []models.IngredientShortage) error {
+	ids := make([]int64, 0, len(shortages))
+	for _, sh := range shortages {
+		ids = append(ids, sh.IngredientID)
+	}
+
+	rows, err := tx.Query(ctx, `SELECT id, name FROM ingredients WHERE id = ANY($1)`, ids)
+	if err != nil {
+		return fmt.Errorf("cannot select ingredients: %w", err)
+	}
+	defer rows.Close()
+
+	names := make(map[int64]string, len(ids))
+	for rows.Next() {
+		var id int64
+		var name string
+		if err = rows.Scan(&id, &name); err != nil {
+			return fmt.Errorf("cannot scan ingredients: %w", err)
+		}
+		names[id] = name
+	}
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("cannot read ingredients: %w", err)
+	}
+
+	for i := range shortages {
+		shortages[i].Name = names[shortages[i].IngredientID]
+	}
+	return nil
+}
+
+var statusColumns = map[models.OrderStatus]string{
+	models.StatusInProgress: "started_at",
+	models.StatusReady:      "ready_at",
+	models.StatusClosed:     "closed_at",
+	models.StatusCancelled:  "cancelled_at",
+}
+
+func (s *Storage) SetOrderStatus(ctx context.Context, id int64, from, to models.OrderStatus) (time.Time, error) {
+	column, ok := statusColumns[to]
+	if !ok {
+		return time.Time{}, fmt.Errorf("%w: %s -> %s", models.ErrInvalidTransition, from, to)
+	}
+
+	var changedAt time.Time
+	err := s.db.QueryRow(ctx, fmt.Sprintf(`
+        UPDATE orders SET status = $1, %[1]s = NOW()
+        WHERE id = $2 AND status = $3
+        RETURNING %[1]s
+    `, column), to, id, from).Scan(&changedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return time.Time{}, orderStatusConflict(ctx, s.db, id, from, to)
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("cannot update order status: %w", err)
+	}
+
+	return changedAt, nil
+}
+
+func (s *Storage) CancelOrder(ctx context.Context, id int64, from models.OrderStatus) (time.Time, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("cannot begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var cancelledAt time.Time
+	err = tx.QueryRow(ctx, `
+        UPDATE orders SET status = $1, cancelled_at = NOW()
+        WHERE id = $2 AND status = $3
+        RETURNING cancelled_at
+    `, models.StatusCancelled, id, from).Scan(&cancelledAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return time.Time{}, orderStatusConflict(ctx, tx, id, from, models.StatusCancelled)
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("cannot cancel order: %w", err)
+	}
+
+	if err = restockOrder(ctx, tx, id); err != nil {
+		return time.Time{}, err
+	}
+	if err = releaseDiscounts(ctx, tx, id); err != nil {
+		return time.Time{}, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return time.Time{}, fmt.Errorf("cannot commit transaction: %w", err)
+	}
+	return cancelledAt, nil
+}
+
+// CloseOrder closes the order and records the tip left on it and the points
+// its customer earns in one transaction.
+func (s *Storage) CloseOrder(ctx context.Context, id int64, from models.OrderStatus, tip money.Amount, points int64) (time.Time, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("cannot begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var closedAt time.Time
+	err = tx.QueryRow(ctx, `
+        UPDATE orders SET status = $1, closed_at = NOW(), tip = $4
+        WHERE id = $2 AND status = $3
+        RETURNING closed_at
+    `, models.StatusClosed, id, from, tip).Scan(&closedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return time.Time{}, orderStatusConflict(ctx, tx, id, from, models.StatusClosed)
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("cannot close order: %w", err)
+	}
+
+	if points > 0 {
+		_, err = tx.Exec(ctx, `
+            INSERT INTO loyalty_ledger(customer_id, points, reason, order_id)
+            SELECT customer_id, $2, 'earn', id FROM orders
+            WHERE id = $1 AND customer_id IS NOT NULL
+        `, id, points)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("cannot insert into loyalty_ledger: %w", err)
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return time.Time{}, fmt.Errorf("cannot commit transaction: %w", err)
+	}
+	return closedAt, nil
+}
+
+// orderStatusConflict explains why a conditional status update touched no row.
+func orderStatusConflict(ctx context.Context, q querier, id int64, from, to models.OrderStatus) error {
+	var current models.OrderStatus
+	err := q.QueryRow(ctx, `SELECT status FROM orders WHERE id = $1`, id).Scan(&current)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("cannot select order status: %w", err)
+	}
+	return fmt.Errorf("%w: %s -> %s", models.ErrInvalidTransition, current, to)
+}
+
+// queryOrders loads orders matching the where clause with their priced lines
+// and line modifiers in one round trip, newest first.
+func queryOrders(ctx context.Context, q querier, where string, args ...any) ([]models.Order, error) {
+	rows, err := q.Query(ctx, `
+        SELECT o.id, o.customer_id, o.customer_name, o.tip,
+               COALESCE(o.rounding, ''), COALESCE(o.cash_increment, 0), o.status, o.created_at,
+               o.started_at, o.ready_at, o.closed_at, o.cancelled_at,
+               COALESCE(json_agg(json_build_object(
+                   'line_id', oi.id,
+                   'product_id', oi.menu_id,
+                   'variant_id', COALESCE(oi.variant_id, 0),
+                   'quantity', oi.quantity,
+                   'name', oi.name,
+                   'category', oi.category,
+                   'unit_price', oi.unit_price,
+                   'line_total', oi.unit_price * oi.quantity,
+                   'tax_rate', oi.tax_rate,
+                   'modifiers', (
+                       SELECT json_agg(oim.modifier_id ORDER BY oim.modifier_id)
+                       FROM order_item_modifiers oim
+                       WHERE oim.order_item_id = oi.id
+                   )
+               ) ORDER BY oi.id) FILTER (WHERE oi.id IS NOT NULL), '[]')
+        FROM orders o
+        LEFT JOIN order_items oi ON oi.order_id = o.id
+        `+where+`
+        GROUP BY o.id
+        ORDER BY o.created_at DESC, o.id DESC
+    `, args...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot select orders: %w", err)
+	}
+
+	orders, err := pgx.CollectRows(rows, scanOrder)
+	if err != nil {
+		return nil, fmt.Errorf("cannot scan orders: %w", err)
+	}
+	return orders, nil
+}
+
+func scanOrder(row pgx.CollectableRow) (models.Order, error) {
+	var o models.Order
+	var createdAt time.Time
+	var items []byte
+	err := row.Scan(&o.ID, &o.CustomerID, &o.CustomerName, &o.Tip, &o.Rounding, &o.CashIncrement, &o.Status, &createdAt,
+		&o.StartedAt, &o.ReadyAt, &o.ClosedAt, &o.CancelledAt, &items)
+	if err != nil {
+		return o, err
+	}
+	o.CreatedAt = createdAt.Format(time.RFC3339)
+	if err = json.Unmarshal(items, &o.Lines); err != nil {
+		return o, err
+	}
+
+	o.Items = make([]models.OrderItem, 0, len(o.Lines))
+	for _, line := range o.Lines {
+		o.Items = append(o.Items, models.OrderItem{
+			ProductID: line.ProductID,
+			VariantID: line.VariantID,
+			Modifiers: line.Modifiers,
+			Quantity:  line.Quantity,
+		})
+	}
+	return o, nil
 }
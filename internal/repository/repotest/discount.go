@@ -0,0 +1,397 @@
+package repotest
+
+import (
+	"context"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"github.com/weeweeshka/hot-coffee/internal/money"
+	"slices"
+	"testing"
+)
+
+// RunDiscountRepoSuite checks that the promotion usages and loyalty
+// redemptions of an order are written with the order or not at all, that
+// points come back only from orders that will not be paid, and that refunds
+// take back the points an order earned in proportion.
+func RunDiscountRepoSuite(t *testing.T, factory func(t *testing.T) DiscountStore) {
+	ctx := context.Background()
+
+	// fixture is a customer with points to spend and an order of one menu
+	// item to spend them on.
+	type fixture struct {
+		customer    int64
+		order       models.Order
+		consumption []models.IngredientAmount
+		ingredient  int64
+	}
+	closeEarning := func(t *testing.T, repo DiscountStore, id, points int64) {
+		t.Helper()
+		if _, err := repo.CloseOrder(ctx, id, models.StatusOpen, 0, points); err != nil {
+			t.Fatalf("CloseOrder: %v", err)
+		}
+	}
+	setup := func(t *testing.T, repo DiscountStore, points int64) fixture {
+		t.Helper()
+		customer, err := repo.SaveCustomer(ctx, models.Customer{Name: uniqueName(t, "customer")})
+		if err != nil {
+			t.Fatalf("SaveCustomer: %v", err)
+		}
+
+		ingredient := saveIngredient(t, repo, 100)
+		menu := saveMenu(t, repo, ingredient, 10)
+		f := fixture{
+			customer: customer,
+			order: models.Order{
+				CustomerID:   &customer,
+				CustomerName: "conformance",
+				Lines: []models.PricedLine{{
+					ProductID: menu.ID,
+					Name:      menu.Name,
+					Category:  menu.Category,
+					Quantity:  1,
+					UnitPrice: menu.Price,
+				}},
+			},
+			consumption: []models.IngredientAmount{{IngredientID: ingredient.IngredientID, Quantity: 10}},
+			ingredient:  ingredient.IngredientID,
+		}
+
+		// The points are earned on a first order, which leaves 90 units of
+		// the ingredient.
+		earnedOn, _, err := repo.SaveOrder(ctx, f.order, f.consumption, models.OrderDiscounts{})
+		if err != nil {
+			t.Fatalf("SaveOrder: %v", err)
+		}
+		closeEarning(t, repo, earnedOn, points)
+		return f
+	}
+	promotion := func(t *testing.T, repo DiscountStore, maxUses int64) models.Promotion {
+		t.Helper()
+		p := models.Promotion{
+			Code:    uniqueName(t, "PROMO"),
+			Name:    "conformance",
+			Type:    models.DiscountFixed,
+			Value:   money.Amount(50),
+			MaxUses: maxUses,
+			Active:  true,
+		}
+		id, err := repo.SavePromotion(ctx, p)
+		if err != nil {
+			t.Fatalf("SavePromotion: %v", err)
+		}
+		p.ID = id
+		return p
+	}
+	redemption := func(f fixture, points int64) *models.LoyaltyRedemption {
+		return &models.LoyaltyRedemption{
+			CustomerID: f.customer,
+			Reward:     models.RewardDiscount,
+			Points:     points,
+			Value:      money.Amount(points),
+		}
+	}
+	balance := func(t *testing.T, repo DiscountStore, customer int64) int64 {
+		t.Helper()
+		b, err := repo.GetLoyaltyBalance(ctx, customer)
+		if err != nil {
+			t.Fatalf("GetLoyaltyBalance: %v", err)
+		}
+		return b
+	}
+
+	t.Run("SavedWithOrder", func(t *testing.T) {
+		repo := factory(t)
+		f := setup(t, repo, 100)
+		p := promotion(t, repo, 0)
+
+		id, _, err := repo.SaveOrder(ctx, f.order, f.consumption, models.OrderDiscounts{
+			Promotion:  &p,
+			Usage:      models.PromotionUsage{CustomerID: &f.customer, Amount: 50},
+			Redemption: redemption(f, 30),
+		})
+		if err != nil {
+			t.Fatalf("SaveOrder: %v", err)
+		}
+
+		usages, err := repo.GetOrderPromotionUsages(ctx, id)
+		if err != nil {
+			t.Fatalf("GetOrderPromotionUsages: %v", err)
+		}
+		if len(usages) != 1 || usages[0].PromotionID != p.ID || usages[0].OrderID != id || usages[0].Amount != 50 {
+			t.Errorf("usages of order %d = %+v, want one of promotion %d for 50", id, usages, p.ID)
+		}
+		redemptions, err := repo.GetOrderRedemptions(ctx, id)
+		if err != nil {
+			t.Fatalf("GetOrderRedemptions: %v", err)
+		}
+		if len(redemptions) != 1 || redemptions[0].OrderID != id || redemptions[0].Points != 30 {
+			t.Errorf("redemptions of order %d = %+v, want one of 30 points", id, redemptions)
+		}
+		if got := balance(t, repo, f.customer); got != 70 {
+			t.Errorf("balance = %d, want 70", got)
+		}
+	})
+
+	t.Run("EarnedWithClose", func(t *testing.T) {
+		repo := factory(t)
+		f := setup(t, repo, 100)
+
+		id, _, err := repo.SaveOrder(ctx, f.order, f.consumption, models.OrderDiscounts{})
+		if err != nil {
+			t.Fatalf("SaveOrder: %v", err)
+		}
+		_, err = repo.CloseOrder(ctx, id, models.StatusReady, 0, 25)
+		expectErr(t, "CloseOrder from the wrong status", err, models.ErrInvalidTransition)
+		if got := balance(t, repo, f.customer); got != 100 {
+			t.Errorf("balance after a refused close = %d, want 100", got)
+		}
+
+		closeEarning(t, repo, id, 25)
+		if got := balance(t, repo, f.customer); got != 125 {
+			t.Errorf("balance after the close = %d, want 125", got)
+		}
+		_, err = repo.CloseOrder(ctx, id, models.StatusOpen, 0, 25)
+		expectErr(t, "CloseOrder twice", err, models.ErrInvalidTransition)
+		if got := balance(t, repo, f.customer); got != 125 {
+			t.Errorf("balance after closing twice = %d, want 125", got)
+		}
+
+		// Orders without a customer earn nobody anything.
+		anonymous := f.order
+		anonymous.CustomerID = nil
+		id, _, err = repo.SaveOrder(ctx, anonymous, f.consumption, models.OrderDiscounts{})
+		if err != nil {
+			t.Fatalf("SaveOrder: %v", err)
+		}
+		closeEarning(t, repo, id, 25)
+		if got := balance(t, repo, f.customer); got != 125 {
+			t.Errorf("balance after closing an anonymous order = %d, want 125", got)
+		}
+	})
+
+	t.Run("RepricedWithUpdate", func(t *testing.T) {
+		repo := factory(t)
+		f := setup(t, repo, 100)
+		p := promotion(t, repo, 0)
+
+		id, _, err := repo.SaveOrder(ctx, f.order, f.consumption, models.OrderDiscounts{
+			Promotion: &p,
+			Usage:     models.PromotionUsage{CustomerID: &f.customer, Amount: 50},
+		})
+		if err != nil {
+			t.Fatalf("SaveOrder: %v", err)
+		}
+		usages, err := repo.GetOrderPromotionUsages(ctx, id)
+		if err != nil || len(usages) != 1 {
+			t.Fatalf("GetOrderPromotionUsages = %v, %v; want one usage", usages, err)
+		}
+
+		// A usage of another order fails the whole update.
+		o := f.order
+		o.Lines = slices.Clone(o.Lines)
+		o.Lines[0].Quantity = 2
+		consumption := []models.IngredientAmount{{IngredientID: f.ingredient, Quantity: 20}}
+		stranger := []models.PromotionUsage{{ID: usages[0].ID + 1000, Amount: 20}}
+		_, _, err = repo.UpdateOrder(ctx, id, o, consumption, stranger)
+		expectErr(t, "UpdateOrder with a usage of another order", err, models.ErrNotFound)
+		expectQuantity(t, repo, f.ingredient, 80)
+
+		usages[0].Amount = 20
+		if _, _, err = repo.UpdateOrder(ctx, id, o, consumption, usages); err != nil {
+			t.Fatalf("UpdateOrder: %v", err)
+		}
+		expectQuantity(t, repo, f.ingredient, 70)
+		repriced, err := repo.GetOrderPromotionUsages(ctx, id)
+		if err != nil || len(repriced) != 1 || repriced[0].Amount != 20 {
+			t.Errorf("usages after the update = %+v, %v; want one of 20", repriced, err)
+		}
+	})
+
+	t.Run("RefusedTogether", func(t *testing.T) {
+		repo := factory(t)
+		f := setup(t, repo, 100)
+		p := promotion(t, repo, 1)
+		newest := models.OrderPage{Limit: 1}
+		before, err := repo.GetOrders(ctx, newest)
+		if err != nil {
+			t.Fatalf("GetOrders: %v", err)
+		}
+
+		// The promotion is fine but the points are not there, so neither
+		// the order nor its usage of the promotion is written.
+		_, _, err = repo.SaveOrder(ctx, f.order, f.consumption, models.OrderDiscounts{
+			Promotion:  &p,
+			Usage:      models.PromotionUsage{CustomerID: &f.customer, Amount: 50},
+			Redemption: redemption(f, 101),
+		})
+		expectErr(t, "SaveOrder beyond the balance", err, models.ErrInsufficientPoints)
+		expectQuantity(t, repo, f.ingredient, 90)
+		if after, _ := repo.GetOrders(ctx, newest); !slices.Equal(orderIDs(after), orderIDs(before)) {
+			t.Errorf("a refused order was stored: newest order %v before, %v after", orderIDs(before), orderIDs(after))
+		}
+
+		// The refused order did not use up the promotion's only use.
+		discounts := models.OrderDiscounts{
+			Promotion: &p,
+			Usage:     models.PromotionUsage{CustomerID: &f.customer, Amount: 50},
+		}
+		if _, _, err = repo.SaveOrder(ctx, f.order, f.consumption, discounts); err != nil {
+			t.Fatalf("SaveOrder: %v", err)
+		}
+
+		// Now it is used up, and the points are not spent either.
+		discounts.Redemption = redemption(f, 30)
+		_, _, err = repo.SaveOrder(ctx, f.order, f.consumption, discounts)
+		expectErr(t, "SaveOrder past the promotion's limit", err, models.ErrPromoLimitReached)
+		expectQuantity(t, repo, f.ingredient, 80)
+		if got := balance(t, repo, f.customer); got != 100 {
+			t.Errorf("balance = %d, want 100", got)
+		}
+	})
+
+	t.Run("UndoNeedsOpenOrder", func(t *testing.T) {
+		repo := factory(t)
+		f := setup(t, repo, 100)
+
+		redeemed := func(t *testing.T, points int64) (int64, models.LoyaltyRedemption) {
+			t.Helper()
+			id, _, err := repo.SaveOrder(ctx, f.order, f.consumption, models.OrderDiscounts{Redemption: redemption(f, points)})
+			if err != nil {
+				t.Fatalf("SaveOrder: %v", err)
+			}
+			redemptions, err := repo.GetOrderRedemptions(ctx, id)
+			if err != nil || len(redemptions) != 1 {
+				t.Fatalf("GetOrderRedemptions = %v, %v; want one redemption", redemptions, err)
+			}
+			return id, redemptions[0]
+		}
+
+		id, r := redeemed(t, 40)
+		if _, err := repo.SetOrderStatus(ctx, id, models.StatusOpen, models.StatusInProgress); err != nil {
+			t.Fatalf("SetOrderStatus: %v", err)
+		}
+		_, err := repo.UndoRedemption(ctx, r.ID)
+		expectErr(t, "UndoRedemption of an order in progress", err, models.ErrOrderClosed)
+		if got := balance(t, repo, f.customer); got != 60 {
+			t.Errorf("balance after a refused undo = %d, want 60", got)
+		}
+
+		_, r = redeemed(t, 20)
+		if _, err = repo.UndoRedemption(ctx, r.ID); err != nil {
+			t.Fatalf("UndoRedemption of an open order: %v", err)
+		}
+		if got := balance(t, repo, f.customer); got != 60 {
+			t.Errorf("balance after undo = %d, want 60", got)
+		}
+		_, err = repo.UndoRedemption(ctx, r.ID)
+		expectErr(t, "UndoRedemption twice", err, models.ErrRedemptionUndone)
+	})
+
+	t.Run("ReleasedWithOrder", func(t *testing.T) {
+		for name, release := range map[string]func(repo DiscountStore, id int64) error{
+			"Cancel": func(repo DiscountStore, id int64) error {
+				_, err := repo.CancelOrder(ctx, id, models.StatusInProgress)
+				return err
+			},
+			"Delete": func(repo DiscountStore, id int64) error {
+				return repo.DeleteOrder(ctx, id)
+			},
+		} {
+			t.Run(name, func(t *testing.T) {
+				repo := factory(t)
+				f := setup(t, repo, 100)
+				p := promotion(t, repo, 1)
+				discounts := models.OrderDiscounts{
+					Promotion:  &p,
+					Usage:      models.PromotionUsage{CustomerID: &f.customer, Amount: 50},
+					Redemption: redemption(f, 30),
+				}
+
+				id, _, err := repo.SaveOrder(ctx, f.order, f.consumption, discounts)
+				if err != nil {
+					t.Fatalf("SaveOrder: %v", err)
+				}
+				redemptions, err := repo.GetOrderRedemptions(ctx, id)
+				if err != nil || len(redemptions) != 1 {
+					t.Fatalf("GetOrderRedemptions = %v, %v; want one redemption", redemptions, err)
+				}
+				if _, err = repo.SetOrderStatus(ctx, id, models.StatusOpen, models.StatusInProgress); err != nil {
+					t.Fatalf("SetOrderStatus: %v", err)
+				}
+				if err = release(repo, id); err != nil {
+					t.Fatalf("%s: %v", name, err)
+				}
+
+				if got := balance(t, repo, f.customer); got != 100 {
+					t.Errorf("balance = %d, want 100", got)
+				}
+				_, err = repo.UndoRedemption(ctx, redemptions[0].ID)
+				expectErr(t, "UndoRedemption of a released order", err, models.ErrRedemptionUndone)
+				if usages, err := repo.GetOrderPromotionUsages(ctx, id); err != nil || len(usages) != 0 {
+					t.Errorf("usages of the released order = %v, %v; want none", usages, err)
+				}
+				// The promotion's only use is free again.
+				if _, _, err = repo.SaveOrder(ctx, f.order, f.consumption, discounts); err != nil {
+					t.Fatalf("SaveOrder with the released promotion: %v", err)
+				}
+			})
+		}
+	})
+
+	t.Run("RefundReversesEarnedPoints", func(t *testing.T) {
+		repo := factory(t)
+		f := setup(t, repo, 100)
+
+		o := f.order
+		o.Lines = slices.Clone(o.Lines)
+		o.Lines[0].Quantity = 4
+		consumption := []models.IngredientAmount{{IngredientID: f.ingredient, Quantity: 40}}
+		id, _, err := repo.SaveOrder(ctx, o, consumption, models.OrderDiscounts{})
+		if err != nil {
+			t.Fatalf("SaveOrder: %v", err)
+		}
+		saved, err := repo.GetOrder(ctx, id)
+		if err != nil {
+			t.Fatalf("GetOrder: %v", err)
+		}
+		line := saved.Lines[0]
+		total := line.UnitPrice.Mul(4)
+		closeEarning(t, repo, id, 40)
+
+		// A quarter, then three quarters, then all of the order is refunded.
+		for _, step := range []struct {
+			quantity int
+			want     int64
+		}{
+			{1, 130},
+			{2, 110},
+			{1, 100},
+		} {
+			refund := models.Refund{
+				OrderID: id,
+				Reason:  "conformance",
+				Amount:  line.UnitPrice.Mul(step.quantity),
+				Lines:   []models.RefundLine{{LineID: line.ID, Quantity: step.quantity, Amount: line.UnitPrice.Mul(step.quantity)}},
+			}
+			if _, err = repo.SaveRefund(ctx, refund, nil, total); err != nil {
+				t.Fatalf("SaveRefund of %d: %v", step.quantity, err)
+			}
+			if got := balance(t, repo, f.customer); got != step.want {
+				t.Errorf("balance after refunding %d more = %d, want %d", step.quantity, got, step.want)
+			}
+		}
+
+		history, err := repo.GetLoyaltyHistory(ctx, f.customer)
+		if err != nil {
+			t.Fatalf("GetLoyaltyHistory: %v", err)
+		}
+		var reversed int64
+		for _, e := range history {
+			if e.Reason == models.LoyaltyReversal && e.OrderID != nil && *e.OrderID == id {
+				reversed += e.Points
+			}
+		}
+		if reversed != -40 {
+			t.Errorf("reversals on order %d add up to %d, want -40", id, reversed)
+		}
+	})
+}
@@ -0,0 +1,211 @@
+package repotest
+
+import (
+	"context"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"github.com/weeweeshka/hot-coffee/internal/service"
+	"slices"
+	"testing"
+	"time"
+)
+
+// RunInventoryRepoSuite checks an InventoryRepo: CRUD, not-found errors,
+// unit changes, the movement ledger, low stock, and that concurrent movements
+// never take the stock below zero.
+func RunInventoryRepoSuite(t *testing.T, factory func(t *testing.T) service.InventoryRepo) {
+	ctx := context.Background()
+
+	t.Run("CRUD", func(t *testing.T) {
+		repo := factory(t)
+		item := saveIngredient(t, repo, 500)
+
+		got, err := repo.GetInventory(ctx, item.IngredientID)
+		if err != nil {
+			t.Fatalf("GetInventory: %v", err)
+		}
+		if got != item {
+			t.Errorf("GetInventory = %+v, want %+v", got, item)
+		}
+
+		all, err := repo.GetAllInventories(ctx)
+		if err != nil {
+			t.Fatalf("GetAllInventories: %v", err)
+		}
+		if !slices.Contains(all, item) {
+			t.Errorf("GetAllInventories does not list %+v", item)
+		}
+
+		item.Name = uniqueName(t, "renamed")
+		item.ReorderLevel = 50
+		updated, err := repo.UpdateInventory(ctx, item.IngredientID, item)
+		if err != nil {
+			t.Fatalf("UpdateInventory: %v", err)
+		}
+		if updated != item {
+			t.Errorf("UpdateInventory = %+v, want %+v", updated, item)
+		}
+		if got, _ = repo.GetInventory(ctx, item.IngredientID); got != item {
+			t.Errorf("GetInventory after update = %+v, want %+v", got, item)
+		}
+
+		if err = repo.DeleteInventory(ctx, item.IngredientID); err != nil {
+			t.Fatalf("DeleteInventory: %v", err)
+		}
+		_, err = repo.GetInventory(ctx, item.IngredientID)
+		expectErr(t, "GetInventory after delete", err, models.ErrNotFound)
+	})
+
+	t.Run("Duplicate", func(t *testing.T) {
+		repo := factory(t)
+		item := saveIngredient(t, repo, 500)
+		other := saveIngredient(t, repo, 500)
+
+		_, err := repo.SaveInventory(ctx, models.InventoryItem{Name: item.Name, Unit: item.Unit})
+		expectErr(t, "SaveInventory of a taken name", err, models.ErrDuplicateInventory)
+
+		other.Name = item.Name
+		_, err = repo.UpdateInventory(ctx, other.IngredientID, other)
+		expectErr(t, "UpdateInventory to a taken name", err, models.ErrDuplicateInventory)
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		repo := factory(t)
+
+		_, err := repo.GetInventory(ctx, missingID)
+		expectErr(t, "GetInventory", err, models.ErrNotFound)
+		_, err = repo.UpdateInventory(ctx, missingID, models.InventoryItem{Name: uniqueName(t, "missing"), Unit: "g"})
+		expectErr(t, "UpdateInventory", err, models.ErrNotFound)
+		expectErr(t, "DeleteInventory", repo.DeleteInventory(ctx, missingID), models.ErrNotFound)
+		_, err = repo.AddInventoryTransaction(ctx, models.InventoryTransaction{IngredientID: missingID, Delta: 1, Reason: models.ReasonRestock})
+		expectErr(t, "AddInventoryTransaction", err, models.ErrNotFound)
+		_, err = repo.GetInventoryHistory(ctx, missingID, time.Time{}, time.Time{})
+		expectErr(t, "GetInventoryHistory", err, models.ErrNotFound)
+	})
+
+	t.Run("UnitChange", func(t *testing.T) {
+		repo := factory(t)
+		item := saveIngredient(t, repo, 500)
+
+		changed := item
+		changed.Unit = "kg"
+		_, err := repo.UpdateInventory(ctx, item.IngredientID, changed)
+		expectErr(t, "UpdateInventory of the unit of a stocked item", err, models.ErrInvalidInventory)
+		if got, _ := repo.GetInventory(ctx, item.IngredientID); got != item {
+			t.Errorf("a refused unit change left %+v, want %+v", got, item)
+		}
+
+		item.Quantity = 0
+		if _, err = repo.UpdateInventory(ctx, item.IngredientID, item); err != nil {
+			t.Fatalf("UpdateInventory to zero: %v", err)
+		}
+		changed.Quantity = 0
+		if _, err = repo.UpdateInventory(ctx, item.IngredientID, changed); err != nil {
+			t.Errorf("UpdateInventory of the unit of an empty item: %v", err)
+		}
+	})
+
+	t.Run("Ledger", func(t *testing.T) {
+		repo := factory(t)
+		item := saveIngredient(t, repo, 100)
+
+		waste, err := repo.AddInventoryTransaction(ctx, models.InventoryTransaction{
+			IngredientID: item.IngredientID,
+			Delta:        -30,
+			Reason:       models.ReasonWaste,
+			Note:         "spilt",
+		})
+		if err != nil {
+			t.Fatalf("AddInventoryTransaction: %v", err)
+		}
+		if waste.ID == 0 || waste.CreatedAt.IsZero() {
+			t.Errorf("AddInventoryTransaction = %+v, want an ID and a time", waste)
+		}
+		expectQuantity(t, repo, item.IngredientID, 70)
+
+		item.Quantity = 90
+		if _, err = repo.UpdateInventory(ctx, item.IngredientID, item); err != nil {
+			t.Fatalf("UpdateInventory: %v", err)
+		}
+
+		history, err := repo.GetInventoryHistory(ctx, item.IngredientID, time.Time{}, time.Time{})
+		if err != nil {
+			t.Fatalf("GetInventoryHistory: %v", err)
+		}
+		var reasons []models.InventoryReason
+		var deltas []float64
+		for _, movement := range history {
+			reasons = append(reasons, movement.Reason)
+			deltas = append(deltas, movement.Delta)
+		}
+		wantReasons := []models.InventoryReason{models.ReasonRestock, models.ReasonWaste, models.ReasonCountCorrection}
+		if !slices.Equal(reasons, wantReasons) || !slices.Equal(deltas, []float64{100, -30, 20}) {
+			t.Errorf("history = %v %v, want %v [100 -30 20]", reasons, deltas, wantReasons)
+		}
+
+		future, err := repo.GetInventoryHistory(ctx, item.IngredientID, time.Now().Add(time.Hour), time.Time{})
+		if err != nil {
+			t.Fatalf("GetInventoryHistory from the future: %v", err)
+		}
+		if len(future) != 0 {
+			t.Errorf("history from the future = %+v, want none", future)
+		}
+	})
+
+	t.Run("RollbackOnShortage", func(t *testing.T) {
+		repo := factory(t)
+		item := saveIngredient(t, repo, 10)
+
+		_, err := repo.AddInventoryTransaction(ctx, models.InventoryTransaction{
+			IngredientID: item.IngredientID,
+			Delta:        -11,
+			Reason:       models.ReasonWaste,
+		})
+		expectShortage(t, "AddInventoryTransaction", err)
+		expectQuantity(t, repo, item.IngredientID, 10)
+
+		history, err := repo.GetInventoryHistory(ctx, item.IngredientID, time.Time{}, time.Time{})
+		if err != nil {
+			t.Fatalf("GetInventoryHistory: %v", err)
+		}
+		if len(history) != 1 {
+			t.Errorf("history after a refused movement has %d entries, want 1", len(history))
+		}
+	})
+
+	t.Run("LowStock", func(t *testing.T) {
+		repo := factory(t)
+		plenty := saveIngredient(t, repo, 100)
+		low := saveIngredient(t, repo, 5)
+		empty := saveIngredient(t, repo, 0)
+
+		items, err := repo.GetLowStock(ctx)
+		if err != nil {
+			t.Fatalf("GetLowStock: %v", err)
+		}
+		var ids []int64
+		for _, item := range items {
+			ids = append(ids, item.IngredientID)
+		}
+		if got := filterIDs(ids, plenty.IngredientID, low.IngredientID, empty.IngredientID); !slices.Equal(got, []int64{empty.IngredientID, low.IngredientID}) {
+			t.Errorf("GetLowStock lists %v, want %v", got, []int64{empty.IngredientID, low.IngredientID})
+		}
+	})
+
+	t.Run("ConcurrentMovements", func(t *testing.T) {
+		repo := factory(t)
+		item := saveIngredient(t, repo, concurrency/2)
+
+		succeeded := runConcurrently(func(int) error {
+			_, err := repo.AddInventoryTransaction(ctx, models.InventoryTransaction{
+				IngredientID: item.IngredientID,
+				Delta:        -1,
+				Reason:       models.ReasonWaste,
+			})
+			return err
+		})
+		if succeeded != concurrency/2 {
+			t.Errorf("%d of %d movements succeeded, want %d", succeeded, concurrency, concurrency/2)
+		}
+		expectQuantity(t, repo, item.IngredientID, 0)
+	})
+}
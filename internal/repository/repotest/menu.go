@@ -0,0 +1,135 @@
+package repotest
+
+import (
+	"context"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"github.com/weeweeshka/hot-coffee/internal/money"
+	"slices"
+	"testing"
+)
+
+// RunMenuRepoSuite checks a MenuRepo: CRUD with variants and modifiers,
+// not-found errors, that recipes pin the unit of their ingredients, and that
+// concurrent saves get distinct IDs.
+func RunMenuRepoSuite(t *testing.T, factory func(t *testing.T) MenuStore) {
+	ctx := context.Background()
+
+	t.Run("CRUD", func(t *testing.T) {
+		repo := factory(t)
+		milk := saveIngredient(t, repo, 1000)
+		syrup := saveIngredient(t, repo, 1000)
+
+		menu := models.MenuItem{
+			Name:        uniqueName(t, "latte"),
+			Description: "espresso and milk",
+			Category:    "coffee",
+			Price:       money.Amount(350),
+			Ingredients: []models.MenuItemIngredient{{IngredientID: milk.IngredientID, Quantity: 200}},
+			Variants: []models.MenuVariant{{
+				Name:        "large",
+				Price:       money.Amount(450),
+				Ingredients: []models.MenuItemIngredient{{IngredientID: milk.IngredientID, Quantity: 300}},
+			}},
+			ModifierGroups: []models.ModifierGroup{{
+				Name:      "syrup",
+				MaxSelect: 1,
+				Modifiers: []models.Modifier{{
+					Name:        "vanilla",
+					PriceDelta:  money.Amount(50),
+					Ingredients: []models.MenuItemIngredient{{IngredientID: syrup.IngredientID, Quantity: 10}},
+				}},
+			}},
+		}
+		id, err := repo.SaveMenu(ctx, menu)
+		if err != nil {
+			t.Fatalf("SaveMenu: %v", err)
+		}
+
+		got, err := repo.GetMenu(ctx, id)
+		if err != nil {
+			t.Fatalf("GetMenu: %v", err)
+		}
+		if got.ID != id || got.Name != menu.Name || got.Category != menu.Category || got.Price != menu.Price {
+			t.Errorf("GetMenu = %+v, want %+v", got, menu)
+		}
+		if len(got.Ingredients) != 1 || got.Ingredients[0].Quantity != 200 {
+			t.Errorf("GetMenu ingredients = %+v, want 200 of %d", got.Ingredients, milk.IngredientID)
+		}
+		if len(got.Variants) != 1 || got.Variants[0].ID == 0 || got.Variants[0].Price != menu.Variants[0].Price {
+			t.Fatalf("GetMenu variants = %+v, want one with an ID", got.Variants)
+		}
+		if len(got.ModifierGroups) != 1 || len(got.ModifierGroups[0].Modifiers) != 1 || got.ModifierGroups[0].Modifiers[0].ID == 0 {
+			t.Fatalf("GetMenu modifier groups = %+v, want one modifier with an ID", got.ModifierGroups)
+		}
+
+		all, err := repo.GetAllMenus(ctx)
+		if err != nil {
+			t.Fatalf("GetAllMenus: %v", err)
+		}
+		if !slices.ContainsFunc(all, func(m models.MenuItem) bool { return m.ID == id }) {
+			t.Errorf("GetAllMenus does not list menu item %d", id)
+		}
+
+		got.Price = money.Amount(375)
+		got.Description = "more milk"
+		updated, err := repo.UpdateMenu(ctx, id, got)
+		if err != nil {
+			t.Fatalf("UpdateMenu: %v", err)
+		}
+		if updated.Price != got.Price || updated.Variants[0].ID != got.Variants[0].ID {
+			t.Errorf("UpdateMenu = %+v, want the new price and the same variant", updated)
+		}
+		if reread, _ := repo.GetMenu(ctx, id); reread.Price != got.Price || reread.Description != got.Description {
+			t.Errorf("GetMenu after update = %+v, want price %s", reread, got.Price)
+		}
+
+		if err = repo.DeleteMenu(ctx, id); err != nil {
+			t.Fatalf("DeleteMenu: %v", err)
+		}
+		_, err = repo.GetMenu(ctx, id)
+		expectErr(t, "GetMenu after delete", err, models.ErrNotFound)
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		repo := factory(t)
+
+		_, err := repo.GetMenu(ctx, missingID)
+		expectErr(t, "GetMenu", err, models.ErrNotFound)
+		_, err = repo.UpdateMenu(ctx, missingID, models.MenuItem{Name: uniqueName(t, "missing")})
+		expectErr(t, "UpdateMenu", err, models.ErrNotFound)
+		expectErr(t, "DeleteMenu", repo.DeleteMenu(ctx, missingID), models.ErrNotFound)
+	})
+
+	t.Run("RecipePinsUnit", func(t *testing.T) {
+		repo := factory(t)
+		ingredient := saveIngredient(t, repo, 0)
+		saveMenu(t, repo, ingredient, 10)
+
+		ingredient.Unit = "kg"
+		_, err := repo.UpdateInventory(ctx, ingredient.IngredientID, ingredient)
+		expectErr(t, "UpdateInventory of the unit of a recipe ingredient", err, models.ErrInvalidInventory)
+	})
+
+	t.Run("ConcurrentSaves", func(t *testing.T) {
+		repo := factory(t)
+		milk := saveIngredient(t, repo, 1000)
+
+		ids := make([]int64, concurrency)
+		succeeded := runConcurrently(func(i int) error {
+			var err error
+			ids[i], err = repo.SaveMenu(ctx, models.MenuItem{
+				Name:        uniqueName(t, "concurrent"),
+				Price:       money.Amount(100),
+				Ingredients: []models.MenuItemIngredient{{IngredientID: milk.IngredientID, Quantity: 1}},
+			})
+			return err
+		})
+		if succeeded != concurrency {
+			t.Fatalf("%d of %d saves succeeded", succeeded, concurrency)
+		}
+		slices.Sort(ids)
+		if len(slices.Compact(ids)) != concurrency {
+			t.Errorf("concurrent saves got IDs %v, want all distinct", ids)
+		}
+	})
+}
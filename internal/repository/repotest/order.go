@@ -0,0 +1,343 @@
+package repotest
+
+import (
+	"context"
+	"errors"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"github.com/weeweeshka/hot-coffee/internal/money"
+	"slices"
+	"sync/atomic"
+	"testing"
+)
+
+// RunOrderRepoSuite checks an OrderRepo: CRUD, not-found errors, that the
+// inventory moves with the order and not at all when a write fails, the
+// reported stock changes, status transitions, newest-first listing, and that
+// concurrent orders never oversell an ingredient.
+func RunOrderRepoSuite(t *testing.T, factory func(t *testing.T) OrderStore) {
+	ctx := context.Background()
+
+	// fixture is a fresh ingredient with stock units and a menu item made of
+	// per units of it.
+	type fixture struct {
+		ingredient models.InventoryItem
+		menu       models.MenuItem
+	}
+	setup := func(t *testing.T, repo OrderStore, stock, per float64) fixture {
+		ingredient := saveIngredient(t, repo, stock)
+		return fixture{ingredient: ingredient, menu: saveMenu(t, repo, ingredient, per)}
+	}
+	order := func(f fixture, quantity int) (models.Order, []models.IngredientAmount) {
+		line := models.PricedLine{
+			ProductID: f.menu.ID,
+			Name:      f.menu.Name,
+			Category:  f.menu.Category,
+			Quantity:  quantity,
+			UnitPrice: f.menu.Price,
+		}
+		consumption := []models.IngredientAmount{{
+			IngredientID: f.ingredient.IngredientID,
+			Quantity:     f.menu.Ingredients[0].Quantity * float64(quantity),
+		}}
+		return models.Order{
+			CustomerName:  "conformance",
+			Lines:         []models.PricedLine{line},
+			Rounding:      money.Down,
+			CashIncrement: money.Amount(5),
+		}, consumption
+	}
+	save := func(t *testing.T, repo OrderStore, f fixture, quantity int) int64 {
+		t.Helper()
+		o, consumption := order(f, quantity)
+		id, _, err := repo.SaveOrder(ctx, o, consumption, models.OrderDiscounts{})
+		if err != nil {
+			t.Fatalf("SaveOrder: %v", err)
+		}
+		return id
+	}
+
+	t.Run("CRUD", func(t *testing.T) {
+		repo := factory(t)
+		f := setup(t, repo, 100, 10)
+
+		id := save(t, repo, f, 2)
+		expectQuantity(t, repo, f.ingredient.IngredientID, 80)
+
+		got, err := repo.GetOrder(ctx, id)
+		if err != nil {
+			t.Fatalf("GetOrder: %v", err)
+		}
+		if got.ID != id || got.Status != models.StatusOpen || got.CustomerName != "conformance" || got.CreatedAt == "" {
+			t.Errorf("GetOrder = %+v, want an open order", got)
+		}
+		if len(got.Lines) != 1 || got.Lines[0].ID == 0 || got.Lines[0].LineTotal != f.menu.Price.Mul(2) {
+			t.Errorf("GetOrder lines = %+v, want one line of 2 with an ID", got.Lines)
+		}
+		if len(got.Items) != 1 || got.Items[0].ProductID != f.menu.ID || got.Items[0].Quantity != 2 {
+			t.Errorf("GetOrder items = %+v, want 2 of %d", got.Items, f.menu.ID)
+		}
+		if got.Rounding != money.Down || got.CashIncrement != 5 {
+			t.Errorf("GetOrder rounding = %q to %s, want down to 0.05", got.Rounding, got.CashIncrement)
+		}
+
+		// The rounding stays what the order was created with.
+		o, consumption := order(f, 5)
+		o.CustomerName = "changed"
+		o.Rounding, o.CashIncrement = money.Up, 0
+		updated, _, err := repo.UpdateOrder(ctx, id, o, consumption, nil)
+		if err != nil {
+			t.Fatalf("UpdateOrder: %v", err)
+		}
+		if updated.CustomerName != "changed" || len(updated.Lines) != 1 || updated.Lines[0].Quantity != 5 {
+			t.Errorf("UpdateOrder = %+v, want 5 for changed", updated)
+		}
+		if updated.Rounding != money.Down || updated.CashIncrement != 5 {
+			t.Errorf("UpdateOrder rounding = %q to %s, want down to 0.05", updated.Rounding, updated.CashIncrement)
+		}
+		expectQuantity(t, repo, f.ingredient.IngredientID, 50)
+
+		if err = repo.DeleteOrder(ctx, id); err != nil {
+			t.Fatalf("DeleteOrder: %v", err)
+		}
+		_, err = repo.GetOrder(ctx, id)
+		expectErr(t, "GetOrder after delete", err, models.ErrNotFound)
+		expectQuantity(t, repo, f.ingredient.IngredientID, 100)
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		repo := factory(t)
+		f := setup(t, repo, 100, 1)
+		o, consumption := order(f, 1)
+
+		_, err := repo.GetOrder(ctx, missingID)
+		expectErr(t, "GetOrder", err, models.ErrNotFound)
+		_, _, err = repo.UpdateOrder(ctx, missingID, o, consumption, nil)
+		expectErr(t, "UpdateOrder", err, models.ErrNotFound)
+		expectErr(t, "DeleteOrder", repo.DeleteOrder(ctx, missingID), models.ErrNotFound)
+		_, err = repo.SetOrderStatus(ctx, missingID, models.StatusOpen, models.StatusInProgress)
+		expectErr(t, "SetOrderStatus", err, models.ErrNotFound)
+		_, err = repo.CancelOrder(ctx, missingID, models.StatusOpen)
+		expectErr(t, "CancelOrder", err, models.ErrNotFound)
+		_, err = repo.CloseOrder(ctx, missingID, models.StatusReady, money.Amount(100), 0)
+		expectErr(t, "CloseOrder", err, models.ErrNotFound)
+		expectQuantity(t, repo, f.ingredient.IngredientID, 100)
+	})
+
+	t.Run("RollbackOnShortage", func(t *testing.T) {
+		repo := factory(t)
+		plenty := setup(t, repo, 100, 10)
+		scarce := setup(t, repo, 5, 10)
+
+		// The first line could be served; the second cannot, so neither is.
+		o, consumption := order(plenty, 1)
+		scarceOrder, scarceConsumption := order(scarce, 1)
+		o.Lines = append(o.Lines, scarceOrder.Lines...)
+		consumption = append(consumption, scarceConsumption...)
+
+		newest := models.OrderPage{Limit: 1}
+		before, err := repo.GetOrders(ctx, newest)
+		if err != nil {
+			t.Fatalf("GetOrders: %v", err)
+		}
+		_, _, err = repo.SaveOrder(ctx, o, consumption, models.OrderDiscounts{})
+		expectShortage(t, "SaveOrder", err)
+		expectQuantity(t, repo, plenty.ingredient.IngredientID, 100)
+		expectQuantity(t, repo, scarce.ingredient.IngredientID, 5)
+		if after, _ := repo.GetOrders(ctx, newest); !slices.Equal(orderIDs(after), orderIDs(before)) {
+			t.Errorf("a refused order was stored: newest order %v before, %v after", orderIDs(before), orderIDs(after))
+		}
+
+		id := save(t, repo, plenty, 2)
+		_, _, err = repo.UpdateOrder(ctx, id, o, consumption, nil)
+		expectShortage(t, "UpdateOrder", err)
+		expectQuantity(t, repo, plenty.ingredient.IngredientID, 80)
+		expectQuantity(t, repo, scarce.ingredient.IngredientID, 5)
+		if got, _ := repo.GetOrder(ctx, id); len(got.Lines) != 1 || got.Lines[0].Quantity != 2 {
+			t.Errorf("a refused update changed the order to %+v", got.Lines)
+		}
+	})
+
+	t.Run("StockChanges", func(t *testing.T) {
+		repo := factory(t)
+		f := setup(t, repo, 100, 10)
+		held := setup(t, repo, 100, 10)
+
+		o, consumption := order(held, 2)
+		id, changes, err := repo.SaveOrder(ctx, o, consumption, models.OrderDiscounts{})
+		if err != nil {
+			t.Fatalf("SaveOrder: %v", err)
+		}
+		want := []models.StockChange{{IngredientID: held.ingredient.IngredientID, Before: 100, After: 80, ReorderLevel: 10}}
+		if !slices.Equal(changes, want) {
+			t.Errorf("SaveOrder changes = %+v, want %+v", changes, want)
+		}
+
+		// The update gives back what the order held and takes the new lines.
+		o, consumption = order(f, 3)
+		_, changes, err = repo.UpdateOrder(ctx, id, o, consumption, nil)
+		if err != nil {
+			t.Fatalf("UpdateOrder: %v", err)
+		}
+		want = []models.StockChange{
+			{IngredientID: f.ingredient.IngredientID, Before: 100, After: 70, ReorderLevel: 10},
+			{IngredientID: held.ingredient.IngredientID, Before: 80, After: 100, ReorderLevel: 10},
+		}
+		slices.SortFunc(changes, func(a, b models.StockChange) int { return int(a.IngredientID - b.IngredientID) })
+		if !slices.Equal(changes, want) {
+			t.Errorf("UpdateOrder changes = %+v, want %+v", changes, want)
+		}
+	})
+
+	t.Run("ConcurrentCrossing", func(t *testing.T) {
+		repo := factory(t)
+		// Every order succeeds and exactly one takes the stock from the
+		// reorder level of 10 to 9.
+		f := setup(t, repo, concurrency, 1)
+
+		var crossed atomic.Int64
+		succeeded := runConcurrently(func(int) error {
+			o, consumption := order(f, 1)
+			_, changes, err := repo.SaveOrder(ctx, o, consumption, models.OrderDiscounts{})
+			for _, c := range changes {
+				if c.CrossedReorderLevel() {
+					crossed.Add(1)
+				}
+			}
+			return err
+		})
+		if succeeded != concurrency || crossed.Load() != 1 {
+			t.Errorf("%d orders succeeded and %d crossed the reorder level, want %d and 1", succeeded, crossed.Load(), concurrency)
+		}
+	})
+
+	t.Run("Transitions", func(t *testing.T) {
+		repo := factory(t)
+		f := setup(t, repo, 100, 10)
+		id := save(t, repo, f, 1)
+
+		startedAt, err := repo.SetOrderStatus(ctx, id, models.StatusOpen, models.StatusInProgress)
+		if err != nil {
+			t.Fatalf("SetOrderStatus: %v", err)
+		}
+		got, _ := repo.GetOrder(ctx, id)
+		if got.Status != models.StatusInProgress || got.StartedAt == nil || !got.StartedAt.Equal(startedAt) {
+			t.Errorf("GetOrder after start = %s at %v, want in_progress at %v", got.Status, got.StartedAt, startedAt)
+		}
+
+		_, err = repo.SetOrderStatus(ctx, id, models.StatusOpen, models.StatusInProgress)
+		expectErr(t, "SetOrderStatus from a stale status", err, models.ErrInvalidTransition)
+
+		if _, err = repo.CancelOrder(ctx, id, models.StatusInProgress); err != nil {
+			t.Fatalf("CancelOrder: %v", err)
+		}
+		got, _ = repo.GetOrder(ctx, id)
+		if got.Status != models.StatusCancelled || got.CancelledAt == nil {
+			t.Errorf("GetOrder after cancel = %s, want cancelled", got.Status)
+		}
+		expectQuantity(t, repo, f.ingredient.IngredientID, 100)
+
+		_, err = repo.CancelOrder(ctx, id, models.StatusInProgress)
+		expectErr(t, "CancelOrder twice", err, models.ErrInvalidTransition)
+		_, err = repo.CloseOrder(ctx, id, models.StatusInProgress, money.Amount(100), 0)
+		expectErr(t, "CloseOrder on a cancelled order", err, models.ErrInvalidTransition)
+		if got, _ = repo.GetOrder(ctx, id); got.Tip != 0 {
+			t.Errorf("tip on a cancelled order = %s, want none", got.Tip)
+		}
+		expectQuantity(t, repo, f.ingredient.IngredientID, 100)
+	})
+
+	t.Run("ClosedOrdersStay", func(t *testing.T) {
+		repo := factory(t)
+		f := setup(t, repo, 100, 10)
+		id := save(t, repo, f, 1)
+
+		for _, step := range [][2]models.OrderStatus{
+			{models.StatusOpen, models.StatusInProgress},
+			{models.StatusInProgress, models.StatusReady},
+		} {
+			if _, err := repo.SetOrderStatus(ctx, id, step[0], step[1]); err != nil {
+				t.Fatalf("SetOrderStatus %s -> %s: %v", step[0], step[1], err)
+			}
+		}
+		closedAt, err := repo.CloseOrder(ctx, id, models.StatusReady, money.Amount(150), 0)
+		if err != nil {
+			t.Fatalf("CloseOrder: %v", err)
+		}
+		got, _ := repo.GetOrder(ctx, id)
+		if got.Status != models.StatusClosed || got.ClosedAt == nil || !got.ClosedAt.Equal(closedAt) || got.Tip != 150 {
+			t.Errorf("GetOrder after close = %s at %v with tip %s, want closed at %v with tip 1.50", got.Status, got.ClosedAt, got.Tip, closedAt)
+		}
+		_, err = repo.CloseOrder(ctx, id, models.StatusReady, money.Amount(500), 0)
+		expectErr(t, "CloseOrder twice", err, models.ErrInvalidTransition)
+		if got, _ = repo.GetOrder(ctx, id); got.Tip != 150 {
+			t.Errorf("tip after a refused close = %s, want 1.50", got.Tip)
+		}
+
+		expectErr(t, "DeleteOrder of a closed order", repo.DeleteOrder(ctx, id), models.ErrOrderClosed)
+		if _, err := repo.GetOrder(ctx, id); err != nil {
+			t.Errorf("GetOrder after a refused delete: %v", err)
+		}
+		expectQuantity(t, repo, f.ingredient.IngredientID, 90)
+
+		err = repo.DeleteMenu(ctx, f.menu.ID)
+		if err == nil || errors.Is(err, models.ErrNotFound) {
+			t.Errorf("DeleteMenu of an ordered item: err = %v, want a refusal", err)
+		}
+	})
+
+	t.Run("NewestFirst", func(t *testing.T) {
+		repo := factory(t)
+		f := setup(t, repo, 100, 1)
+		first := save(t, repo, f, 1)
+		second := save(t, repo, f, 1)
+		third := save(t, repo, f, 1)
+
+		orders, err := repo.GetOrders(ctx, models.OrderPage{Limit: 1000})
+		if err != nil {
+			t.Fatalf("GetOrders: %v", err)
+		}
+		if got := filterIDs(orderIDs(orders), first, second, third); !slices.Equal(got, []int64{third, second, first}) {
+			t.Errorf("GetOrders lists %v, want %v", got, []int64{third, second, first})
+		}
+	})
+
+	t.Run("Pages", func(t *testing.T) {
+		repo := factory(t)
+		f := setup(t, repo, 100, 1)
+		first := save(t, repo, f, 1)
+		second := save(t, repo, f, 1)
+		third := save(t, repo, f, 1)
+
+		for _, tc := range []struct {
+			page models.OrderPage
+			want []int64
+		}{
+			{models.OrderPage{Limit: 2}, []int64{third, second}},
+			{models.OrderPage{Limit: 2, Offset: 1}, []int64{second, first}},
+			{models.OrderPage{Limit: 1, Offset: 2}, []int64{first}},
+		} {
+			orders, err := repo.GetOrders(ctx, tc.page)
+			if err != nil {
+				t.Fatalf("GetOrders %+v: %v", tc.page, err)
+			}
+			if got := orderIDs(orders); !slices.Equal(got, tc.want) {
+				t.Errorf("GetOrders %+v lists %v, want %v", tc.page, got, tc.want)
+			}
+		}
+	})
+
+	t.Run("ConcurrentOrders", func(t *testing.T) {
+		repo := factory(t)
+		f := setup(t, repo, concurrency/2, 1)
+
+		succeeded := runConcurrently(func(int) error {
+			o, consumption := order(f, 1)
+			_, _, err := repo.SaveOrder(ctx, o, consumption, models.OrderDiscounts{})
+			return err
+		})
+		if succeeded != concurrency/2 {
+			t.Errorf("%d of %d orders succeeded, want %d", succeeded, concurrency, concurrency/2)
+		}
+		expectQuantity(t, repo, f.ingredient.IngredientID, 0)
+	})
+}
@@ -0,0 +1,160 @@
+// Package repotest checks that a storage backend behaves the way the
+// services expect of their repositories, so that the postgres, JSON file
+// and in-memory storages cannot drift apart. A backend's tests call the
+// Run*Suite functions with a factory that hands each subtest a repository.
+//
+// The suites only look at the rows they create themselves, so a factory may
+// return a repository shared with other tests, such as one database.
+package repotest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"github.com/weeweeshka/hot-coffee/internal/money"
+	"github.com/weeweeshka/hot-coffee/internal/service"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// MenuStore is what the menu suite needs: menu items are made of
+// ingredients.
+type MenuStore interface {
+	service.MenuRepo
+	service.InventoryRepo
+}
+
+// OrderStore is what the order suite needs: orders are made of menu items
+// and consume ingredients.
+type OrderStore interface {
+	service.OrderRepo
+	service.MenuRepo
+	service.InventoryRepo
+}
+
+// DiscountStore is what the discount suite needs: orders that spend a
+// customer's points and use promotions, and refunds that take earned points
+// back.
+type DiscountStore interface {
+	OrderStore
+	service.CustomerRepo
+	service.LoyaltyRepo
+	service.PromotionRepo
+	service.RefundRepo
+}
+
+// concurrency is how many goroutines the concurrency checks start.
+const concurrency = 20
+
+var names atomic.Int64
+
+// uniqueName returns a name no other row created by the suites has.
+func uniqueName(t *testing.T, prefix string) string {
+	return fmt.Sprintf("%s %s %d-%d", prefix, t.Name(), time.Now().UnixNano(), names.Add(1))
+}
+
+func saveIngredient(t *testing.T, repo service.InventoryRepo, quantity float64) models.InventoryItem {
+	t.Helper()
+	item := models.InventoryItem{
+		Name:         uniqueName(t, "ingredient"),
+		Quantity:     quantity,
+		Unit:         "g",
+		ReorderLevel: 10,
+		TargetLevel:  100,
+	}
+	id, err := repo.SaveInventory(context.Background(), item)
+	if err != nil {
+		t.Fatalf("SaveInventory: %v", err)
+	}
+	item.IngredientID = id
+	return item
+}
+
+func quantityOf(t *testing.T, repo service.InventoryRepo, id int64) float64 {
+	t.Helper()
+	item, err := repo.GetInventory(context.Background(), id)
+	if err != nil {
+		t.Fatalf("GetInventory(%d): %v", id, err)
+	}
+	return item.Quantity
+}
+
+func expectQuantity(t *testing.T, repo service.InventoryRepo, id int64, want float64) {
+	t.Helper()
+	if got := quantityOf(t, repo, id); got != want {
+		t.Errorf("quantity of ingredient %d = %g, want %g", id, got, want)
+	}
+}
+
+func saveMenu(t *testing.T, repo service.MenuRepo, ingredient models.InventoryItem, per float64) models.MenuItem {
+	t.Helper()
+	menu := models.MenuItem{
+		Name:        uniqueName(t, "menu"),
+		Description: "made by the conformance suite",
+		Category:    "coffee",
+		Price:       money.Amount(350),
+		Ingredients: []models.MenuItemIngredient{{IngredientID: ingredient.IngredientID, Quantity: per}},
+	}
+	id, err := repo.SaveMenu(context.Background(), menu)
+	if err != nil {
+		t.Fatalf("SaveMenu: %v", err)
+	}
+	menu.ID = id
+	return menu
+}
+
+func expectErr(t *testing.T, op string, err, want error) {
+	t.Helper()
+	if !errors.Is(err, want) {
+		t.Errorf("%s: err = %v, want %v", op, err, want)
+	}
+}
+
+func expectShortage(t *testing.T, op string, err error) {
+	t.Helper()
+	var shortage *models.InsufficientIngredientsError
+	if !errors.As(err, &shortage) {
+		t.Errorf("%s: err = %v, want *models.InsufficientIngredientsError", op, err)
+	}
+}
+
+// missingID is an ID no backend hands out.
+const missingID int64 = 1 << 60
+
+// runConcurrently calls fn from concurrency goroutines at once and returns
+// how many calls succeeded.
+func runConcurrently(fn func(i int) error) int {
+	var wg sync.WaitGroup
+	var succeeded atomic.Int64
+	start := make(chan struct{})
+	for i := range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			if fn(i) == nil {
+				succeeded.Add(1)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+	return int(succeeded.Load())
+}
+
+// filterIDs keeps the IDs of got that are in want, in the order of got.
+func filterIDs(got []int64, want ...int64) []int64 {
+	return slices.DeleteFunc(got, func(id int64) bool { return !slices.Contains(want, id) })
+}
+
+func orderIDs(orders []models.Order) []int64 {
+	ids := make([]int64, 0, len(orders))
+	for _, o := range orders {
+		ids = append(ids, o.ID)
+	}
+	return ids
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/weeweeshka/hot-coffee/internal/audit"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"log/slog"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+type AuditImpl struct {
+	logr *slog.Logger
+	repo AuditRepo
+}
+
+type AuditRepo interface {
+	SaveAuditEntry(ctx context.Context, entry models.AuditEntry) (int64, error)
+	// GetAuditLog lists the entries matching the filter, newest first.
+	GetAuditLog(ctx context.Context, filter models.AuditFilter) ([]models.AuditEntry, error)
+}
+
+// AuditRecorder records who changed an entity and how. It takes the actor
+// and request ID from ctx.
+type AuditRecorder interface {
+	Record(ctx context.Context, action models.AuditAction, entity models.AuditEntity, id int64, before, after any)
+}
+
+func NewAuditService(logr *slog.Logger, repo AuditRepo) *AuditImpl {
+	return &AuditImpl{logr: logr, repo: repo}
+}
+
+// Record stores the change after it has been made. A failure does not undo
+// the change; it is logged with the diff so it can be entered by hand.
+func (a *AuditImpl) Record(ctx context.Context, action models.AuditAction, entity models.AuditEntity, id int64, before, after any) {
+	entry := models.AuditEntry{
+		Actor:      audit.Actor(ctx),
+		Action:     action,
+		EntityType: entity,
+		EntityID:   id,
+		RequestID:  audit.RequestID(ctx),
+	}
+
+	diff, err := audit.Diff(before, after)
+	if err != nil {
+		a.logr.Error("Failed to record audit entry", "action", action, "entity_type", entity, "entity_id", id, "err", err)
+		return
+	}
+	entry.Diff = diff
+
+	// The change is made by now, so it is recorded even if the client has
+	// gone away.
+	if _, err = a.repo.SaveAuditEntry(context.WithoutCancel(ctx), entry); err != nil {
+		a.logr.Error("Failed to record audit entry", "action", action, "entity_type", entity, "entity_id", id,
+			"actor", entry.Actor.Username, "request_id", entry.RequestID, "diff", string(diff), "err", err)
+	}
+}
+
+func (a *AuditImpl) GetAuditLog(ctx context.Context, filter models.AuditFilter) ([]models.AuditEntry, error) {
+	switch {
+	case filter.Limit < 0 || filter.Limit > maxAuditLimit:
+		err := fmt.Errorf("%w: limit must be between 1 and %d", models.ErrInvalidAuditFilter, maxAuditLimit)
+		a.logr.Info("Audit Get Error", "err", err)
+		return nil, err
+	case filter.Limit == 0:
+		filter.Limit = defaultAuditLimit
+	}
+
+	entries, err := a.repo.GetAuditLog(ctx, filter)
+	if err != nil {
+		a.logr.Info("Audit Get Error", "err", err)
+		return nil, err
+	}
+	return entries, nil
+}
+
+// record is Record on recorder, which may be nil when nothing is audited.
+func record(ctx context.Context, recorder AuditRecorder, action models.AuditAction, entity models.AuditEntity, id int64, before, after any) {
+	if recorder == nil {
+		return
+	}
+	recorder.Record(ctx, action, entity, id, before, after)
+}
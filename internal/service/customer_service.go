@@ -0,0 +1,206 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"log/slog"
+	"strings"
+)
+
+type CustomerImpl struct {
+	logr   *slog.Logger
+	repo   CustomerRepo
+	orders OrderCreator
+}
+
+type CustomerRepo interface {
+	SaveCustomer(ctx context.Context, data models.Customer) (int64, error)
+	GetAllCustomers(ctx context.Context) ([]models.Customer, error)
+	GetCustomer(ctx context.Context, id int64) (models.Customer, error)
+	UpdateCustomer(ctx context.Context, id int64, customer models.Customer) (models.Customer, error)
+	DeleteCustomer(ctx context.Context, id int64) error
+	// GetCustomerOrders lists the customer's orders, newest first.
+	GetCustomerOrders(ctx context.Context, id int64) ([]models.Order, error)
+	SaveFavorite(ctx context.Context, data models.FavoriteOrder) (int64, error)
+	GetFavorites(ctx context.Context, customerID int64) ([]models.FavoriteOrder, error)
+	GetFavorite(ctx context.Context, customerID, favoriteID int64) (models.FavoriteOrder, error)
+	DeleteFavorite(ctx context.Context, customerID, favoriteID int64) error
+}
+
+// OrderCreator places orders on behalf of other services.
+type OrderCreator interface {
+	CreateOrder(ctx context.Context, data models.OrderRequest) (int64, error)
+}
+
+func NewCustomerService(logr *slog.Logger, repo CustomerRepo, orders OrderCreator) *CustomerImpl {
+	return &CustomerImpl{
+		logr:   logr,
+		repo:   repo,
+		orders: orders,
+	}
+}
+
+func (c *CustomerImpl) CreateCustomer(ctx context.Context, customer models.Customer) (int64, error) {
+	customer, err := validateCustomer(customer)
+	if err != nil {
+		c.logr.Info("Customer Create Error", "err", err)
+		return 0, err
+	}
+
+	id, err := c.repo.SaveCustomer(ctx, customer)
+	if err != nil {
+		c.logr.Info("Customer Create Error", "err", err)
+		return 0, err
+	}
+	return id, nil
+}
+
+func (c *CustomerImpl) GetCustomers(ctx context.Context) ([]models.Customer, error) {
+	customers, err := c.repo.GetAllCustomers(ctx)
+	if err != nil {
+		c.logr.Info("Customer Get All Error", "err", err)
+		return []models.Customer{}, err
+	}
+	return customers, nil
+}
+
+func (c *CustomerImpl) GetCustomer(ctx context.Context, id int64) (models.Customer, error) {
+	customer, err := c.repo.GetCustomer(ctx, id)
+	if err != nil {
+		c.logr.Info("Customer Get Error", "err", err)
+		return models.Customer{}, err
+	}
+	return customer, nil
+}
+
+func (c *CustomerImpl) UpdateCustomer(ctx context.Context, id int64, customer models.Customer) (models.Customer, error) {
+	customer, err := validateCustomer(customer)
+	if err != nil {
+		c.logr.Info("Customer Update Error", "err", err)
+		return models.Customer{}, err
+	}
+
+	nCustomer, err := c.repo.UpdateCustomer(ctx, id, customer)
+	if err != nil {
+		c.logr.Info("Customer Update Error", "err", err)
+		return models.Customer{}, err
+	}
+	return nCustomer, nil
+}
+
+func (c *CustomerImpl) DeleteCustomer(ctx context.Context, id int64) error {
+	err := c.repo.DeleteCustomer(ctx, id)
+	if err != nil {
+		c.logr.Info("Customer Delete Error", "err", err)
+	}
+	return err
+}
+
+func (c *CustomerImpl) GetCustomerOrders(ctx context.Context, id int64) ([]models.Order, error) {
+	orders, err := c.repo.GetCustomerOrders(ctx, id)
+	if err != nil {
+		c.logr.Info("Customer Orders Error", "err", err)
+		return []models.Order{}, err
+	}
+	return orders, nil
+}
+
+func (c *CustomerImpl) SaveFavorite(ctx context.Context, customerID int64, favorite models.FavoriteOrder) (int64, error) {
+	if _, err := c.repo.GetCustomer(ctx, customerID); err != nil {
+		c.logr.Info("Favorite Save Error", "err", err)
+		return 0, err
+	}
+
+	if favorite.Name == "" {
+		favorite.Name = "usual"
+	}
+	if err := validateFavoriteItems(favorite.Items); err != nil {
+		c.logr.Info("Favorite Save Error", "err", err)
+		return 0, err
+	}
+
+	favorite.CustomerID = customerID
+	id, err := c.repo.SaveFavorite(ctx, favorite)
+	if err != nil {
+		c.logr.Info("Favorite Save Error", "err", err)
+		return 0, err
+	}
+	return id, nil
+}
+
+func (c *CustomerImpl) GetFavorites(ctx context.Context, customerID int64) ([]models.FavoriteOrder, error) {
+	if _, err := c.repo.GetCustomer(ctx, customerID); err != nil {
+		c.logr.Info("Favorites Get Error", "err", err)
+		return []models.FavoriteOrder{}, err
+	}
+
+	favorites, err := c.repo.GetFavorites(ctx, customerID)
+	if err != nil {
+		c.logr.Info("Favorites Get Error", "err", err)
+		return []models.FavoriteOrder{}, err
+	}
+	return favorites, nil
+}
+
+func (c *CustomerImpl) DeleteFavorite(ctx context.Context, customerID, favoriteID int64) error {
+	err := c.repo.DeleteFavorite(ctx, customerID, favoriteID)
+	if err != nil {
+		c.logr.Info("Favorite Delete Error", "err", err)
+	}
+	return err
+}
+
+// Reorder places a new order for the customer from one of their favorites.
+func (c *CustomerImpl) Reorder(ctx context.Context, customerID, favoriteID int64) (int64, error) {
+	customer, err := c.repo.GetCustomer(ctx, customerID)
+	if err != nil {
+		c.logr.Info("Reorder Error", "err", err)
+		return 0, err
+	}
+
+	favorite, err := c.repo.GetFavorite(ctx, customerID, favoriteID)
+	if err != nil {
+		c.logr.Info("Reorder Error", "err", err)
+		return 0, err
+	}
+
+	id, err := c.orders.CreateOrder(ctx, models.OrderRequest{
+		CustomerID:   &customer.ID,
+		CustomerName: customer.Name,
+		Items:        favorite.Items,
+	})
+	if err != nil {
+		c.logr.Info("Reorder Error", "err", err)
+		return 0, err
+	}
+	return id, nil
+}
+
+func validateCustomer(customer models.Customer) (models.Customer, error) {
+	customer.Name = strings.TrimSpace(customer.Name)
+	customer.Phone = strings.TrimSpace(customer.Phone)
+	customer.Email = strings.ToLower(strings.TrimSpace(customer.Email))
+
+	if customer.Name == "" {
+		return customer, fmt.Errorf("%w: name is required", models.ErrInvalidCustomer)
+	}
+	if customer.Email != "" && !strings.Contains(customer.Email, "@") {
+		return customer, fmt.Errorf("%w: invalid email", models.ErrInvalidCustomer)
+	}
+	return customer, nil
+}
+
+// validateFavoriteItems only checks the shape of the items; the menu is
+// checked when the favorite is ordered, since it may change in between.
+func validateFavoriteItems(items []models.OrderItem) error {
+	if len(items) == 0 {
+		return fmt.Errorf("%w: favorite has no items", models.ErrInvalidCustomer)
+	}
+	for _, item := range items {
+		if item.Quantity <= 0 {
+			return fmt.Errorf("%w: product %d has quantity %d", models.ErrInvalidCustomer, item.ProductID, item.Quantity)
+		}
+	}
+	return nil
+}
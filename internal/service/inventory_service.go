@@ -2,13 +2,17 @@ package service
 
 import (
 	"context"
+	"fmt"
 	"github.com/weeweeshka/hot-coffee/internal/models"
+	"github.com/weeweeshka/hot-coffee/internal/units"
 	"log/slog"
+	"time"
 )
 
 type InventoryImpl struct {
-	logr *slog.Logger
-	repo InventoryRepo
+	logr  *slog.Logger
+	repo  InventoryRepo
+	audit AuditRecorder
 }
 
 type InventoryRepo interface {
@@ -17,32 +21,51 @@ type InventoryRepo interface {
 	GetInventory(ctx context.Context, id int64) (models.InventoryItem, error)
 	UpdateInventory(ctx context.Context, id int64, inventory models.InventoryItem) (models.InventoryItem, error)
 	DeleteInventory(ctx context.Context, id int64) error
+	// AddInventoryTransaction applies the delta to the item and appends it to
+	// the ledger, refusing movements that would make the stock negative.
+	AddInventoryTransaction(ctx context.Context, t models.InventoryTransaction) (models.InventoryTransaction, error)
+	// GetInventoryHistory lists movements in [from, to); zero bounds are open.
+	GetInventoryHistory(ctx context.Context, id int64, from, to time.Time) ([]models.InventoryTransaction, error)
+	// GetLowStock lists the items whose quantity is below their reorder level.
+	GetLowStock(ctx context.Context) ([]models.InventoryItem, error)
 }
 
-func NewInventoryService(logr *slog.Logger, repo InventoryRepo) *InventoryImpl {
+// NewInventoryService records changes to the inventory with audit, which
+// may be nil.
+func NewInventoryService(logr *slog.Logger, repo InventoryRepo, audit AuditRecorder) *InventoryImpl {
 	return &InventoryImpl{
-		logr: logr,
-		repo: repo,
+		logr:  logr,
+		repo:  repo,
+		audit: audit,
 	}
 }
 
 func (s *InventoryImpl) CreateInventory(ctx context.Context, inventory models.InventoryItem) (int64, error) {
 
+	inventory, err := validateInventory(inventory)
+	if err != nil {
+		s.logr.Info("Error creating inventory", "err", err)
+		return 0, err
+	}
+
 	id, err := s.repo.SaveInventory(ctx, inventory)
 	if err != nil {
-		s.logr.Info("Error creating inventory", err)
+		s.logr.Info("Error creating inventory", "err", err)
 		return 0, err
 	}
+
+	inventory.IngredientID = id
+	record(ctx, s.audit, models.AuditCreate, models.EntityInventory, id, nil, inventory)
 	return id, nil
 }
 
-func (s *InventoryImpl) GetAllInventories(ctx context.Context) ([]models.InventoryItem, error) {
+func (s *InventoryImpl) GetInventories(ctx context.Context) ([]models.InventoryItem, error) {
 
 	var inventories []models.InventoryItem
 
 	inventories, err := s.repo.GetAllInventories(ctx)
 	if err != nil {
-		s.logr.Info("Error getting inventory", err)
+		s.logr.Info("Error getting inventory", "err", err)
 		return []models.InventoryItem{}, err
 	}
 
@@ -53,27 +76,158 @@ func (s *InventoryImpl) GetInventory(ctx context.Context, id int64) (models.Inve
 
 	inventory, err := s.repo.GetInventory(ctx, id)
 	if err != nil {
-		s.logr.Info("Error getting inventory", err)
+		s.logr.Info("Error getting inventory", "err", err)
 		return models.InventoryItem{}, err
 	}
 	return inventory, nil
 }
 
 func (s *InventoryImpl) UpdateInventory(ctx context.Context, id int64, inventory models.InventoryItem) (models.InventoryItem, error) {
+	inventory, err := validateInventory(inventory)
+	if err != nil {
+		s.logr.Info("Error updating inventory", "err", err)
+		return models.InventoryItem{}, err
+	}
+
+	before, err := s.repo.GetInventory(ctx, id)
+	if err != nil {
+		s.logr.Info("Error updating inventory", "err", err)
+		return models.InventoryItem{}, err
+	}
+
 	var nInventory models.InventoryItem
-	nInventory, err := s.repo.UpdateInventory(ctx, id, inventory)
+	nInventory, err = s.repo.UpdateInventory(ctx, id, inventory)
 	if err != nil {
-		s.logr.Info("Error updating inventory", err)
+		s.logr.Info("Error updating inventory", "err", err)
 		return models.InventoryItem{}, err
 	}
+
+	record(ctx, s.audit, models.AuditUpdate, models.EntityInventory, id, before, nInventory)
 	return nInventory, nil
 
 }
 func (s *InventoryImpl) DeleteInventory(ctx context.Context, id int64) error {
-	err := s.repo.DeleteInventory(ctx, id)
+	before, err := s.repo.GetInventory(ctx, id)
 	if err != nil {
-		s.logr.Info("Error deleting inventory", err)
+		s.logr.Info("Error deleting inventory", "err", err)
 		return err
 	}
+
+	err = s.repo.DeleteInventory(ctx, id)
+	if err != nil {
+		s.logr.Info("Error deleting inventory", "err", err)
+		return err
+	}
+
+	record(ctx, s.audit, models.AuditDelete, models.EntityInventory, id, before, nil)
+	return nil
+}
+
+func (s *InventoryImpl) RecordMovement(ctx context.Context, id int64, movement models.InventoryMovementRequest) (models.InventoryTransaction, error) {
+	if err := validateMovement(movement); err != nil {
+		s.logr.Info("Error recording inventory movement", "err", err)
+		return models.InventoryTransaction{}, err
+	}
+
+	t, err := s.repo.AddInventoryTransaction(ctx, models.InventoryTransaction{
+		IngredientID: id,
+		Delta:        movement.Delta,
+		Reason:       movement.Reason,
+		Actor:        movement.Actor,
+		Note:         movement.Note,
+	})
+	if err != nil {
+		s.logr.Info("Error recording inventory movement", "err", err)
+		return models.InventoryTransaction{}, err
+	}
+
+	s.auditMovement(ctx, t)
+	return t, nil
+}
+
+// auditMovement records the quantity the movement left the item with.
+func (s *InventoryImpl) auditMovement(ctx context.Context, t models.InventoryTransaction) {
+	if s.audit == nil {
+		return
+	}
+	after, err := s.repo.GetInventory(ctx, t.IngredientID)
+	if err != nil {
+		s.logr.Error("Failed to audit inventory movement", "id", t.IngredientID, "transaction_id", t.ID, "err", err)
+		return
+	}
+	before := after
+	before.Quantity -= t.Delta
+	s.audit.Record(ctx, models.AuditMovement, models.EntityInventory, t.IngredientID, before, after)
+}
+
+func (s *InventoryImpl) GetInventoryHistory(ctx context.Context, id int64, from, to time.Time) ([]models.InventoryTransaction, error) {
+	history, err := s.repo.GetInventoryHistory(ctx, id, from, to)
+	if err != nil {
+		s.logr.Info("Error getting inventory history", "err", err)
+		return []models.InventoryTransaction{}, err
+	}
+	return history, nil
+}
+
+func (s *InventoryImpl) GetLowStock(ctx context.Context) ([]models.LowStockItem, error) {
+	items, err := s.repo.GetLowStock(ctx)
+	if err != nil {
+		s.logr.Info("Error getting low stock", "err", err)
+		return []models.LowStockItem{}, err
+	}
+
+	lowStock := make([]models.LowStockItem, 0, len(items))
+	for _, item := range items {
+		lowStock = append(lowStock, models.LowStockItem{InventoryItem: item, ReorderAmount: item.ReorderAmount()})
+	}
+	return lowStock, nil
+}
+
+// validateInventory checks the item and normalises its unit to the symbol
+// the units package knows it by.
+func validateInventory(item models.InventoryItem) (models.InventoryItem, error) {
+	if item.Name == "" {
+		return item, fmt.Errorf("%w: name is required", models.ErrInvalidInventory)
+	}
+	if item.Quantity < 0 {
+		return item, fmt.Errorf("%w: quantity must not be negative", models.ErrInvalidInventory)
+	}
+	if item.ReorderLevel < 0 || item.TargetLevel < 0 {
+		return item, fmt.Errorf("%w: stock levels must not be negative", models.ErrInvalidInventory)
+	}
+	if item.TargetLevel != 0 && item.TargetLevel < item.ReorderLevel {
+		return item, fmt.Errorf("%w: target level is below reorder level", models.ErrInvalidInventory)
+	}
+	if item.Density < 0 {
+		return item, fmt.Errorf("%w: density must not be negative", models.ErrInvalidInventory)
+	}
+
+	unit, err := units.Parse(item.Unit)
+	if err != nil {
+		return item, fmt.Errorf("%w: %v", models.ErrInvalidInventory, err)
+	}
+	item.Unit = unit.Symbol
+	return item, nil
+}
+
+// validateMovement accepts the reasons staff may book by hand. Order
+// consumption and its reversal are only written by the order flow.
+func validateMovement(m models.InventoryMovementRequest) error {
+	switch m.Reason {
+	case models.ReasonRestock:
+		if m.Delta <= 0 {
+			return fmt.Errorf("%w: restock must be positive", models.ErrInvalidMovement)
+		}
+	case models.ReasonWaste:
+		if m.Delta >= 0 {
+			return fmt.Errorf("%w: waste must be negative", models.ErrInvalidMovement)
+		}
+	case models.ReasonAdjustment, models.ReasonCountCorrection:
+		if m.Delta == 0 {
+			return fmt.Errorf("%w: delta must not be zero", models.ErrInvalidMovement)
+		}
+	default:
+		return fmt.Errorf("%w: unsupported reason %q", models.ErrInvalidMovement, m.Reason)
+	}
 	return nil
 }
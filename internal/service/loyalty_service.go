@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"github.com/weeweeshka/hot-coffee/internal/money"
+	"log/slog"
+	"math"
+)
+
+type LoyaltyImpl struct {
+	logr      *slog.Logger
+	repo      LoyaltyRepo
+	customers CustomerLookup
+	rule      models.LoyaltyRule
+}
+
+type LoyaltyRepo interface {
+	GetLoyaltyBalance(ctx context.Context, customerID int64) (int64, error)
+	GetLoyaltyHistory(ctx context.Context, customerID int64) ([]models.LoyaltyEntry, error)
+	GetRedemptions(ctx context.Context, customerID int64) ([]models.LoyaltyRedemption, error)
+	// GetOrderRedemptions lists the redemptions made on the orders, in one
+	// query however many orders are asked for.
+	GetOrderRedemptions(ctx context.Context, orderIDs ...int64) ([]models.LoyaltyRedemption, error)
+	// UndoRedemption returns the redemption's points, failing with
+	// models.ErrRedemptionUndone when it was already undone and with
+	// models.ErrOrderClosed unless models.CanUndoRedemption allows the status
+	// of the order, which is checked under the order's lock.
+	UndoRedemption(ctx context.Context, id int64) (models.LoyaltyRedemption, error)
+}
+
+// NewLoyaltyService runs the program under rule, which the caller is expected
+// to have checked with models.LoyaltyRule.Validate.
+func NewLoyaltyService(logr *slog.Logger, repo LoyaltyRepo, customers CustomerLookup, rule models.LoyaltyRule) *LoyaltyImpl {
+	return &LoyaltyImpl{
+		logr:      logr,
+		repo:      repo,
+		customers: customers,
+		rule:      rule,
+	}
+}
+
+func (l *LoyaltyImpl) GetLoyalty(ctx context.Context, customerID int64) (models.LoyaltyAccount, error) {
+	if _, err := l.customers.GetCustomer(ctx, customerID); err != nil {
+		l.logr.Info("Loyalty Get Error", "err", err)
+		return models.LoyaltyAccount{}, err
+	}
+
+	balance, err := l.repo.GetLoyaltyBalance(ctx, customerID)
+	if err != nil {
+		l.logr.Info("Loyalty Get Error", "err", err)
+		return models.LoyaltyAccount{}, err
+	}
+	history, err := l.repo.GetLoyaltyHistory(ctx, customerID)
+	if err != nil {
+		l.logr.Info("Loyalty Get Error", "err", err)
+		return models.LoyaltyAccount{}, err
+	}
+	redemptions, err := l.repo.GetRedemptions(ctx, customerID)
+	if err != nil {
+		l.logr.Info("Loyalty Get Error", "err", err)
+		return models.LoyaltyAccount{}, err
+	}
+
+	return models.LoyaltyAccount{
+		CustomerID:  customerID,
+		Balance:     balance,
+		Rule:        l.rule,
+		History:     history,
+		Redemptions: redemptions,
+	}, nil
+}
+
+func (l *LoyaltyImpl) UndoRedemption(ctx context.Context, customerID, redemptionID int64) (models.LoyaltyRedemption, error) {
+	redemptions, err := l.repo.GetRedemptions(ctx, customerID)
+	if err != nil {
+		l.logr.Info("Loyalty Undo Error", "err", err)
+		return models.LoyaltyRedemption{}, err
+	}
+
+	owned := false
+	for _, r := range redemptions {
+		owned = owned || r.ID == redemptionID
+	}
+	if !owned {
+		l.logr.Info("Loyalty Undo Error", "err", models.ErrNotFound)
+		return models.LoyaltyRedemption{}, models.ErrNotFound
+	}
+
+	r, err := l.repo.UndoRedemption(ctx, redemptionID)
+	if err != nil {
+		l.logr.Info("Loyalty Undo Error", "err", err)
+		return models.LoyaltyRedemption{}, err
+	}
+	return r, nil
+}
+
+// quote prices a redemption request against the priced lines of the order
+// being created, of which payable is still left to pay after other
+// discounts. The result is saved with the order, which gives it its order id.
+func (l *LoyaltyImpl) quote(data models.OrderRequest, lines []models.PricedLine, payable money.Amount) (models.LoyaltyRedemption, error) {
+	req := data.Redeem
+	if data.CustomerID == nil {
+		return models.LoyaltyRedemption{}, fmt.Errorf("%w: only customers can redeem points", models.ErrInvalidRedemption)
+	}
+	r := models.LoyaltyRedemption{CustomerID: *data.CustomerID, Reward: req.Reward}
+
+	switch req.Reward {
+	case models.RewardFreeItem:
+		if l.rule.FreeItemPoints == 0 {
+			return models.LoyaltyRedemption{}, fmt.Errorf("%w: free items are not offered", models.ErrInvalidRedemption)
+		}
+		// The cheapest matching line is free, modifiers included.
+		found := false
+		for _, line := range lines {
+			if line.ProductID != req.ProductID || line.VariantID != req.VariantID {
+				continue
+			}
+			if !found || line.UnitPrice < r.Value {
+				r.Value = line.UnitPrice
+			}
+			found = true
+		}
+		if !found {
+			return models.LoyaltyRedemption{}, fmt.Errorf("%w: product %d is not on the order", models.ErrInvalidRedemption, req.ProductID)
+		}
+		r.ProductID, r.VariantID = req.ProductID, req.VariantID
+		r.Points = l.rule.FreeItemPoints
+		r.Value = min(r.Value, payable)
+
+	case models.RewardDiscount:
+		if l.rule.PointValue == 0 {
+			return models.LoyaltyRedemption{}, fmt.Errorf("%w: discounts are not offered", models.ErrInvalidRedemption)
+		}
+		if req.Points <= 0 {
+			return models.LoyaltyRedemption{}, fmt.Errorf("%w: points must be positive", models.ErrInvalidRedemption)
+		}
+		r.Points = req.Points
+		r.Value = l.rule.PointValue * money.Amount(req.Points)
+		if r.Value > payable {
+			return models.LoyaltyRedemption{}, fmt.Errorf("%w: discount %s exceeds order total %s", models.ErrInvalidRedemption, r.Value, payable)
+		}
+
+	default:
+		return models.LoyaltyRedemption{}, fmt.Errorf("%w: unknown reward %q", models.ErrInvalidRedemption, req.Reward)
+	}
+
+	return r, nil
+}
+
+// earned returns the points the customer of an order earns when it closes,
+// of which paid was paid after discounts and before tax. Free items do not
+// earn stamps either.
+func (l *LoyaltyImpl) earned(ctx context.Context, order models.Order, paid money.Amount) (int64, error) {
+	redemptions, err := l.repo.GetOrderRedemptions(ctx, order.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	var earned float64
+	switch l.rule.Mode {
+	case models.EarnPerCurrency:
+		earned = paid.Float64() * l.rule.PointsPerUnit
+	case models.EarnPerItem:
+		var items int
+		for _, item := range order.Items {
+			items += item.Quantity
+		}
+		for _, r := range redemptions {
+			if r.UndoneAt == nil && r.Reward == models.RewardFreeItem {
+				items--
+			}
+		}
+		earned = float64(items) * l.rule.PointsPerUnit
+	}
+
+	return max(int64(math.Floor(earned+1e-9)), 0), nil
+}
+
+// activeRedemptions lists the orders' redemptions that are not undone.
+func (l *LoyaltyImpl) activeRedemptions(ctx context.Context, orderIDs ...int64) ([]models.LoyaltyRedemption, error) {
+	redemptions, err := l.repo.GetOrderRedemptions(ctx, orderIDs...)
+	if err != nil {
+		return nil, err
+	}
+	active := redemptions[:0]
+	for _, r := range redemptions {
+		if r.UndoneAt == nil {
+			active = append(active, r)
+		}
+	}
+	return active, nil
+}
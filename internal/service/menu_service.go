@@ -2,13 +2,19 @@ package service
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/weeweeshka/hot-coffee/internal/models"
+	"github.com/weeweeshka/hot-coffee/internal/units"
 	"log/slog"
+	"strings"
 )
 
 type MenuImpl struct {
-	logr *slog.Logger
-	repo MenuRepo
+	logr      *slog.Logger
+	repo      MenuRepo
+	inventory InventoryRepo
+	audit     AuditRecorder
 }
 
 type MenuRepo interface {
@@ -19,62 +25,308 @@ type MenuRepo interface {
 	DeleteMenu(ctx context.Context, id int64) error
 }
 
-func NewMenuService(logr *slog.Logger, repo MenuRepo) *MenuImpl {
+// NewMenuService records changes to the menu with audit, which may be nil.
+func NewMenuService(logr *slog.Logger, repo MenuRepo, inventory InventoryRepo, audit AuditRecorder) *MenuImpl {
 	return &MenuImpl{
-		logr: logr,
-		repo: repo,
+		logr:      logr,
+		repo:      repo,
+		inventory: inventory,
+		audit:     audit,
 	}
 }
 
 func (m *MenuImpl) CreateMenu(ctx context.Context, menu models.MenuItem) (int64, error) {
 
+	menu, err := m.validateMenu(ctx, menu)
+	if err != nil {
+		m.logr.Info("Menu Create Error", "err", err)
+		return 0, err
+	}
+
 	id, err := m.repo.SaveMenu(ctx, menu)
 	if err != nil {
 		m.logr.Info("Menu Create Error", "err", err)
 		return 0, err
 	}
 
+	menu.ID = id
+	record(ctx, m.audit, models.AuditCreate, models.EntityMenu, id, nil, menu)
 	return id, nil
 }
 
-func (m *MenuImpl) GetMenus(ctx context.Context) ([]models.MenuItem, error) {
+func (m *MenuImpl) GetMenus(ctx context.Context, availableOnly bool) ([]models.MenuResponse, error) {
 
 	var menus []models.MenuItem
 
 	menus, err := m.repo.GetAllMenus(ctx)
 	if err != nil {
 		m.logr.Info("Menu Get All Error", "err", err)
-		return []models.MenuItem{}, err
+		return []models.MenuResponse{}, err
 	}
 
-	return menus, nil
+	book := newRecipeBook(m.repo, m.inventory)
+	if err = book.loadStock(ctx); err != nil {
+		m.logr.Info("Menu Get All Error", "err", err)
+		return []models.MenuResponse{}, err
+	}
+
+	responses := make([]models.MenuResponse, 0, len(menus))
+	for _, menu := range menus {
+		response, err := menuResponse(ctx, book, menu)
+		if err != nil {
+			m.logr.Info("Menu Get All Error", "err", err)
+			return []models.MenuResponse{}, err
+		}
+		if availableOnly && !response.Available {
+			continue
+		}
+		responses = append(responses, response)
+	}
+
+	return responses, nil
 }
 
-func (m *MenuImpl) GetMenu(ctx context.Context, id int64) (models.MenuItem, error) {
+func (m *MenuImpl) GetMenu(ctx context.Context, id int64) (models.MenuResponse, error) {
 
 	var menu models.MenuItem
 	menu, err := m.repo.GetMenu(ctx, id)
 	if err != nil {
 		m.logr.Info("Menu Get Error", "err", err)
-		return models.MenuItem{}, err
+		return models.MenuResponse{}, err
 	}
-	return menu, nil
+
+	response, err := menuResponse(ctx, newRecipeBook(m.repo, m.inventory), menu)
+	if err != nil {
+		m.logr.Info("Menu Get Error", "err", err)
+		return models.MenuResponse{}, err
+	}
+	return response, nil
+}
+
+func menuResponse(ctx context.Context, book *recipeBook, menu models.MenuItem) (models.MenuResponse, error) {
+	response := models.MenuResponse{
+		ID:             menu.ID,
+		Name:           menu.Name,
+		Description:    menu.Description,
+		Category:       menu.Category,
+		Price:          menu.Price,
+		Ingredients:    menu.Ingredients,
+		ModifierGroups: menu.ModifierGroups,
+	}
+
+	if len(menu.Variants) == 0 {
+		servings, err := book.maxServings(ctx, menu.Ingredients)
+		if err != nil {
+			return models.MenuResponse{}, err
+		}
+		response.Available = servings == nil || *servings > 0
+		response.MaxServings = servings
+		return response, nil
+	}
+
+	for i, variant := range menu.Variants {
+		servings, err := book.maxServings(ctx, variant.Ingredients)
+		if err != nil {
+			return models.MenuResponse{}, err
+		}
+
+		available := servings == nil || *servings > 0
+		response.Variants = append(response.Variants, models.MenuVariantResponse{
+			MenuVariant: variant,
+			Available:   available,
+			MaxServings: servings,
+		})
+
+		response.Available = response.Available || available
+		if i == 0 || (response.MaxServings != nil && (servings == nil || *servings > *response.MaxServings)) {
+			response.MaxServings = servings
+		}
+	}
+	return response, nil
 }
 
 func (m *MenuImpl) UpdateMenu(ctx context.Context, id int64, menu models.MenuItem) (models.MenuItem, error) {
 
+	menu, err := m.validateMenu(ctx, menu)
+	if err != nil {
+		m.logr.Info("Menu Update Error", "err", err)
+		return models.MenuItem{}, err
+	}
+
+	before, err := m.repo.GetMenu(ctx, id)
+	if err != nil {
+		m.logr.Info("Menu Update Error", "err", err)
+		return models.MenuItem{}, err
+	}
+
 	var nMenu models.MenuItem
-	nMenu, err := m.repo.UpdateMenu(ctx, id, menu)
+	nMenu, err = m.repo.UpdateMenu(ctx, id, menu)
 	if err != nil {
 		m.logr.Info("Menu Update Error", "err", err)
+		return nMenu, err
 	}
-	return nMenu, err
+
+	record(ctx, m.audit, models.AuditUpdate, models.EntityMenu, id, before, nMenu)
+	return nMenu, nil
 }
 
 func (m *MenuImpl) DeleteMenu(ctx context.Context, id int64) error {
-	err := m.repo.DeleteMenu(ctx, id)
+	before, err := m.repo.GetMenu(ctx, id)
+	if err != nil {
+		m.logr.Info("Menu Delete Error", "err", err)
+		return err
+	}
+
+	err = m.repo.DeleteMenu(ctx, id)
 	if err != nil {
 		m.logr.Info("Menu Delete Error", "err", err)
+		return err
 	}
-	return err
+
+	record(ctx, m.audit, models.AuditDelete, models.EntityMenu, id, before, nil)
+	return nil
+}
+
+// validateMenu checks that every recipe line names a stocked ingredient in a
+// unit that converts to the unit it is stocked in, and normalises the units.
+func (m *MenuImpl) validateMenu(ctx context.Context, menu models.MenuItem) (models.MenuItem, error) {
+	if menu.Name == "" {
+		return menu, fmt.Errorf("%w: name is required", models.ErrInvalidMenu)
+	}
+	if menu.Price < 0 {
+		return menu, fmt.Errorf("%w: price must not be negative", models.ErrInvalidMenu)
+	}
+	menu.Category = strings.TrimSpace(menu.Category)
+
+	ingredients, err := m.validateRecipe(ctx, menu.Ingredients)
+	if err != nil {
+		return menu, err
+	}
+	menu.Ingredients = ingredients
+
+	names := make(map[string]bool, len(menu.Variants))
+	variants := make([]models.MenuVariant, 0, len(menu.Variants))
+	for _, variant := range menu.Variants {
+		if variant.Name == "" {
+			return menu, fmt.Errorf("%w: variant name is required", models.ErrInvalidMenu)
+		}
+		if names[variant.Name] {
+			return menu, fmt.Errorf("%w: duplicate variant %q", models.ErrInvalidMenu, variant.Name)
+		}
+		names[variant.Name] = true
+
+		if variant.Price < 0 {
+			return menu, fmt.Errorf("%w: variant %q has a negative price", models.ErrInvalidMenu, variant.Name)
+		}
+		if variant.Ingredients, err = m.validateRecipe(ctx, variant.Ingredients); err != nil {
+			return menu, err
+		}
+		variants = append(variants, variant)
+	}
+	if len(variants) > 0 {
+		menu.Variants = variants
+	}
+
+	if menu.ModifierGroups, err = m.validateModifierGroups(ctx, menu.ModifierGroups); err != nil {
+		return menu, err
+	}
+	return menu, nil
+}
+
+func (m *MenuImpl) validateModifierGroups(ctx context.Context, groups []models.ModifierGroup) ([]models.ModifierGroup, error) {
+	if len(groups) == 0 {
+		return groups, nil
+	}
+
+	names := make(map[string]bool, len(groups))
+	validated := make([]models.ModifierGroup, 0, len(groups))
+	for _, group := range groups {
+		if group.Name == "" {
+			return nil, fmt.Errorf("%w: modifier group name is required", models.ErrInvalidMenu)
+		}
+		if names[group.Name] {
+			return nil, fmt.Errorf("%w: duplicate modifier group %q", models.ErrInvalidMenu, group.Name)
+		}
+		names[group.Name] = true
+
+		if group.MinSelect < 0 || group.MaxSelect < 0 || (group.MaxSelect > 0 && group.MinSelect > group.MaxSelect) {
+			return nil, fmt.Errorf("%w: modifier group %q has invalid selection limits", models.ErrInvalidMenu, group.Name)
+		}
+		if group.MinSelect > len(group.Modifiers) {
+			return nil, fmt.Errorf("%w: modifier group %q needs more modifiers than it has", models.ErrInvalidMenu, group.Name)
+		}
+
+		modifierNames := make(map[string]bool, len(group.Modifiers))
+		modifiers := make([]models.Modifier, 0, len(group.Modifiers))
+		for _, modifier := range group.Modifiers {
+			if modifier.Name == "" {
+				return nil, fmt.Errorf("%w: modifier name is required in group %q", models.ErrInvalidMenu, group.Name)
+			}
+			if modifierNames[modifier.Name] {
+				return nil, fmt.Errorf("%w: duplicate modifier %q in group %q", models.ErrInvalidMenu, modifier.Name, group.Name)
+			}
+			modifierNames[modifier.Name] = true
+
+			var err error
+			if modifier.Ingredients, err = m.validateDeltas(ctx, modifier.Ingredients); err != nil {
+				return nil, err
+			}
+			modifiers = append(modifiers, modifier)
+		}
+		group.Modifiers = modifiers
+		validated = append(validated, group)
+	}
+	return validated, nil
+}
+
+func (m *MenuImpl) validateRecipe(ctx context.Context, recipe []models.MenuItemIngredient) ([]models.MenuItemIngredient, error) {
+	for _, ingredient := range recipe {
+		if ingredient.Quantity <= 0 {
+			return nil, fmt.Errorf("%w: ingredient %d has quantity %g", models.ErrInvalidMenu, ingredient.IngredientID, ingredient.Quantity)
+		}
+	}
+	return m.validateDeltas(ctx, recipe)
+}
+
+// validateDeltas validates recipe lines that may also take ingredients out,
+// as modifiers do.
+func (m *MenuImpl) validateDeltas(ctx context.Context, recipe []models.MenuItemIngredient) ([]models.MenuItemIngredient, error) {
+	ingredients := make([]models.MenuItemIngredient, 0, len(recipe))
+	for _, ingredient := range recipe {
+		ingredient, err := m.validateIngredient(ctx, ingredient)
+		if err != nil {
+			return nil, err
+		}
+		ingredients = append(ingredients, ingredient)
+	}
+	return ingredients, nil
+}
+
+func (m *MenuImpl) validateIngredient(ctx context.Context, ingredient models.MenuItemIngredient) (models.MenuItemIngredient, error) {
+	if ingredient.Quantity == 0 {
+		return ingredient, fmt.Errorf("%w: ingredient %d has no quantity", models.ErrInvalidMenu, ingredient.IngredientID)
+	}
+
+	item, err := m.inventory.GetInventory(ctx, ingredient.IngredientID)
+	if errors.Is(err, models.ErrNotFound) {
+		return ingredient, fmt.Errorf("%w: unknown ingredient %d", models.ErrInvalidMenu, ingredient.IngredientID)
+	}
+	if err != nil {
+		return ingredient, err
+	}
+
+	if ingredient.Unit == "" {
+		return ingredient, nil
+	}
+
+	unit, err := units.Parse(ingredient.Unit)
+	if err != nil {
+		return ingredient, fmt.Errorf("%w: ingredient %d: %v", models.ErrInvalidMenu, ingredient.IngredientID, err)
+	}
+	if _, err = units.Convert(ingredient.Quantity, unit.Symbol, item.Unit, item.Density); err != nil {
+		return ingredient, fmt.Errorf("%w: ingredient %d: %v", models.ErrInvalidMenu, ingredient.IngredientID, err)
+	}
+
+	ingredient.Unit = unit.Symbol
+	return ingredient, nil
 }
@@ -2,96 +2,711 @@ package service
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/weeweeshka/hot-coffee/internal/models"
+	"github.com/weeweeshka/hot-coffee/internal/money"
 	"log/slog"
+	"slices"
+	"sort"
+	"time"
+)
+
+const (
+	defaultOrderLimit = 50
+	maxOrderLimit     = 500
 )
 
 type OrderImpl struct {
-	logr *slog.Logger
-	repo OrderRepo
+	logr       *slog.Logger
+	repo       OrderRepo
+	menu       MenuRepo
+	inventory  InventoryRepo
+	observer   ConsumptionObserver
+	customers  CustomerLookup
+	loyalty    *LoyaltyImpl
+	promotions *PromotionImpl
+	pricing    models.PricingRules
+	payments   PaymentLedger
+	audit      AuditRecorder
+}
+
+// CustomerLookup resolves the customer an order is placed for.
+type CustomerLookup interface {
+	GetCustomer(ctx context.Context, id int64) (models.Customer, error)
+}
+
+// ConsumptionObserver is told which ingredients every new order consumed.
+type ConsumptionObserver interface {
+	OrderConsumed(orderID int64, changes []models.StockChange)
+}
+
+type OrderOption func(*OrderImpl)
+
+func WithConsumptionObserver(observer ConsumptionObserver) OrderOption {
+	return func(o *OrderImpl) {
+		o.observer = observer
+	}
+}
+
+// WithCustomers lets orders reference customer profiles. Without it
+// customer_id is rejected.
+func WithCustomers(customers CustomerLookup) OrderOption {
+	return func(o *OrderImpl) {
+		o.customers = customers
+	}
+}
+
+// WithLoyalty lets customers earn points when their orders close and redeem
+// them when they order.
+func WithLoyalty(loyalty *LoyaltyImpl) OrderOption {
+	return func(o *OrderImpl) {
+		o.loyalty = loyalty
+	}
+}
+
+// WithPromotions lets orders apply promo codes.
+func WithPromotions(promotions *PromotionImpl) OrderOption {
+	return func(o *OrderImpl) {
+		o.promotions = promotions
+	}
+}
+
+// WithPricing sets the tax rates and rounding orders are priced with. Without
+// it orders are untaxed and round half up.
+func WithPricing(rules models.PricingRules) OrderOption {
+	return func(o *OrderImpl) {
+		o.pricing = rules
+	}
+}
+
+// WithPayments only lets orders close once they are fully paid, and keeps
+// paid orders from being deleted.
+func WithPayments(payments PaymentLedger) OrderOption {
+	return func(o *OrderImpl) {
+		o.payments = payments
+	}
+}
+
+// WithAudit records every change to an order.
+func WithAudit(audit AuditRecorder) OrderOption {
+	return func(o *OrderImpl) {
+		o.audit = audit
+	}
 }
 
 type OrderRepo interface {
-	SaveOrder(ctx context.Context, data models.OrderRequest) (int64, error)
-	GetAllOrders(ctx context.Context) ([]models.Order, error)
+	// SaveOrder stores the order with its priced lines and discounts and
+	// deducts consumption from the inventory in one transaction. If any
+	// ingredient runs short nothing is written and a
+	// *models.InsufficientIngredientsError is returned; a promotion whose
+	// limits are used up fails with models.ErrPromoLimitReached and a
+	// redemption the customer cannot afford with
+	// models.ErrInsufficientPoints. The stock changes are read under the
+	// same locks as the deduction.
+	SaveOrder(ctx context.Context, order models.Order, consumption []models.IngredientAmount, discounts models.OrderDiscounts) (int64, []models.StockChange, error)
+	// GetOrders lists a page of orders, newest first.
+	GetOrders(ctx context.Context, page models.OrderPage) ([]models.Order, error)
 	GetOrder(ctx context.Context, id int64) (models.Order, error)
-	UpdateOrder(ctx context.Context, id int64, order models.Order) (models.Order, error)
+	// UpdateOrder replaces the order, swaps the inventory it holds for
+	// consumption and sets the amounts of its promotion usages to those of
+	// usages in one transaction, reporting the stock changes like SaveOrder.
+	// A usage that is not on the order fails with models.ErrNotFound.
+	UpdateOrder(ctx context.Context, id int64, order models.Order, consumption []models.IngredientAmount, usages []models.PromotionUsage) (models.Order, []models.StockChange, error)
+	// DeleteOrder removes an order that is not closed and, in the same
+	// transaction, returns its ingredients to the inventory, gives back the
+	// points spent on it and voids its promotion usages.
 	DeleteOrder(ctx context.Context, id int64) error
-	CloseOrder(ctx context.Context, id int64) (models.Order, error)
+	// SetOrderStatus moves the order from one status to another and returns
+	// the time of the change. It fails with models.ErrInvalidTransition when
+	// the order is no longer in the from status.
+	SetOrderStatus(ctx context.Context, id int64, from, to models.OrderStatus) (time.Time, error)
+	// CancelOrder is SetOrderStatus to models.StatusCancelled that also
+	// returns the order's ingredients to the inventory, gives back the points
+	// spent on it and voids its promotion usages.
+	CancelOrder(ctx context.Context, id int64, from models.OrderStatus) (time.Time, error)
+	// CloseOrder is SetOrderStatus to models.StatusClosed that also records
+	// the tip left on the order and credits points, if positive, to the
+	// order's customer in the same write.
+	CloseOrder(ctx context.Context, id int64, from models.OrderStatus, tip money.Amount, points int64) (time.Time, error)
 }
 
-func NewOrderService(repo OrderRepo, logr *slog.Logger) *OrderImpl {
-	return &OrderImpl{repo: repo, logr: logr}
+var orderTransitions = map[models.OrderStatus][]models.OrderStatus{
+	models.StatusOpen:       {models.StatusInProgress, models.StatusCancelled},
+	models.StatusInProgress: {models.StatusReady, models.StatusCancelled},
+	models.StatusReady:      {models.StatusClosed, models.StatusCancelled},
+}
+
+func canTransition(from, to models.OrderStatus) bool {
+	for _, next := range orderTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+func NewOrderService(repo OrderRepo, menu MenuRepo, inventory InventoryRepo, logr *slog.Logger, opts ...OrderOption) *OrderImpl {
+	o := &OrderImpl{repo: repo, menu: menu, inventory: inventory, logr: logr}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
 }
 
 func (o *OrderImpl) CreateOrder(ctx context.Context, data models.OrderRequest) (int64, error) {
 
-	id, err := o.repo.SaveOrder(ctx, data)
+	data, err := o.resolveCustomer(ctx, data)
+	if err != nil {
+		o.logr.Info("Failed to create order", "err", err)
+		return 0, err
+	}
+
+	book := newRecipeBook(o.menu, o.inventory)
+	consumption, err := book.consumption(ctx, data.Items)
+	if err != nil {
+		o.logr.Info("Failed to expand order ingredients", "err", err)
+		return 0, err
+	}
+
+	if err = checkAvailability(ctx, book, data.Items); err != nil {
+		o.logr.Info("Failed to create order", "err", err)
+		return 0, err
+	}
+
+	lines, subtotal, err := priceLines(ctx, book, o.pricing, data.Items)
+	if err != nil {
+		o.logr.Info("Failed to price order", "err", err)
+		return 0, err
+	}
+
+	promotion, err := o.quotePromotion(ctx, data, lines)
+	if err != nil {
+		o.logr.Info("Failed to create order", "err", err)
+		return 0, err
+	}
+	payable := subtotal
+	if promotion != nil {
+		payable -= promotion.amount
+	}
+
+	redemption, err := o.quoteRedemption(ctx, data, lines, payable)
+	if err != nil {
+		o.logr.Info("Failed to create order", "err", err)
+		return 0, err
+	}
+
+	discounts := models.OrderDiscounts{Redemption: redemption}
+	if promotion != nil {
+		discounts.Promotion = &promotion.promotion
+		discounts.Usage = models.PromotionUsage{CustomerID: data.CustomerID, Amount: promotion.amount}
+	}
+
+	order := models.Order{
+		CustomerID:    data.CustomerID,
+		CustomerName:  data.CustomerName,
+		Items:         data.Items,
+		Lines:         lines,
+		Rounding:      o.pricing.Rounding,
+		CashIncrement: o.pricing.CashIncrement,
+	}
+	if order.Rounding == "" {
+		order.Rounding = money.HalfUp
+	}
+	id, changes, err := o.repo.SaveOrder(ctx, order, consumption, discounts)
 	if err != nil {
 		o.logr.Info("Failed to save order", "err", err)
 		return 0, err
 	}
 
+	if o.observer != nil {
+		o.observer.OrderConsumed(id, changes)
+	}
+
+	order.ID = id
+	order.Status = models.StatusOpen
+	record(ctx, o.audit, models.AuditCreate, models.EntityOrder, id, nil, order)
 	return id, err
 }
 
-func (o *OrderImpl) GetOrders(ctx context.Context) ([]models.Order, error) {
+// resolveCustomer checks that the order's customer exists and names the
+// order after them when no name was given.
+func (o *OrderImpl) resolveCustomer(ctx context.Context, data models.OrderRequest) (models.OrderRequest, error) {
+	if data.CustomerID == nil {
+		return data, nil
+	}
+	if o.customers == nil {
+		return data, fmt.Errorf("%w: customer profiles are not enabled", models.ErrInvalidOrder)
+	}
+
+	customer, err := o.customers.GetCustomer(ctx, *data.CustomerID)
+	if errors.Is(err, models.ErrNotFound) {
+		return data, fmt.Errorf("%w: unknown customer %d", models.ErrInvalidOrder, *data.CustomerID)
+	}
+	if err != nil {
+		return data, err
+	}
+
+	if data.CustomerName == "" {
+		data.CustomerName = customer.Name
+	}
+	return data, nil
+}
+
+// quoteRedemption prices the loyalty redemption the order asks for and checks
+// the customer can afford it. The balance is checked again when the order is
+// saved.
+func (o *OrderImpl) quoteRedemption(ctx context.Context, data models.OrderRequest, lines []models.PricedLine, payable money.Amount) (*models.LoyaltyRedemption, error) {
+	if data.Redeem == nil {
+		return nil, nil
+	}
+	if o.loyalty == nil {
+		return nil, fmt.Errorf("%w: loyalty program is not enabled", models.ErrInvalidRedemption)
+	}
+
+	redemption, err := o.loyalty.quote(data, lines, payable)
+	if err != nil {
+		return nil, err
+	}
+
+	balance, err := o.loyalty.repo.GetLoyaltyBalance(ctx, redemption.CustomerID)
+	if err != nil {
+		return nil, err
+	}
+	if balance < redemption.Points {
+		return nil, fmt.Errorf("%w: %d needed, %d available", models.ErrInsufficientPoints, redemption.Points, balance)
+	}
+	return &redemption, nil
+}
+
+// quotePromotion prices the promo code the order asks for.
+func (o *OrderImpl) quotePromotion(ctx context.Context, data models.OrderRequest, lines []models.PricedLine) (*appliedPromotion, error) {
+	if data.PromoCode == "" {
+		return nil, nil
+	}
+	if o.promotions == nil {
+		return nil, fmt.Errorf("%w: promo codes are not enabled", models.ErrPromoNotApplicable)
+	}
+
+	promotion, err := o.promotions.quote(ctx, data.PromoCode, lines, o.pricing.Rounding, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if promotion.promotion.MaxUsesPerCustomer > 0 && data.CustomerID == nil {
+		return nil, fmt.Errorf("%w: %s is limited per customer and needs a customer_id", models.ErrPromoNotApplicable, promotion.promotion.Code)
+	}
+	return &promotion, nil
+}
+
+// repricePromotions prices the promotions of an order being updated to lines.
+// Discounts are chosen when the order is created, so the update cannot
+// redeem points or bring another promo code.
+func (o *OrderImpl) repricePromotions(ctx context.Context, order models.Order, data models.OrderRequest, lines []models.PricedLine) ([]models.PromotionUsage, error) {
+	if data.Redeem != nil {
+		return nil, fmt.Errorf("%w: points are redeemed when the order is created", models.ErrInvalidOrder)
+	}
+	if o.promotions == nil {
+		if data.PromoCode != "" {
+			return nil, fmt.Errorf("%w: promo codes are not enabled", models.ErrPromoNotApplicable)
+		}
+		return nil, nil
+	}
+	return o.promotions.reprice(ctx, order.ID, data.PromoCode, lines, o.orderRules(order).Rounding)
+}
 
-	var orders []models.Order
-	orders, err := o.repo.GetAllOrders(ctx)
+// checkRedemptions refuses edits that would leave a redemption on the order
+// without what it was spent on.
+func (o *OrderImpl) checkRedemptions(ctx context.Context, order models.Order, data models.OrderRequest) error {
+	if o.loyalty == nil {
+		return nil
+	}
+	redemptions, err := o.loyalty.activeRedemptions(ctx, order.ID)
 	if err != nil {
-		o.logr.Info("Failed to get all orders", "err", err)
-		return []models.Order{}, err
+		return err
 	}
-	return orders, nil
+
+	for _, r := range redemptions {
+		if data.CustomerID == nil || *data.CustomerID != r.CustomerID {
+			return fmt.Errorf("%w: undo redemption %d before changing the customer", models.ErrOrderNotEditable, r.ID)
+		}
+		if r.Reward != models.RewardFreeItem {
+			continue
+		}
+		onOrder := slices.ContainsFunc(data.Items, func(item models.OrderItem) bool {
+			return item.ProductID == r.ProductID && item.VariantID == r.VariantID
+		})
+		if !onOrder {
+			return fmt.Errorf("%w: undo redemption %d before removing product %d", models.ErrOrderNotEditable, r.ID, r.ProductID)
+		}
+	}
+	return nil
+}
+
+// consumption expands order items through their menu recipes into the total
+// amount of every ingredient the order uses, in the units the ingredients are
+// stocked in and sorted by ingredient id so that storages lock inventory rows
+// in a stable order.
+func (b *recipeBook) consumption(ctx context.Context, items []models.OrderItem) ([]models.IngredientAmount, error) {
+	if len(items) == 0 {
+		return nil, fmt.Errorf("%w: order has no items", models.ErrInvalidOrder)
+	}
+
+	needs := make(map[int64]float64)
+	for _, item := range items {
+		if item.Quantity <= 0 {
+			return nil, fmt.Errorf("%w: product %d has quantity %d", models.ErrInvalidOrder, item.ProductID, item.Quantity)
+		}
+
+		line, err := b.orderLine(ctx, item)
+		if err != nil {
+			return nil, err
+		}
+
+		lineNeeds, err := b.stockNeeds(ctx, line.recipe())
+		if err != nil {
+			return nil, err
+		}
+		for id, quantity := range lineNeeds {
+			needs[id] += quantity * float64(item.Quantity)
+		}
+	}
+
+	amounts := make([]models.IngredientAmount, 0, len(needs))
+	for id, quantity := range needs {
+		// A modifier can take out more than the recipe puts in.
+		if quantity <= 0 {
+			continue
+		}
+		amounts = append(amounts, models.IngredientAmount{IngredientID: id, Quantity: quantity})
+	}
+	sort.Slice(amounts, func(i, j int) bool {
+		return amounts[i].IngredientID < amounts[j].IngredientID
+	})
+
+	return amounts, nil
 }
 
-func (o *OrderImpl) GetOrder(ctx context.Context, id int64) (models.Order, error) {
+// checkAvailability refuses items that current stock cannot make as many
+// times as they are ordered, using the same calculation as the menu. Items
+// that share ingredients are still checked together when the order is saved.
+func checkAvailability(ctx context.Context, book *recipeBook, items []models.OrderItem) error {
+	product := func(item models.OrderItem) string {
+		modifiers := append([]int64(nil), item.Modifiers...)
+		slices.Sort(modifiers)
+		return fmt.Sprint(item.ProductID, item.VariantID, modifiers)
+	}
+
+	requested := make(map[string]int64)
+	var products []models.OrderItem
+	for _, item := range items {
+		key := product(item)
+		if _, ok := requested[key]; !ok {
+			products = append(products, item)
+		}
+		requested[key] += int64(item.Quantity)
+	}
+
+	var unavailable []models.UnavailableItem
+	for _, item := range products {
+		line, err := book.orderLine(ctx, item)
+		if err != nil {
+			return err
+		}
+
+		servings, err := book.maxServings(ctx, line.recipe())
+		if err != nil {
+			return err
+		}
+		if want := requested[product(item)]; servings != nil && *servings < want {
+			unavailable = append(unavailable, models.UnavailableItem{
+				ProductID:   item.ProductID,
+				VariantID:   item.VariantID,
+				Name:        line.name(),
+				Requested:   want,
+				MaxServings: *servings,
+			})
+		}
+	}
+
+	if len(unavailable) > 0 {
+		return &models.UnavailableItemsError{Items: unavailable}
+	}
+	return nil
+}
+
+// GetOrders lists a page of orders, newest first, priced with the discounts
+// of the whole page loaded at once.
+func (o *OrderImpl) GetOrders(ctx context.Context, page models.OrderPage) ([]models.OrderResponse, error) {
+	switch {
+	case page.Limit < 0 || page.Limit > maxOrderLimit:
+		err := fmt.Errorf("%w: limit must be between 1 and %d", models.ErrInvalidOrder, maxOrderLimit)
+		o.logr.Info("Failed to get orders", "err", err)
+		return []models.OrderResponse{}, err
+	case page.Offset < 0:
+		err := fmt.Errorf("%w: offset must not be negative", models.ErrInvalidOrder)
+		o.logr.Info("Failed to get orders", "err", err)
+		return []models.OrderResponse{}, err
+	case page.Limit == 0:
+		page.Limit = defaultOrderLimit
+	}
+
+	orders, err := o.repo.GetOrders(ctx, page)
+	if err != nil {
+		o.logr.Info("Failed to get orders", "err", err)
+		return []models.OrderResponse{}, err
+	}
+
+	ids := make([]int64, 0, len(orders))
+	for _, order := range orders {
+		ids = append(ids, order.ID)
+	}
+	discounts, err := o.orderDiscounts(ctx, ids...)
+	if err != nil {
+		o.logr.Info("Failed to price orders", "err", err)
+		return []models.OrderResponse{}, err
+	}
+
+	responses := make([]models.OrderResponse, 0, len(orders))
+	for _, order := range orders {
+		responses = append(responses, newOrderResponse(order, price(o.orderRules(order), order.Lines, discounts[order.ID])))
+	}
+	return responses, nil
+}
+
+func (o *OrderImpl) GetOrder(ctx context.Context, id int64) (models.OrderResponse, error) {
 	var order models.Order
 	order, err := o.repo.GetOrder(ctx, id)
 	if err != nil {
 		o.logr.Info("Failed to get order", "err", err)
-		return models.Order{}, err
+		return models.OrderResponse{}, err
 	}
-	return order, nil
+
+	response, err := o.orderResponse(ctx, order)
+	if err != nil {
+		o.logr.Info("Failed to price order", "id", id, "err", err)
+		return models.OrderResponse{}, err
+	}
+	return response, nil
 }
 
-func (o *OrderImpl) UpdateOrder(ctx context.Context, id int64, order models.Order) (models.Order, error) {
+func (o *OrderImpl) UpdateOrder(ctx context.Context, id int64, data models.OrderRequest) (models.OrderResponse, error) {
+
+	order, err := o.repo.GetOrder(ctx, id)
+	if err != nil {
+		o.logr.Info("Failed to get order", "err", err)
+		return models.OrderResponse{}, err
+	}
+
+	if order.Status != models.StatusOpen {
+		err = fmt.Errorf("%w: order %d is %s", models.ErrOrderNotEditable, id, order.Status)
+		o.logr.Info("Failed to update order", "err", err)
+		return models.OrderResponse{}, err
+	}
 
-	nOrder, err := o.repo.UpdateOrder(ctx, id, order)
+	data, err = o.resolveCustomer(ctx, data)
 	if err != nil {
 		o.logr.Info("Failed to update order", "err", err)
-		return models.Order{}, err
+		return models.OrderResponse{}, err
+	}
+
+	book := newRecipeBook(o.menu, o.inventory)
+	consumption, err := book.consumption(ctx, data.Items)
+	if err != nil {
+		o.logr.Info("Failed to expand order ingredients", "err", err)
+		return models.OrderResponse{}, err
+	}
+
+	lines, _, err := priceLines(ctx, book, o.pricing, data.Items)
+	if err != nil {
+		o.logr.Info("Failed to price order", "err", err)
+		return models.OrderResponse{}, err
 	}
-	return nOrder, nil
+
+	if err = o.checkRedemptions(ctx, order, data); err != nil {
+		o.logr.Info("Failed to update order", "err", err)
+		return models.OrderResponse{}, err
+	}
+	usages, err := o.repricePromotions(ctx, order, data, lines)
+	if err != nil {
+		o.logr.Info("Failed to update order", "err", err)
+		return models.OrderResponse{}, err
+	}
+
+	before := order
+	order.CustomerID = data.CustomerID
+	order.CustomerName = data.CustomerName
+	order.Items = data.Items
+	order.Lines = lines
+
+	nOrder, changes, err := o.repo.UpdateOrder(ctx, id, order, consumption, usages)
+	if err != nil {
+		o.logr.Info("Failed to update order", "err", err)
+		return models.OrderResponse{}, err
+	}
+	if o.observer != nil {
+		o.observer.OrderConsumed(id, changes)
+	}
+	record(ctx, o.audit, models.AuditUpdate, models.EntityOrder, id, before, nOrder)
+
+	response, err := o.orderResponse(ctx, nOrder)
+	if err != nil {
+		o.logr.Info("Failed to price order", "id", id, "err", err)
+		return models.OrderResponse{}, err
+	}
+	return response, nil
 }
 
 func (o *OrderImpl) DeleteOrder(ctx context.Context, id int64) error {
 
-	err := o.repo.DeleteOrder(ctx, id)
+	order, err := o.repo.GetOrder(ctx, id)
 	if err != nil {
-		o.logr.Info("Failed to delete order", "err", err)
+		o.logr.Info("Failed to get order", "err", err)
 		return err
 	}
 
+	if order.Status == models.StatusClosed {
+		o.logr.Info("Failed to delete order", "id", id, "err", models.ErrOrderClosed)
+		return models.ErrOrderClosed
+	}
+
+	if o.payments != nil {
+		paid, err := o.payments.OrderPaid(ctx, id)
+		if err != nil {
+			o.logr.Info("Failed to delete order", "err", err)
+			return err
+		}
+		if paid > 0 {
+			err = fmt.Errorf("%w: %s paid", models.ErrOrderPaid, paid)
+			o.logr.Info("Failed to delete order", "id", id, "err", err)
+			return err
+		}
+	}
+
+	err = o.repo.DeleteOrder(ctx, id)
+	if err != nil {
+		o.logr.Info("Failed to delete order", "err", err)
+		return err
+	}
+	record(ctx, o.audit, models.AuditDelete, models.EntityOrder, id, order, nil)
 	return nil
 }
 
-func (o *OrderImpl) CloseOrder(ctx context.Context, id int64) error {
-	var order models.Order
+func (o *OrderImpl) StartOrder(ctx context.Context, id int64) (models.Order, error) {
+	return o.transition(ctx, id, models.StatusInProgress, 0)
+}
+
+func (o *OrderImpl) ReadyOrder(ctx context.Context, id int64) (models.Order, error) {
+	return o.transition(ctx, id, models.StatusReady, 0)
+}
+
+// CloseOrder closes the order with the tip left on it, if any. The tip is
+// recorded together with the status, so it is never left on an order that
+// failed to close.
+func (o *OrderImpl) CloseOrder(ctx context.Context, id int64, tip money.Amount) (models.Order, error) {
+	if tip < 0 {
+		err := fmt.Errorf("%w: tip must not be negative", models.ErrInvalidOrder)
+		o.logr.Info("Failed to close order", "id", id, "err", err)
+		return models.Order{}, err
+	}
+	return o.transition(ctx, id, models.StatusClosed, tip)
+}
+
+func (o *OrderImpl) CancelOrder(ctx context.Context, id int64) (models.Order, error) {
+	return o.transition(ctx, id, models.StatusCancelled, 0)
+}
+
+// transition moves the order to the to status. The tip is only recorded when
+// the order is closed.
+func (o *OrderImpl) transition(ctx context.Context, id int64, to models.OrderStatus, tip money.Amount) (models.Order, error) {
 
 	order, err := o.repo.GetOrder(ctx, id)
 	if err != nil {
 		o.logr.Info("Failed to get order", "err", err)
-		return err
+		return models.Order{}, err
+	}
+
+	if !canTransition(order.Status, to) {
+		err = fmt.Errorf("%w: %s -> %s", models.ErrInvalidTransition, order.Status, to)
+		o.logr.Info("Failed to change order status", "id", id, "err", err)
+		return models.Order{}, err
 	}
 
-	order.Status = "closed"
-	_, err = o.repo.UpdateOrder(ctx, id, order)
+	var points int64
+	if to == models.StatusClosed {
+		if err = o.checkPaid(ctx, order); err != nil {
+			o.logr.Info("Failed to change order status", "id", id, "err", err)
+			return models.Order{}, err
+		}
+		if points, err = o.earnedPoints(ctx, order); err != nil {
+			o.logr.Info("Failed to change order status", "id", id, "err", err)
+			return models.Order{}, err
+		}
+	}
+
+	var at time.Time
+	switch to {
+	case models.StatusCancelled:
+		at, err = o.repo.CancelOrder(ctx, id, order.Status)
+	case models.StatusClosed:
+		at, err = o.repo.CloseOrder(ctx, id, order.Status, tip, points)
+	default:
+		at, err = o.repo.SetOrderStatus(ctx, id, order.Status, to)
+	}
+	if err != nil {
+		o.logr.Info("Failed to change order status", "id", id, "err", err)
+		return models.Order{}, err
+	}
+
+	before := order
+	order.SetStatus(to, at)
+	if to == models.StatusClosed {
+		order.Tip = tip
+	}
+
+	action := models.AuditUpdate
+	switch to {
+	case models.StatusClosed:
+		action = models.AuditClose
+	case models.StatusCancelled:
+		action = models.AuditCancel
+	}
+	record(ctx, o.audit, action, models.EntityOrder, id, before, order)
+
+	if points > 0 {
+		o.logr.Info("Loyalty points earned", "id", id, "customer_id", *order.CustomerID, "points", points)
+	}
+	return order, nil
+}
+
+// checkPaid fails with models.ErrOrderNotPaid unless the payments towards the
+// order cover its total.
+func (o *OrderImpl) checkPaid(ctx context.Context, order models.Order) error {
+	if o.payments == nil {
+		return nil
+	}
+	pricing, err := o.orderPricing(ctx, order)
 	if err != nil {
-		o.logr.Info("Failed to update order", "err", err)
 		return err
 	}
+	paid, err := o.payments.OrderPaid(ctx, order.ID)
+	if err != nil {
+		return err
+	}
+	if paid < pricing.Total {
+		return fmt.Errorf("%w: %s of %s paid", models.ErrOrderNotPaid, paid, pricing.Total)
+	}
+	return nil
+}
 
-	return err
+// earnedPoints returns the points the customer of the order earns by
+// closing it, which are credited with the close.
+func (o *OrderImpl) earnedPoints(ctx context.Context, order models.Order) (int64, error) {
+	if o.loyalty == nil || order.CustomerID == nil {
+		return 0, nil
+	}
+	pricing, err := o.orderPricing(ctx, order)
+	if err != nil {
+		return 0, err
+	}
+	return o.loyalty.earned(ctx, order, pricing.Subtotal-pricing.DiscountTotal)
 }
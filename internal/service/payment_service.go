@@ -0,0 +1,197 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"github.com/weeweeshka/hot-coffee/internal/money"
+	"log/slog"
+	"strings"
+)
+
+type PaymentImpl struct {
+	logr    *slog.Logger
+	repo    PaymentRepo
+	orders  OrderReader
+	gateway PaymentGateway
+}
+
+// PaymentLedger reports how much has been paid towards an order.
+type PaymentLedger interface {
+	OrderPaid(ctx context.Context, orderID int64) (money.Amount, error)
+}
+
+type PaymentRepo interface {
+	PaymentLedger
+	// SavePayment records the payment, failing with models.ErrOverpayment
+	// when it would take the order's paid amount over total.
+	SavePayment(ctx context.Context, p models.Payment, total money.Amount) (models.Payment, error)
+	GetOrderPayments(ctx context.Context, orderID int64) ([]models.Payment, error)
+}
+
+// OrderReader returns orders priced as the customer sees them.
+type OrderReader interface {
+	GetOrder(ctx context.Context, id int64) (models.OrderResponse, error)
+}
+
+// PaymentGateway charges cards. Charge returns the gateway's reference for
+// the charge and fails with an error wrapping models.ErrPaymentDeclined when
+// the card is refused. Refund gives back part or all of a charge.
+type PaymentGateway interface {
+	Charge(ctx context.Context, charge models.CardCharge) (string, error)
+	Refund(ctx context.Context, reference string, amount money.Amount) error
+}
+
+// NewPaymentService takes cash only when gateway is nil.
+func NewPaymentService(logr *slog.Logger, repo PaymentRepo, orders OrderReader, gateway PaymentGateway) *PaymentImpl {
+	return &PaymentImpl{
+		logr:    logr,
+		repo:    repo,
+		orders:  orders,
+		gateway: gateway,
+	}
+}
+
+// Pay takes one tender towards the order and returns the payment with the
+// order's balance after it.
+func (p *PaymentImpl) Pay(ctx context.Context, orderID int64, req models.PaymentRequest) (models.Payment, models.OrderBalance, error) {
+	order, err := p.orders.GetOrder(ctx, orderID)
+	if err != nil {
+		p.logr.Info("Payment Error", "err", err)
+		return models.Payment{}, models.OrderBalance{}, err
+	}
+	if order.Status == models.StatusClosed || order.Status == models.StatusCancelled {
+		err = fmt.Errorf("%w: order %d is %s", models.ErrInvalidPayment, orderID, order.Status)
+		p.logr.Info("Payment Error", "err", err)
+		return models.Payment{}, models.OrderBalance{}, err
+	}
+
+	paid, err := p.repo.OrderPaid(ctx, orderID)
+	if err != nil {
+		p.logr.Info("Payment Error", "err", err)
+		return models.Payment{}, models.OrderBalance{}, err
+	}
+
+	payment, err := tender(orderID, req, order.Pricing.Total-paid)
+	if err != nil {
+		p.logr.Info("Payment Error", "err", err)
+		return models.Payment{}, models.OrderBalance{}, err
+	}
+
+	if payment.Method == models.PaymentCard {
+		if p.gateway == nil {
+			err = fmt.Errorf("%w: card payments are not enabled", models.ErrInvalidPayment)
+			p.logr.Info("Payment Error", "err", err)
+			return models.Payment{}, models.OrderBalance{}, err
+		}
+		charge := models.CardCharge{OrderID: orderID, Amount: payment.Amount + payment.Tip, Token: req.CardToken}
+		payment.Reference, err = p.gateway.Charge(ctx, charge)
+		if err != nil {
+			p.logr.Info("Payment Error", "err", err)
+			return models.Payment{}, models.OrderBalance{}, err
+		}
+	}
+
+	saved, err := p.repo.SavePayment(ctx, payment, order.Pricing.Total)
+	if err != nil {
+		p.logr.Info("Payment Error", "err", err)
+		p.voidCharge(ctx, payment)
+		return models.Payment{}, models.OrderBalance{}, err
+	}
+
+	balance, err := p.balance(ctx, order)
+	if err != nil {
+		p.logr.Info("Payment Error", "err", err)
+		return models.Payment{}, models.OrderBalance{}, err
+	}
+	return saved, balance, nil
+}
+
+// voidCharge gives back a card charge that could not be recorded. A failure
+// is logged for a manual refund.
+func (p *PaymentImpl) voidCharge(ctx context.Context, payment models.Payment) {
+	if payment.Reference == "" {
+		return
+	}
+	if err := p.gateway.Refund(ctx, payment.Reference, payment.Amount+payment.Tip); err != nil {
+		p.logr.Error("Failed to void card charge", "order_id", payment.OrderID, "reference", payment.Reference, "err", err)
+	}
+}
+
+func (p *PaymentImpl) GetPayments(ctx context.Context, orderID int64) (models.OrderBalance, error) {
+	order, err := p.orders.GetOrder(ctx, orderID)
+	if err != nil {
+		p.logr.Info("Payment Get Error", "err", err)
+		return models.OrderBalance{}, err
+	}
+
+	balance, err := p.balance(ctx, order)
+	if err != nil {
+		p.logr.Info("Payment Get Error", "err", err)
+		return models.OrderBalance{}, err
+	}
+	return balance, nil
+}
+
+func (p *PaymentImpl) balance(ctx context.Context, order models.OrderResponse) (models.OrderBalance, error) {
+	payments, err := p.repo.GetOrderPayments(ctx, order.ID)
+	if err != nil {
+		return models.OrderBalance{}, err
+	}
+
+	balance := models.OrderBalance{OrderID: order.ID, Total: order.Pricing.Total, Payments: payments}
+	for _, payment := range payments {
+		balance.Paid += payment.Amount
+		balance.Refunded += payment.Refunded
+	}
+	balance.Due = max(balance.Total-balance.Paid, 0)
+	return balance, nil
+}
+
+// tender turns the request into a payment of at most due, working out the
+// change for cash. A tip comes out of the cash tendered before the order
+// does.
+func tender(orderID int64, req models.PaymentRequest, due money.Amount) (models.Payment, error) {
+	if due <= 0 {
+		return models.Payment{}, fmt.Errorf("%w: order %d is already paid", models.ErrOverpayment, orderID)
+	}
+	if req.Amount < 0 || req.Tendered < 0 || req.Tip < 0 {
+		return models.Payment{}, fmt.Errorf("%w: amounts must not be negative", models.ErrInvalidPayment)
+	}
+
+	payment := models.Payment{OrderID: orderID, Method: req.Method, Amount: req.Amount, Tip: req.Tip}
+	switch req.Method {
+	case models.PaymentCash:
+		if payment.Amount == 0 {
+			payment.Amount = due
+			if req.Tendered > 0 {
+				payment.Amount = min(due, req.Tendered-req.Tip)
+			}
+		}
+		payment.Tendered = req.Tendered
+		if payment.Tendered == 0 {
+			payment.Tendered = payment.Amount + payment.Tip
+		}
+		if payment.Amount <= 0 || payment.Tendered < payment.Amount+payment.Tip {
+			return models.Payment{}, fmt.Errorf("%w: %s tendered for %s and a tip of %s", models.ErrInvalidPayment, payment.Tendered, payment.Amount, payment.Tip)
+		}
+		payment.Change = payment.Tendered - payment.Amount - payment.Tip
+	case models.PaymentCard:
+		if req.Tendered != 0 {
+			return models.Payment{}, fmt.Errorf("%w: tendered is only for cash", models.ErrInvalidPayment)
+		}
+		if strings.TrimSpace(req.CardToken) == "" {
+			return models.Payment{}, fmt.Errorf("%w: card_token is required", models.ErrInvalidPayment)
+		}
+		if payment.Amount == 0 {
+			payment.Amount = due
+		}
+	default:
+		return models.Payment{}, fmt.Errorf("%w: unknown method %q", models.ErrInvalidPayment, req.Method)
+	}
+
+	if payment.Amount > due {
+		return models.Payment{}, fmt.Errorf("%w: %s due", models.ErrOverpayment, due)
+	}
+	return payment, nil
+}
@@ -0,0 +1,201 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"github.com/weeweeshka/hot-coffee/internal/money"
+	"slices"
+	"sort"
+)
+
+// priceLines prices the items at current menu prices and tax rates and
+// returns them with their subtotal.
+func priceLines(ctx context.Context, book *recipeBook, rules models.PricingRules, items []models.OrderItem) ([]models.PricedLine, money.Amount, error) {
+	lines := make([]models.PricedLine, 0, len(items))
+	var subtotal money.Amount
+	for _, item := range items {
+		line, err := book.orderLine(ctx, item)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		priced := models.PricedLine{
+			ProductID: item.ProductID,
+			VariantID: item.VariantID,
+			Modifiers: item.Modifiers,
+			Name:      line.name(),
+			Category:  line.menu.Category,
+			Quantity:  item.Quantity,
+			UnitPrice: line.unitPrice(),
+			TaxRate:   rules.TaxRate(line.menu.Category),
+		}
+		priced.LineTotal = priced.UnitPrice.Mul(item.Quantity)
+		subtotal += priced.LineTotal
+		lines = append(lines, priced)
+	}
+	return lines, subtotal, nil
+}
+
+// price totals the lines after discounts and tax. Each discount is spread
+// over the lines it applies to in proportion to their totals, and tax is
+// charged per category and rate on what is left of the lines. The tax of each
+// category is spread back over its lines to give their Net.
+func price(rules models.PricingRules, lines []models.PricedLine, discounts []models.AppliedDiscount) models.OrderPricing {
+	lines = slices.Clone(lines)
+	pricing := models.OrderPricing{Lines: lines, Discounts: discounts}
+	taxable := make([]money.Amount, len(lines))
+	for i, line := range lines {
+		pricing.Subtotal += line.LineTotal
+		taxable[i] = line.LineTotal
+	}
+
+	for _, d := range discounts {
+		weights := make([]money.Amount, len(lines))
+		for i, line := range lines {
+			if d.ProductID == 0 || line.ProductID == d.ProductID {
+				weights[i] = line.LineTotal
+			}
+		}
+		for i, part := range d.Amount.Allocate(weights) {
+			taxable[i] -= part
+		}
+	}
+
+	type taxKey struct {
+		category string
+		rate     money.Rate
+	}
+	taxes := make(map[taxKey]money.Amount)
+	var net money.Amount
+	for i, line := range lines {
+		taxable[i] = max(taxable[i], 0)
+		net += taxable[i]
+		taxes[taxKey{line.Category, line.TaxRate}] += taxable[i]
+	}
+	pricing.DiscountTotal = pricing.Subtotal - net
+
+	for i := range lines {
+		lines[i].Net = taxable[i]
+	}
+	for key, amount := range taxes {
+		tax := amount.Percent(key.rate, rules.Rounding)
+		if tax == 0 {
+			continue
+		}
+		pricing.Taxes = append(pricing.Taxes, models.TaxLine{Category: key.category, Rate: key.rate, Taxable: amount, Amount: tax})
+		pricing.TaxTotal += tax
+
+		weights := make([]money.Amount, len(lines))
+		for i, line := range lines {
+			if line.Category == key.category && line.TaxRate == key.rate {
+				weights[i] = taxable[i]
+			}
+		}
+		for i, part := range tax.Allocate(weights) {
+			lines[i].Net += part
+		}
+	}
+	sort.Slice(pricing.Taxes, func(i, j int) bool {
+		if pricing.Taxes[i].Category != pricing.Taxes[j].Category {
+			return pricing.Taxes[i].Category < pricing.Taxes[j].Category
+		}
+		return pricing.Taxes[i].Rate < pricing.Taxes[j].Rate
+	})
+
+	total := net + pricing.TaxTotal
+	pricing.Total = total.RoundTo(rules.CashIncrement, rules.Rounding)
+	pricing.Rounding = pricing.Total - total
+	return pricing
+}
+
+// orderPricing prices the order from the prices stored with its lines and the
+// discounts recorded for it.
+func (o *OrderImpl) orderPricing(ctx context.Context, order models.Order) (models.OrderPricing, error) {
+	discounts, err := o.orderDiscounts(ctx, order.ID)
+	if err != nil {
+		return models.OrderPricing{}, err
+	}
+	return price(o.orderRules(order), order.Lines, discounts[order.ID]), nil
+}
+
+// orderRules are the pricing rules the order was created under, or the
+// current rules for orders from before the rounding was kept with them.
+func (o *OrderImpl) orderRules(order models.Order) models.PricingRules {
+	rules := o.pricing
+	if order.Rounding != "" {
+		rules.Rounding, rules.CashIncrement = order.Rounding, order.CashIncrement
+	}
+	return rules
+}
+
+// orderDiscounts loads the discounts recorded for the orders by order ID, with
+// one query per kind of discount however many orders there are.
+func (o *OrderImpl) orderDiscounts(ctx context.Context, orderIDs ...int64) (map[int64][]models.AppliedDiscount, error) {
+	discounts := make(map[int64][]models.AppliedDiscount, len(orderIDs))
+	if len(orderIDs) == 0 {
+		return discounts, nil
+	}
+
+	if o.promotions != nil {
+		usages, err := o.promotions.repo.GetOrderPromotionUsages(ctx, orderIDs...)
+		if err != nil {
+			return nil, err
+		}
+		for _, u := range usages {
+			discounts[u.OrderID] = append(discounts[u.OrderID], models.AppliedDiscount{
+				Source:      models.DiscountFromPromotion,
+				Code:        u.Code,
+				Description: "promo code " + u.Code,
+				ProductID:   u.ProductID,
+				Amount:      u.Amount,
+			})
+		}
+	}
+
+	if o.loyalty != nil {
+		redemptions, err := o.loyalty.activeRedemptions(ctx, orderIDs...)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range redemptions {
+			description := fmt.Sprintf("%d loyalty points", r.Points)
+			if r.Reward == models.RewardFreeItem {
+				description = fmt.Sprintf("free item for %d loyalty points", r.Points)
+			}
+			discounts[r.OrderID] = append(discounts[r.OrderID], models.AppliedDiscount{
+				Source:      models.DiscountFromLoyalty,
+				Description: description,
+				ProductID:   r.ProductID,
+				Amount:      r.Value,
+			})
+		}
+	}
+
+	return discounts, nil
+}
+
+func (o *OrderImpl) orderResponse(ctx context.Context, order models.Order) (models.OrderResponse, error) {
+	pricing, err := o.orderPricing(ctx, order)
+	if err != nil {
+		return models.OrderResponse{}, err
+	}
+	return newOrderResponse(order, pricing), nil
+}
+
+func newOrderResponse(order models.Order, pricing models.OrderPricing) models.OrderResponse {
+	return models.OrderResponse{
+		ID:           order.ID,
+		CustomerID:   order.CustomerID,
+		CustomerName: order.CustomerName,
+		Items:        order.Items,
+		Tip:          order.Tip,
+		Status:       order.Status,
+		CreatedAt:    order.CreatedAt,
+		StartedAt:    order.StartedAt,
+		ReadyAt:      order.ReadyAt,
+		ClosedAt:     order.ClosedAt,
+		CancelledAt:  order.CancelledAt,
+		Pricing:      pricing,
+	}
+}
@@ -0,0 +1,172 @@
+package service
+
+import (
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"github.com/weeweeshka/hot-coffee/internal/money"
+	"slices"
+	"testing"
+)
+
+func pricedLine(product int64, category string, quantity int, unit money.Amount, rate money.Rate) models.PricedLine {
+	return models.PricedLine{
+		ProductID: product,
+		Category:  category,
+		Quantity:  quantity,
+		UnitPrice: unit,
+		LineTotal: unit.Mul(quantity),
+		TaxRate:   rate,
+	}
+}
+
+func TestPrice(t *testing.T) {
+	coffee := pricedLine(1, "coffee", 2, 350, 1000)
+	food := pricedLine(2, "food", 1, 500, 500)
+
+	for _, tc := range []struct {
+		name      string
+		rules     models.PricingRules
+		lines     []models.PricedLine
+		discounts []models.AppliedDiscount
+		want      models.OrderPricing
+		taxes     []models.TaxLine
+		nets      []money.Amount
+	}{
+		{
+			name:  "one rate",
+			lines: []models.PricedLine{coffee},
+			want:  models.OrderPricing{Subtotal: 700, TaxTotal: 70, Total: 770},
+			taxes: []models.TaxLine{{Category: "coffee", Rate: 1000, Taxable: 700, Amount: 70}},
+			nets:  []money.Amount{770},
+		},
+		{
+			name:  "rates per category",
+			lines: []models.PricedLine{food, coffee},
+			want:  models.OrderPricing{Subtotal: 1200, TaxTotal: 95, Total: 1295},
+			taxes: []models.TaxLine{
+				{Category: "coffee", Rate: 1000, Taxable: 700, Amount: 70},
+				{Category: "food", Rate: 500, Taxable: 500, Amount: 25},
+			},
+			nets: []money.Amount{525, 770},
+		},
+		{
+			name:      "order discount spread by line total",
+			lines:     []models.PricedLine{coffee, food},
+			discounts: []models.AppliedDiscount{{Source: models.DiscountFromPromotion, Amount: 120}},
+			want:      models.OrderPricing{Subtotal: 1200, DiscountTotal: 120, TaxTotal: 86, Total: 1166},
+			taxes: []models.TaxLine{
+				{Category: "coffee", Rate: 1000, Taxable: 630, Amount: 63},
+				{Category: "food", Rate: 500, Taxable: 450, Amount: 23},
+			},
+			nets: []money.Amount{693, 473},
+		},
+		{
+			name:      "half-even tax rounding",
+			rules:     models.PricingRules{Rounding: money.HalfEven},
+			lines:     []models.PricedLine{coffee, food},
+			discounts: []models.AppliedDiscount{{Source: models.DiscountFromPromotion, Amount: 120}},
+			want:      models.OrderPricing{Subtotal: 1200, DiscountTotal: 120, TaxTotal: 85, Total: 1165},
+			taxes: []models.TaxLine{
+				{Category: "coffee", Rate: 1000, Taxable: 630, Amount: 63},
+				{Category: "food", Rate: 500, Taxable: 450, Amount: 22},
+			},
+			nets: []money.Amount{693, 472},
+		},
+		{
+			name:      "product discount",
+			lines:     []models.PricedLine{coffee, food},
+			discounts: []models.AppliedDiscount{{Source: models.DiscountFromPromotion, ProductID: 2, Amount: 100}},
+			want:      models.OrderPricing{Subtotal: 1200, DiscountTotal: 100, TaxTotal: 90, Total: 1190},
+			taxes: []models.TaxLine{
+				{Category: "coffee", Rate: 1000, Taxable: 700, Amount: 70},
+				{Category: "food", Rate: 500, Taxable: 400, Amount: 20},
+			},
+			nets: []money.Amount{770, 420},
+		},
+		{
+			name:  "promotion and loyalty discounts together",
+			lines: []models.PricedLine{coffee},
+			discounts: []models.AppliedDiscount{
+				{Source: models.DiscountFromPromotion, Amount: 100},
+				{Source: models.DiscountFromLoyalty, Amount: 100},
+			},
+			want:  models.OrderPricing{Subtotal: 700, DiscountTotal: 200, TaxTotal: 50, Total: 550},
+			taxes: []models.TaxLine{{Category: "coffee", Rate: 1000, Taxable: 500, Amount: 50}},
+			nets:  []money.Amount{550},
+		},
+		{
+			name:      "discount larger than the order",
+			lines:     []models.PricedLine{coffee},
+			discounts: []models.AppliedDiscount{{Source: models.DiscountFromLoyalty, Amount: 1000}},
+			want:      models.OrderPricing{Subtotal: 700, DiscountTotal: 700},
+			nets:      []money.Amount{0},
+		},
+		{
+			name:  "untaxed category",
+			rules: models.PricingRules{},
+			lines: []models.PricedLine{pricedLine(3, "retail", 1, 1299, 0)},
+			want:  models.OrderPricing{Subtotal: 1299, Total: 1299},
+			nets:  []money.Amount{1299},
+		},
+		{
+			name:  "cash rounding",
+			rules: models.PricingRules{CashIncrement: 5},
+			lines: []models.PricedLine{pricedLine(3, "retail", 1, 333, 0)},
+			want:  models.OrderPricing{Subtotal: 333, Rounding: 2, Total: 335},
+			nets:  []money.Amount{333},
+		},
+		{
+			name:  "cash rounding down",
+			rules: models.PricingRules{CashIncrement: 10, Rounding: money.Down},
+			lines: []models.PricedLine{pricedLine(3, "retail", 1, 339, 0)},
+			want:  models.OrderPricing{Subtotal: 339, Rounding: -9, Total: 330},
+			nets:  []money.Amount{339},
+		},
+	} {
+		got := price(tc.rules, tc.lines, tc.discounts)
+
+		if got.Subtotal != tc.want.Subtotal || got.DiscountTotal != tc.want.DiscountTotal || got.TaxTotal != tc.want.TaxTotal ||
+			got.Rounding != tc.want.Rounding || got.Total != tc.want.Total {
+			t.Errorf("%s: subtotal %s, discounts %s, tax %s, rounding %s, total %s; want %s, %s, %s, %s, %s", tc.name,
+				got.Subtotal, got.DiscountTotal, got.TaxTotal, got.Rounding, got.Total,
+				tc.want.Subtotal, tc.want.DiscountTotal, tc.want.TaxTotal, tc.want.Rounding, tc.want.Total)
+		}
+		if !slices.Equal(got.Taxes, tc.taxes) {
+			t.Errorf("%s: taxes %+v, want %+v", tc.name, got.Taxes, tc.taxes)
+		}
+
+		var nets []money.Amount
+		var sum money.Amount
+		for _, line := range got.Lines {
+			nets = append(nets, line.Net)
+			sum += line.Net
+		}
+		if !slices.Equal(nets, tc.nets) {
+			t.Errorf("%s: line nets %v, want %v", tc.name, nets, tc.nets)
+		}
+		if sum != got.Total-got.Rounding {
+			t.Errorf("%s: line nets add up to %s, want the total before rounding %s", tc.name, sum, got.Total-got.Rounding)
+		}
+		if tc.lines[0].Net != 0 {
+			t.Errorf("%s: price changed the lines it was given", tc.name)
+		}
+	}
+}
+
+func TestOrderRules(t *testing.T) {
+	o := &OrderImpl{pricing: models.PricingRules{DefaultTaxRate: 500, Rounding: money.Up, CashIncrement: 10}}
+	lines := []models.PricedLine{pricedLine(1, "coffee", 1, 333, 0)}
+
+	// An order keeps the rounding it was created under after the rules
+	// change, and one from before the rounding was kept follows the rules.
+	kept := models.Order{Lines: lines, Rounding: money.Down, CashIncrement: 5}
+	if got := price(o.orderRules(kept), lines, nil).Total; got != 330 {
+		t.Errorf("total under the order's own rounding = %s, want 3.30", got)
+	}
+	legacy := models.Order{Lines: lines}
+	if got := price(o.orderRules(legacy), lines, nil).Total; got != 340 {
+		t.Errorf("total of an order without a rounding = %s, want 3.40", got)
+	}
+	if rules := o.orderRules(kept); rules.DefaultTaxRate != 500 {
+		t.Errorf("orderRules dropped the tax rates: %+v", rules)
+	}
+}
@@ -0,0 +1,289 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"github.com/weeweeshka/hot-coffee/internal/money"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+)
+
+type PromotionImpl struct {
+	logr *slog.Logger
+	repo PromotionRepo
+}
+
+type PromotionRepo interface {
+	SavePromotion(ctx context.Context, p models.Promotion) (int64, error)
+	GetAllPromotions(ctx context.Context) ([]models.Promotion, error)
+	GetPromotion(ctx context.Context, id int64) (models.Promotion, error)
+	GetPromotionByCode(ctx context.Context, code string) (models.Promotion, error)
+	UpdatePromotion(ctx context.Context, id int64, p models.Promotion) (models.Promotion, error)
+	DeactivatePromotion(ctx context.Context, id int64) error
+	// GetOrderPromotionUsages lists the usages of the orders that are not
+	// voided, in one query however many orders are asked for.
+	GetOrderPromotionUsages(ctx context.Context, orderIDs ...int64) ([]models.PromotionUsage, error)
+}
+
+// appliedPromotion is a promotion priced against an order.
+type appliedPromotion struct {
+	promotion models.Promotion
+	amount    money.Amount
+}
+
+func NewPromotionService(logr *slog.Logger, repo PromotionRepo) *PromotionImpl {
+	return &PromotionImpl{
+		logr: logr,
+		repo: repo,
+	}
+}
+
+// CreatePromotion adds an active promotion.
+func (p *PromotionImpl) CreatePromotion(ctx context.Context, promotion models.Promotion) (int64, error) {
+	promotion.Active = true
+	promotion, err := validatePromotion(promotion)
+	if err != nil {
+		p.logr.Info("Promotion Create Error", "err", err)
+		return 0, err
+	}
+
+	id, err := p.repo.SavePromotion(ctx, promotion)
+	if err != nil {
+		p.logr.Info("Promotion Create Error", "err", err)
+		return 0, err
+	}
+	return id, nil
+}
+
+func (p *PromotionImpl) GetPromotions(ctx context.Context) ([]models.Promotion, error) {
+	promotions, err := p.repo.GetAllPromotions(ctx)
+	if err != nil {
+		p.logr.Info("Promotion Get All Error", "err", err)
+		return []models.Promotion{}, err
+	}
+	return promotions, nil
+}
+
+func (p *PromotionImpl) GetPromotion(ctx context.Context, id int64) (models.Promotion, error) {
+	promotion, err := p.repo.GetPromotion(ctx, id)
+	if err != nil {
+		p.logr.Info("Promotion Get Error", "err", err)
+		return models.Promotion{}, err
+	}
+	return promotion, nil
+}
+
+func (p *PromotionImpl) UpdatePromotion(ctx context.Context, id int64, promotion models.Promotion) (models.Promotion, error) {
+	promotion, err := validatePromotion(promotion)
+	if err != nil {
+		p.logr.Info("Promotion Update Error", "err", err)
+		return models.Promotion{}, err
+	}
+
+	nPromotion, err := p.repo.UpdatePromotion(ctx, id, promotion)
+	if err != nil {
+		p.logr.Info("Promotion Update Error", "err", err)
+		return models.Promotion{}, err
+	}
+	return nPromotion, nil
+}
+
+// DeletePromotion deactivates the promotion; its usage history is kept for
+// reports.
+func (p *PromotionImpl) DeletePromotion(ctx context.Context, id int64) error {
+	err := p.repo.DeactivatePromotion(ctx, id)
+	if err != nil {
+		p.logr.Info("Promotion Delete Error", "err", err)
+	}
+	return err
+}
+
+// quote looks up code and prices it against the order lines at now. Usage
+// limits are checked when the usage is saved.
+func (p *PromotionImpl) quote(ctx context.Context, code string, lines []models.PricedLine, rounding money.RoundingMode, now time.Time) (appliedPromotion, error) {
+	promotion, err := p.repo.GetPromotionByCode(ctx, normalizeCode(code))
+	if errors.Is(err, models.ErrNotFound) {
+		return appliedPromotion{}, fmt.Errorf("%w: unknown code %q", models.ErrPromoNotApplicable, code)
+	}
+	if err != nil {
+		return appliedPromotion{}, err
+	}
+
+	if err = promotionApplies(promotion, now); err != nil {
+		return appliedPromotion{}, err
+	}
+
+	amount := promotionDiscount(promotion, lines, rounding)
+	if amount <= 0 {
+		return appliedPromotion{}, fmt.Errorf("%w: %s gives no discount on this order", models.ErrPromoNotApplicable, promotion.Code)
+	}
+	return appliedPromotion{promotion: promotion, amount: amount}, nil
+}
+
+// reprice returns the usages of an order's promotions with the discounts
+// they give once its items change to lines, for the update to save. code is
+// the promo code the update asks for, which can repeat the order's promotion
+// but not change it.
+func (p *PromotionImpl) reprice(ctx context.Context, orderID int64, code string, lines []models.PricedLine, rounding money.RoundingMode) ([]models.PromotionUsage, error) {
+	usages, err := p.repo.GetOrderPromotionUsages(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if code != "" && !slices.ContainsFunc(usages, func(u models.PromotionUsage) bool { return u.Code == normalizeCode(code) }) {
+		return nil, fmt.Errorf("%w: the promo code of order %d cannot change", models.ErrInvalidOrder, orderID)
+	}
+
+	for i, u := range usages {
+		promotion, err := p.repo.GetPromotion(ctx, u.PromotionID)
+		if err != nil {
+			return nil, err
+		}
+		usages[i].Amount = promotionDiscount(promotion, lines, rounding)
+	}
+	return usages, nil
+}
+
+func promotionApplies(p models.Promotion, now time.Time) error {
+	switch {
+	case !p.Active:
+		return fmt.Errorf("%w: %s is not active", models.ErrPromoNotApplicable, p.Code)
+	case p.StartsAt != nil && now.Before(*p.StartsAt):
+		return fmt.Errorf("%w: %s starts at %s", models.ErrPromoNotApplicable, p.Code, p.StartsAt.Format(time.RFC3339))
+	case p.EndsAt != nil && !now.Before(*p.EndsAt):
+		return fmt.Errorf("%w: %s ended at %s", models.ErrPromoNotApplicable, p.Code, p.EndsAt.Format(time.RFC3339))
+	case p.Window != nil && !inWindow(*p.Window, now):
+		return fmt.Errorf("%w: %s is only valid %s-%s", models.ErrPromoNotApplicable, p.Code, p.Window.Start, p.Window.End)
+	}
+	return nil
+}
+
+// inWindow reports whether now falls in the window. A window that runs past
+// midnight belongs to the day it started on.
+func inWindow(w models.TimeWindow, now time.Time) bool {
+	start, _ := time.Parse("15:04", w.Start)
+	end, _ := time.Parse("15:04", w.End)
+	from := start.Hour()*60 + start.Minute()
+	to := end.Hour()*60 + end.Minute()
+	minute := now.Hour()*60 + now.Minute()
+
+	day := now.Weekday()
+	switch {
+	case from < to:
+		if minute < from || minute >= to {
+			return false
+		}
+	case minute >= from:
+	case minute < to:
+		day = (day + 6) % 7
+	default:
+		return false
+	}
+
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// promotionDiscount is the amount p takes off the lines, never more than
+// the lines it applies to cost.
+func promotionDiscount(p models.Promotion, lines []models.PricedLine, rounding money.RoundingMode) money.Amount {
+	var eligible money.Amount
+	var units []money.Amount
+	for _, line := range lines {
+		if p.ProductID != 0 && line.ProductID != p.ProductID {
+			continue
+		}
+		eligible += line.LineTotal
+		for i := 0; i < line.Quantity; i++ {
+			units = append(units, line.UnitPrice)
+		}
+	}
+
+	var amount money.Amount
+	switch p.Type {
+	case models.DiscountPercentage:
+		amount = eligible.Percent(p.Percent(), rounding)
+	case models.DiscountFixed:
+		amount = p.Value
+	case models.DiscountBuyXGetY:
+		slices.Sort(units)
+		free := len(units) / (p.BuyQuantity + p.GetQuantity) * p.GetQuantity
+		for _, price := range units[:free] {
+			amount += price
+		}
+	}
+	return min(amount, eligible)
+}
+
+func normalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func validatePromotion(p models.Promotion) (models.Promotion, error) {
+	p.Code = normalizeCode(p.Code)
+	p.Name = strings.TrimSpace(p.Name)
+
+	if p.Code == "" || strings.ContainsAny(p.Code, " \t\n") {
+		return p, fmt.Errorf("%w: code must be a single word", models.ErrInvalidPromotion)
+	}
+	if p.Name == "" {
+		p.Name = p.Code
+	}
+
+	switch p.Type {
+	case models.DiscountPercentage:
+		if p.Percent() <= 0 || p.Percent() > money.Percent100 {
+			return p, fmt.Errorf("%w: percentage must be in (0, 100]", models.ErrInvalidPromotion)
+		}
+	case models.DiscountFixed:
+		if p.Value <= 0 {
+			return p, fmt.Errorf("%w: fixed amount must be positive", models.ErrInvalidPromotion)
+		}
+	case models.DiscountBuyXGetY:
+		if p.ProductID == 0 {
+			return p, fmt.Errorf("%w: buy-x-get-y needs a product", models.ErrInvalidPromotion)
+		}
+		if p.BuyQuantity <= 0 || p.GetQuantity <= 0 {
+			return p, fmt.Errorf("%w: buy and get quantities must be positive", models.ErrInvalidPromotion)
+		}
+	default:
+		return p, fmt.Errorf("%w: unknown type %q", models.ErrInvalidPromotion, p.Type)
+	}
+
+	if w := p.Window; w != nil {
+		start, err := time.Parse("15:04", w.Start)
+		if err != nil {
+			return p, fmt.Errorf("%w: window start %q is not HH:MM", models.ErrInvalidPromotion, w.Start)
+		}
+		end, err := time.Parse("15:04", w.End)
+		if err != nil {
+			return p, fmt.Errorf("%w: window end %q is not HH:MM", models.ErrInvalidPromotion, w.End)
+		}
+		if start.Equal(end) {
+			return p, fmt.Errorf("%w: window is empty", models.ErrInvalidPromotion)
+		}
+		for _, day := range w.Days {
+			if day < time.Sunday || day > time.Saturday {
+				return p, fmt.Errorf("%w: unknown weekday %d", models.ErrInvalidPromotion, day)
+			}
+		}
+	}
+
+	if p.StartsAt != nil && p.EndsAt != nil && !p.StartsAt.Before(*p.EndsAt) {
+		return p, fmt.Errorf("%w: starts_at must be before ends_at", models.ErrInvalidPromotion)
+	}
+	if p.MaxUses < 0 || p.MaxUsesPerCustomer < 0 || p.MaxDiscountTotal < 0 {
+		return p, fmt.Errorf("%w: limits must not be negative", models.ErrInvalidPromotion)
+	}
+	return p, nil
+}
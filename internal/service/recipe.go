@@ -0,0 +1,237 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"github.com/weeweeshka/hot-coffee/internal/money"
+	"github.com/weeweeshka/hot-coffee/internal/units"
+	"math"
+)
+
+// recipeBook resolves menu recipes into amounts of stocked ingredients. It
+// caches what it looks up, so it is meant to live for a single request.
+type recipeBook struct {
+	menu      MenuRepo
+	inventory InventoryRepo
+	menus     map[int64]models.MenuItem
+	stock     map[int64]models.InventoryItem
+	// stockLoaded means stock holds the whole inventory, so a miss is final.
+	stockLoaded bool
+}
+
+func newRecipeBook(menu MenuRepo, inventory InventoryRepo) *recipeBook {
+	return &recipeBook{
+		menu:      menu,
+		inventory: inventory,
+		menus:     make(map[int64]models.MenuItem),
+		stock:     make(map[int64]models.InventoryItem),
+	}
+}
+
+func (b *recipeBook) menuItem(ctx context.Context, id int64) (models.MenuItem, error) {
+	if menu, ok := b.menus[id]; ok {
+		return menu, nil
+	}
+	menu, err := b.menu.GetMenu(ctx, id)
+	if err != nil {
+		return models.MenuItem{}, err
+	}
+	b.menus[id] = menu
+	return menu, nil
+}
+
+// orderLine is an order item resolved against the menu.
+type orderLine struct {
+	menu      models.MenuItem
+	variant   models.MenuVariant
+	modifiers []models.Modifier
+}
+
+func (l orderLine) name() string {
+	if l.variant.Name == "" {
+		return l.menu.Name
+	}
+	return l.menu.Name + " (" + l.variant.Name + ")"
+}
+
+// unitPrice is the variant's price plus the price deltas of the selected
+// modifiers.
+func (l orderLine) unitPrice() money.Amount {
+	price := l.variant.Price
+	for _, modifier := range l.modifiers {
+		price += modifier.PriceDelta
+	}
+	return price
+}
+
+// recipe is the variant's recipe followed by the ingredient deltas of the
+// selected modifiers, so an ingredient may appear more than once.
+func (l orderLine) recipe() []models.MenuItemIngredient {
+	recipe := append([]models.MenuItemIngredient(nil), l.variant.Ingredients...)
+	for _, modifier := range l.modifiers {
+		recipe = append(recipe, modifier.Ingredients...)
+	}
+	return recipe
+}
+
+// orderLine resolves the menu item and variant an order item asks for.
+func (b *recipeBook) orderLine(ctx context.Context, item models.OrderItem) (orderLine, error) {
+	menu, err := b.menuItem(ctx, item.ProductID)
+	if errors.Is(err, models.ErrNotFound) {
+		return orderLine{}, fmt.Errorf("%w: unknown product %d", models.ErrInvalidOrder, item.ProductID)
+	}
+	if err != nil {
+		return orderLine{}, err
+	}
+
+	variant, ok := menu.Variant(item.VariantID)
+	if !ok {
+		if item.VariantID == 0 {
+			return orderLine{}, fmt.Errorf("%w: product %d needs a variant", models.ErrInvalidOrder, item.ProductID)
+		}
+		return orderLine{}, fmt.Errorf("%w: product %d has no variant %d", models.ErrInvalidOrder, item.ProductID, item.VariantID)
+	}
+
+	modifiers, err := selectModifiers(menu, item.Modifiers)
+	if err != nil {
+		return orderLine{}, err
+	}
+	return orderLine{menu: menu, variant: variant, modifiers: modifiers}, nil
+}
+
+// selectModifiers checks the selection against the item's modifier groups.
+func selectModifiers(menu models.MenuItem, ids []int64) ([]models.Modifier, error) {
+	selected := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		if selected[id] {
+			return nil, fmt.Errorf("%w: modifier %d selected twice", models.ErrInvalidOrder, id)
+		}
+		selected[id] = true
+	}
+
+	modifiers := make([]models.Modifier, 0, len(ids))
+	for _, group := range menu.ModifierGroups {
+		count := 0
+		for _, modifier := range group.Modifiers {
+			if selected[modifier.ID] {
+				modifiers = append(modifiers, modifier)
+				delete(selected, modifier.ID)
+				count++
+			}
+		}
+
+		if count < group.MinSelect {
+			return nil, fmt.Errorf("%w: %s needs at least %d of %s", models.ErrInvalidOrder, menu.Name, group.MinSelect, group.Name)
+		}
+		if group.MaxSelect > 0 && count > group.MaxSelect {
+			return nil, fmt.Errorf("%w: %s allows at most %d of %s", models.ErrInvalidOrder, menu.Name, group.MaxSelect, group.Name)
+		}
+	}
+
+	for id := range selected {
+		return nil, fmt.Errorf("%w: product %d has no modifier %d", models.ErrInvalidOrder, menu.ID, id)
+	}
+	return modifiers, nil
+}
+
+// loadStock reads the whole inventory at once, for callers that are about to
+// look at many recipes.
+func (b *recipeBook) loadStock(ctx context.Context) error {
+	items, err := b.inventory.GetAllInventories(ctx)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		b.stock[item.IngredientID] = item
+	}
+	b.stockLoaded = true
+	return nil
+}
+
+func (b *recipeBook) stockItem(ctx context.Context, id int64) (models.InventoryItem, error) {
+	if item, ok := b.stock[id]; ok {
+		return item, nil
+	}
+	if b.stockLoaded {
+		return models.InventoryItem{}, models.ErrNotFound
+	}
+	item, err := b.inventory.GetInventory(ctx, id)
+	if err != nil {
+		return models.InventoryItem{}, err
+	}
+	b.stock[id] = item
+	return item, nil
+}
+
+// stockAmount converts a recipe line into the unit its ingredient is stocked
+// in. Ingredients that are not stocked at all are left as they are; there is
+// nothing to draw them from either way.
+func (b *recipeBook) stockAmount(ctx context.Context, ingredient models.MenuItemIngredient) (float64, error) {
+	if ingredient.Unit == "" {
+		return ingredient.Quantity, nil
+	}
+
+	item, err := b.stockItem(ctx, ingredient.IngredientID)
+	if errors.Is(err, models.ErrNotFound) {
+		return ingredient.Quantity, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	quantity, err := units.Convert(ingredient.Quantity, ingredient.Unit, item.Unit, item.Density)
+	if err != nil {
+		return 0, fmt.Errorf("ingredient %d: %w", ingredient.IngredientID, err)
+	}
+	return quantity, nil
+}
+
+// stockNeeds sums a recipe per ingredient in stock units.
+func (b *recipeBook) stockNeeds(ctx context.Context, recipe []models.MenuItemIngredient) (map[int64]float64, error) {
+	needs := make(map[int64]float64, len(recipe))
+	for _, ingredient := range recipe {
+		amount, err := b.stockAmount(ctx, ingredient)
+		if err != nil {
+			return nil, err
+		}
+		needs[ingredient.IngredientID] += amount
+	}
+	return needs, nil
+}
+
+// maxServings is how many times the recipe can be made from current stock, or
+// nil when the recipe draws on no stock at all.
+func (b *recipeBook) maxServings(ctx context.Context, recipe []models.MenuItemIngredient) (*int64, error) {
+	needs, err := b.stockNeeds(ctx, recipe)
+	if err != nil {
+		return nil, err
+	}
+
+	var servings *int64
+	for id, amount := range needs {
+		if amount <= 0 {
+			continue
+		}
+
+		var available float64
+		item, err := b.stockItem(ctx, id)
+		switch {
+		case err == nil:
+			available = item.Quantity
+		case !errors.Is(err, models.ErrNotFound):
+			return nil, err
+		}
+
+		// The epsilon keeps 0.3 / 0.1 from rounding down to two servings.
+		n := int64(math.Floor(available/amount + 1e-9))
+		if n < 0 {
+			n = 0
+		}
+		if servings == nil || n < *servings {
+			servings = &n
+		}
+	}
+	return servings, nil
+}
@@ -0,0 +1,275 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"github.com/weeweeshka/hot-coffee/internal/money"
+	"log/slog"
+	"strings"
+)
+
+type RefundImpl struct {
+	logr      *slog.Logger
+	repo      RefundRepo
+	orders    OrderReader
+	menu      MenuRepo
+	inventory InventoryRepo
+	gateway   PaymentGateway
+}
+
+type RefundRepo interface {
+	// SaveRefund records the refund, puts restock back into the inventory
+	// and takes back the loyalty points the order earned, as
+	// models.RefundedPoints works out from the order's refunds so far and
+	// orderTotal, all in one transaction. It fails with
+	// models.ErrInvalidRefund when the refund gives back more of a line or a
+	// payment than is left.
+	SaveRefund(ctx context.Context, r models.Refund, restock []models.IngredientAmount, orderTotal money.Amount) (models.Refund, error)
+	GetOrderRefunds(ctx context.Context, orderID int64) ([]models.Refund, error)
+	GetOrderPayments(ctx context.Context, orderID int64) ([]models.Payment, error)
+}
+
+// NewRefundService gives card payments back through gateway, which may be
+// nil when only cash is taken.
+func NewRefundService(logr *slog.Logger, repo RefundRepo, orders OrderReader, menu MenuRepo, inventory InventoryRepo, gateway PaymentGateway) *RefundImpl {
+	return &RefundImpl{
+		logr:      logr,
+		repo:      repo,
+		orders:    orders,
+		menu:      menu,
+		inventory: inventory,
+		gateway:   gateway,
+	}
+}
+
+// Refund gives back the lines of the request, or whatever is left of the
+// order when it names none. Each line is refunded at its net price, so its
+// share of discounts stays off and its share of tax comes back.
+func (r *RefundImpl) Refund(ctx context.Context, orderID int64, req models.RefundRequest) (models.Refund, error) {
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		err := fmt.Errorf("%w: reason is required", models.ErrInvalidRefund)
+		r.logr.Info("Refund Error", "err", err)
+		return models.Refund{}, err
+	}
+
+	order, err := r.orders.GetOrder(ctx, orderID)
+	if err != nil {
+		r.logr.Info("Refund Error", "err", err)
+		return models.Refund{}, err
+	}
+
+	payments, err := r.repo.GetOrderPayments(ctx, orderID)
+	if err != nil {
+		r.logr.Info("Refund Error", "err", err)
+		return models.Refund{}, err
+	}
+
+	switch {
+	case order.Status == models.StatusClosed:
+	case order.Status == models.StatusCancelled && len(payments) > 0:
+		if req.Restock {
+			err = fmt.Errorf("%w: cancelled orders are already restocked", models.ErrInvalidRefund)
+			r.logr.Info("Refund Error", "err", err)
+			return models.Refund{}, err
+		}
+	default:
+		err = fmt.Errorf("%w: order %d is %s", models.ErrInvalidRefund, orderID, order.Status)
+		r.logr.Info("Refund Error", "err", err)
+		return models.Refund{}, err
+	}
+
+	previous, err := r.repo.GetOrderRefunds(ctx, orderID)
+	if err != nil {
+		r.logr.Info("Refund Error", "err", err)
+		return models.Refund{}, err
+	}
+
+	refund, err := refundLines(order, previous, req)
+	if err != nil {
+		r.logr.Info("Refund Error", "err", err)
+		return models.Refund{}, err
+	}
+
+	refund.Payments, err = refundPayments(payments, refund.Amount)
+	if err != nil {
+		r.logr.Info("Refund Error", "err", err)
+		return models.Refund{}, err
+	}
+	for _, p := range refund.Payments {
+		if p.Method == models.PaymentCard && r.gateway == nil {
+			err = fmt.Errorf("%w: card payments are not enabled", models.ErrInvalidRefund)
+			r.logr.Info("Refund Error", "err", err)
+			return models.Refund{}, err
+		}
+	}
+
+	var restock []models.IngredientAmount
+	if req.Restock {
+		restock, err = r.restock(ctx, order, refund.Lines)
+		if err != nil {
+			r.logr.Info("Refund Error", "err", err)
+			return models.Refund{}, err
+		}
+	}
+
+	refund, err = r.repo.SaveRefund(ctx, refund, restock, order.Pricing.Total)
+	if err != nil {
+		r.logr.Info("Refund Error", "err", err)
+		return models.Refund{}, err
+	}
+
+	// The refund is on record before any card is credited, so a card that
+	// fails here is logged and reported for a manual refund rather than
+	// refunded twice.
+	for _, p := range refund.Payments {
+		if p.Method != models.PaymentCard {
+			continue
+		}
+		if err = r.gateway.Refund(ctx, p.Reference, p.Amount); err != nil {
+			r.logr.Error("Failed to refund card payment", "refund_id", refund.ID, "payment_id", p.PaymentID, "reference", p.Reference, "err", err)
+			return refund, fmt.Errorf("%w: refund %d, payment %d: %v", models.ErrRefundFailed, refund.ID, p.PaymentID, err)
+		}
+	}
+	return refund, nil
+}
+
+func (r *RefundImpl) GetRefunds(ctx context.Context, orderID int64) ([]models.Refund, error) {
+	if _, err := r.orders.GetOrder(ctx, orderID); err != nil {
+		r.logr.Info("Refund Get Error", "err", err)
+		return nil, err
+	}
+
+	refunds, err := r.repo.GetOrderRefunds(ctx, orderID)
+	if err != nil {
+		r.logr.Info("Refund Get Error", "err", err)
+		return nil, err
+	}
+	return refunds, nil
+}
+
+// restock works out the ingredients of the refunded lines from today's
+// recipes. The storage caps it at what the order took out of the inventory.
+func (r *RefundImpl) restock(ctx context.Context, order models.OrderResponse, lines []models.RefundLine) ([]models.IngredientAmount, error) {
+	byID := make(map[int64]models.PricedLine, len(order.Pricing.Lines))
+	for _, line := range order.Pricing.Lines {
+		byID[line.ID] = line
+	}
+
+	items := make([]models.OrderItem, 0, len(lines))
+	for _, refunded := range lines {
+		line := byID[refunded.LineID]
+		items = append(items, models.OrderItem{
+			ProductID: line.ProductID,
+			VariantID: line.VariantID,
+			Modifiers: line.Modifiers,
+			Quantity:  refunded.Quantity,
+		})
+	}
+	return newRecipeBook(r.menu, r.inventory).consumption(ctx, items)
+}
+
+// refundLines prices the lines the request gives back against what earlier
+// refunds left of them. A line refunded to the last unit gets whatever is
+// left of its net price, and an order refunded in full gets back the rest of
+// its total, cash rounding included.
+func refundLines(order models.OrderResponse, previous []models.Refund, req models.RefundRequest) (models.Refund, error) {
+	type refunded struct {
+		quantity int
+		amount   money.Amount
+	}
+	done := make(map[int64]refunded)
+	var doneTotal money.Amount
+	for _, refund := range previous {
+		doneTotal += refund.Amount
+		for _, line := range refund.Lines {
+			d := done[line.LineID]
+			d.quantity += line.Quantity
+			d.amount += line.Amount
+			done[line.LineID] = d
+		}
+	}
+
+	lines := make(map[int64]models.PricedLine, len(order.Pricing.Lines))
+	for _, line := range order.Pricing.Lines {
+		lines[line.ID] = line
+	}
+
+	requested := req.Lines
+	if len(requested) == 0 {
+		for _, line := range order.Pricing.Lines {
+			if left := line.Quantity - done[line.ID].quantity; left > 0 {
+				requested = append(requested, models.RefundLine{LineID: line.ID, Quantity: left})
+			}
+		}
+		if len(requested) == 0 {
+			return models.Refund{}, fmt.Errorf("%w: order %d is already refunded", models.ErrInvalidRefund, order.ID)
+		}
+	}
+
+	refund := models.Refund{OrderID: order.ID, Reason: req.Reason, Restock: req.Restock}
+	seen := make(map[int64]bool, len(requested))
+	for _, r := range requested {
+		line, ok := lines[r.LineID]
+		if !ok {
+			return models.Refund{}, fmt.Errorf("%w: line %d is not on order %d", models.ErrInvalidRefund, r.LineID, order.ID)
+		}
+		if seen[r.LineID] {
+			return models.Refund{}, fmt.Errorf("%w: line %d is listed twice", models.ErrInvalidRefund, r.LineID)
+		}
+		seen[r.LineID] = true
+
+		left := line.Quantity - done[line.ID].quantity
+		if r.Quantity <= 0 || r.Quantity > left {
+			return models.Refund{}, fmt.Errorf("%w: line %d has %d left to refund, not %d", models.ErrInvalidRefund, r.LineID, left, r.Quantity)
+		}
+
+		r.Amount = line.Net.Mul(r.Quantity).Div(int64(line.Quantity), money.HalfUp)
+		if r.Quantity == left {
+			r.Amount = line.Net - done[line.ID].amount
+		}
+		refund.Lines = append(refund.Lines, r)
+		refund.Amount += r.Amount
+
+		d := done[r.LineID]
+		d.quantity += r.Quantity
+		done[r.LineID] = d
+	}
+
+	everything := true
+	for _, line := range order.Pricing.Lines {
+		if done[line.ID].quantity < line.Quantity {
+			everything = false
+		}
+	}
+	if everything {
+		refund.Amount = order.Pricing.Total - doneTotal
+	}
+	refund.Amount = max(refund.Amount, 0)
+	return refund, nil
+}
+
+// refundPayments takes amount off the order's payments, newest first. Orders
+// with no payments on record are refunded outside the till.
+func refundPayments(payments []models.Payment, amount money.Amount) ([]models.PaymentRefund, error) {
+	if len(payments) == 0 {
+		return nil, nil
+	}
+
+	var refunds []models.PaymentRefund
+	left := amount
+	for i := len(payments) - 1; i >= 0 && left > 0; i-- {
+		p := payments[i]
+		part := min(left, p.Amount-p.Refunded)
+		if part <= 0 {
+			continue
+		}
+		refunds = append(refunds, models.PaymentRefund{PaymentID: p.ID, Method: p.Method, Amount: part, Reference: p.Reference})
+		left -= part
+	}
+	if left > 0 {
+		return nil, fmt.Errorf("%w: only %s of the payments is left to refund", models.ErrInvalidRefund, amount-left)
+	}
+	return refunds, nil
+}
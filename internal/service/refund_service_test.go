@@ -0,0 +1,173 @@
+package service
+
+import (
+	"errors"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"github.com/weeweeshka/hot-coffee/internal/money"
+	"slices"
+	"testing"
+)
+
+func TestRefundLines(t *testing.T) {
+	// Three lattes share a net of 10.00, so a single one is 3.33 and the
+	// last gets the cent left over. Cash rounding put 0.02 on the total.
+	order := models.OrderResponse{
+		ID: 9,
+		Pricing: models.OrderPricing{
+			Lines: []models.PricedLine{
+				{ID: 1, Quantity: 3, Net: 1000},
+				{ID: 2, Quantity: 1, Net: 548},
+			},
+			Rounding: 2,
+			Total:    1550,
+		},
+	}
+	refund := func(lines ...models.RefundLine) models.Refund {
+		r := models.Refund{Lines: lines}
+		for _, line := range lines {
+			r.Amount += line.Amount
+		}
+		return r
+	}
+	one := refund(models.RefundLine{LineID: 1, Quantity: 1, Amount: 333})
+	lattes := refund(models.RefundLine{LineID: 1, Quantity: 3, Amount: 1000})
+
+	for _, tc := range []struct {
+		name     string
+		previous []models.Refund
+		lines    []models.RefundLine
+		want     []models.RefundLine
+		amount   money.Amount
+	}{
+		{
+			name:   "one unit",
+			lines:  []models.RefundLine{{LineID: 1, Quantity: 1}},
+			want:   []models.RefundLine{{LineID: 1, Quantity: 1, Amount: 333}},
+			amount: 333,
+		},
+		{
+			name:   "two units round half up",
+			lines:  []models.RefundLine{{LineID: 1, Quantity: 2}},
+			want:   []models.RefundLine{{LineID: 1, Quantity: 2, Amount: 667}},
+			amount: 667,
+		},
+		{
+			name:     "rest of a line",
+			previous: []models.Refund{one},
+			lines:    []models.RefundLine{{LineID: 1, Quantity: 2}},
+			want:     []models.RefundLine{{LineID: 1, Quantity: 2, Amount: 667}},
+			amount:   667,
+		},
+		{
+			name:     "last unit gets the remainder",
+			previous: []models.Refund{one, one},
+			lines:    []models.RefundLine{{LineID: 1, Quantity: 1}},
+			want:     []models.RefundLine{{LineID: 1, Quantity: 1, Amount: 334}},
+			amount:   334,
+		},
+		{
+			name:   "several lines",
+			lines:  []models.RefundLine{{LineID: 2, Quantity: 1}, {LineID: 1, Quantity: 1}},
+			want:   []models.RefundLine{{LineID: 2, Quantity: 1, Amount: 548}, {LineID: 1, Quantity: 1, Amount: 333}},
+			amount: 881,
+		},
+		{
+			name:   "whole order",
+			want:   []models.RefundLine{{LineID: 1, Quantity: 3, Amount: 1000}, {LineID: 2, Quantity: 1, Amount: 548}},
+			amount: 1550,
+		},
+		{
+			name:     "rest of the order",
+			previous: []models.Refund{one},
+			want:     []models.RefundLine{{LineID: 1, Quantity: 2, Amount: 667}, {LineID: 2, Quantity: 1, Amount: 548}},
+			amount:   1217,
+		},
+		{
+			name:     "last line brings the cash rounding",
+			previous: []models.Refund{lattes},
+			lines:    []models.RefundLine{{LineID: 2, Quantity: 1}},
+			want:     []models.RefundLine{{LineID: 2, Quantity: 1, Amount: 548}},
+			amount:   550,
+		},
+	} {
+		got, err := refundLines(order, tc.previous, models.RefundRequest{Lines: tc.lines, Reason: "spilled", Restock: true})
+		if err != nil {
+			t.Errorf("refundLines %s: %v", tc.name, err)
+			continue
+		}
+		if !slices.Equal(got.Lines, tc.want) || got.Amount != tc.amount {
+			t.Errorf("refundLines %s = %v, %s; want %v, %s", tc.name, got.Lines, got.Amount, tc.want, tc.amount)
+		}
+		if got.OrderID != order.ID || got.Reason != "spilled" || !got.Restock {
+			t.Errorf("refundLines %s = order %d, reason %q, restock %t; want the request's", tc.name, got.OrderID, got.Reason, got.Restock)
+		}
+	}
+
+	for _, tc := range []struct {
+		name     string
+		previous []models.Refund
+		lines    []models.RefundLine
+	}{
+		{"already refunded", []models.Refund{lattes, refund(models.RefundLine{LineID: 2, Quantity: 1, Amount: 550})}, nil},
+		{"unknown line", nil, []models.RefundLine{{LineID: 3, Quantity: 1}}},
+		{"line listed twice", nil, []models.RefundLine{{LineID: 1, Quantity: 1}, {LineID: 1, Quantity: 1}}},
+		{"no units", nil, []models.RefundLine{{LineID: 1}}},
+		{"negative units", nil, []models.RefundLine{{LineID: 1, Quantity: -1}}},
+		{"more units than ordered", nil, []models.RefundLine{{LineID: 1, Quantity: 4}}},
+		{"more units than left", []models.Refund{one}, []models.RefundLine{{LineID: 1, Quantity: 3}}},
+		{"line already refunded", []models.Refund{lattes}, []models.RefundLine{{LineID: 1, Quantity: 1}}},
+	} {
+		if got, err := refundLines(order, tc.previous, models.RefundRequest{Lines: tc.lines}); !errors.Is(err, models.ErrInvalidRefund) {
+			t.Errorf("refundLines %s = %v, %v; want ErrInvalidRefund", tc.name, got.Lines, err)
+		}
+	}
+}
+
+func TestRefundPayments(t *testing.T) {
+	cash := models.Payment{ID: 1, Method: models.PaymentCash, Amount: 1000}
+	card := models.Payment{ID: 2, Method: models.PaymentCard, Amount: 500, Reference: "ch_1"}
+	cardRefunded := card
+	cardRefunded.Refunded = 500
+
+	for _, tc := range []struct {
+		name     string
+		payments []models.Payment
+		amount   money.Amount
+		want     []models.PaymentRefund
+	}{
+		{"no payments", nil, 300, nil},
+		{"nothing to refund", []models.Payment{cash, card}, 0, nil},
+		{"newest payment first", []models.Payment{cash, card}, 300, []models.PaymentRefund{
+			{PaymentID: 2, Method: models.PaymentCard, Amount: 300, Reference: "ch_1"},
+		}},
+		{"spills into older payments", []models.Payment{cash, card}, 700, []models.PaymentRefund{
+			{PaymentID: 2, Method: models.PaymentCard, Amount: 500, Reference: "ch_1"},
+			{PaymentID: 1, Method: models.PaymentCash, Amount: 200},
+		}},
+		{"skips refunded payments", []models.Payment{cash, cardRefunded}, 300, []models.PaymentRefund{
+			{PaymentID: 1, Method: models.PaymentCash, Amount: 300},
+		}},
+		{"everything", []models.Payment{cash, card}, 1500, []models.PaymentRefund{
+			{PaymentID: 2, Method: models.PaymentCard, Amount: 500, Reference: "ch_1"},
+			{PaymentID: 1, Method: models.PaymentCash, Amount: 1000},
+		}},
+	} {
+		got, err := refundPayments(tc.payments, tc.amount)
+		if err != nil || !slices.Equal(got, tc.want) {
+			t.Errorf("refundPayments %s = %v, %v; want %v", tc.name, got, err, tc.want)
+		}
+	}
+
+	for _, tc := range []struct {
+		name     string
+		payments []models.Payment
+		amount   money.Amount
+	}{
+		{"more than was paid", []models.Payment{cash, card}, 1501},
+		{"more than is left", []models.Payment{cash, cardRefunded}, 1001},
+	} {
+		if got, err := refundPayments(tc.payments, tc.amount); !errors.Is(err, models.ErrInvalidRefund) {
+			t.Errorf("refundPayments %s = %v, %v; want ErrInvalidRefund", tc.name, got, err)
+		}
+	}
+}
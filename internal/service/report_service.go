@@ -0,0 +1,238 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"github.com/weeweeshka/hot-coffee/internal/money"
+	"log/slog"
+	"math"
+	"time"
+)
+
+type ReportImpl struct {
+	logr    *slog.Logger
+	repo    ReportRepo
+	pooling models.TipPooling
+}
+
+type ReportRepo interface {
+	// TotalSales aggregates closed orders in [from, to); zero bounds are open.
+	// Periods of the series start at the truncation of closed_at to groupBy.
+	TotalSales(ctx context.Context, from, to time.Time, groupBy models.SalesGrouping) (models.SalesReport, error)
+	// PopularItems ranks menu items sold in closed orders in [from, to) and
+	// returns the top limit items by sortBy.
+	PopularItems(ctx context.Context, from, to time.Time, sortBy models.PopularItemsSort, limit int) ([]models.PopularItem, error)
+	// PromotionUsage measures every promotion by its usages in [from, to).
+	PromotionUsage(ctx context.Context, from, to time.Time) ([]models.PromotionUsageStats, error)
+	// Tips totals the tips of closed orders per day in [from, to), oldest
+	// day first, leaving the staff shares empty.
+	Tips(ctx context.Context, from, to time.Time) ([]models.TipDay, error)
+	GetShifts(ctx context.Context, from, to time.Time) ([]models.Shift, error)
+}
+
+type ReportOption func(*ReportImpl)
+
+// WithTipPooling sets how tips are shared when the report does not ask for
+// a rule. The default is models.PoolEqual.
+func WithTipPooling(pooling models.TipPooling) ReportOption {
+	return func(r *ReportImpl) {
+		r.pooling = pooling
+	}
+}
+
+const (
+	defaultPopularItemsLimit = 10
+	maxPopularItemsLimit     = 100
+)
+
+func NewReportService(logr *slog.Logger, repo ReportRepo, opts ...ReportOption) *ReportImpl {
+	r := &ReportImpl{logr: logr, repo: repo, pooling: models.PoolEqual}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+func (r *ReportImpl) TotalSales(ctx context.Context, from, to time.Time, groupBy models.SalesGrouping) (models.SalesReport, error) {
+	switch groupBy {
+	case "", models.GroupByDay, models.GroupByWeek, models.GroupByMonth:
+	default:
+		err := fmt.Errorf("%w: unsupported group_by %q", models.ErrInvalidReport, groupBy)
+		r.logr.Info("Total sales report error", "err", err)
+		return models.SalesReport{}, err
+	}
+
+	report, err := r.repo.TotalSales(ctx, from, to, groupBy)
+	if err != nil {
+		r.logr.Info("Total sales report error", "err", err)
+		return models.SalesReport{}, err
+	}
+
+	if !from.IsZero() {
+		report.From = &from
+	}
+	if !to.IsZero() {
+		report.To = &to
+	}
+	report.AverageTicket = averageTicket(report.TotalRevenue, report.OrderCount)
+	for i := range report.Series {
+		report.Series[i].AverageTicket = averageTicket(report.Series[i].Revenue, report.Series[i].OrderCount)
+	}
+	return report, nil
+}
+
+func (r *ReportImpl) PopularItems(ctx context.Context, from, to time.Time, sortBy models.PopularItemsSort, limit int) (models.PopularItemsReport, error) {
+	if sortBy == "" {
+		sortBy = models.SortByQuantity
+	}
+	if sortBy != models.SortByQuantity && sortBy != models.SortByRevenue {
+		err := fmt.Errorf("%w: unsupported sort %q", models.ErrInvalidReport, sortBy)
+		r.logr.Info("Popular items report error", "err", err)
+		return models.PopularItemsReport{}, err
+	}
+
+	if limit == 0 {
+		limit = defaultPopularItemsLimit
+	}
+	if limit < 0 || limit > maxPopularItemsLimit {
+		err := fmt.Errorf("%w: limit must be between 1 and %d", models.ErrInvalidReport, maxPopularItemsLimit)
+		r.logr.Info("Popular items report error", "err", err)
+		return models.PopularItemsReport{}, err
+	}
+
+	items, err := r.repo.PopularItems(ctx, from, to, sortBy, limit)
+	if err != nil {
+		r.logr.Info("Popular items report error", "err", err)
+		return models.PopularItemsReport{}, err
+	}
+
+	report := models.PopularItemsReport{SortBy: sortBy, Items: items}
+	if !from.IsZero() {
+		report.From = &from
+	}
+	if !to.IsZero() {
+		report.To = &to
+	}
+	return report, nil
+}
+
+func (r *ReportImpl) PromotionUsage(ctx context.Context, from, to time.Time) (models.PromotionReport, error) {
+	stats, err := r.repo.PromotionUsage(ctx, from, to)
+	if err != nil {
+		r.logr.Info("Promotion usage report error", "err", err)
+		return models.PromotionReport{}, err
+	}
+
+	report := models.PromotionReport{Promotions: stats}
+	if !from.IsZero() {
+		report.From = &from
+	}
+	if !to.IsZero() {
+		report.To = &to
+	}
+	return report, nil
+}
+
+// Tips shares every day's tips between the staff who worked that day, by
+// pooling or by the service's rule when pooling is empty.
+func (r *ReportImpl) Tips(ctx context.Context, from, to time.Time, pooling models.TipPooling) (models.TipReport, error) {
+	if pooling == "" {
+		pooling = r.pooling
+	}
+	if pooling != models.PoolEqual && pooling != models.PoolByHours {
+		err := fmt.Errorf("%w: unsupported pooling %q", models.ErrInvalidReport, pooling)
+		r.logr.Info("Tips report error", "err", err)
+		return models.TipReport{}, err
+	}
+
+	days, err := r.repo.Tips(ctx, from, to)
+	if err != nil {
+		r.logr.Info("Tips report error", "err", err)
+		return models.TipReport{}, err
+	}
+	shifts, err := r.repo.GetShifts(ctx, from, to)
+	if err != nil {
+		r.logr.Info("Tips report error", "err", err)
+		return models.TipReport{}, err
+	}
+
+	report := poolTips(days, shifts, pooling, time.Now())
+	if !from.IsZero() {
+		report.From = &from
+	}
+	if !to.IsZero() {
+		report.To = &to
+	}
+	return report, nil
+}
+
+// poolTips shares each day's tips between the staff whose shifts overlap
+// that day, equally or in proportion to the time they worked in it.
+func poolTips(days []models.TipDay, shifts []models.Shift, pooling models.TipPooling, now time.Time) models.TipReport {
+	if days == nil {
+		days = []models.TipDay{}
+	}
+	report := models.TipReport{Pooling: pooling, Days: days, Staff: []models.StaffTips{}}
+	totals := make(map[string]*models.StaffTips)
+	var order []string
+
+	for i := range days {
+		day := &days[i]
+		report.Total += day.Total
+
+		start := day.Date
+		end := start.AddDate(0, 0, 1)
+		worked := make(map[string]time.Duration)
+		var staff []string
+		for _, shift := range shifts {
+			d := shift.Worked(start, end, now)
+			if d <= 0 {
+				continue
+			}
+			if _, ok := worked[shift.Staff]; !ok {
+				staff = append(staff, shift.Staff)
+			}
+			worked[shift.Staff] += d
+		}
+		if len(staff) == 0 {
+			day.Unassigned = day.Total
+			report.Unassigned += day.Total
+			continue
+		}
+
+		weights := make([]money.Amount, len(staff))
+		for j, name := range staff {
+			weights[j] = 1
+			if pooling == models.PoolByHours {
+				weights[j] = money.Amount(worked[name] / time.Second)
+			}
+		}
+		for j, share := range day.Total.Allocate(weights) {
+			name := staff[j]
+			hours := math.Round(worked[name].Hours()*100) / 100
+			day.Staff = append(day.Staff, models.StaffTips{Staff: name, Hours: hours, Tips: share})
+
+			total, ok := totals[name]
+			if !ok {
+				total = &models.StaffTips{Staff: name}
+				totals[name] = total
+				order = append(order, name)
+			}
+			total.Hours += hours
+			total.Tips += share
+		}
+	}
+
+	for _, name := range order {
+		report.Staff = append(report.Staff, *totals[name])
+	}
+	return report
+}
+
+func averageTicket(revenue money.Amount, orders int64) money.Amount {
+	if orders == 0 {
+		return 0
+	}
+	return revenue.Div(orders, money.HalfUp)
+}
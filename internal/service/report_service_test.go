@@ -0,0 +1,121 @@
+package service
+
+import (
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"github.com/weeweeshka/hot-coffee/internal/money"
+	"slices"
+	"testing"
+	"time"
+)
+
+func at(day, hour, minute int) time.Time {
+	return time.Date(2026, 3, day, hour, minute, 0, 0, time.UTC)
+}
+
+func shift(staff string, start, end time.Time) models.Shift {
+	return models.Shift{Staff: staff, StartedAt: start, EndedAt: &end}
+}
+
+func tips(staff string, hours float64, amount money.Amount) models.StaffTips {
+	return models.StaffTips{Staff: staff, Hours: hours, Tips: amount}
+}
+
+// tipWeek is three days of tips: one worked by ann, bob and cat, whose shift
+// began the evening before, one by ann on a shift still open at noon, and
+// one nobody worked.
+func tipWeek() ([]models.TipDay, []models.Shift, time.Time) {
+	days := []models.TipDay{
+		{Date: at(2, 0, 0), Total: 1000},
+		{Date: at(3, 0, 0), Total: 301},
+		{Date: at(4, 0, 0), Total: 500},
+	}
+	shifts := []models.Shift{
+		shift("ann", at(2, 8, 0), at(2, 14, 0)),
+		shift("bob", at(2, 12, 0), at(2, 16, 0)),
+		shift("cat", at(1, 22, 0), at(2, 2, 0)),
+		{Staff: "ann", StartedAt: at(3, 9, 0)},
+	}
+	return days, shifts, at(3, 12, 0)
+}
+
+func expectTipReport(t *testing.T, report models.TipReport, days [][]models.StaffTips, staff []models.StaffTips) {
+	t.Helper()
+	if report.Total != 1801 || report.Unassigned != 500 {
+		t.Errorf("total %s, unassigned %s; want 18.01, 5.00", report.Total, report.Unassigned)
+	}
+	if !slices.Equal(report.Staff, staff) {
+		t.Errorf("staff = %v, want %v", report.Staff, staff)
+	}
+	for i, day := range report.Days {
+		if !slices.Equal(day.Staff, days[i]) {
+			t.Errorf("%s = %v, want %v", day.Date.Format(time.DateOnly), day.Staff, days[i])
+		}
+	}
+	if last := report.Days[2]; last.Unassigned != last.Total {
+		t.Errorf("%s unassigned = %s, want all of %s", last.Date.Format(time.DateOnly), last.Unassigned, last.Total)
+	}
+}
+
+func TestPoolTipsEqually(t *testing.T) {
+	days, shifts, now := tipWeek()
+	report := poolTips(days, shifts, models.PoolEqual, now)
+	if report.Pooling != models.PoolEqual {
+		t.Errorf("pooling = %s, want %s", report.Pooling, models.PoolEqual)
+	}
+	// The cent left over goes to the first of the staff.
+	expectTipReport(t, report,
+		[][]models.StaffTips{
+			{tips("ann", 6, 334), tips("bob", 4, 333), tips("cat", 2, 333)},
+			{tips("ann", 3, 301)},
+			nil,
+		},
+		[]models.StaffTips{tips("ann", 9, 635), tips("bob", 4, 333), tips("cat", 2, 333)},
+	)
+}
+
+func TestPoolTipsByHours(t *testing.T) {
+	days, shifts, now := tipWeek()
+	// Only the two hours cat worked after midnight count towards the 2nd,
+	// and ann's open shift counts up to now.
+	expectTipReport(t, poolTips(days, shifts, models.PoolByHours, now),
+		[][]models.StaffTips{
+			{tips("ann", 6, 500), tips("bob", 4, 333), tips("cat", 2, 167)},
+			{tips("ann", 3, 301)},
+			nil,
+		},
+		[]models.StaffTips{tips("ann", 9, 801), tips("bob", 4, 333), tips("cat", 2, 167)},
+	)
+}
+
+func TestPoolTipsAddsUpShifts(t *testing.T) {
+	day := []models.TipDay{{Date: at(2, 0, 0), Total: 1000}}
+	shifts := []models.Shift{
+		shift("ann", at(2, 8, 0), at(2, 9, 0)),
+		shift("bob", at(2, 8, 0), at(2, 10, 0)),
+		shift("ann", at(2, 15, 0), at(2, 16, 0)),
+	}
+	report := poolTips(day, shifts, models.PoolEqual, at(3, 0, 0))
+	if want := []models.StaffTips{tips("ann", 2, 500), tips("bob", 2, 500)}; !slices.Equal(report.Staff, want) {
+		t.Errorf("staff = %v, want %v", report.Staff, want)
+	}
+}
+
+func TestPoolTipsRoundsHours(t *testing.T) {
+	day := []models.TipDay{{Date: at(2, 0, 0), Total: 1000}}
+	shifts := []models.Shift{
+		shift("ann", at(2, 8, 0), at(2, 9, 20)),
+		shift("bob", at(2, 8, 0), at(2, 10, 40)),
+	}
+	report := poolTips(day, shifts, models.PoolByHours, at(3, 0, 0))
+	if want := []models.StaffTips{tips("ann", 1.33, 333), tips("bob", 2.67, 667)}; !slices.Equal(report.Staff, want) {
+		t.Errorf("staff = %v, want %v", report.Staff, want)
+	}
+}
+
+func TestPoolTipsWithoutTips(t *testing.T) {
+	_, shifts, now := tipWeek()
+	report := poolTips(nil, shifts, models.PoolEqual, now)
+	if report.Days == nil || report.Staff == nil || report.Total != 0 {
+		t.Errorf("poolTips with no tips = %+v, want empty days and staff", report)
+	}
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+type ShiftImpl struct {
+	logr *slog.Logger
+	repo ShiftRepo
+}
+
+type ShiftRepo interface {
+	// StartShift opens a shift for staff, failing with models.ErrShiftOpen
+	// when they are already on one.
+	StartShift(ctx context.Context, staff string) (models.Shift, error)
+	// EndShift closes an open shift, failing with models.ErrShiftEnded when
+	// it was already closed.
+	EndShift(ctx context.Context, id int64) (models.Shift, error)
+	// GetShifts lists the shifts that overlap [from, to); zero bounds are
+	// open.
+	GetShifts(ctx context.Context, from, to time.Time) ([]models.Shift, error)
+}
+
+func NewShiftService(logr *slog.Logger, repo ShiftRepo) *ShiftImpl {
+	return &ShiftImpl{logr: logr, repo: repo}
+}
+
+func (s *ShiftImpl) StartShift(ctx context.Context, req models.ShiftRequest) (models.Shift, error) {
+	staff := strings.TrimSpace(req.Staff)
+	if staff == "" {
+		err := fmt.Errorf("%w: staff is required", models.ErrInvalidShift)
+		s.logr.Info("Shift Start Error", "err", err)
+		return models.Shift{}, err
+	}
+
+	shift, err := s.repo.StartShift(ctx, staff)
+	if err != nil {
+		s.logr.Info("Shift Start Error", "err", err)
+		return models.Shift{}, err
+	}
+	return shift, nil
+}
+
+func (s *ShiftImpl) EndShift(ctx context.Context, id int64) (models.Shift, error) {
+	shift, err := s.repo.EndShift(ctx, id)
+	if err != nil {
+		s.logr.Info("Shift End Error", "err", err)
+		return models.Shift{}, err
+	}
+	return shift, nil
+}
+
+func (s *ShiftImpl) GetShifts(ctx context.Context, from, to time.Time) ([]models.Shift, error) {
+	shifts, err := s.repo.GetShifts(ctx, from, to)
+	if err != nil {
+		s.logr.Info("Shift Get Error", "err", err)
+		return nil, err
+	}
+	return shifts, nil
+}
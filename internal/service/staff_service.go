@@ -0,0 +1,213 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"golang.org/x/crypto/bcrypt"
+	"log/slog"
+	"strings"
+)
+
+const (
+	minPasswordLength = 8
+	// bcrypt ignores anything past 72 bytes.
+	maxPasswordLength = 72
+)
+
+type StaffImpl struct {
+	logr   *slog.Logger
+	repo   StaffRepo
+	tokens TokenSigner
+	// dummyHash is compared against when a username is unknown, so that
+	// logins take as long whether or not the user exists.
+	dummyHash []byte
+}
+
+type StaffRepo interface {
+	SaveStaff(ctx context.Context, staff models.Staff) (int64, error)
+	GetAllStaff(ctx context.Context) ([]models.Staff, error)
+	GetStaff(ctx context.Context, id int64) (models.Staff, error)
+	GetStaffByUsername(ctx context.Context, username string) (models.Staff, error)
+	// UpdateStaff keeps the stored password when staff.PasswordHash is empty.
+	UpdateStaff(ctx context.Context, id int64, staff models.Staff) (models.Staff, error)
+	CountStaff(ctx context.Context) (int64, error)
+}
+
+// TokenSigner issues the bearer tokens staff log in with and checks them,
+// failing with models.ErrUnauthorized.
+type TokenSigner interface {
+	Sign(staff models.Staff) (string, models.Claims, error)
+	Verify(token string) (models.Claims, error)
+}
+
+func NewStaffService(logr *slog.Logger, repo StaffRepo, tokens TokenSigner) *StaffImpl {
+	dummyHash, _ := bcrypt.GenerateFromPassword([]byte("not a password"), bcrypt.DefaultCost)
+	return &StaffImpl{logr: logr, repo: repo, tokens: tokens, dummyHash: dummyHash}
+}
+
+// EnsureAdmin creates an admin with the given credentials when there are no
+// staff users at all, so that a fresh install can be logged into.
+func (s *StaffImpl) EnsureAdmin(ctx context.Context, username, password string) error {
+	count, err := s.repo.CountStaff(ctx)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	id, err := s.CreateStaff(ctx, models.StaffRequest{Username: username, Name: username, Password: password, Role: models.RoleAdmin})
+	if err != nil {
+		return err
+	}
+	s.logr.Info("Initial admin created", "staff_id", id, "username", username)
+	return nil
+}
+
+func (s *StaffImpl) Login(ctx context.Context, req models.LoginRequest) (models.Session, error) {
+	staff, err := s.repo.GetStaffByUsername(ctx, strings.ToLower(strings.TrimSpace(req.Username)))
+	if errors.Is(err, models.ErrNotFound) {
+		_ = bcrypt.CompareHashAndPassword(s.dummyHash, []byte(req.Password))
+		s.logr.Info("Login failed", "username", req.Username)
+		return models.Session{}, models.ErrInvalidCredentials
+	}
+	if err != nil {
+		s.logr.Info("Login Error", "err", err)
+		return models.Session{}, err
+	}
+
+	if err = bcrypt.CompareHashAndPassword([]byte(staff.PasswordHash), []byte(req.Password)); err != nil || !staff.Active {
+		s.logr.Info("Login failed", "username", staff.Username)
+		return models.Session{}, models.ErrInvalidCredentials
+	}
+
+	token, claims, err := s.tokens.Sign(staff)
+	if err != nil {
+		s.logr.Info("Login Error", "err", err)
+		return models.Session{}, err
+	}
+	return models.Session{Token: token, ExpiresAt: claims.ExpiresAt, Staff: staff}, nil
+}
+
+// Authenticate resolves a bearer token to its staff member. The role comes
+// from the staff record rather than the token, so role changes and
+// deactivation take effect at once.
+func (s *StaffImpl) Authenticate(ctx context.Context, token string) (models.Staff, error) {
+	claims, err := s.tokens.Verify(token)
+	if err != nil {
+		return models.Staff{}, err
+	}
+
+	staff, err := s.repo.GetStaff(ctx, claims.StaffID)
+	if errors.Is(err, models.ErrNotFound) {
+		return models.Staff{}, fmt.Errorf("%w: unknown staff member", models.ErrUnauthorized)
+	}
+	if err != nil {
+		return models.Staff{}, err
+	}
+	if !staff.Active {
+		return models.Staff{}, fmt.Errorf("%w: account is deactivated", models.ErrUnauthorized)
+	}
+	return staff, nil
+}
+
+func (s *StaffImpl) CreateStaff(ctx context.Context, req models.StaffRequest) (int64, error) {
+	staff, err := validateStaff(req, true)
+	if err != nil {
+		s.logr.Info("Staff Create Error", "err", err)
+		return 0, err
+	}
+
+	id, err := s.repo.SaveStaff(ctx, staff)
+	if err != nil {
+		s.logr.Info("Staff Create Error", "err", err)
+		return 0, err
+	}
+	return id, nil
+}
+
+func (s *StaffImpl) GetAllStaff(ctx context.Context) ([]models.Staff, error) {
+	staff, err := s.repo.GetAllStaff(ctx)
+	if err != nil {
+		s.logr.Info("Staff Get Error", "err", err)
+		return nil, err
+	}
+	return staff, nil
+}
+
+func (s *StaffImpl) GetStaff(ctx context.Context, id int64) (models.Staff, error) {
+	staff, err := s.repo.GetStaff(ctx, id)
+	if err != nil {
+		s.logr.Info("Staff Get Error", "err", err)
+		return models.Staff{}, err
+	}
+	return staff, nil
+}
+
+func (s *StaffImpl) UpdateStaff(ctx context.Context, id int64, req models.StaffRequest) (models.Staff, error) {
+	staff, err := validateStaff(req, false)
+	if err != nil {
+		s.logr.Info("Staff Update Error", "err", err)
+		return models.Staff{}, err
+	}
+
+	staff, err = s.repo.UpdateStaff(ctx, id, staff)
+	if err != nil {
+		s.logr.Info("Staff Update Error", "err", err)
+		return models.Staff{}, err
+	}
+	return staff, nil
+}
+
+// DeactivateStaff locks the staff member out but keeps them for the records
+// that name them.
+func (s *StaffImpl) DeactivateStaff(ctx context.Context, id int64) error {
+	staff, err := s.repo.GetStaff(ctx, id)
+	if err != nil {
+		s.logr.Info("Staff Delete Error", "err", err)
+		return err
+	}
+
+	staff.Active = false
+	staff.PasswordHash = ""
+	if _, err = s.repo.UpdateStaff(ctx, id, staff); err != nil {
+		s.logr.Info("Staff Delete Error", "err", err)
+		return err
+	}
+	return nil
+}
+
+// validateStaff normalises the request and hashes its password, which is
+// required when creating.
+func validateStaff(req models.StaffRequest, create bool) (models.Staff, error) {
+	staff := models.Staff{
+		Username: strings.ToLower(strings.TrimSpace(req.Username)),
+		Name:     strings.TrimSpace(req.Name),
+		Role:     req.Role,
+		Active:   req.Active == nil || *req.Active,
+	}
+	if staff.Username == "" || strings.ContainsAny(staff.Username, " \t\n") {
+		return models.Staff{}, fmt.Errorf("%w: username is required and must not contain spaces", models.ErrInvalidStaff)
+	}
+	if staff.Name == "" {
+		staff.Name = staff.Username
+	}
+	if !staff.Role.Valid() {
+		return models.Staff{}, fmt.Errorf("%w: unknown role %q", models.ErrInvalidStaff, req.Role)
+	}
+
+	if req.Password == "" && !create {
+		return staff, nil
+	}
+	if len(req.Password) < minPasswordLength || len(req.Password) > maxPasswordLength {
+		return models.Staff{}, fmt.Errorf("%w: password must be %d to %d bytes long", models.ErrInvalidStaff, minPasswordLength, maxPasswordLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return models.Staff{}, fmt.Errorf("cannot hash password: %w", err)
+	}
+	staff.PasswordHash = string(hash)
+	return staff, nil
+}
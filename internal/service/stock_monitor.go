@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"log/slog"
+	"time"
+)
+
+// Notifier delivers stock alerts, for example to a log or a webhook.
+type Notifier interface {
+	Notify(ctx context.Context, alert models.StockAlert) error
+}
+
+type consumptionEvent struct {
+	orderID int64
+	changes []models.StockChange
+}
+
+// StockMonitor notifies in the background about every item an order took
+// below its reorder level. It decides from the quantities the repository read
+// while changing them, so concurrent orders cannot hide a crossing from it.
+type StockMonitor struct {
+	logr     *slog.Logger
+	repo     InventoryRepo
+	notifier Notifier
+	events   chan consumptionEvent
+}
+
+func NewStockMonitor(logr *slog.Logger, repo InventoryRepo, notifier Notifier, buffer int) *StockMonitor {
+	return &StockMonitor{
+		logr:     logr,
+		repo:     repo,
+		notifier: notifier,
+		events:   make(chan consumptionEvent, buffer),
+	}
+}
+
+// OrderConsumed queues a check without blocking the order. When the queue is
+// full the check is dropped; the low-stock endpoint still reports the item.
+func (m *StockMonitor) OrderConsumed(orderID int64, changes []models.StockChange) {
+	select {
+	case m.events <- consumptionEvent{orderID: orderID, changes: changes}:
+	default:
+		m.logr.Warn("Stock monitor queue is full, check dropped", "order_id", orderID)
+	}
+}
+
+// Run processes queued checks until ctx is cancelled.
+func (m *StockMonitor) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-m.events:
+			m.check(ctx, event)
+		}
+	}
+}
+
+func (m *StockMonitor) check(ctx context.Context, event consumptionEvent) {
+	for _, change := range event.changes {
+		if !change.CrossedReorderLevel() {
+			continue
+		}
+
+		item, err := m.repo.GetInventory(ctx, change.IngredientID)
+		if errors.Is(err, models.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			m.logr.Info("Stock monitor failed to get inventory", "id", change.IngredientID, "err", err)
+			continue
+		}
+		item.Quantity = change.After
+		item.ReorderLevel = change.ReorderLevel
+
+		alert := models.StockAlert{
+			IngredientID:  item.IngredientID,
+			Name:          item.Name,
+			Unit:          item.Unit,
+			Quantity:      item.Quantity,
+			ReorderLevel:  item.ReorderLevel,
+			ReorderAmount: item.ReorderAmount(),
+			OrderID:       event.orderID,
+			RaisedAt:      time.Now(),
+		}
+		if err = m.notifier.Notify(ctx, alert); err != nil {
+			m.logr.Info("Stock monitor failed to notify", "id", item.IngredientID, "err", err)
+		}
+	}
+}
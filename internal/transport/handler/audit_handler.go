@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"github.com/weeweeshka/hot-coffee/internal/audit"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	requestIDHeader = "X-Request-ID"
+	maxRequestIDLen = 128
+)
+
+type AuditHandler struct {
+	bus  AuditBus
+	logr *slog.Logger
+}
+
+type AuditBus interface {
+	GetAuditLog(ctx context.Context, filter models.AuditFilter) ([]models.AuditEntry, error)
+}
+
+func NewAuditHandler(bus AuditBus, logr *slog.Logger) *AuditHandler {
+	return &AuditHandler{bus: bus, logr: logr}
+}
+
+// RequestID is middleware that gives every request an ID, the client's
+// X-Request-ID when it sends a usable one, and echoes it in the response so
+// audit entries can be traced back to the call that made them.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		c.Header(requestIDHeader, id)
+		c.Request = c.Request.WithContext(audit.WithRequestID(c.Request.Context(), id))
+		c.Next()
+	}
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for _, r := range id {
+		if r < '!' || r > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// GetAuditLog lists audit entries, newest first, filtered by the optional
+// staff_id, action, entity_type, entity_id, request_id, from, to and limit
+// query parameters.
+func (h *AuditHandler) GetAuditLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		from, to, ok := parseTimeRange(c)
+		if !ok {
+			return
+		}
+
+		filter := models.AuditFilter{
+			Action:     models.AuditAction(c.Query("action")),
+			EntityType: models.AuditEntity(c.Query("entity_type")),
+			RequestID:  c.Query("request_id"),
+			From:       from,
+			To:         to,
+		}
+		var limit int64
+		if !parseQueryInt(c, "staff_id", &filter.StaffID) || !parseQueryInt(c, "entity_id", &filter.EntityID) ||
+			!parseQueryInt(c, "limit", &limit) {
+			return
+		}
+		filter.Limit = int(limit)
+
+		entries, err := h.bus.GetAuditLog(c.Request.Context(), filter)
+		if errors.Is(err, models.ErrInvalidAuditFilter) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			writeError(c, http.StatusInternalServerError, err, h.logr, "GetAuditLog: business error")
+			return
+		}
+
+		h.logr.Info("Audit log retrieved", "count", len(entries))
+		c.JSON(http.StatusOK, gin.H{"entries": entries})
+	}
+}
+
+// parseQueryInt reads an optional positive integer query parameter into
+// value, answering 400 when it is malformed.
+func parseQueryInt(c *gin.Context, param string, value *int64) bool {
+	raw := c.Query(param)
+	if raw == "" {
+		return true
+	}
+	n, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || n <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + param})
+		return false
+	}
+	*value = n
+	return true
+}
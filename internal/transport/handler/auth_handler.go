@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"github.com/weeweeshka/hot-coffee/internal/audit"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const staffKey = "staff"
+
+type AuthHandler struct {
+	bus  AuthBus
+	logr *slog.Logger
+}
+
+type AuthBus interface {
+	Login(ctx context.Context, req models.LoginRequest) (models.Session, error)
+	Authenticate(ctx context.Context, token string) (models.Staff, error)
+}
+
+func NewAuthHandler(bus AuthBus, logr *slog.Logger) *AuthHandler {
+	return &AuthHandler{bus: bus, logr: logr}
+}
+
+// CurrentStaff is the staff member Authenticate let through.
+func CurrentStaff(c *gin.Context) (models.Staff, bool) {
+	value, ok := c.Get(staffKey)
+	if !ok {
+		return models.Staff{}, false
+	}
+	staff, ok := value.(models.Staff)
+	return staff, ok
+}
+
+func (h *AuthHandler) Login() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.LoginRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		session, err := h.bus.Login(c.Request.Context(), req)
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			writeError(c, http.StatusInternalServerError, err, h.logr, "Login: business error")
+			return
+		}
+
+		h.logr.Info("Staff logged in", "staff_id", session.Staff.ID, "role", session.Staff.Role)
+		c.JSON(http.StatusOK, session)
+	}
+}
+
+func (h *AuthHandler) Me() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		staff, ok := CurrentStaff(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": models.ErrUnauthorized.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"staff": staff})
+	}
+}
+
+// Authenticate is middleware that lets through requests with a valid
+// "Authorization: Bearer <token>" header and records who made them.
+func (h *AuthHandler) Authenticate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scheme, token, ok := strings.Cut(c.GetHeader("Authorization"), " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": models.ErrUnauthorized.Error()})
+			return
+		}
+
+		staff, err := h.bus.Authenticate(c.Request.Context(), strings.TrimSpace(token))
+		if errors.Is(err, models.ErrUnauthorized) {
+			h.logr.Info("Authentication failed", "err", err, "path", c.FullPath())
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			h.logr.Error("Authenticate: business error", "error", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Set(staffKey, staff)
+		actor := models.AuditActor{StaffID: &staff.ID, Username: staff.Username}
+		c.Request = c.Request.WithContext(audit.WithActor(c.Request.Context(), actor))
+		c.Next()
+	}
+}
+
+// Require is middleware that lets through staff whose role holds the
+// permission. It must run after Authenticate.
+func (h *AuthHandler) Require(permission models.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		staff, ok := CurrentStaff(c)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": models.ErrUnauthorized.Error()})
+			return
+		}
+		if !staff.Role.Can(permission) {
+			h.logr.Info("Permission denied", "staff_id", staff.ID, "role", staff.Role, "permission", permission, "path", c.FullPath())
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": models.ErrForbidden.Error(), "permission": permission})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,247 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CustomerHandler struct {
+	bus  CustomerBus
+	logr *slog.Logger
+}
+
+type CustomerBus interface {
+	CreateCustomer(ctx context.Context, customer models.Customer) (int64, error)
+	GetCustomers(ctx context.Context) ([]models.Customer, error)
+	GetCustomer(ctx context.Context, id int64) (models.Customer, error)
+	UpdateCustomer(ctx context.Context, id int64, customer models.Customer) (models.Customer, error)
+	DeleteCustomer(ctx context.Context, id int64) error
+	GetCustomerOrders(ctx context.Context, id int64) ([]models.Order, error)
+	SaveFavorite(ctx context.Context, customerID int64, favorite models.FavoriteOrder) (int64, error)
+	GetFavorites(ctx context.Context, customerID int64) ([]models.FavoriteOrder, error)
+	DeleteFavorite(ctx context.Context, customerID, favoriteID int64) error
+	Reorder(ctx context.Context, customerID, favoriteID int64) (int64, error)
+}
+
+func NewCustomerHandler(bus CustomerBus, logr *slog.Logger) *CustomerHandler {
+	return &CustomerHandler{bus: bus, logr: logr}
+}
+
+func (h *CustomerHandler) writeCustomerError(c *gin.Context, err error, notFound, msg string) {
+	switch {
+	case errors.Is(err, models.ErrInvalidCustomer):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrDuplicateCustomer):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": notFound})
+	default:
+		writeError(c, http.StatusInternalServerError, err, h.logr, msg)
+	}
+}
+
+func (h *CustomerHandler) CreateCustomer() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var customer models.Customer
+		if err := c.ShouldBindJSON(&customer); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		id, err := h.bus.CreateCustomer(c.Request.Context(), customer)
+		if err != nil {
+			h.writeCustomerError(c, err, "customer not found", "CreateCustomer: business error")
+			return
+		}
+
+		h.logr.Info("Customer created", "customer_id", id)
+		c.JSON(http.StatusCreated, gin.H{"id": id, "status": "created"})
+	}
+}
+
+func (h *CustomerHandler) GetCustomers() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		customers, err := h.bus.GetCustomers(c.Request.Context())
+		if err != nil {
+			writeError(c, http.StatusInternalServerError, err, h.logr, "GetCustomers: business error")
+			return
+		}
+
+		h.logr.Info("Customers retrieved", "count", len(customers))
+		c.JSON(http.StatusOK, gin.H{"customers": customers})
+	}
+}
+
+func (h *CustomerHandler) GetCustomer() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := parseID(c, "id")
+		if !ok {
+			return
+		}
+
+		customer, err := h.bus.GetCustomer(c.Request.Context(), id)
+		if err != nil {
+			h.writeCustomerError(c, err, "customer not found", "GetCustomer: business error")
+			return
+		}
+
+		h.logr.Info("Customer retrieved", "id", id)
+		c.JSON(http.StatusOK, gin.H{"customer": customer})
+	}
+}
+
+func (h *CustomerHandler) UpdateCustomer() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := parseID(c, "id")
+		if !ok {
+			return
+		}
+
+		var customer models.Customer
+		if err := c.ShouldBindJSON(&customer); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		nCustomer, err := h.bus.UpdateCustomer(c.Request.Context(), id, customer)
+		if err != nil {
+			h.writeCustomerError(c, err, "customer not found", "UpdateCustomer: business error")
+			return
+		}
+
+		h.logr.Info("Customer updated", "id", id)
+		c.JSON(http.StatusOK, gin.H{"id": id, "customer": nCustomer})
+	}
+}
+
+func (h *CustomerHandler) DeleteCustomer() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := parseID(c, "id")
+		if !ok {
+			return
+		}
+
+		if err := h.bus.DeleteCustomer(c.Request.Context(), id); err != nil {
+			h.writeCustomerError(c, err, "customer not found", "DeleteCustomer: business error")
+			return
+		}
+
+		h.logr.Info("Customer deleted", "id", id)
+		c.JSON(http.StatusOK, gin.H{"id": id, "status": "deleted"})
+	}
+}
+
+func (h *CustomerHandler) GetCustomerOrders() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := parseID(c, "id")
+		if !ok {
+			return
+		}
+
+		orders, err := h.bus.GetCustomerOrders(c.Request.Context(), id)
+		if err != nil {
+			h.writeCustomerError(c, err, "customer not found", "GetCustomerOrders: business error")
+			return
+		}
+
+		h.logr.Info("Customer orders retrieved", "id", id, "count", len(orders))
+		c.JSON(http.StatusOK, gin.H{"orders": orders})
+	}
+}
+
+func (h *CustomerHandler) SaveFavorite() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := parseID(c, "id")
+		if !ok {
+			return
+		}
+
+		var favorite models.FavoriteOrder
+		if err := c.ShouldBindJSON(&favorite); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		favoriteID, err := h.bus.SaveFavorite(c.Request.Context(), id, favorite)
+		if err != nil {
+			h.writeCustomerError(c, err, "customer not found", "SaveFavorite: business error")
+			return
+		}
+
+		h.logr.Info("Favorite saved", "id", id, "favorite_id", favoriteID)
+		c.JSON(http.StatusCreated, gin.H{"id": favoriteID, "status": "created"})
+	}
+}
+
+func (h *CustomerHandler) GetFavorites() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := parseID(c, "id")
+		if !ok {
+			return
+		}
+
+		favorites, err := h.bus.GetFavorites(c.Request.Context(), id)
+		if err != nil {
+			h.writeCustomerError(c, err, "customer not found", "GetFavorites: business error")
+			return
+		}
+
+		h.logr.Info("Favorites retrieved", "id", id, "count", len(favorites))
+		c.JSON(http.StatusOK, gin.H{"favorites": favorites})
+	}
+}
+
+func (h *CustomerHandler) DeleteFavorite() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := parseID(c, "id")
+		if !ok {
+			return
+		}
+		favoriteID, ok := parseID(c, "favorite_id")
+		if !ok {
+			return
+		}
+
+		if err := h.bus.DeleteFavorite(c.Request.Context(), id, favoriteID); err != nil {
+			h.writeCustomerError(c, err, "favorite not found", "DeleteFavorite: business error")
+			return
+		}
+
+		h.logr.Info("Favorite deleted", "id", id, "favorite_id", favoriteID)
+		c.JSON(http.StatusOK, gin.H{"id": favoriteID, "status": "deleted"})
+	}
+}
+
+// Reorder places the favorite as a new order. Errors from placing the order
+// are reported the same way POST /orders reports them.
+func (h *CustomerHandler) Reorder() gin.HandlerFunc {
+	orders := &OrderHandler{logr: h.logr}
+	return func(c *gin.Context) {
+		id, ok := parseID(c, "id")
+		if !ok {
+			return
+		}
+		favoriteID, ok := parseID(c, "favorite_id")
+		if !ok {
+			return
+		}
+
+		orderID, err := h.bus.Reorder(c.Request.Context(), id, favoriteID)
+		if errors.Is(err, models.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "customer or favorite not found"})
+			return
+		}
+		if err != nil {
+			orders.writeOrderError(c, err, "Reorder: business error")
+			return
+		}
+
+		h.logr.Info("Favorite reordered", "id", id, "favorite_id", favoriteID, "order_id", orderID)
+		c.JSON(http.StatusCreated, gin.H{"id": orderID, "status": "created"})
+	}
+}
@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"context"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type HealthHandler struct {
+	storage StorageMonitor
+	logr    *slog.Logger
+}
+
+// StorageMonitor is a storage backed by a database that can be checked and
+// whose connection pool can be watched.
+type StorageMonitor interface {
+	Ping(ctx context.Context) error
+	Stats() models.StorageStats
+}
+
+// NewHealthHandler reports on storage, which is nil for storages without a
+// database.
+func NewHealthHandler(storage StorageMonitor, logr *slog.Logger) *HealthHandler {
+	return &HealthHandler{storage: storage, logr: logr}
+}
+
+// Health answers 200 while the database answers and 503 once it does not.
+// Anyone may ask, so it tells the status only; why the database is
+// unreachable goes to the log.
+func (h *HealthHandler) Health() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if h.storage == nil {
+			c.JSON(http.StatusOK, gin.H{"status": "ok"})
+			return
+		}
+
+		if err := h.storage.Ping(c.Request.Context()); err != nil {
+			h.logr.Error("Health: database unreachable", "error", err)
+			c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	}
+}
+
+// Details answers like Health with the error and the pool statistics added,
+// for staff allowed to watch the service.
+func (h *HealthHandler) Details() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if h.storage == nil {
+			c.JSON(http.StatusOK, gin.H{"status": "ok"})
+			return
+		}
+
+		stats := h.storage.Stats()
+		if err := h.storage.Ping(c.Request.Context()); err != nil {
+			h.logr.Error("Health: database unreachable", "error", err)
+			c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "error": err.Error(), "storage": stats})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "ok", "storage": stats})
+	}
+}
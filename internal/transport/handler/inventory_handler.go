@@ -7,6 +7,7 @@ import (
 	"log/slog"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -22,6 +23,13 @@ type InventoryBus interface {
 	GetInventory(ctx context.Context, id int64) (models.InventoryItem, error)
 	UpdateInventory(ctx context.Context, id int64, inventory models.InventoryItem) (models.InventoryItem, error)
 	DeleteInventory(ctx context.Context, id int64) error
+	RecordMovement(ctx context.Context, id int64, movement models.InventoryMovementRequest) (models.InventoryTransaction, error)
+	GetInventoryHistory(ctx context.Context, id int64, from, to time.Time) ([]models.InventoryTransaction, error)
+	GetLowStock(ctx context.Context) ([]models.LowStockItem, error)
+}
+
+func NewInventoryHandler(bus InventoryBus, logr *slog.Logger) *InventoryHandler {
+	return &InventoryHandler{bus: bus, logr: logr}
 }
 
 func (h *InventoryHandler) CreateInventory() gin.HandlerFunc {
@@ -34,6 +42,14 @@ func (h *InventoryHandler) CreateInventory() gin.HandlerFunc {
 
 		id, err := h.bus.CreateInventory(c.Request.Context(), inventory)
 		if err != nil {
+			if errors.Is(err, models.ErrDuplicateInventory) {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+			if errors.Is(err, models.ErrInvalidInventory) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
 			writeError(c, http.StatusInternalServerError, err, h.logr, "CreateInventory: business error")
 			return
 		}
@@ -109,6 +125,14 @@ func (h *InventoryHandler) UpdateInventory() gin.HandlerFunc {
 				c.JSON(http.StatusNotFound, gin.H{"error": "inventory not found"})
 				return
 			}
+			if errors.Is(err, models.ErrDuplicateInventory) {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+			if errors.Is(err, models.ErrInvalidInventory) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
 			writeError(c, http.StatusInternalServerError, err, h.logr, "UpdateInventory: business error")
 			return
 		}
@@ -139,3 +163,124 @@ func (h *InventoryHandler) DeleteInventory() gin.HandlerFunc {
 		c.JSON(http.StatusNoContent, gin.H{})
 	}
 }
+
+func (h *InventoryHandler) RecordMovement() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := parseID(c, "id")
+		if !ok {
+			return
+		}
+
+		staff, ok := CurrentStaff(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": models.ErrUnauthorized.Error()})
+			return
+		}
+
+		var movement models.InventoryMovementRequest
+		if err := c.ShouldBindJSON(&movement); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		movement.Actor = staff.Username
+
+		t, err := h.bus.RecordMovement(c.Request.Context(), id, movement)
+		if err != nil {
+			var shortage *models.InsufficientIngredientsError
+			switch {
+			case errors.Is(err, models.ErrNotFound):
+				c.JSON(http.StatusNotFound, gin.H{"error": "inventory not found"})
+			case errors.Is(err, models.ErrInvalidMovement):
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			case errors.As(err, &shortage):
+				c.JSON(http.StatusConflict, gin.H{"error": models.ErrInsufficientIngredients.Error(), "shortages": shortage.Shortages})
+			default:
+				writeError(c, http.StatusInternalServerError, err, h.logr, "RecordMovement: business error")
+			}
+			return
+		}
+
+		h.logr.Info("Inventory movement recorded", "id", id, "reason", t.Reason)
+		c.JSON(http.StatusCreated, gin.H{"movement": t})
+	}
+}
+
+func (h *InventoryHandler) GetInventoryHistory() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := parseID(c, "id")
+		if !ok {
+			return
+		}
+
+		from, to, ok := parseTimeRange(c)
+		if !ok {
+			return
+		}
+
+		history, err := h.bus.GetInventoryHistory(c.Request.Context(), id, from, to)
+		if err != nil {
+			if errors.Is(err, models.ErrNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "inventory not found"})
+				return
+			}
+			writeError(c, http.StatusInternalServerError, err, h.logr, "GetInventoryHistory: business error")
+			return
+		}
+
+		h.logr.Info("Inventory history retrieved", "id", id, "count", len(history))
+		c.JSON(http.StatusOK, gin.H{"id": id, "history": history})
+	}
+}
+
+func (h *InventoryHandler) GetLowStock() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		items, err := h.bus.GetLowStock(c.Request.Context())
+		if err != nil {
+			writeError(c, http.StatusInternalServerError, err, h.logr, "GetLowStock: business error")
+			return
+		}
+
+		h.logr.Info("Low stock retrieved", "count", len(items))
+		c.JSON(http.StatusOK, gin.H{"items": items})
+	}
+}
+
+// parseTimeRange reads the optional from and to query parameters, given either
+// as RFC 3339 timestamps or as dates. A date in to includes that whole day.
+func parseTimeRange(c *gin.Context) (time.Time, time.Time, bool) {
+	from, err := parseTime(c.Query("from"), false)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from: " + err.Error()})
+		return time.Time{}, time.Time{}, false
+	}
+
+	to, err := parseTime(c.Query("to"), true)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to: " + err.Error()})
+		return time.Time{}, time.Time{}, false
+	}
+
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+		return time.Time{}, time.Time{}, false
+	}
+	return from, to, true
+}
+
+func parseTime(value string, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
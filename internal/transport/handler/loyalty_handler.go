@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type LoyaltyHandler struct {
+	bus  LoyaltyBus
+	logr *slog.Logger
+}
+
+type LoyaltyBus interface {
+	GetLoyalty(ctx context.Context, customerID int64) (models.LoyaltyAccount, error)
+	UndoRedemption(ctx context.Context, customerID, redemptionID int64) (models.LoyaltyRedemption, error)
+}
+
+func NewLoyaltyHandler(bus LoyaltyBus, logr *slog.Logger) *LoyaltyHandler {
+	return &LoyaltyHandler{bus: bus, logr: logr}
+}
+
+func (h *LoyaltyHandler) GetLoyalty() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := parseID(c, "id")
+		if !ok {
+			return
+		}
+
+		account, err := h.bus.GetLoyalty(c.Request.Context(), id)
+		if errors.Is(err, models.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "customer not found"})
+			return
+		}
+		if err != nil {
+			writeError(c, http.StatusInternalServerError, err, h.logr, "GetLoyalty: business error")
+			return
+		}
+
+		h.logr.Info("Loyalty retrieved", "id", id, "balance", account.Balance)
+		c.JSON(http.StatusOK, gin.H{"loyalty": account})
+	}
+}
+
+func (h *LoyaltyHandler) UndoRedemption() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := parseID(c, "id")
+		if !ok {
+			return
+		}
+		redemptionID, ok := parseID(c, "redemption_id")
+		if !ok {
+			return
+		}
+
+		redemption, err := h.bus.UndoRedemption(c.Request.Context(), id, redemptionID)
+		switch {
+		case errors.Is(err, models.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "redemption not found"})
+			return
+		case errors.Is(err, models.ErrRedemptionUndone), errors.Is(err, models.ErrOrderClosed):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			writeError(c, http.StatusInternalServerError, err, h.logr, "UndoRedemption: business error")
+			return
+		}
+
+		h.logr.Info("Redemption undone", "id", id, "redemption_id", redemptionID, "points", redemption.Points)
+		c.JSON(http.StatusOK, gin.H{"redemption": redemption})
+	}
+}
@@ -18,12 +18,16 @@ type MenuHandler struct {
 
 type MenuBus interface {
 	CreateMenu(ctx context.Context, menu models2.MenuItem) (int64, error)
-	GetMenus(ctx context.Context) ([]models2.MenuResponse, error)
+	GetMenus(ctx context.Context, availableOnly bool) ([]models2.MenuResponse, error)
 	GetMenu(ctx context.Context, id int64) (models2.MenuResponse, error)
 	UpdateMenu(ctx context.Context, id int64, menu models2.MenuItem) (models2.MenuItem, error)
 	DeleteMenu(ctx context.Context, id int64) error
 }
 
+func NewMenuHandler(bus MenuBus, logr *slog.Logger) *MenuHandler {
+	return &MenuHandler{bus: bus, logr: logr}
+}
+
 func (h *MenuHandler) CreateMenu() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var menu models2.MenuItem
@@ -34,6 +38,10 @@ func (h *MenuHandler) CreateMenu() gin.HandlerFunc {
 
 		id, err := h.bus.CreateMenu(c.Request.Context(), menu)
 		if err != nil {
+			if errors.Is(err, models2.ErrInvalidMenu) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
 			writeError(c, http.StatusInternalServerError, err, h.logr, "CreateMenu: business error")
 			return
 		}
@@ -45,7 +53,16 @@ func (h *MenuHandler) CreateMenu() gin.HandlerFunc {
 
 func (h *MenuHandler) GetMenus() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		menus, err := h.bus.GetMenus(c.Request.Context())
+		var availableOnly bool
+		if value := c.Query("available_only"); value != "" {
+			var err error
+			if availableOnly, err = strconv.ParseBool(value); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid available_only"})
+				return
+			}
+		}
+
+		menus, err := h.bus.GetMenus(c.Request.Context(), availableOnly)
 		if err != nil {
 			writeError(c, http.StatusInternalServerError, err, h.logr, "GetMenus: business error")
 			return
@@ -99,6 +116,10 @@ func (h *MenuHandler) UpdateMenu() gin.HandlerFunc {
 				c.JSON(http.StatusNotFound, gin.H{"error": "menu not found"})
 				return
 			}
+			if errors.Is(err, models2.ErrInvalidMenu) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
 			writeError(c, http.StatusInternalServerError, err, h.logr, "UpdateMenu: business error")
 			return
 		}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"github.com/weeweeshka/hot-coffee/internal/models"
+	"github.com/weeweeshka/hot-coffee/internal/money"
+	"io"
 	"log/slog"
 	"net/http"
 	"strconv"
@@ -18,11 +20,18 @@ type OrderHandler struct {
 
 type OrderBus interface {
 	CreateOrder(ctx context.Context, data models.OrderRequest) (int64, error)
-	GetOrders(ctx context.Context) ([]models.Order, error)
-	GetOrder(ctx context.Context, id int64) (models.Order, error)
-	UpdateOrder(ctx context.Context, id int64, order models.OrderRequest) (models.Order, error)
+	GetOrders(ctx context.Context, page models.OrderPage) ([]models.OrderResponse, error)
+	GetOrder(ctx context.Context, id int64) (models.OrderResponse, error)
+	UpdateOrder(ctx context.Context, id int64, order models.OrderRequest) (models.OrderResponse, error)
 	DeleteOrder(ctx context.Context, id int64) error
-	CloseOrder(ctx context.Context, id int64) error
+	StartOrder(ctx context.Context, id int64) (models.Order, error)
+	ReadyOrder(ctx context.Context, id int64) (models.Order, error)
+	CloseOrder(ctx context.Context, id int64, tip money.Amount) (models.Order, error)
+	CancelOrder(ctx context.Context, id int64) (models.Order, error)
+}
+
+func NewOrderHandler(bus OrderBus, logr *slog.Logger) *OrderHandler {
+	return &OrderHandler{bus: bus, logr: logr}
 }
 
 func writeError(c *gin.Context, code int, err error, logger *slog.Logger, msg string) {
@@ -30,6 +39,38 @@ func writeError(c *gin.Context, code int, err error, logger *slog.Logger, msg st
 	c.JSON(code, gin.H{"error": err.Error()})
 }
 
+func parseID(c *gin.Context, param string) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param(param), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + param})
+		return 0, false
+	}
+	return id, true
+}
+
+func (h *OrderHandler) writeOrderError(c *gin.Context, err error, msg string) {
+	var shortage *models.InsufficientIngredientsError
+	var unavailable *models.UnavailableItemsError
+	switch {
+	case errors.As(err, &shortage):
+		c.JSON(http.StatusConflict, gin.H{"error": models.ErrInsufficientIngredients.Error(), "shortages": shortage.Shortages})
+	case errors.As(err, &unavailable):
+		c.JSON(http.StatusConflict, gin.H{"error": models.ErrItemUnavailable.Error(), "items": unavailable.Items})
+	case errors.Is(err, models.ErrInvalidOrder), errors.Is(err, models.ErrInvalidRedemption),
+		errors.Is(err, models.ErrPromoNotApplicable):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+	case errors.Is(err, models.ErrInvalidTransition), errors.Is(err, models.ErrOrderNotEditable),
+		errors.Is(err, models.ErrOrderClosed), errors.Is(err, models.ErrInsufficientPoints),
+		errors.Is(err, models.ErrPromoLimitReached), errors.Is(err, models.ErrOrderNotPaid),
+		errors.Is(err, models.ErrOrderPaid):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		writeError(c, http.StatusInternalServerError, err, h.logr, msg)
+	}
+}
+
 func (h *OrderHandler) CreateOrder() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var orderReq models.OrderRequest
@@ -40,7 +81,7 @@ func (h *OrderHandler) CreateOrder() gin.HandlerFunc {
 
 		id, err := h.bus.CreateOrder(c.Request.Context(), orderReq)
 		if err != nil {
-			writeError(c, http.StatusInternalServerError, err, h.logr, "CreateOrder: business error")
+			h.writeOrderError(c, err, "CreateOrder: business error")
 			return
 		}
 
@@ -49,9 +90,28 @@ func (h *OrderHandler) CreateOrder() gin.HandlerFunc {
 	}
 }
 
+// GetOrders lists a page of orders, newest first, sized by the optional limit
+// query parameter and starting after the number of orders in offset.
 func (h *OrderHandler) GetOrders() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		orders, err := h.bus.GetOrders(c.Request.Context())
+		var limit, offset int64
+		if !parseQueryInt(c, "limit", &limit) {
+			return
+		}
+		if raw := c.Query("offset"); raw != "" {
+			n, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil || n < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid offset"})
+				return
+			}
+			offset = n
+		}
+
+		orders, err := h.bus.GetOrders(c.Request.Context(), models.OrderPage{Limit: int(limit), Offset: int(offset)})
+		if errors.Is(err, models.ErrInvalidOrder) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		if err != nil {
 			writeError(c, http.StatusInternalServerError, err, h.logr, "GetOrders: business error")
 			return
@@ -64,19 +124,14 @@ func (h *OrderHandler) GetOrders() gin.HandlerFunc {
 
 func (h *OrderHandler) GetOrder() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		idstr := c.Param("id")
-		id, err := strconv.Atoi(idstr)
-		if err != nil {
-			writeError(c, http.StatusInternalServerError, err, h.logr, "GetInventory: invalid id")
+		id, ok := parseID(c, "id")
+		if !ok {
+			return
 		}
 
-		order, err := h.bus.GetOrder(c.Request.Context(), int64(id))
+		order, err := h.bus.GetOrder(c.Request.Context(), id)
 		if err != nil {
-			if errors.Is(err, models.ErrNotFound) {
-				c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
-				return
-			}
-			writeError(c, http.StatusInternalServerError, err, h.logr, "GetOrder: business error")
+			h.writeOrderError(c, err, "GetOrder: business error")
 			return
 		}
 
@@ -87,10 +142,9 @@ func (h *OrderHandler) GetOrder() gin.HandlerFunc {
 
 func (h *OrderHandler) UpdateOrder() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		idstr := c.Param("id")
-		id, err := strconv.Atoi(idstr)
-		if err != nil {
-			writeError(c, http.StatusInternalServerError, err, h.logr, "GetInventory: invalid id")
+		id, ok := parseID(c, "id")
+		if !ok {
+			return
 		}
 
 		var order models.OrderRequest
@@ -99,13 +153,9 @@ func (h *OrderHandler) UpdateOrder() gin.HandlerFunc {
 			return
 		}
 
-		nOrder, err := h.bus.UpdateOrder(c.Request.Context(), int64(id), order)
+		nOrder, err := h.bus.UpdateOrder(c.Request.Context(), id, order)
 		if err != nil {
-			if errors.Is(err, models.ErrNotFound) {
-				c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
-				return
-			}
-			writeError(c, http.StatusInternalServerError, err, h.logr, "UpdateOrder: business error")
+			h.writeOrderError(c, err, "UpdateOrder: business error")
 			return
 		}
 
@@ -116,18 +166,13 @@ func (h *OrderHandler) UpdateOrder() gin.HandlerFunc {
 
 func (h *OrderHandler) DeleteOrder() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		idstr := c.Param("id")
-		id, err := strconv.Atoi(idstr)
-		if err != nil {
-			writeError(c, http.StatusInternalServerError, err, h.logr, "GetInventory: invalid id")
+		id, ok := parseID(c, "id")
+		if !ok {
+			return
 		}
 
-		if err := h.bus.DeleteOrder(c.Request.Context(), int64(id)); err != nil {
-			if errors.Is(err, models.ErrNotFound) {
-				c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
-				return
-			}
-			writeError(c, http.StatusInternalServerError, err, h.logr, "DeleteOrder: business error")
+		if err := h.bus.DeleteOrder(c.Request.Context(), id); err != nil {
+			h.writeOrderError(c, err, "DeleteOrder: business error")
 			return
 		}
 
@@ -136,24 +181,47 @@ func (h *OrderHandler) DeleteOrder() gin.HandlerFunc {
 	}
 }
 
+func (h *OrderHandler) StartOrder() gin.HandlerFunc {
+	return h.changeStatus(h.bus.StartOrder, "StartOrder")
+}
+
+func (h *OrderHandler) ReadyOrder() gin.HandlerFunc {
+	return h.changeStatus(h.bus.ReadyOrder, "ReadyOrder")
+}
+
+// CloseOrder takes an optional body with the tip left on the order.
 func (h *OrderHandler) CloseOrder() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		idstr := c.Param("id")
-		id, err := strconv.Atoi(idstr)
-		if err != nil {
-			writeError(c, http.StatusInternalServerError, err, h.logr, "GetInventory: invalid id")
+		var req models.CloseRequest
+		if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
 		}
 
-		if err := h.bus.CloseOrder(c.Request.Context(), int64(id)); err != nil {
-			if errors.Is(err, models.ErrNotFound) {
-				c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
-				return
-			}
-			writeError(c, http.StatusInternalServerError, err, h.logr, "CloseOrder: business error")
+		h.changeStatus(func(ctx context.Context, id int64) (models.Order, error) {
+			return h.bus.CloseOrder(ctx, id, req.Tip)
+		}, "CloseOrder")(c)
+	}
+}
+
+func (h *OrderHandler) CancelOrder() gin.HandlerFunc {
+	return h.changeStatus(h.bus.CancelOrder, "CancelOrder")
+}
+
+func (h *OrderHandler) changeStatus(change func(ctx context.Context, id int64) (models.Order, error), name string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := parseID(c, "id")
+		if !ok {
+			return
+		}
+
+		order, err := change(c.Request.Context(), id)
+		if err != nil {
+			h.writeOrderError(c, err, name+": business error")
 			return
 		}
 
-		h.logr.Info("Order closed", "id", id)
-		c.JSON(http.StatusOK, gin.H{"id": id, "status": "closed"})
+		h.logr.Info("Order status changed", "id", id, "status", order.Status)
+		c.JSON(http.StatusOK, gin.H{"id": id, "status": order.Status, "order": order})
 	}
 }
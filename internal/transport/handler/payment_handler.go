@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PaymentHandler struct {
+	bus  PaymentBus
+	logr *slog.Logger
+}
+
+type PaymentBus interface {
+	Pay(ctx context.Context, orderID int64, req models.PaymentRequest) (models.Payment, models.OrderBalance, error)
+	GetPayments(ctx context.Context, orderID int64) (models.OrderBalance, error)
+}
+
+func NewPaymentHandler(bus PaymentBus, logr *slog.Logger) *PaymentHandler {
+	return &PaymentHandler{bus: bus, logr: logr}
+}
+
+func (h *PaymentHandler) writePaymentError(c *gin.Context, err error, msg string) {
+	switch {
+	case errors.Is(err, models.ErrInvalidPayment):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrPaymentDeclined):
+		c.JSON(http.StatusPaymentRequired, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+	case errors.Is(err, models.ErrOverpayment):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		writeError(c, http.StatusInternalServerError, err, h.logr, msg)
+	}
+}
+
+func (h *PaymentHandler) Pay() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := parseID(c, "id")
+		if !ok {
+			return
+		}
+
+		var req models.PaymentRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		payment, balance, err := h.bus.Pay(c.Request.Context(), id, req)
+		if err != nil {
+			h.writePaymentError(c, err, "Pay: business error")
+			return
+		}
+
+		h.logr.Info("Payment taken", "order_id", id, "method", payment.Method, "amount", payment.Amount, "due", balance.Due)
+		c.JSON(http.StatusCreated, gin.H{"payment": payment, "balance": balance})
+	}
+}
+
+func (h *PaymentHandler) GetPayments() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := parseID(c, "id")
+		if !ok {
+			return
+		}
+
+		balance, err := h.bus.GetPayments(c.Request.Context(), id)
+		if err != nil {
+			h.writePaymentError(c, err, "GetPayments: business error")
+			return
+		}
+
+		h.logr.Info("Payments retrieved", "order_id", id, "count", len(balance.Payments))
+		c.JSON(http.StatusOK, gin.H{"balance": balance})
+	}
+}
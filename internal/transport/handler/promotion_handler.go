@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PromotionHandler struct {
+	bus  PromotionBus
+	logr *slog.Logger
+}
+
+type PromotionBus interface {
+	CreatePromotion(ctx context.Context, promotion models.Promotion) (int64, error)
+	GetPromotions(ctx context.Context) ([]models.Promotion, error)
+	GetPromotion(ctx context.Context, id int64) (models.Promotion, error)
+	UpdatePromotion(ctx context.Context, id int64, promotion models.Promotion) (models.Promotion, error)
+	DeletePromotion(ctx context.Context, id int64) error
+}
+
+func NewPromotionHandler(bus PromotionBus, logr *slog.Logger) *PromotionHandler {
+	return &PromotionHandler{bus: bus, logr: logr}
+}
+
+func (h *PromotionHandler) writePromotionError(c *gin.Context, err error, msg string) {
+	switch {
+	case errors.Is(err, models.ErrInvalidPromotion):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrDuplicatePromotion):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "promotion not found"})
+	default:
+		writeError(c, http.StatusInternalServerError, err, h.logr, msg)
+	}
+}
+
+func (h *PromotionHandler) CreatePromotion() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var promotion models.Promotion
+		if err := c.ShouldBindJSON(&promotion); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		id, err := h.bus.CreatePromotion(c.Request.Context(), promotion)
+		if err != nil {
+			h.writePromotionError(c, err, "CreatePromotion: business error")
+			return
+		}
+
+		h.logr.Info("Promotion created", "promotion_id", id)
+		c.JSON(http.StatusCreated, gin.H{"id": id, "status": "created"})
+	}
+}
+
+func (h *PromotionHandler) GetPromotions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		promotions, err := h.bus.GetPromotions(c.Request.Context())
+		if err != nil {
+			writeError(c, http.StatusInternalServerError, err, h.logr, "GetPromotions: business error")
+			return
+		}
+
+		h.logr.Info("Promotions retrieved", "count", len(promotions))
+		c.JSON(http.StatusOK, gin.H{"promotions": promotions})
+	}
+}
+
+func (h *PromotionHandler) GetPromotion() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := parseID(c, "id")
+		if !ok {
+			return
+		}
+
+		promotion, err := h.bus.GetPromotion(c.Request.Context(), id)
+		if err != nil {
+			h.writePromotionError(c, err, "GetPromotion: business error")
+			return
+		}
+
+		h.logr.Info("Promotion retrieved", "id", id)
+		c.JSON(http.StatusOK, gin.H{"promotion": promotion})
+	}
+}
+
+func (h *PromotionHandler) UpdatePromotion() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := parseID(c, "id")
+		if !ok {
+			return
+		}
+
+		var promotion models.Promotion
+		if err := c.ShouldBindJSON(&promotion); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		nPromotion, err := h.bus.UpdatePromotion(c.Request.Context(), id, promotion)
+		if err != nil {
+			h.writePromotionError(c, err, "UpdatePromotion: business error")
+			return
+		}
+
+		h.logr.Info("Promotion updated", "id", id)
+		c.JSON(http.StatusOK, gin.H{"id": id, "promotion": nPromotion})
+	}
+}
+
+func (h *PromotionHandler) DeletePromotion() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := parseID(c, "id")
+		if !ok {
+			return
+		}
+
+		if err := h.bus.DeletePromotion(c.Request.Context(), id); err != nil {
+			h.writePromotionError(c, err, "DeletePromotion: business error")
+			return
+		}
+
+		h.logr.Info("Promotion deactivated", "id", id)
+		c.JSON(http.StatusOK, gin.H{"id": id, "status": "deactivated"})
+	}
+}
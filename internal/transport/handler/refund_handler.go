@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RefundHandler struct {
+	bus  RefundBus
+	logr *slog.Logger
+}
+
+type RefundBus interface {
+	Refund(ctx context.Context, orderID int64, req models.RefundRequest) (models.Refund, error)
+	GetRefunds(ctx context.Context, orderID int64) ([]models.Refund, error)
+}
+
+func NewRefundHandler(bus RefundBus, logr *slog.Logger) *RefundHandler {
+	return &RefundHandler{bus: bus, logr: logr}
+}
+
+func (h *RefundHandler) Refund() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := parseID(c, "id")
+		if !ok {
+			return
+		}
+
+		var req models.RefundRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		refund, err := h.bus.Refund(c.Request.Context(), id, req)
+		switch {
+		case errors.Is(err, models.ErrInvalidRefund):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, models.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+			return
+		case errors.Is(err, models.ErrRefundFailed):
+			// The refund is recorded; only the card credit needs redoing.
+			h.logr.Error("Refund: card refund failed", "error", err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error(), "refund": refund})
+			return
+		case err != nil:
+			writeError(c, http.StatusInternalServerError, err, h.logr, "Refund: business error")
+			return
+		}
+
+		h.logr.Info("Order refunded", "order_id", id, "refund_id", refund.ID, "amount", refund.Amount, "restock", refund.Restock)
+		c.JSON(http.StatusCreated, gin.H{"refund": refund})
+	}
+}
+
+func (h *RefundHandler) GetRefunds() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := parseID(c, "id")
+		if !ok {
+			return
+		}
+
+		refunds, err := h.bus.GetRefunds(c.Request.Context(), id)
+		if errors.Is(err, models.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+			return
+		}
+		if err != nil {
+			writeError(c, http.StatusInternalServerError, err, h.logr, "GetRefunds: business error")
+			return
+		}
+
+		h.logr.Info("Refunds retrieved", "order_id", id, "count", len(refunds))
+		c.JSON(http.StatusOK, gin.H{"refunds": refunds})
+	}
+}
@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ReportHandler struct {
+	bus  ReportBus
+	logr *slog.Logger
+}
+
+type ReportBus interface {
+	TotalSales(ctx context.Context, from, to time.Time, groupBy models.SalesGrouping) (models.SalesReport, error)
+	PopularItems(ctx context.Context, from, to time.Time, sortBy models.PopularItemsSort, limit int) (models.PopularItemsReport, error)
+	PromotionUsage(ctx context.Context, from, to time.Time) (models.PromotionReport, error)
+	Tips(ctx context.Context, from, to time.Time, pooling models.TipPooling) (models.TipReport, error)
+}
+
+func NewReportHandler(bus ReportBus, logr *slog.Logger) *ReportHandler {
+	return &ReportHandler{bus: bus, logr: logr}
+}
+
+func (h *ReportHandler) writeReportError(c *gin.Context, err error, msg string) {
+	if errors.Is(err, models.ErrInvalidReport) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	writeError(c, http.StatusInternalServerError, err, h.logr, msg)
+}
+
+func (h *ReportHandler) TotalSales() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		from, to, ok := parseTimeRange(c)
+		if !ok {
+			return
+		}
+
+		report, err := h.bus.TotalSales(c.Request.Context(), from, to, models.SalesGrouping(c.Query("group_by")))
+		if err != nil {
+			h.writeReportError(c, err, "TotalSales: business error")
+			return
+		}
+
+		h.logr.Info("Total sales report retrieved", "orders", report.OrderCount)
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+func (h *ReportHandler) PopularItems() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		from, to, ok := parseTimeRange(c)
+		if !ok {
+			return
+		}
+
+		var limit int
+		if value := c.Query("limit"); value != "" {
+			var err error
+			if limit, err = strconv.Atoi(value); err != nil || limit <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+				return
+			}
+		}
+
+		report, err := h.bus.PopularItems(c.Request.Context(), from, to, models.PopularItemsSort(c.Query("sort")), limit)
+		if err != nil {
+			h.writeReportError(c, err, "PopularItems: business error")
+			return
+		}
+
+		h.logr.Info("Popular items report retrieved", "count", len(report.Items))
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+func (h *ReportHandler) PromotionUsage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		from, to, ok := parseTimeRange(c)
+		if !ok {
+			return
+		}
+
+		report, err := h.bus.PromotionUsage(c.Request.Context(), from, to)
+		if err != nil {
+			h.writeReportError(c, err, "PromotionUsage: business error")
+			return
+		}
+
+		h.logr.Info("Promotion usage report retrieved", "count", len(report.Promotions))
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+func (h *ReportHandler) Tips() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		from, to, ok := parseTimeRange(c)
+		if !ok {
+			return
+		}
+
+		report, err := h.bus.Tips(c.Request.Context(), from, to, models.TipPooling(c.Query("pool")))
+		if err != nil {
+			h.writeReportError(c, err, "Tips: business error")
+			return
+		}
+
+		h.logr.Info("Tips report retrieved", "days", len(report.Days), "total", report.Total)
+		c.JSON(http.StatusOK, report)
+	}
+}
@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ShiftHandler struct {
+	bus  ShiftBus
+	logr *slog.Logger
+}
+
+type ShiftBus interface {
+	StartShift(ctx context.Context, req models.ShiftRequest) (models.Shift, error)
+	EndShift(ctx context.Context, id int64) (models.Shift, error)
+	GetShifts(ctx context.Context, from, to time.Time) ([]models.Shift, error)
+}
+
+func NewShiftHandler(bus ShiftBus, logr *slog.Logger) *ShiftHandler {
+	return &ShiftHandler{bus: bus, logr: logr}
+}
+
+func (h *ShiftHandler) writeShiftError(c *gin.Context, err error, msg string) {
+	switch {
+	case errors.Is(err, models.ErrInvalidShift):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "shift not found"})
+	case errors.Is(err, models.ErrShiftOpen), errors.Is(err, models.ErrShiftEnded):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		writeError(c, http.StatusInternalServerError, err, h.logr, msg)
+	}
+}
+
+// StartShift starts a shift for the staff member making the request.
+func (h *ShiftHandler) StartShift() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		staff, ok := CurrentStaff(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": models.ErrUnauthorized.Error()})
+			return
+		}
+
+		shift, err := h.bus.StartShift(c.Request.Context(), models.ShiftRequest{Staff: staff.Username})
+		if err != nil {
+			h.writeShiftError(c, err, "StartShift: business error")
+			return
+		}
+
+		h.logr.Info("Shift started", "shift_id", shift.ID, "staff", shift.Staff)
+		c.JSON(http.StatusCreated, gin.H{"shift": shift})
+	}
+}
+
+func (h *ShiftHandler) EndShift() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := parseID(c, "id")
+		if !ok {
+			return
+		}
+
+		shift, err := h.bus.EndShift(c.Request.Context(), id)
+		if err != nil {
+			h.writeShiftError(c, err, "EndShift: business error")
+			return
+		}
+
+		h.logr.Info("Shift ended", "shift_id", shift.ID, "staff", shift.Staff)
+		c.JSON(http.StatusOK, gin.H{"shift": shift})
+	}
+}
+
+func (h *ShiftHandler) GetShifts() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		from, to, ok := parseTimeRange(c)
+		if !ok {
+			return
+		}
+
+		shifts, err := h.bus.GetShifts(c.Request.Context(), from, to)
+		if err != nil {
+			h.writeShiftError(c, err, "GetShifts: business error")
+			return
+		}
+
+		h.logr.Info("Shifts retrieved", "count", len(shifts))
+		c.JSON(http.StatusOK, gin.H{"shifts": shifts})
+	}
+}
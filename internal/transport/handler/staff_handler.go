@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type StaffHandler struct {
+	bus  StaffBus
+	logr *slog.Logger
+}
+
+type StaffBus interface {
+	CreateStaff(ctx context.Context, req models.StaffRequest) (int64, error)
+	GetAllStaff(ctx context.Context) ([]models.Staff, error)
+	GetStaff(ctx context.Context, id int64) (models.Staff, error)
+	UpdateStaff(ctx context.Context, id int64, req models.StaffRequest) (models.Staff, error)
+	DeactivateStaff(ctx context.Context, id int64) error
+}
+
+func NewStaffHandler(bus StaffBus, logr *slog.Logger) *StaffHandler {
+	return &StaffHandler{bus: bus, logr: logr}
+}
+
+func (h *StaffHandler) writeStaffError(c *gin.Context, err error, msg string) {
+	switch {
+	case errors.Is(err, models.ErrInvalidStaff):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "staff member not found"})
+	case errors.Is(err, models.ErrDuplicateStaff):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		writeError(c, http.StatusInternalServerError, err, h.logr, msg)
+	}
+}
+
+func (h *StaffHandler) CreateStaff() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.StaffRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		id, err := h.bus.CreateStaff(c.Request.Context(), req)
+		if err != nil {
+			h.writeStaffError(c, err, "CreateStaff: business error")
+			return
+		}
+
+		h.logr.Info("Staff member created", "staff_id", id, "role", req.Role)
+		c.JSON(http.StatusCreated, gin.H{"id": id, "status": "created"})
+	}
+}
+
+func (h *StaffHandler) GetAllStaff() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		staff, err := h.bus.GetAllStaff(c.Request.Context())
+		if err != nil {
+			h.writeStaffError(c, err, "GetAllStaff: business error")
+			return
+		}
+
+		h.logr.Info("Staff retrieved", "count", len(staff))
+		c.JSON(http.StatusOK, gin.H{"staff": staff})
+	}
+}
+
+func (h *StaffHandler) GetStaff() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := parseID(c, "id")
+		if !ok {
+			return
+		}
+
+		staff, err := h.bus.GetStaff(c.Request.Context(), id)
+		if err != nil {
+			h.writeStaffError(c, err, "GetStaff: business error")
+			return
+		}
+
+		h.logr.Info("Staff member retrieved", "staff_id", id)
+		c.JSON(http.StatusOK, gin.H{"staff": staff})
+	}
+}
+
+func (h *StaffHandler) UpdateStaff() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := parseID(c, "id")
+		if !ok {
+			return
+		}
+
+		var req models.StaffRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		staff, err := h.bus.UpdateStaff(c.Request.Context(), id, req)
+		if err != nil {
+			h.writeStaffError(c, err, "UpdateStaff: business error")
+			return
+		}
+
+		h.logr.Info("Staff member updated", "staff_id", id, "role", staff.Role)
+		c.JSON(http.StatusOK, gin.H{"staff": staff})
+	}
+}
+
+func (h *StaffHandler) DeactivateStaff() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := parseID(c, "id")
+		if !ok {
+			return
+		}
+
+		if err := h.bus.DeactivateStaff(c.Request.Context(), id); err != nil {
+			h.writeStaffError(c, err, "DeactivateStaff: business error")
+			return
+		}
+
+		h.logr.Info("Staff member deactivated", "staff_id", id)
+		c.JSON(http.StatusOK, gin.H{"id": id, "status": "deactivated"})
+	}
+}
@@ -1 +1,131 @@
 package router
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/weeweeshka/hot-coffee/internal/models"
+	"github.com/weeweeshka/hot-coffee/internal/transport/handler"
+)
+
+type Handlers struct {
+	Health     *handler.HealthHandler
+	Auth       *handler.AuthHandler
+	Staff      *handler.StaffHandler
+	Audit      *handler.AuditHandler
+	Orders     *handler.OrderHandler
+	Menus      *handler.MenuHandler
+	Inventory  *handler.InventoryHandler
+	Reports    *handler.ReportHandler
+	Customers  *handler.CustomerHandler
+	Loyalty    *handler.LoyaltyHandler
+	Promotions *handler.PromotionHandler
+	Payments   *handler.PaymentHandler
+	Refunds    *handler.RefundHandler
+	Shifts     *handler.ShiftHandler
+}
+
+// New wires the routes. Everything but the health check and logging in needs
+// a bearer token, and each route needs the permission of the
+// models.Permissions matrix it is listed with.
+func New(h Handlers) *gin.Engine {
+	router := gin.Default()
+	router.Use(handler.RequestID())
+	can := h.Auth.Require
+
+	router.GET("/health", h.Health.Health())
+	router.POST("/auth/login", h.Auth.Login())
+
+	api := router.Group("", h.Auth.Authenticate())
+	api.GET("/auth/me", h.Auth.Me())
+	api.GET("/health/details", can(models.PermHealth), h.Health.Details())
+
+	groupOrder := api.Group("/orders", can(models.PermOrders))
+	{
+		groupOrder.POST("", h.Orders.CreateOrder())
+		groupOrder.GET("", h.Orders.GetOrders())
+		groupOrder.GET("/:id", h.Orders.GetOrder())
+		groupOrder.PUT("/:id", h.Orders.UpdateOrder())
+		groupOrder.DELETE("/:id", can(models.PermOrdersCancel), h.Orders.DeleteOrder())
+		groupOrder.POST("/:id/start", h.Orders.StartOrder())
+		groupOrder.POST("/:id/ready", h.Orders.ReadyOrder())
+		groupOrder.POST("/:id/close", can(models.PermPayments), h.Orders.CloseOrder())
+		groupOrder.POST("/:id/cancel", can(models.PermOrdersCancel), h.Orders.CancelOrder())
+		groupOrder.GET("/:id/payments", can(models.PermPayments), h.Payments.GetPayments())
+		groupOrder.POST("/:id/payments", can(models.PermPayments), h.Payments.Pay())
+		groupOrder.GET("/:id/refunds", h.Refunds.GetRefunds())
+		groupOrder.POST("/:id/refunds", can(models.PermRefunds), h.Refunds.Refund())
+	}
+
+	groupMenu := api.Group("/menu", can(models.PermMenuRead))
+	{
+		groupMenu.POST("", can(models.PermMenuWrite), h.Menus.CreateMenu())
+		groupMenu.GET("", h.Menus.GetMenus())
+		groupMenu.GET("/:id", h.Menus.GetMenu())
+		groupMenu.PUT("/:id", can(models.PermMenuWrite), h.Menus.UpdateMenu())
+		groupMenu.DELETE("/:id", can(models.PermMenuWrite), h.Menus.DeleteMenu())
+	}
+
+	groupInventory := api.Group("/inventory", can(models.PermInventoryRead))
+	{
+		groupInventory.POST("", can(models.PermInventoryWrite), h.Inventory.CreateInventory())
+		groupInventory.GET("", h.Inventory.GetInventories())
+		groupInventory.GET("/low-stock", h.Inventory.GetLowStock())
+		groupInventory.GET("/:id", h.Inventory.GetInventory())
+		groupInventory.GET("/:id/history", h.Inventory.GetInventoryHistory())
+		groupInventory.POST("/:id/movements", can(models.PermInventoryMove), h.Inventory.RecordMovement())
+		groupInventory.PUT("/:id", can(models.PermInventoryWrite), h.Inventory.UpdateInventory())
+		groupInventory.DELETE("/:id", can(models.PermInventoryWrite), h.Inventory.DeleteInventory())
+	}
+
+	groupReport := api.Group("/reports", can(models.PermReports))
+	{
+		groupReport.GET("/total-sales", h.Reports.TotalSales())
+		groupReport.GET("/popular-items", h.Reports.PopularItems())
+		groupReport.GET("/promotions", h.Reports.PromotionUsage())
+		groupReport.GET("/tips", h.Reports.Tips())
+	}
+
+	groupShift := api.Group("/shifts", can(models.PermShifts))
+	{
+		groupShift.POST("", h.Shifts.StartShift())
+		groupShift.GET("", h.Shifts.GetShifts())
+		groupShift.POST("/:id/end", h.Shifts.EndShift())
+	}
+
+	groupPromotion := api.Group("/promotions", can(models.PermPromotionsRead))
+	{
+		groupPromotion.POST("", can(models.PermPromotionsWrite), h.Promotions.CreatePromotion())
+		groupPromotion.GET("", h.Promotions.GetPromotions())
+		groupPromotion.GET("/:id", h.Promotions.GetPromotion())
+		groupPromotion.PUT("/:id", can(models.PermPromotionsWrite), h.Promotions.UpdatePromotion())
+		groupPromotion.DELETE("/:id", can(models.PermPromotionsWrite), h.Promotions.DeletePromotion())
+	}
+
+	groupCustomer := api.Group("/customers", can(models.PermCustomers))
+	{
+		groupCustomer.POST("", h.Customers.CreateCustomer())
+		groupCustomer.GET("", h.Customers.GetCustomers())
+		groupCustomer.GET("/:id", h.Customers.GetCustomer())
+		groupCustomer.PUT("/:id", h.Customers.UpdateCustomer())
+		groupCustomer.DELETE("/:id", can(models.PermCustomersDelete), h.Customers.DeleteCustomer())
+		groupCustomer.GET("/:id/orders", h.Customers.GetCustomerOrders())
+		groupCustomer.GET("/:id/favorites", h.Customers.GetFavorites())
+		groupCustomer.POST("/:id/favorites", h.Customers.SaveFavorite())
+		groupCustomer.DELETE("/:id/favorites/:favorite_id", h.Customers.DeleteFavorite())
+		groupCustomer.POST("/:id/favorites/:favorite_id/reorder", h.Customers.Reorder())
+		groupCustomer.GET("/:id/loyalty", h.Loyalty.GetLoyalty())
+		groupCustomer.POST("/:id/loyalty/redemptions/:redemption_id/undo", can(models.PermLoyaltyAdjust), h.Loyalty.UndoRedemption())
+	}
+
+	groupStaff := api.Group("/staff", can(models.PermStaffRead))
+	{
+		groupStaff.POST("", can(models.PermStaffWrite), h.Staff.CreateStaff())
+		groupStaff.GET("", h.Staff.GetAllStaff())
+		groupStaff.GET("/:id", h.Staff.GetStaff())
+		groupStaff.PUT("/:id", can(models.PermStaffWrite), h.Staff.UpdateStaff())
+		groupStaff.DELETE("/:id", can(models.PermStaffWrite), h.Staff.DeactivateStaff())
+	}
+
+	api.GET("/audit", can(models.PermAudit), h.Audit.GetAuditLog())
+
+	return router
+}
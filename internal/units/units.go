@@ -0,0 +1,123 @@
+// Package units converts ingredient quantities between units of mass, volume
+// and count.
+package units
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrUnknownUnit       = errors.New("unknown unit")
+	ErrIncompatibleUnits = errors.New("incompatible units")
+)
+
+type Dimension string
+
+const (
+	Mass   Dimension = "mass"
+	Volume Dimension = "volume"
+	Count  Dimension = "count"
+)
+
+// Unit is a unit of measure. Factor is the size of the unit in the base unit
+// of its dimension: grams, milliliters or pieces.
+type Unit struct {
+	Symbol    string
+	Dimension Dimension
+	Factor    float64
+}
+
+var known = []Unit{
+	{Symbol: "mg", Dimension: Mass, Factor: 0.001},
+	{Symbol: "g", Dimension: Mass, Factor: 1},
+	{Symbol: "kg", Dimension: Mass, Factor: 1000},
+	{Symbol: "oz", Dimension: Mass, Factor: 28.349523125},
+	{Symbol: "lb", Dimension: Mass, Factor: 453.59237},
+	{Symbol: "ml", Dimension: Volume, Factor: 1},
+	{Symbol: "cl", Dimension: Volume, Factor: 10},
+	{Symbol: "dl", Dimension: Volume, Factor: 100},
+	{Symbol: "l", Dimension: Volume, Factor: 1000},
+	{Symbol: "tsp", Dimension: Volume, Factor: 4.92892159375},
+	{Symbol: "tbsp", Dimension: Volume, Factor: 14.78676478125},
+	{Symbol: "fl_oz", Dimension: Volume, Factor: 29.5735295625},
+	{Symbol: "cup", Dimension: Volume, Factor: 236.5882365},
+	{Symbol: "pcs", Dimension: Count, Factor: 1},
+	{Symbol: "dozen", Dimension: Count, Factor: 12},
+}
+
+var aliases = map[string]string{
+	"gram":        "g",
+	"grams":       "g",
+	"kilogram":    "kg",
+	"kilograms":   "kg",
+	"milligram":   "mg",
+	"milligrams":  "mg",
+	"ounce":       "oz",
+	"ounces":      "oz",
+	"pound":       "lb",
+	"pounds":      "lb",
+	"lbs":         "lb",
+	"milliliter":  "ml",
+	"milliliters": "ml",
+	"millilitre":  "ml",
+	"millilitres": "ml",
+	"liter":       "l",
+	"liters":      "l",
+	"litre":       "l",
+	"litres":      "l",
+	"fl oz":       "fl_oz",
+	"cups":        "cup",
+	"pc":          "pcs",
+	"piece":       "pcs",
+	"pieces":      "pcs",
+	"ea":          "pcs",
+}
+
+var bySymbol = func() map[string]Unit {
+	m := make(map[string]Unit, len(known))
+	for _, u := range known {
+		m[u.Symbol] = u
+	}
+	return m
+}()
+
+// Parse looks a unit up by its symbol or one of its common spellings.
+func Parse(s string) (Unit, error) {
+	key := strings.ToLower(strings.TrimSpace(s))
+	if alias, ok := aliases[key]; ok {
+		key = alias
+	}
+	u, ok := bySymbol[key]
+	if !ok {
+		return Unit{}, fmt.Errorf("%w: %q", ErrUnknownUnit, s)
+	}
+	return u, nil
+}
+
+// Convert expresses quantity, given in from, in to. Mass and volume can only
+// be converted into each other with a density in grams per milliliter; pass
+// zero when the density is unknown.
+func Convert(quantity float64, from, to string, density float64) (float64, error) {
+	src, err := Parse(from)
+	if err != nil {
+		return 0, err
+	}
+	dst, err := Parse(to)
+	if err != nil {
+		return 0, err
+	}
+
+	base := quantity * src.Factor
+	switch {
+	case src.Dimension == dst.Dimension:
+	case src.Dimension == Volume && dst.Dimension == Mass && density > 0:
+		base *= density
+	case src.Dimension == Mass && dst.Dimension == Volume && density > 0:
+		base /= density
+	default:
+		return 0, fmt.Errorf("%w: %s to %s", ErrIncompatibleUnits, src.Symbol, dst.Symbol)
+	}
+	return base / dst.Factor, nil
+}
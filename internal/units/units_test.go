@@ -0,0 +1,82 @@
+package units_test
+
+import (
+	"errors"
+	"github.com/weeweeshka/hot-coffee/internal/units"
+	"math"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		in        string
+		symbol    string
+		dimension units.Dimension
+	}{
+		{"g", "g", units.Mass},
+		{" KG ", "kg", units.Mass},
+		{"Grams", "g", units.Mass},
+		{"lbs", "lb", units.Mass},
+		{"litre", "l", units.Volume},
+		{"fl oz", "fl_oz", units.Volume},
+		{"cups", "cup", units.Volume},
+		{"ea", "pcs", units.Count},
+		{"dozen", "dozen", units.Count},
+	} {
+		u, err := units.Parse(tc.in)
+		if err != nil || u.Symbol != tc.symbol || u.Dimension != tc.dimension {
+			t.Errorf("Parse(%q) = %s %s, %v; want %s %s", tc.in, u.Symbol, u.Dimension, err, tc.symbol, tc.dimension)
+		}
+	}
+
+	for _, in := range []string{"", "gallon", "fl  oz", "k g"} {
+		if _, err := units.Parse(in); !errors.Is(err, units.ErrUnknownUnit) {
+			t.Errorf("Parse(%q) err = %v, want ErrUnknownUnit", in, err)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	for _, tc := range []struct {
+		quantity float64
+		from, to string
+		density  float64
+		want     float64
+	}{
+		{1.5, "kg", "g", 0, 1500},
+		{250, "g", "kg", 0, 0.25},
+		{1, "lb", "oz", 0, 16},
+		{2, "l", "ml", 0, 2000},
+		{1, "cup", "ml", 0, 236.5882365},
+		{3, "tsp", "tbsp", 0, 1},
+		{2, "dozen", "pcs", 0, 24},
+		{5, "g", "g", 0, 5},
+		// Mass and volume convert through the density in g/ml.
+		{500, "ml", "g", 1.03, 515},
+		{515, "g", "ml", 1.03, 500},
+		{1, "l", "kg", 0.5, 0.5},
+		{0, "ml", "g", 1.03, 0},
+	} {
+		got, err := units.Convert(tc.quantity, tc.from, tc.to, tc.density)
+		if err != nil || math.Abs(got-tc.want) > 1e-9 {
+			t.Errorf("Convert(%g, %s, %s, %g) = %g, %v; want %g", tc.quantity, tc.from, tc.to, tc.density, got, err, tc.want)
+		}
+	}
+
+	for _, tc := range []struct {
+		from, to string
+		density  float64
+		want     error
+	}{
+		{"ml", "g", 0, units.ErrIncompatibleUnits},
+		{"g", "ml", -1, units.ErrIncompatibleUnits},
+		{"pcs", "g", 1, units.ErrIncompatibleUnits},
+		{"ml", "dozen", 1, units.ErrIncompatibleUnits},
+		{"gallon", "ml", 0, units.ErrUnknownUnit},
+		{"ml", "gallon", 0, units.ErrUnknownUnit},
+	} {
+		if _, err := units.Convert(1, tc.from, tc.to, tc.density); !errors.Is(err, tc.want) {
+			t.Errorf("Convert(1, %s, %s, %g) err = %v, want %v", tc.from, tc.to, tc.density, err, tc.want)
+		}
+	}
+}
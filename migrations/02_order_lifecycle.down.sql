@@ -0,0 +1,7 @@
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_status_check;
+
+ALTER TABLE orders
+    DROP COLUMN IF EXISTS started_at,
+    DROP COLUMN IF EXISTS ready_at,
+    DROP COLUMN IF EXISTS closed_at,
+    DROP COLUMN IF EXISTS cancelled_at;
@@ -0,0 +1,15 @@
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS started_at TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS ready_at TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS closed_at TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS cancelled_at TIMESTAMP;
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'orders_status_check') THEN
+        ALTER TABLE orders
+            ADD CONSTRAINT orders_status_check
+            CHECK (status IN ('open', 'in_progress', 'ready', 'closed', 'cancelled'));
+    END IF;
+END;
+$$;
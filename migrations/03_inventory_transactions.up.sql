@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS inventory_transactions (
+    id SERIAL PRIMARY KEY,
+    ingredient_id INT NOT NULL REFERENCES ingredients(id) ON DELETE RESTRICT,
+    -- not a foreign key, so the history outlives deleted orders
+    order_id INT,
+    delta NUMERIC NOT NULL,
+    reason TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS inventory_transactions_order_id_idx ON inventory_transactions(order_id);
@@ -0,0 +1,11 @@
+DROP TRIGGER IF EXISTS inventory_transactions_append_only ON inventory_transactions;
+
+DROP FUNCTION IF EXISTS inventory_transactions_append_only();
+
+DROP INDEX IF EXISTS inventory_transactions_ingredient_id_created_at_idx;
+
+ALTER TABLE inventory_transactions DROP CONSTRAINT IF EXISTS inventory_transactions_reason_check;
+
+ALTER TABLE inventory_transactions
+    DROP COLUMN IF EXISTS actor,
+    DROP COLUMN IF EXISTS note;
@@ -0,0 +1,35 @@
+ALTER TABLE inventory_transactions
+    ADD COLUMN IF NOT EXISTS actor TEXT,
+    ADD COLUMN IF NOT EXISTS note TEXT NOT NULL DEFAULT '';
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'inventory_transactions_reason_check') THEN
+        ALTER TABLE inventory_transactions
+            ADD CONSTRAINT inventory_transactions_reason_check
+            CHECK (reason IN ('restock', 'order_consumption', 'order_reversal', 'waste', 'adjustment', 'count_correction'));
+    END IF;
+END;
+$$;
+
+CREATE INDEX IF NOT EXISTS inventory_transactions_ingredient_id_created_at_idx
+    ON inventory_transactions(ingredient_id, created_at);
+
+-- Opening balances, so that every inventory quantity equals the sum of its ledger.
+INSERT INTO inventory_transactions(ingredient_id, delta, reason, note)
+SELECT inv.ingredient_id, inv.quantity - COALESCE(SUM(t.delta), 0), 'adjustment', 'opening balance'
+FROM inventory inv
+LEFT JOIN inventory_transactions t ON t.ingredient_id = inv.ingredient_id
+GROUP BY inv.ingredient_id, inv.quantity
+HAVING inv.quantity - COALESCE(SUM(t.delta), 0) <> 0;
+
+CREATE OR REPLACE FUNCTION inventory_transactions_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'inventory_transactions is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS inventory_transactions_append_only ON inventory_transactions;
+CREATE TRIGGER inventory_transactions_append_only
+    BEFORE UPDATE OR DELETE ON inventory_transactions
+    FOR EACH ROW EXECUTE FUNCTION inventory_transactions_append_only();
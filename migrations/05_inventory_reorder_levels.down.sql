@@ -0,0 +1,3 @@
+ALTER TABLE inventory
+    DROP COLUMN IF EXISTS reorder_level,
+    DROP COLUMN IF EXISTS target_level;
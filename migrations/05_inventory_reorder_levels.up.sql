@@ -0,0 +1,3 @@
+ALTER TABLE inventory
+    ADD COLUMN IF NOT EXISTS reorder_level NUMERIC NOT NULL DEFAULT 0 CHECK (reorder_level >= 0),
+    ADD COLUMN IF NOT EXISTS target_level NUMERIC NOT NULL DEFAULT 0 CHECK (target_level >= 0);
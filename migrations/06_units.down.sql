@@ -0,0 +1,3 @@
+ALTER TABLE menu_ingredients DROP COLUMN IF EXISTS unit;
+
+ALTER TABLE ingredients DROP COLUMN IF EXISTS density;
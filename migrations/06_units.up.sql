@@ -0,0 +1,6 @@
+ALTER TABLE ingredients
+    ADD COLUMN IF NOT EXISTS density NUMERIC CHECK (density > 0);
+
+-- NULL means the recipe is measured in the unit the ingredient is stocked in.
+ALTER TABLE menu_ingredients
+    ADD COLUMN IF NOT EXISTS unit TEXT;
@@ -0,0 +1,5 @@
+ALTER TABLE order_items DROP COLUMN IF EXISTS variant_id;
+
+DROP TABLE IF EXISTS menu_variant_ingredients;
+
+DROP TABLE IF EXISTS menu_variants;
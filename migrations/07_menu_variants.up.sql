@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS menu_variants (
+    id SERIAL PRIMARY KEY,
+    menu_id INT NOT NULL REFERENCES menus(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    price NUMERIC NOT NULL CHECK (price >= 0),
+    UNIQUE (menu_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS menu_variant_ingredients (
+    variant_id INT NOT NULL REFERENCES menu_variants(id) ON DELETE CASCADE,
+    ingredient_id INT NOT NULL REFERENCES ingredients(id) ON DELETE RESTRICT,
+    quantity NUMERIC NOT NULL CHECK (quantity > 0),
+    unit TEXT,
+    PRIMARY KEY (variant_id, ingredient_id)
+);
+
+ALTER TABLE order_items
+    ADD COLUMN IF NOT EXISTS variant_id INT REFERENCES menu_variants(id) ON DELETE RESTRICT;
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS order_item_modifiers;
+
+DROP TABLE IF EXISTS modifier_ingredients;
+
+DROP TABLE IF EXISTS modifiers;
+
+DROP TABLE IF EXISTS modifier_groups;
@@ -0,0 +1,32 @@
+CREATE TABLE IF NOT EXISTS modifier_groups (
+    id SERIAL PRIMARY KEY,
+    menu_id INT NOT NULL REFERENCES menus(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    min_select INT NOT NULL DEFAULT 0 CHECK (min_select >= 0),
+    -- 0 means no upper limit
+    max_select INT NOT NULL DEFAULT 0 CHECK (max_select >= 0),
+    UNIQUE (menu_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS modifiers (
+    id SERIAL PRIMARY KEY,
+    group_id INT NOT NULL REFERENCES modifier_groups(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    price_delta NUMERIC NOT NULL DEFAULT 0,
+    UNIQUE (group_id, name)
+);
+
+-- Quantities are deltas against the recipe and may be negative.
+CREATE TABLE IF NOT EXISTS modifier_ingredients (
+    modifier_id INT NOT NULL REFERENCES modifiers(id) ON DELETE CASCADE,
+    ingredient_id INT NOT NULL REFERENCES ingredients(id) ON DELETE RESTRICT,
+    quantity NUMERIC NOT NULL CHECK (quantity <> 0),
+    unit TEXT,
+    PRIMARY KEY (modifier_id, ingredient_id)
+);
+
+CREATE TABLE IF NOT EXISTS order_item_modifiers (
+    order_item_id INT NOT NULL REFERENCES order_items(id) ON DELETE CASCADE,
+    modifier_id INT NOT NULL REFERENCES modifiers(id) ON DELETE RESTRICT,
+    PRIMARY KEY (order_item_id, modifier_id)
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS loyalty_ledger;
+DROP TABLE IF EXISTS loyalty_redemptions;
@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS loyalty_redemptions (
+    id SERIAL PRIMARY KEY,
+    customer_id INT NOT NULL REFERENCES customers(id) ON DELETE CASCADE,
+    order_id INT NOT NULL,
+    reward TEXT NOT NULL CHECK (reward IN ('free_item', 'discount')),
+    product_id INT,
+    variant_id INT,
+    points INT NOT NULL CHECK (points > 0),
+    value NUMERIC(10, 2) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    undone_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS loyalty_redemptions_order_id_idx ON loyalty_redemptions(order_id);
+
+-- The ledger is the source of truth for balances. A redemption is undone by
+-- a reversal entry rather than by deleting its redeem entry.
+CREATE TABLE IF NOT EXISTS loyalty_ledger (
+    id SERIAL PRIMARY KEY,
+    customer_id INT NOT NULL REFERENCES customers(id) ON DELETE CASCADE,
+    points INT NOT NULL CHECK (points <> 0),
+    reason TEXT NOT NULL CHECK (reason IN ('earn', 'redeem', 'reversal')),
+    order_id INT,
+    redemption_id INT REFERENCES loyalty_redemptions(id),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS loyalty_ledger_customer_id_idx ON loyalty_ledger(customer_id, created_at);
+
+-- An order earns points once.
+CREATE UNIQUE INDEX IF NOT EXISTS loyalty_ledger_earn_once_idx ON loyalty_ledger(order_id) WHERE reason = 'earn';
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS promotion_usages;
+DROP TABLE IF EXISTS promotions;
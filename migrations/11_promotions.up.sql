@@ -0,0 +1,34 @@
+CREATE TABLE IF NOT EXISTS promotions (
+    id SERIAL PRIMARY KEY,
+    code TEXT NOT NULL UNIQUE,
+    name TEXT NOT NULL,
+    type TEXT NOT NULL CHECK (type IN ('percentage', 'fixed', 'buy_x_get_y')),
+    value NUMERIC(10, 2) NOT NULL DEFAULT 0,
+    product_id INT REFERENCES menus(id) ON DELETE CASCADE,
+    buy_quantity INT NOT NULL DEFAULT 0,
+    get_quantity INT NOT NULL DEFAULT 0,
+    -- Happy hour window as "15:04" clock times and weekdays (0 = Sunday).
+    window_start TEXT,
+    window_end TEXT,
+    window_days INT[],
+    starts_at TIMESTAMP,
+    ends_at TIMESTAMP,
+    max_uses INT NOT NULL DEFAULT 0,
+    max_uses_per_customer INT NOT NULL DEFAULT 0,
+    max_discount_total NUMERIC(10, 2) NOT NULL DEFAULT 0,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS promotion_usages (
+    id SERIAL PRIMARY KEY,
+    promotion_id INT NOT NULL REFERENCES promotions(id) ON DELETE CASCADE,
+    order_id INT NOT NULL,
+    customer_id INT REFERENCES customers(id) ON DELETE SET NULL,
+    amount NUMERIC(10, 2) NOT NULL CHECK (amount >= 0),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    voided_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS promotion_usages_promotion_id_idx ON promotion_usages(promotion_id) WHERE voided_at IS NULL;
+CREATE INDEX IF NOT EXISTS promotion_usages_order_id_idx ON promotion_usages(order_id);
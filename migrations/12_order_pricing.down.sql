@@ -0,0 +1,11 @@
+ALTER TABLE order_items
+    DROP COLUMN IF EXISTS tax_rate,
+    DROP COLUMN IF EXISTS unit_price,
+    DROP COLUMN IF EXISTS category,
+    DROP COLUMN IF EXISTS name;
+
+ALTER TABLE menus DROP COLUMN IF EXISTS category;
+
+ALTER TABLE modifiers ALTER COLUMN price_delta TYPE NUMERIC;
+ALTER TABLE menu_variants ALTER COLUMN price TYPE NUMERIC;
+ALTER TABLE menus ALTER COLUMN price TYPE NUMERIC;
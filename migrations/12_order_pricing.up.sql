@@ -0,0 +1,35 @@
+-- Money is kept to the cent everywhere.
+ALTER TABLE menus ALTER COLUMN price TYPE NUMERIC(10, 2) USING ROUND(price, 2);
+ALTER TABLE menu_variants ALTER COLUMN price TYPE NUMERIC(10, 2) USING ROUND(price, 2);
+ALTER TABLE modifiers ALTER COLUMN price_delta TYPE NUMERIC(10, 2) USING ROUND(price_delta, 2);
+
+ALTER TABLE menus
+    ADD COLUMN IF NOT EXISTS category TEXT NOT NULL DEFAULT '';
+
+-- Order lines keep what they were sold at, so menu edits do not rewrite
+-- history.
+ALTER TABLE order_items
+    ADD COLUMN IF NOT EXISTS name TEXT,
+    ADD COLUMN IF NOT EXISTS category TEXT,
+    ADD COLUMN IF NOT EXISTS unit_price NUMERIC(10, 2),
+    ADD COLUMN IF NOT EXISTS tax_rate NUMERIC(5, 2);
+
+-- Existing orders are priced at today's menu, the best record there is.
+UPDATE order_items oi
+SET name = m.name || COALESCE(' (' || (SELECT v.name FROM menu_variants v WHERE v.id = oi.variant_id) || ')', ''),
+    category = m.category,
+    unit_price = COALESCE((SELECT v.price FROM menu_variants v WHERE v.id = oi.variant_id), m.price) + (
+        SELECT COALESCE(SUM(md.price_delta), 0)
+        FROM order_item_modifiers oim
+        JOIN modifiers md ON md.id = oim.modifier_id
+        WHERE oim.order_item_id = oi.id
+    ),
+    tax_rate = 0
+FROM menus m
+WHERE m.id = oi.menu_id;
+
+ALTER TABLE order_items
+    ALTER COLUMN name SET NOT NULL,
+    ALTER COLUMN category SET NOT NULL,
+    ALTER COLUMN unit_price SET NOT NULL,
+    ALTER COLUMN tax_rate SET NOT NULL;
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS payments (
+    id SERIAL PRIMARY KEY,
+    order_id INT NOT NULL REFERENCES orders(id),
+    method TEXT NOT NULL CHECK (method IN ('cash', 'card')),
+    amount NUMERIC(10, 2) NOT NULL CHECK (amount > 0),
+    tendered NUMERIC(10, 2) NOT NULL DEFAULT 0,
+    change NUMERIC(10, 2) NOT NULL DEFAULT 0,
+    -- Gateway reference of a card charge.
+    reference TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS payments_order_id_idx ON payments(order_id);
@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS refunds (
+    id SERIAL PRIMARY KEY,
+    order_id INT NOT NULL REFERENCES orders(id),
+    reason TEXT NOT NULL,
+    restock BOOLEAN NOT NULL DEFAULT FALSE,
+    amount NUMERIC(10, 2) NOT NULL CHECK (amount >= 0),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS refunds_order_id_idx ON refunds(order_id);
+
+CREATE TABLE IF NOT EXISTS refund_lines (
+    refund_id INT NOT NULL REFERENCES refunds(id) ON DELETE CASCADE,
+    order_item_id INT NOT NULL REFERENCES order_items(id),
+    quantity INT NOT NULL CHECK (quantity > 0),
+    amount NUMERIC(10, 2) NOT NULL CHECK (amount >= 0),
+    PRIMARY KEY (refund_id, order_item_id)
+);
+
+CREATE INDEX IF NOT EXISTS refund_lines_order_item_id_idx ON refund_lines(order_item_id);
+
+CREATE TABLE IF NOT EXISTS payment_refunds (
+    refund_id INT NOT NULL REFERENCES refunds(id) ON DELETE CASCADE,
+    payment_id INT NOT NULL REFERENCES payments(id),
+    amount NUMERIC(10, 2) NOT NULL CHECK (amount > 0),
+    PRIMARY KEY (refund_id, payment_id)
+);
+
+CREATE INDEX IF NOT EXISTS payment_refunds_payment_id_idx ON payment_refunds(payment_id);
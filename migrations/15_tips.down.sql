@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS shifts;
+ALTER TABLE orders DROP COLUMN IF EXISTS tip;
+ALTER TABLE payments DROP COLUMN IF EXISTS tip;
@@ -0,0 +1,17 @@
+ALTER TABLE payments
+    ADD COLUMN IF NOT EXISTS tip NUMERIC(10, 2) NOT NULL DEFAULT 0 CHECK (tip >= 0);
+
+-- Tip left when the order was closed, apart from tips paid with payments.
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS tip NUMERIC(10, 2) NOT NULL DEFAULT 0 CHECK (tip >= 0);
+
+CREATE TABLE IF NOT EXISTS shifts (
+    id SERIAL PRIMARY KEY,
+    staff TEXT NOT NULL,
+    started_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    ended_at TIMESTAMP CHECK (ended_at >= started_at)
+);
+
+-- A staff member has at most one open shift.
+CREATE UNIQUE INDEX IF NOT EXISTS shifts_staff_open_idx ON shifts(staff) WHERE ended_at IS NULL;
+CREATE INDEX IF NOT EXISTS shifts_started_at_idx ON shifts(started_at);
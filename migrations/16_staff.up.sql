@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS staff (
+    id SERIAL PRIMARY KEY,
+    username TEXT NOT NULL UNIQUE,
+    name TEXT NOT NULL,
+    -- bcrypt hash; the password itself is never stored.
+    password_hash TEXT NOT NULL,
+    role TEXT NOT NULL CHECK (role IN ('barista', 'shift_lead', 'manager', 'admin')),
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
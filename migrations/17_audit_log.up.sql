@@ -0,0 +1,17 @@
+-- Append-only record of changes to orders, the menu and the inventory.
+CREATE TABLE IF NOT EXISTS audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    -- NULL for changes made by the system rather than a staff member.
+    staff_id INT REFERENCES staff(id),
+    actor TEXT NOT NULL,
+    action TEXT NOT NULL,
+    entity_type TEXT NOT NULL,
+    entity_id BIGINT NOT NULL,
+    diff JSONB NOT NULL,
+    request_id TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_entity_idx ON audit_log(entity_type, entity_id);
+CREATE INDEX IF NOT EXISTS audit_log_staff_id_idx ON audit_log(staff_id);
+CREATE INDEX IF NOT EXISTS audit_log_created_at_idx ON audit_log(created_at);
@@ -0,0 +1,9 @@
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'inventory_transactions_ingredient_id_fkey') THEN
+        ALTER TABLE inventory_transactions
+            ADD CONSTRAINT inventory_transactions_ingredient_id_fkey
+            FOREIGN KEY (ingredient_id) REFERENCES ingredients(id) ON DELETE RESTRICT NOT VALID;
+    END IF;
+END;
+$$;
@@ -0,0 +1,4 @@
+-- Not a foreign key any more, so the history outlives deleted ingredients,
+-- like it outlives deleted orders.
+ALTER TABLE inventory_transactions
+    DROP CONSTRAINT IF EXISTS inventory_transactions_ingredient_id_fkey;
@@ -0,0 +1 @@
+ALTER TABLE inventory DROP CONSTRAINT IF EXISTS inventory_ingredient_id_key;
@@ -0,0 +1,11 @@
+-- Every ingredient has one inventory row; the storage reads and locks stock
+-- by ingredient. Duplicates left by hand edits must be merged before this
+-- runs, or it fails.
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'inventory_ingredient_id_key') THEN
+        ALTER TABLE inventory
+            ADD CONSTRAINT inventory_ingredient_id_key UNIQUE (ingredient_id);
+    END IF;
+END;
+$$;
@@ -0,0 +1,3 @@
+ALTER TABLE orders
+    DROP COLUMN IF EXISTS cash_increment,
+    DROP COLUMN IF EXISTS rounding;
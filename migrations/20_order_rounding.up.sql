@@ -0,0 +1,6 @@
+-- Orders keep the rounding they were priced with, so later changes to the
+-- pricing rules do not rewrite their totals. Existing orders have none and
+-- go on being priced with the current rules.
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS rounding TEXT,
+    ADD COLUMN IF NOT EXISTS cash_increment NUMERIC(10, 2);